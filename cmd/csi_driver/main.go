@@ -18,8 +18,15 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/auth"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
@@ -27,21 +34,63 @@ import (
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
 	driver "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_driver"
 	csimounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_mounter"
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/component-base/tracing"
+	tracingv1 "k8s.io/component-base/tracing/api/v1"
 	"k8s.io/klog/v2"
 	"k8s.io/mount-utils"
 )
 
 var (
-	endpoint        			= flag.String("endpoint", "unix:/tmp/csi.sock", "CSI endpoint")
-	nodeID          			= flag.String("nodeid", "", "node id")
-	runController    			= flag.Bool("controller", false, "run controller service")
-	runNode         			= flag.Bool("node", false, "run node service")
-	kubeconfigPath   			= flag.String("kubeconfig-path", "", "The kubeconfig path.")
-	sidecarImage     			= flag.String("sidecar-image", "", "The gcsfuse sidecar container image.")
-	identityPool     			= flag.String("identity-pool", "", "The Identity Pool to authenticate with GCS API.")
-	identityProvider 			= flag.String("identity-provider", "", "The Identity Provider to authenticate with GCS API.")
-	storageEndpoint  			= flag.String("storage-endpoint", "", "If set, used as the endpoint for the GCS API.")
-	tokenServerEndpoint  	= flag.String("token-server-endpoint", "", "If set, used as the endpoint for the Token Server API.")
+	endpoint                    = flag.String("endpoint", "unix:/tmp/csi.sock", "CSI endpoint")
+	nodeID                      = flag.String("nodeid", "", "node id")
+	runController               = flag.Bool("controller", false, "run controller service")
+	runNode                     = flag.Bool("node", false, "run node service")
+	kubeconfigPath              = flag.String("kubeconfig-path", "", "The kubeconfig path.")
+	sidecarImage                = flag.String("sidecar-image", "", "The gcsfuse sidecar container image.")
+	identityPool                = flag.String("identity-pool", "", "The Identity Pool to authenticate with GCS API.")
+	identityProvider            = flag.String("identity-provider", "", "The Identity Provider to authenticate with GCS API.")
+	projectID                   = flag.String("project-id", "", "If set, used as the project ID instead of the value from the metadata source.")
+	metadataSource              = flag.String("metadata-source", metadata.SourceGKE, "The source of the project ID, Identity Pool, and Identity Provider. One of gke, static, downward-api.")
+	storageEndpoint             = flag.String("storage-endpoint", "", "If set, used as the endpoint for the GCS API.")
+	storageEmulator             = flag.Bool("storage-emulator", false, "If set, the storage-endpoint is a GCS emulator, e.g. fake-gcs-server, and the GCS API calls are not authenticated. Only for testing.")
+	tokenServerEndpoint         = flag.String("token-server-endpoint", "", "If set, used as the endpoint for the Token Server API.")
+	enableRegionalEndpoint      = flag.Bool("enable-regional-endpoint", false, "If set, gcsfuse uses the GCS regional endpoint for buckets in a single region with a regional endpoint, and the global endpoint for the other regions, and dual-region and multi-region buckets. The bucket location is cached for 10 minutes. Ignored when storage-endpoint is set.")
+	enableTokenDownscoping      = flag.Bool("enable-token-downscoping", false, "If set, the tokens of the node driver bucket checks and the tokens served to gcsfuse in the sidecar containers are downscoped with a Credential Access Boundary to the volume bucket, instead of the full devstorage scope.")
+	httpEndpoint                = flag.String("http-endpoint", "", "The TCP network address where the prometheus metrics endpoint will listen (example: `:8080`). The default is empty string, which means metrics endpoint is disabled.")
+	metricsPath                 = flag.String("metrics-path", "/metrics", "The HTTP path where prometheus metrics will be exposed. Default is `/metrics`.")
+	maxConcurrentTokenExchanges = flag.Int("max-concurrent-token-exchanges", 10, "The maximum number of concurrent GCP token exchanges, to protect the STS quota during mass Pod startup.")
+	bucketCacheTTL              = flag.Duration("bucket-cache-ttl", time.Minute, "The TTL of the cached bucket existence and attribute lookups in the node driver. Set to 0 to disable the cache.")
+	quotaProject                = flag.String("quota-project", "", "If set, used as the X-Goog-User-Project for the GCS API calls to attribute API quota and billing.")
+	mountErrorBackoffMax        = flag.Duration("mount-error-backoff-max", time.Minute, "The maximum backoff of the retries of repeatedly failing mounts. The node driver returns the previous error until the backoff expires. Set to 0 to disable the backoff.")
+	enableIdentityAuditEvents   = flag.Bool("enable-identity-audit-events", false, "If set, the node driver records an event on the workload Pod with the GCP identity chain used for each volume mount.")
+	enableMountConfigEvents     = flag.Bool("enable-mount-config-events", false, "If set, the node driver records an event on the workload Pod with the resolved gcsfuse mount options of each volume mount, with the sensitive values redacted.")
+	enableStateEndpoint         = flag.Bool("enable-state-endpoint", false, "If set, the node driver serves the current mounts, in-flight operations, and per-volume status as JSON at /debug/state on the http-endpoint.")
+	stateSocket                 = flag.String("state-socket", "/tmp/gcsfuse-csi-state.sock", "The unix domain socket where the node driver serves the node state and the mounted volumes for the dump-state and list-volumes modes. Set to empty to disable.")
+	enableDriverConfig          = flag.Bool("enable-driver-config", false, "If set, the node driver enforces the bucket and mount option allowlists, and applies the default mount options, of the GCSFuseCSIDriverConfig object named \"default\".")
+	kubeAPIQPS                  = flag.Float64("kube-api-qps", 5, "The QPS of the Kubernetes API client, shared by the Pod, node, service account, and token requests.")
+	kubeAPIBurst                = flag.Int("kube-api-burst", 10, "The burst of the Kubernetes API client.")
+	fdHandoffTimeout            = flag.Duration("fd-handoff-timeout", csimounter.DefaultHandshakeTimeouts.FDHandoff, "The deadline for the sidecar container to receive the FUSE file descriptor after the volume is mounted. After the deadline, NodePublishVolume fails with the MountHandshakeTimeout error.")
+	gcsfuseReadyTimeout         = flag.Duration("gcsfuse-ready-timeout", csimounter.DefaultHandshakeTimeouts.GCSFuseReady, "The deadline for gcsfuse to serve the file system after the sidecar container receives the FUSE file descriptor. After the deadline, NodePublishVolume fails with the MountHandshakeTimeout error.")
+	enableMachineTypeDefaults   = flag.Bool("enable-machine-type-defaults", false, "If set, the node driver applies the recommended gcsfuse mount options of the node machine family, e.g. more connections and a larger stat cache on the GPU and TPU machines, to the volumes that do not set them.")
+	enableReadyCondition        = flag.Bool("enable-volumes-ready-condition", false, "If set, the node driver sets the gke-gcsfuse/volumes-ready condition of the Pods once all their gcsfuse volumes are mounted, so that readiness gates can wait for the volumes. Requires the permission to patch the pods/status.")
+	sharedCacheDir              = flag.String("shared-cache-dir", "", "The node directory where the read-only volumes with the fileCacheShared volume attribute share the gcsfuse cache of each bucket, per Pod namespace and service account. Set to empty to disable.")
+	sharedCacheMaxSizeMB        = flag.Int("shared-cache-max-size-mb", 10240, "The maximum file-cache-max-size-mb mount option of the volumes using the shared cache directory. Unlimited and larger values are lowered to it. Set to 0 to keep the mount option of the volumes.")
+	orphanCleanupInterval       = flag.Duration("orphan-cleanup-interval", 10*time.Minute, "The interval of removing the sidecar volume directories, including the gcsfuse temp files, of the Pods that no longer exist on the node, e.g. after a node crash or a forced Pod deletion. Set to 0 to disable the cleanup.")
+	pvStatusInterval            = flag.Duration("pv-status-interval", 0, "The interval of annotating the PersistentVolumes of the driver with the location and storage class of their buckets, and the result of the last bucket access check, looked up with the controller credentials. Only used by the controller service. Set to 0 to disable.")
+	throttlingCheckInterval     = flag.Duration("sidecar-throttling-check-interval", time.Minute, "The interval of checking the CPU throttling reported by the sidecar containers on the node. A warning event suggesting to raise the sidecar container CPU limit is recorded on the Pods with heavy throttling. Set to 0 to disable.")
+	tracingEndpoint             = flag.String("tracing-endpoint", "", "The OTLP gRPC endpoint of the OpenTelemetry collector where the node driver exports the traces of the CSI calls (example: `localhost:4317`). The trace IDs are attached to the latency histograms as exemplars, exposed in the OpenMetrics format. The default is empty string, which means tracing is disabled.")
+	tracingSamplingRate         = flag.Int("tracing-sampling-rate-per-million", 0, "The number of the CSI calls in a million that are traced, when tracing-endpoint is set. The CSI calls traced by the kubelet are always traced.")
+	maxConcurrentUnmounts       = flag.Int("max-concurrent-unmounts", 20, "The maximum number of the volumes unmounted concurrently by the node driver. The other unmounts are queued and batched, so that draining a node with many gcsfuse volumes finishes within the eviction timeouts.")
+	kubeletRootDir              = flag.String("kubelet-root-dir", "", "The root directory of the kubelet, the --root-dir flag of the kubelet. The pods directory in it must be mounted at the same path in the node driver container. If empty, the root directory is detected from the known layouts, e.g. /var/lib/kubelet and microk8s.")
+	dumpState                   = flag.Bool("dump-state", false, "If set, print the state of every gcsfuse volume on the node as JSON, read from the running node driver via the state-socket, and exit.")
+	listVolumes                 = flag.Bool("list-volumes", false, "If set, print the gcsfuse volumes mounted on the node with their Pods and redacted mount options as JSON, read from the running node driver via the state-socket, and exit.")
 
 	// These are set at compile time.
 	version = "unknown"
@@ -51,29 +100,79 @@ func main() {
 	klog.InitFlags(nil)
 	flag.Parse()
 
-	clientset, err := clientset.New(*kubeconfigPath)
+	if *dumpState {
+		printNodeState()
+
+		return
+	}
+
+	if *listVolumes {
+		printMountedVolumes()
+
+		return
+	}
+
+	clientset, err := clientset.New(*kubeconfigPath, float32(*kubeAPIQPS), *kubeAPIBurst)
 	if err != nil {
 		klog.Fatal("Failed to configure k8s client")
 	}
 
-	meta, err := metadata.NewMetadataService(*identityPool, *identityProvider, clientset)
+	meta, err := metadata.New(&metadata.Config{
+		Source:           *metadataSource,
+		ProjectID:        *projectID,
+		IdentityPool:     *identityPool,
+		IdentityProvider: *identityProvider,
+	}, clientset)
 	if err != nil {
 		klog.Fatalf("Failed to set up metadata service: %v", err)
 	}
 
-	tm := auth.NewTokenManager(meta, clientset)
-	ssm, err := storage.NewGCSServiceManager()
+	userAgent := buildUserAgent(clientset)
+	klog.Infof("Using user agent %q for the GCS and IAM API calls", userAgent)
+
+	var mm *metrics.Manager
+	if *httpEndpoint != "" {
+		mm = metrics.NewMetricsManager()
+		mm.InitializeHTTPHandler(*httpEndpoint, *metricsPath)
+	}
+
+	tm := auth.NewTokenManager(meta, clientset, userAgent, *maxConcurrentTokenExchanges)
+	if *storageEmulator {
+		if *storageEndpoint == "" {
+			klog.Fatal("storage-endpoint must be set when storage-emulator is set")
+		}
+		// The emulator does not authenticate the requests, so skip the token exchange which requires a GCP project.
+		klog.Warningf("Using the GCS emulator at %q, the GCS API calls are not authenticated", *storageEndpoint)
+		tm = auth.NewNoAuthTokenManager(meta, clientset)
+	}
+	ssm, err := storage.NewGCSServiceManager(userAgent)
 	if err != nil {
 		klog.Fatalf("Failed to set up storage service manager: %v", err)
 	}
 
 	var mounter mount.Interface
+	var driverConfig *driverconfig.Watcher
 	if *runNode {
 		if *nodeID == "" {
 			klog.Fatalf("NodeID cannot be empty for node service")
 		}
 
-		mounter, err = csimounter.New("", *storageEndpoint)
+		if *kubeletRootDir == "" {
+			*kubeletRootDir = driver.DetectKubeletRootDir()
+			klog.Infof("Using the kubelet root directory %q", *kubeletRootDir)
+		}
+
+		clientset.ConfigurePodLister(*nodeID)
+		clientset.ConfigureNodeLister(*nodeID)
+
+		if *enableDriverConfig {
+			driverConfig = newDriverConfigWatcher()
+		}
+
+		mounter, err = csimounter.New("", *storageEndpoint, userAgent, csimounter.HandshakeTimeouts{
+			FDHandoff:    *fdHandoffTimeout,
+			GCSFuseReady: *gcsfuseReadyTimeout,
+		})
 		if err != nil {
 			klog.Fatalf("Failed to prepare CSI mounter: %v", err)
 		}
@@ -84,18 +183,39 @@ func main() {
 	}
 
 	config := &driver.GCSDriverConfig{
-		Name:                  driver.DefaultName,
-		Version:               version,
-		NodeID:                *nodeID,
-		RunController:         *runController,
-		RunNode:               *runNode,
-		StorageServiceManager: ssm,
-		TokenManager:          tm,
-		Mounter:               mounter,
-		K8sClients:            clientset,
-		SidecarImage:          *sidecarImage,
-		StorageEndpoint: 			 *storageEndpoint,
-		TsEndpoint: 					 *tokenServerEndpoint,
+		Name:                      driver.DefaultName,
+		Version:                   version,
+		NodeID:                    *nodeID,
+		RunController:             *runController,
+		RunNode:                   *runNode,
+		StorageServiceManager:     ssm,
+		TokenManager:              tm,
+		Mounter:                   mounter,
+		K8sClients:                clientset,
+		SidecarImage:              *sidecarImage,
+		StorageEndpoint:           *storageEndpoint,
+		TsEndpoint:                *tokenServerEndpoint,
+		QuotaProject:              *quotaProject,
+		EnableRegionalEndpoint:    *enableRegionalEndpoint,
+		EnableTokenDownscoping:    *enableTokenDownscoping,
+		BucketCacheTTL:            *bucketCacheTTL,
+		MetricsManager:            mm,
+		PodNamespace:              os.Getenv("POD_NAMESPACE"),
+		PodName:                   os.Getenv("POD_NAME"),
+		EnableIdentityAuditEvents: *enableIdentityAuditEvents,
+		EnableMountConfigEvents:   *enableMountConfigEvents,
+		MountErrorBackoffMax:      *mountErrorBackoffMax,
+		DriverConfig:              driverConfig,
+		EnableMachineTypeDefaults: *enableMachineTypeDefaults,
+		EnableReadyCondition:      *enableReadyCondition,
+		SharedCacheDir:            *sharedCacheDir,
+		SharedCacheMaxSizeMB:      *sharedCacheMaxSizeMB,
+		OrphanCleanupInterval:     *orphanCleanupInterval,
+		PVStatusInterval:          *pvStatusInterval,
+		ThrottlingCheckInterval:   *throttlingCheckInterval,
+		MaxConcurrentUnmounts:     *maxConcurrentUnmounts,
+		KubeletRootDir:            *kubeletRootDir,
+		TracerProvider:            newTracerProvider(),
 	}
 
 	gcfsDriver, err := driver.NewGCSDriver(config)
@@ -103,8 +223,155 @@ func main() {
 		klog.Fatalf("Failed to initialize Google Cloud Storage FUSE CSI Driver: %v", err)
 	}
 
+	if *runNode {
+		// Dump the node state to the logs on SIGUSR1 to aid troubleshooting wedged mounts.
+		go logStateOnSignal(gcfsDriver)
+
+		if mm != nil && *enableStateEndpoint {
+			mm.RegisterHandler("/debug/state", gcfsDriver.StateHandler())
+		}
+
+		if *stateSocket != "" {
+			if err := gcfsDriver.ServeStateSocket(*stateSocket); err != nil {
+				klog.Errorf("Failed to serve the node state: %v", err)
+			}
+		}
+	}
+
 	klog.Infof("Running Google Cloud Storage FUSE CSI driver version %v, sidecar container image %v at endpoint %v", version, *sidecarImage, endpoint)
+	if util.FIPSMode {
+		klog.Info("Running in FIPS mode, TLS is restricted to the FIPS approved settings of the BoringCrypto module")
+	}
 	gcfsDriver.Run(*endpoint)
 
 	os.Exit(0)
 }
+
+// newDriverConfigWatcher starts watching the GCSFuseCSIDriverConfig object.
+// If the object cannot be synced, the node driver starts without the cluster policies, and picks them up once synced.
+func newDriverConfigWatcher() *driverconfig.Watcher {
+	rc, err := clientset.NewRestConfig(*kubeconfigPath, float32(*kubeAPIQPS), *kubeAPIBurst)
+	if err != nil {
+		klog.Fatalf("Failed to read kubeconfig: %v", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(rc)
+	if err != nil {
+		klog.Fatalf("Failed to configure dynamic client: %v", err)
+	}
+
+	w := driverconfig.NewWatcher(dynamicClient, driverconfig.DefaultName)
+	if err := w.Start(context.Background()); err != nil {
+		klog.Errorf("The driver config is not synced: %v", err)
+	}
+
+	return w
+}
+
+// printNodeState prints the node state read from the running node driver.
+// If the node driver is not responding, e.g. the node is wedged, the state is collected from the node directly.
+func printNodeState() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	state, err := driver.FetchState(ctx, *stateSocket)
+	if err != nil {
+		klog.Warningf("Failed to read the state from the running node driver, collecting the mounts and sidecar container files without the in-flight operations and mount errors: %v", err)
+		if state, err = driver.DumpLocalState(*nodeID, version); err != nil {
+			klog.Fatalf("Failed to dump the node state: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, state, "", "  "); err != nil {
+		klog.Fatalf("Failed to format the node state: %v", err)
+	}
+	fmt.Println(out.String())
+}
+
+// printMountedVolumes prints the gcsfuse volumes mounted on the node, read from the running node driver.
+func printMountedVolumes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	volumes, err := driver.FetchVolumes(ctx, *stateSocket)
+	if err != nil {
+		klog.Fatalf("Failed to list the mounted volumes: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, volumes, "", "  "); err != nil {
+		klog.Fatalf("Failed to format the mounted volumes: %v", err)
+	}
+	fmt.Println(out.String())
+}
+
+func logStateOnSignal(d *driver.GCSDriver) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	for range c {
+		d.LogState()
+	}
+}
+
+func buildUserAgent(clientset clientset.Interface) string {
+	gkeVersion, err := clientset.GetServerVersion()
+	if err != nil {
+		klog.Warningf("Failed to get the Kubernetes server version, the user agent will not contain the GKE version: %v", err)
+	}
+
+	features := []string{}
+	if *runController {
+		features = append(features, "controller")
+	}
+	if *runNode {
+		features = append(features, "node")
+	}
+	if *storageEndpoint != "" {
+		features = append(features, "storage-endpoint")
+	}
+	if *storageEmulator {
+		features = append(features, "storage-emulator")
+	}
+	if *tokenServerEndpoint != "" {
+		features = append(features, "token-server-endpoint")
+	}
+	if *enableRegionalEndpoint {
+		features = append(features, "regional-endpoint")
+	}
+	if *enableTokenDownscoping {
+		features = append(features, "token-downscoping")
+	}
+	if *quotaProject != "" {
+		features = append(features, "quota-project")
+	}
+
+	ua := &util.UserAgentInfo{
+		DriverVersion:  version,
+		GKEVersion:     gkeVersion,
+		SidecarVersion: util.GetImageVersion(*sidecarImage),
+		Features:       features,
+	}
+
+	return ua.String()
+}
+
+// newTracerProvider returns the provider of the CSI call traces exported to the tracing endpoint,
+// or nil if tracing is disabled.
+func newTracerProvider() trace.TracerProvider {
+	if *tracingEndpoint == "" {
+		return nil
+	}
+
+	samplingRate := int32(*tracingSamplingRate)
+	tp, err := tracing.NewProvider(context.Background(), &tracingv1.TracingConfiguration{
+		Endpoint:               tracingEndpoint,
+		SamplingRatePerMillion: &samplingRate,
+	}, nil, []resource.Option{resource.WithAttributes(attribute.String("service.name", "gcs-fuse-csi-driver"))})
+	if err != nil {
+		klog.Fatalf("Failed to set up tracing: %v", err)
+	}
+	klog.Infof("Exporting the traces of the CSI calls to %q", *tracingEndpoint)
+
+	return tp
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/doctor"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+var (
+	kubeconfigPath  = flag.String("kubeconfig", "", "The kubeconfig path. If not set, the KUBECONFIG environment variable or ~/.kube/config is used.")
+	namespace       = flag.String("namespace", "", "The namespace of the Pod. If not set, the namespace of the current kubeconfig context is used.")
+	identityPool    = flag.String("identity-pool", "", "The Workload Identity pool of the cluster, e.g. <project-id>.svc.id.goog. If not set, it is derived from the project of the Pod node.")
+	storageEndpoint = flag.String("storage-endpoint", "", "If set, used as the endpoint for the GCS API.")
+	driverNamespace = flag.String("driver-namespace", "gcs-fuse-csi-driver", "The namespace of the CSI driver node Pods, where the mounted volumes of the Pod node are listed. Requires the permission to create pods/exec in the namespace.")
+	timeout         = flag.Duration("timeout", time.Minute, "The timeout of all the checks.")
+
+	// These are set at compile time.
+	version = "unknown"
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <pod-name>\n\nChecks the Cloud Storage FUSE CSI driver setup of a Pod, version %s.\n\nFlags:\n", os.Args[0], version)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfigPath
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+
+	ns := *namespace
+	if ns == "" {
+		var err error
+		if ns, _, err = clientConfig.Namespace(); err != nil {
+			klog.Fatalf("Failed to get the namespace of the current context: %v", err)
+		}
+	}
+
+	rc, err := clientConfig.ClientConfig()
+	if err != nil {
+		klog.Fatalf("Failed to read kubeconfig: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		klog.Fatalf("Failed to configure k8s client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	storageServiceManager, err := storage.NewGCSServiceManager("gcs-fuse-csi-driver-doctor/" + version)
+	if err != nil {
+		klog.Fatalf("Failed to set up storage service manager: %v", err)
+	}
+
+	iamService, err := doctor.NewIAMService(ctx)
+	if err != nil {
+		klog.Fatalf("Failed to set up IAM service: %v", err)
+	}
+
+	d := &doctor.Doctor{
+		Client:                client,
+		StorageServiceManager: storageServiceManager,
+		IAMService:            iamService,
+		StorageEndpoint:       *storageEndpoint,
+		IdentityPool:          *identityPool,
+		NodeVolumeLister: &doctor.ExecNodeVolumeLister{
+			Client:     client,
+			RestConfig: rc,
+			Namespace:  *driverNamespace,
+		},
+	}
+
+	report, err := d.Diagnose(ctx, ns, flag.Arg(0))
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := report.Print(os.Stdout); err != nil {
+		klog.Fatalf("Failed to print the report: %v", err)
+	}
+
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
@@ -18,10 +18,8 @@ limitations under the License.
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -39,6 +37,7 @@ var (
 	volumeBasePath = flag.String("volume-base-path", "/gcsfuse-tmp/.volumes", "volume base path")
 	gracePeriod    = flag.Int("grace-period", 30, "grace period for gcsfuse termination")
 	storageEndpoint  			= flag.String("storage-endpoint", "", "If set, used as the endpoint for the GCS API.")
+	cpuThrottlingInterval = flag.Duration("cpu-throttling-check-interval", time.Minute, "The interval of checking the CPU throttling of the sidecar container. The throttling is reported on the Pod by the node driver. Set to 0 to disable.")
 	// This is set at compile time.
 	version = "unknown"
 )
@@ -48,12 +47,19 @@ func main() {
 	flag.Parse()
 
 	klog.Infof("Running Google Cloud Storage FUSE CSI driver sidecar mounter version %v", version)
+	if util.FIPSMode {
+		klog.Info("Running in FIPS mode, TLS is restricted to the FIPS approved settings of the BoringCrypto module")
+	}
 	socketPathPattern := *volumeBasePath + "/*/socket"
 	socketPathes, err := filepath.Glob(socketPathPattern)
 	if err != nil {
 		klog.Fatalf("failed to look up socket paths: %v", err)
 	}
 
+	if m := sidecarmounter.NewCPUThrottlingMonitor(*volumeBasePath); m != nil && *cpuThrottlingInterval > 0 {
+		go m.Run(*cpuThrottlingInterval)
+	}
+
 	mounter := sidecarmounter.New(*gcsfusePath)
 	var wg sync.WaitGroup
 
@@ -63,7 +69,7 @@ func main() {
 		// 2. memory usage peak.
 		time.Sleep(1500 * time.Millisecond)
 		errWriter := sidecarmounter.NewErrorWriter(filepath.Join(filepath.Dir(sp), "error"))
-		mc, err := prepareMountConfig(sp)
+		mc, err := sidecarmounter.ReceiveMountConfig(sp, *storageEndpoint)
 		if err != nil {
 			errMsg := fmt.Sprintf("failed prepare mount config: socket path %q: %v\n", sp, err)
 			klog.Errorf(errMsg)
@@ -74,6 +80,12 @@ func main() {
 			continue
 		}
 		mc.ErrWriter = errWriter
+		// Remove the ready file left by a previous sidecar container run.
+		readyFile := filepath.Join(filepath.Dir(sp), sidecarmounter.ReadyFileName)
+		if err := os.Remove(readyFile); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("failed to remove the ready file %q: %v", readyFile, err)
+		}
+		mc.ReadyWriter = sidecarmounter.NewReadyWriter(readyFile)
 
 		wg.Add(1)
 		go func(mc *sidecarmounter.MountConfig) {
@@ -81,7 +93,7 @@ func main() {
 			cmd, err := mounter.Mount(mc)
 			if err != nil {
 				errMsg := fmt.Sprintf("failed to mount bucket %q for volume %q: %v\n", mc.BucketName, mc.VolumeName, err)
-				klog.Errorf(errMsg)
+				klog.ErrorS(err, "failed to mount bucket", mc.LogFields()...)
 				if _, e := errWriter.Write([]byte(errMsg)); e != nil {
 					klog.Errorf("failed to write the error message %q: %v", errMsg, e)
 				}
@@ -91,7 +103,7 @@ func main() {
 
 			if err = cmd.Start(); err != nil {
 				errMsg := fmt.Sprintf("failed to start gcsfuse with error: %v\n", err)
-				klog.Errorf(errMsg)
+				klog.ErrorS(err, "failed to start gcsfuse", mc.LogFields()...)
 				if _, e := errWriter.Write([]byte(errMsg)); e != nil {
 					klog.Errorf("failed to write the error message %q: %v", errMsg, e)
 				}
@@ -99,17 +111,20 @@ func main() {
 				return
 			}
 
+			// The PID identifies the volume in the opencensus_task label of the exported gcsfuse metrics.
+			klog.InfoS("gcsfuse started", append(mc.LogFields(), "pid", cmd.Process.Pid)...)
+
 			// Since the gcsfuse has taken over the file descriptor,
 			// closing the file descriptor to avoid other process forking it.
 			syscall.Close(mc.FileDescriptor)
 			if err = cmd.Wait(); err != nil {
 				errMsg := fmt.Sprintf("gcsfuse exited with error: %v\n", err)
-				klog.Errorf(errMsg)
+				klog.ErrorS(err, "gcsfuse exited with error", mc.LogFields()...)
 				if _, e := errWriter.Write([]byte(errMsg)); e != nil {
 					klog.Errorf("failed to write the error message %q: %v", errMsg, e)
 				}
 			} else {
-				klog.Infof("[%v] gcsfuse exited normally.", mc.VolumeName)
+				klog.InfoS("gcsfuse exited normally", mc.LogFields()...)
 			}
 		}(mc)
 	}
@@ -149,47 +164,3 @@ func main() {
 
 	klog.Info("exiting sidecar mounter...")
 }
-
-// Fetch the following information from a given socket path:
-// 1. Pod volume name
-// 2. The file descriptor
-// 3. GCS bucket name
-// 4. Mount options passing to gcsfuse (passed by the csi mounter).
-func prepareMountConfig(sp string) (*sidecarmounter.MountConfig, error) {
-	// socket path pattern: /tmp/.volumes/<volume-name>/socket
-	dir := filepath.Dir(sp)
-	volumeName := filepath.Base(dir)
-	mc := sidecarmounter.MountConfig{
-		VolumeName: volumeName,
-		TempDir:    filepath.Join(dir, "temp-dir"),
-		StorageEndpoint: *storageEndpoint,
-	}
-
-	klog.Infof("connecting to socket %q", sp)
-	c, err := net.Dial("unix", sp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to the socket %q: %w", sp, err)
-	}
-
-	fd, msg, err := util.RecvMsg(c)
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive mount options from the socket %q: %w", sp, err)
-	}
-	// as we got all the information from the socket, closing the connection and deleting the socket
-	c.Close()
-	if err = syscall.Unlink(sp); err != nil {
-		klog.Errorf("failed to close socket %q: %v", sp, err)
-	}
-
-	mc.FileDescriptor = fd
-
-	if err := json.Unmarshal(msg, &mc); err != nil {
-		return nil, fmt.Errorf("failed to unmarchal the mount config: %w", err)
-	}
-
-	if mc.BucketName == "" {
-		return nil, fmt.Errorf("failed to fetch bucket name from CSI driver")
-	}
-
-	return &mc, nil
-}
@@ -21,8 +21,14 @@ import (
 	"flag"
 	"net/http"
 
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	wh "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -41,7 +47,17 @@ var (
 	cpuLimit               = flag.String("sidecar-cpu-limit", "250m", "The default CPU limit for gcsfuse sidecar container.")
 	memoryLimit            = flag.String("sidecar-memory-limit", "256Mi", "The default memory limit for gcsfuse sidecar container.")
 	ephemeralStorageLimit  = flag.String("sidecar-ephemeral-storage-limit", "10Gi", "The default ephemeral storage limit for gcsfuse sidecar container.")
+	cpuLimitPercent        = flag.Int("sidecar-cpu-limit-percent", 0, "If set, the CPU limit for gcsfuse sidecar container is raised to the percentage, between 0 and 100, of the total CPU limit of the Pod containers. The sidecar-cpu-limit is the minimum.")
+	memoryLimitPercent     = flag.Int("sidecar-memory-limit-percent", 0, "If set, the memory limit for gcsfuse sidecar container is raised to the percentage, between 0 and 100, of the total memory limit of the Pod containers. The sidecar-memory-limit is the minimum.")
+	storageLimitPercent    = flag.Int("sidecar-ephemeral-storage-limit-percent", 0, "If set, the ephemeral storage limit for gcsfuse sidecar container is raised to the percentage, between 0 and 100, of the total ephemeral storage limit of the Pod containers. The sidecar-ephemeral-storage-limit is the minimum.")
 	sidecarImage           = flag.String("sidecar-image", "", "The gcsfuse sidecar container image.")
+	canarySidecarImage     = flag.String("canary-sidecar-image", "", "The gcsfuse sidecar container image injected into canary-sidecar-percentage percent of the new Pods, chosen by the hash of the Pod.")
+	canarySidecarPercent   = flag.Int("canary-sidecar-percentage", 0, "The percentage, between 0 and 100, of the new Pods that get the canary-sidecar-image.")
+	httpEndpoint           = flag.String("http-endpoint", "", "The TCP network address where the prometheus metrics endpoint will listen (example: `:8080`). The default is empty string, which means metrics endpoint is disabled.")
+	metricsPath            = flag.String("metrics-path", "/metrics", "The HTTP path where prometheus metrics will be exposed. Default is `/metrics`.")
+	kubeAPIQPS             = flag.Float64("kube-api-qps", 20, "The QPS of the Kubernetes API client.")
+	kubeAPIBurst           = flag.Int("kube-api-burst", 30, "The burst of the Kubernetes API client.")
+	enableDriverConfig     = flag.Bool("enable-driver-config", false, "If set, the sidecar container settings of the GCSFuseCSIDriverConfig object named \"default\" take precedence over the sidecar flags.")
 
 	// These are set at compile time.
 	version = "unknown"
@@ -52,16 +68,35 @@ func main() {
 	flag.Parse()
 
 	klog.Infof("Running Google Cloud Storage FUSE CSI driver admission webhook version %v, sidecar container image %v", version, *sidecarImage)
+	if util.FIPSMode {
+		klog.Info("Running in FIPS mode, TLS is restricted to the FIPS approved settings of the BoringCrypto module")
+	}
 
 	// Load webhook config
 	c, err := wh.LoadConfig(*sidecarImage, *imagePullPolicy, *cpuLimit, *memoryLimit, *ephemeralStorageLimit)
 	if err != nil {
 		klog.Fatalf("Unable to load webhook config: %v", err)
 	}
+	if err := c.SetCanary(*canarySidecarImage, *canarySidecarPercent); err != nil {
+		klog.Fatalf("Unable to load webhook config: %v", err)
+	}
+	if err := c.SetLimitPercents(*cpuLimitPercent, *memoryLimitPercent, *storageLimitPercent); err != nil {
+		klog.Fatalf("Unable to load webhook config: %v", err)
+	}
+	if c.CanaryPercentage > 0 {
+		klog.Infof("Injecting canary sidecar container image %v into %d%% of the new Pods", c.CanaryContainerImage, c.CanaryPercentage)
+	}
+
+	if *httpEndpoint != "" {
+		mm := metrics.NewWebhookMetricsManager()
+		mm.InitializeHTTPHandler(*httpEndpoint, *metricsPath)
+	}
 
 	// Setup a Manager
 	klog.Info("Setting up manager.")
-	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{
+	rc := config.GetConfigOrDie()
+	clientset.ConfigureRestConfig(rc, float32(*kubeAPIQPS), *kubeAPIBurst)
+	mgr, err := manager.New(rc, manager.Options{
 		MetricsBindAddress:     "0",
 		HealthProbeBindAddress: *healthProbeBindAddress,
 		ReadinessEndpointName:  "/readyz",
@@ -82,6 +117,20 @@ func main() {
 		klog.Errorf("Unable to set up readyz endpoint: %v", err)
 	}
 
+	ctx := signals.SetupSignalHandler()
+
+	var driverConfig *driverconfig.Watcher
+	if *enableDriverConfig {
+		dynamicClient, err := dynamic.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			klog.Fatalf("Unable to set up dynamic client: %v", err)
+		}
+		driverConfig = driverconfig.NewWatcher(dynamicClient, driverconfig.DefaultName)
+		if err := driverConfig.Start(ctx); err != nil {
+			klog.Errorf("The driver config is not synced, using the sidecar flags: %v", err)
+		}
+	}
+
 	// Setup Webhooks
 	klog.Info("Setting up webhook server.")
 	hookServer := mgr.GetWebhookServer()
@@ -89,14 +138,21 @@ func main() {
 	klog.Info("Registering webhooks to the webhook server.")
 	hookServer.Register("/inject", &webhook.Admission{
 		Handler: &wh.SidecarInjector{
-			Client:  mgr.GetClient(),
-			Config:  c,
+			Client:       mgr.GetClient(),
+			Config:       c,
+			Decoder:      admission.NewDecoder(runtime.NewScheme()),
+			DriverConfig: driverConfig,
+		},
+	})
+	hookServer.Register("/validate-volumes", &webhook.Admission{
+		Handler: &wh.VolumeValidator{
 			Decoder: admission.NewDecoder(runtime.NewScheme()),
+			Checker: volumespec.VolumeSpecValidator{},
 		},
 	})
 
 	klog.Info("Starting manager.")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		klog.Fatalf("Unable to run manager: %v", err)
 	}
 }
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	sts "google.golang.org/api/sts/v1"
+)
+
+// AccessBoundary is the bucket, the object prefix, and the access that a downscoped token is limited to.
+type AccessBoundary struct {
+	BucketName string
+	// ObjectPrefix limits the token to the objects under the prefix, e.g. the only-dir mount option of gcsfuse.
+	ObjectPrefix string
+	// ReadOnly limits the token to reading the objects.
+	ReadOnly bool
+}
+
+// readOnlyPermissions are the permissions of the read-only tokens,
+// enough for the bucket existence and location checks of the node driver, and the read-only gcsfuse mounts.
+var readOnlyPermissions = []string{
+	"inRole:roles/storage.objectViewer",
+	"inRole:roles/storage.legacyBucketReader",
+}
+
+// readWritePermissions are the permissions of the tokens of the gcsfuse mounts that write to the bucket.
+var readWritePermissions = []string{
+	"inRole:roles/storage.objectAdmin",
+	"inRole:roles/storage.legacyBucketReader",
+}
+
+// accessBoundary is the Credential Access Boundary of the STS token exchange options,
+// see https://cloud.google.com/iam/docs/downscoping-short-lived-credentials.
+type accessBoundary struct {
+	AccessBoundary struct {
+		AccessBoundaryRules []accessBoundaryRule `json:"accessBoundaryRules"`
+	} `json:"accessBoundary"`
+}
+
+type accessBoundaryRule struct {
+	AvailableResource     string                 `json:"availableResource"`
+	AvailablePermissions  []string               `json:"availablePermissions"`
+	AvailabilityCondition *availabilityCondition `json:"availabilityCondition,omitempty"`
+}
+
+type availabilityCondition struct {
+	Expression string `json:"expression"`
+}
+
+// accessBoundaryOptions returns the STS token exchange options that limit the token to the access boundary.
+func accessBoundaryOptions(boundary AccessBoundary) (string, error) {
+	rule := accessBoundaryRule{
+		AvailableResource:    "//storage.googleapis.com/projects/_/buckets/" + boundary.BucketName,
+		AvailablePermissions: readWritePermissions,
+	}
+	if boundary.ReadOnly {
+		rule.AvailablePermissions = readOnlyPermissions
+	}
+	if boundary.ObjectPrefix != "" {
+		// The objects are matched by name, and the object listings by the prefix of the list request,
+		// so that gcsfuse can list the directory but not the rest of the bucket.
+		prefix := strings.TrimSuffix(boundary.ObjectPrefix, "/") + "/"
+		rule.AvailabilityCondition = &availabilityCondition{
+			Expression: fmt.Sprintf("resource.name.startsWith(%q) || api.getAttribute('storage.googleapis.com/objectListPrefix', '').startsWith(%q)",
+				"projects/_/buckets/"+boundary.BucketName+"/objects/"+prefix, prefix),
+		}
+	}
+
+	var b accessBoundary
+	b.AccessBoundary.AccessBoundaryRules = []accessBoundaryRule{rule}
+
+	options, err := json.Marshal(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the access boundary: %w", err)
+	}
+
+	return string(options), nil
+}
+
+// DownscopedTokenSource exchanges the tokens of the source for tokens limited to the access boundary,
+// so that a leaked token cannot access the other buckets of the identity, or write to a read-only volume.
+type DownscopedTokenSource struct {
+	source    oauth2.TokenSource
+	boundary  AccessBoundary
+	endpoint  string
+	userAgent string
+}
+
+// Token returns a downscoped token of the source token.
+func (ts *DownscopedTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	sourceToken, err := ts.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("source token fetch error: %w", err)
+	}
+
+	options, err := accessBoundaryOptions(ts.boundary)
+	if err != nil {
+		return nil, err
+	}
+
+	stsOpts := []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: util.NewUserAgentTransport(nil, ts.userAgent)})}
+	if ts.endpoint != "" {
+		stsOpts = append(stsOpts, option.WithEndpoint(ts.endpoint))
+	}
+
+	stsService, err := sts.NewService(ctx, stsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("new STS service error: %w", err)
+	}
+
+	stsResponse, err := stsService.V1.Token(&sts.GoogleIdentityStsV1ExchangeTokenRequest{
+		GrantType:          "urn:ietf:params:oauth:grant-type:token-exchange",
+		RequestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		SubjectTokenType:   "urn:ietf:params:oauth:token-type:access_token",
+		SubjectToken:       sourceToken.AccessToken,
+		Options:            options,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("downscoped token exchange error for bucket %q: %w", ts.boundary.BucketName, err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken: stsResponse.AccessToken,
+		TokenType:   stsResponse.TokenType,
+		Expiry:      sourceToken.Expiry,
+	}
+	// The downscoped token expires with the source token if the response does not tell the lifetime.
+	if stsResponse.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Second * time.Duration(stsResponse.ExpiresIn))
+	}
+
+	return token, nil
+}
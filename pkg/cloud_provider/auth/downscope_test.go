@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+	sts "google.golang.org/api/sts/v1"
+)
+
+func TestAccessBoundaryOptions(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		boundary      AccessBoundary
+		expectedRules []accessBoundaryRule
+	}{
+		{
+			name:     "read-only bucket",
+			boundary: AccessBoundary{BucketName: "test-bucket", ReadOnly: true},
+			expectedRules: []accessBoundaryRule{
+				{
+					AvailableResource:    "//storage.googleapis.com/projects/_/buckets/test-bucket",
+					AvailablePermissions: []string{"inRole:roles/storage.objectViewer", "inRole:roles/storage.legacyBucketReader"},
+				},
+			},
+		},
+		{
+			name:     "writable bucket",
+			boundary: AccessBoundary{BucketName: "test-bucket"},
+			expectedRules: []accessBoundaryRule{
+				{
+					AvailableResource:    "//storage.googleapis.com/projects/_/buckets/test-bucket",
+					AvailablePermissions: []string{"inRole:roles/storage.objectAdmin", "inRole:roles/storage.legacyBucketReader"},
+				},
+			},
+		},
+		{
+			name:     "read-only object prefix",
+			boundary: AccessBoundary{BucketName: "test-bucket", ObjectPrefix: "data/train", ReadOnly: true},
+			expectedRules: []accessBoundaryRule{
+				{
+					AvailableResource:    "//storage.googleapis.com/projects/_/buckets/test-bucket",
+					AvailablePermissions: []string{"inRole:roles/storage.objectViewer", "inRole:roles/storage.legacyBucketReader"},
+					AvailabilityCondition: &availabilityCondition{
+						Expression: `resource.name.startsWith("projects/_/buckets/test-bucket/objects/data/train/") || api.getAttribute('storage.googleapis.com/objectListPrefix', '').startsWith("data/train/")`,
+					},
+				},
+			},
+		},
+		{
+			name:     "object prefix with a trailing slash",
+			boundary: AccessBoundary{BucketName: "test-bucket", ObjectPrefix: "data/"},
+			expectedRules: []accessBoundaryRule{
+				{
+					AvailableResource:    "//storage.googleapis.com/projects/_/buckets/test-bucket",
+					AvailablePermissions: []string{"inRole:roles/storage.objectAdmin", "inRole:roles/storage.legacyBucketReader"},
+					AvailabilityCondition: &availabilityCondition{
+						Expression: `resource.name.startsWith("projects/_/buckets/test-bucket/objects/data/") || api.getAttribute('storage.googleapis.com/objectListPrefix', '').startsWith("data/")`,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		options, err := accessBoundaryOptions(tc.boundary)
+		if err != nil {
+			t.Fatalf("test %q failed: failed to build the access boundary options: %v", tc.name, err)
+		}
+
+		var b accessBoundary
+		if err := json.Unmarshal([]byte(options), &b); err != nil {
+			t.Fatalf("test %q failed: failed to unmarshal the access boundary options %q: %v", tc.name, options, err)
+		}
+		if !reflect.DeepEqual(b.AccessBoundary.AccessBoundaryRules, tc.expectedRules) {
+			t.Errorf("test %q failed: got access boundary rules %+v, expected %+v", tc.name, b.AccessBoundary.AccessBoundaryRules, tc.expectedRules)
+		}
+	}
+}
+
+func TestDownscopedTokenSource(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req sts.GoogleIdentityStsV1ExchangeTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode the STS request: %v", err)
+		}
+		if req.SubjectToken != "source-token" || req.SubjectTokenType != "urn:ietf:params:oauth:token-type:access_token" {
+			t.Errorf("got subject token %q of type %q", req.SubjectToken, req.SubjectTokenType)
+		}
+		if expected, _ := accessBoundaryOptions(AccessBoundary{BucketName: "test-bucket", ReadOnly: true}); req.Options != expected {
+			t.Errorf("got options %q, expected %q", req.Options, expected)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&sts.GoogleIdentityStsV1ExchangeTokenResponse{
+			AccessToken: "downscoped-token",
+			TokenType:   "Bearer",
+			ExpiresIn:   3600,
+		})
+	}))
+	defer server.Close()
+
+	ts := &DownscopedTokenSource{
+		source:   oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "source-token"}),
+		boundary: AccessBoundary{BucketName: "test-bucket", ReadOnly: true},
+		endpoint: server.URL,
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("failed to get the downscoped token: %v", err)
+	}
+	if token.AccessToken != "downscoped-token" || token.Expiry.IsZero() {
+		t.Errorf("got token %+v, expected the downscoped token with an expiry", token)
+	}
+}
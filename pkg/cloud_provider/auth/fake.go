@@ -18,6 +18,8 @@ limitations under the License.
 package auth
 
 import (
+	"context"
+
 	"golang.org/x/oauth2"
 )
 
@@ -31,6 +33,14 @@ func (tm *fakeTokenManager) GetTokenSourceFromK8sServiceAccount(saNamespace, saN
 	return &FakeGCPTokenSource{k8sSAName: saName, k8sSANamespace: saNamespace}
 }
 
+func (tm *fakeTokenManager) GetDownscopedTokenSource(ts oauth2.TokenSource, _ AccessBoundary, _ string) oauth2.TokenSource {
+	return ts
+}
+
+func (tm *fakeTokenManager) ResolveIdentity(_ context.Context, saNamespace, saName string) (*Identity, error) {
+	return newIdentity("test-project.svc.id.goog", saNamespace, saName, ""), nil
+}
+
 type FakeGCPTokenSource struct {
 	k8sSAName      string
 	k8sSANamespace string
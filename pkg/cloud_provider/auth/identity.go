@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Identity describes the chain of principals used to access GCS on behalf of a Kubernetes service account.
+type Identity struct {
+	// KubernetesServiceAccount is the Kubernetes service account in the format of <namespace>/<name>.
+	KubernetesServiceAccount string
+	// FederatedPrincipal is the Workload Identity principal the Kubernetes service account token is exchanged for.
+	FederatedPrincipal string
+	// ImpersonatedServiceAccount is the IAM service account impersonated by the federated principal.
+	// It is empty if the Kubernetes service account is not bound with an IAM service account.
+	ImpersonatedServiceAccount string
+}
+
+func newIdentity(identityPool, saNamespace, saName, gcpSAName string) *Identity {
+	return &Identity{
+		KubernetesServiceAccount:   saNamespace + "/" + saName,
+		FederatedPrincipal:         fmt.Sprintf("serviceAccount:%s[%s/%s]", identityPool, saNamespace, saName),
+		ImpersonatedServiceAccount: gcpSAName,
+	}
+}
+
+// Principal returns the GCP principal that accesses GCS.
+func (i *Identity) Principal() string {
+	if i.ImpersonatedServiceAccount != "" {
+		return "serviceAccount:" + i.ImpersonatedServiceAccount
+	}
+
+	return i.FederatedPrincipal
+}
+
+// Chain returns the impersonation chain from the Kubernetes service account to the GCP principal.
+func (i *Identity) Chain() string {
+	chain := []string{i.KubernetesServiceAccount, i.FederatedPrincipal}
+	if i.ImpersonatedServiceAccount != "" {
+		chain = append(chain, "serviceAccount:"+i.ImpersonatedServiceAccount)
+	}
+
+	return strings.Join(chain, " -> ")
+}
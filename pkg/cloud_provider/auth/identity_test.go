@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name              string
+		identity          *Identity
+		expectedPrincipal string
+		expectedChain     string
+	}{
+		{
+			name:              "should return the federated principal when no IAM service account is bound",
+			identity:          newIdentity("test-project.svc.id.goog", "test-ns", "test-ksa", ""),
+			expectedPrincipal: "serviceAccount:test-project.svc.id.goog[test-ns/test-ksa]",
+			expectedChain:     "test-ns/test-ksa -> serviceAccount:test-project.svc.id.goog[test-ns/test-ksa]",
+		},
+		{
+			name:              "should return the impersonated IAM service account",
+			identity:          newIdentity("test-project.svc.id.goog", "test-ns", "test-ksa", "test-gsa@test-project.iam.gserviceaccount.com"),
+			expectedPrincipal: "serviceAccount:test-gsa@test-project.iam.gserviceaccount.com",
+			expectedChain:     "test-ns/test-ksa -> serviceAccount:test-project.svc.id.goog[test-ns/test-ksa] -> serviceAccount:test-gsa@test-project.iam.gserviceaccount.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		if p := tc.identity.Principal(); p != tc.expectedPrincipal {
+			t.Errorf("Got principal %q, but expected %q", p, tc.expectedPrincipal)
+		}
+		if c := tc.identity.Chain(); c != tc.expectedChain {
+			t.Errorf("Got chain %q, but expected %q", c, tc.expectedChain)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/metadata"
+	"golang.org/x/oauth2"
+)
+
+// noAuthTokenManager returns empty tokens, for storage endpoints that do not authenticate the requests, e.g. a GCS emulator.
+// The identities are still resolved from the Kubernetes service accounts.
+type noAuthTokenManager struct {
+	*tokenManager
+}
+
+// NewNoAuthTokenManager returns a TokenManager that skips the token exchange, which requires a GCP project.
+func NewNoAuthTokenManager(meta metadata.Service, clientset clientset.Interface) TokenManager {
+	return &noAuthTokenManager{
+		tokenManager: &tokenManager{
+			meta:       meta,
+			k8sClients: clientset,
+		},
+	}
+}
+
+func (tm *noAuthTokenManager) GetTokenSourceFromK8sServiceAccount(_, _, _, _ string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{})
+}
+
+func (tm *noAuthTokenManager) GetDownscopedTokenSource(ts oauth2.TokenSource, _ AccessBoundary, _ string) oauth2.TokenSource {
+	return ts
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog/v2"
+)
+
+// tokenExpiryBuffer is the minimum remaining lifetime for a cached token to be reused.
+const tokenExpiryBuffer = 5 * time.Minute
+
+// tokenBroker caches the GCP tokens exchanged for Kubernetes service accounts,
+// dedupes concurrent token exchanges for the same Kubernetes service account,
+// and limits the number of concurrent token exchanges to protect the STS quota.
+type tokenBroker struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+	group  singleflight.Group
+	sem    chan struct{}
+}
+
+func newTokenBroker(maxConcurrentExchanges int) *tokenBroker {
+	if maxConcurrentExchanges <= 0 {
+		maxConcurrentExchanges = 1
+	}
+
+	return &tokenBroker{
+		tokens: map[string]*oauth2.Token{},
+		sem:    make(chan struct{}, maxConcurrentExchanges),
+	}
+}
+
+// getToken returns the cached token for the key if it is still valid,
+// otherwise calls exchange to get a new token and caches it.
+func (b *tokenBroker) getToken(key string, exchange func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	if token := b.getCachedToken(key); token != nil {
+		metrics.TokenCacheHitTotal.Inc()
+
+		return token, nil
+	}
+	metrics.TokenCacheMissTotal.Inc()
+
+	v, err, shared := b.group.Do(key, func() (interface{}, error) {
+		b.sem <- struct{}{}
+		defer func() { <-b.sem }()
+
+		token, err := exchange()
+		if err != nil {
+			metrics.TokenExchangeErrorTotal.Inc()
+
+			return nil, err
+		}
+		b.setCachedToken(key, token)
+
+		return token, nil
+	})
+	if shared {
+		metrics.TokenExchangeDedupedTotal.Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := v.(*oauth2.Token)
+	if !ok {
+		return nil, fmt.Errorf("failed to cast the token exchange result %v to oauth2.Token", v)
+	}
+
+	return token, nil
+}
+
+func (b *tokenBroker) getCachedToken(key string) *oauth2.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	token, ok := b.tokens[key]
+	if !ok || !isTokenFresh(token) {
+		return nil
+	}
+
+	return token
+}
+
+func (b *tokenBroker) setCachedToken(key string, token *oauth2.Token) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Prune the expired tokens so that the cache does not grow with deleted service accounts.
+	for k, t := range b.tokens {
+		if !isTokenFresh(t) {
+			delete(b.tokens, k)
+		}
+	}
+
+	if isTokenFresh(token) {
+		b.tokens[key] = token
+	} else {
+		klog.V(4).Infof("not caching the token for %q because it expires at %v", key, token.Expiry)
+	}
+}
+
+// isTokenFresh returns true if the token has an expiry and does not expire within the buffer.
+func isTokenFresh(token *oauth2.Token) bool {
+	return token != nil && !token.Expiry.IsZero() && time.Until(token.Expiry) > tokenExpiryBuffer
+}
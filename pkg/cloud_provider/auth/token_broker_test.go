@@ -0,0 +1,122 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenBrokerGetToken(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name                  string
+		token                 *oauth2.Token
+		exchangeErr           error
+		calls                 int
+		expectedExchangeCalls int32
+		expectErr             bool
+	}{
+		{
+			name:                  "fresh token is cached",
+			token:                 &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)},
+			calls:                 3,
+			expectedExchangeCalls: 1,
+		},
+		{
+			name:                  "token expiring soon is not cached",
+			token:                 &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Minute)},
+			calls:                 3,
+			expectedExchangeCalls: 3,
+		},
+		{
+			name:                  "token without expiry is not cached",
+			token:                 &oauth2.Token{AccessToken: "token"},
+			calls:                 2,
+			expectedExchangeCalls: 2,
+		},
+		{
+			name:                  "exchange error is not cached",
+			exchangeErr:           errors.New("exchange error"),
+			calls:                 2,
+			expectedExchangeCalls: 2,
+			expectErr:             true,
+		},
+	}
+
+	for _, test := range cases {
+		b := newTokenBroker(1)
+		var exchangeCalls int32
+		exchange := func() (*oauth2.Token, error) {
+			atomic.AddInt32(&exchangeCalls, 1)
+
+			return test.token, test.exchangeErr
+		}
+
+		for i := 0; i < test.calls; i++ {
+			token, err := b.getToken("ns/sa/", exchange)
+			if test.expectErr && err == nil {
+				t.Errorf("test %q failed: expected error, got nil", test.name)
+			}
+			if !test.expectErr && (err != nil || token.AccessToken != test.token.AccessToken) {
+				t.Errorf("test %q failed: got token %v, error %v", test.name, token, err)
+			}
+		}
+
+		if exchangeCalls != test.expectedExchangeCalls {
+			t.Errorf("test %q failed: got %v token exchanges, expected %v", test.name, exchangeCalls, test.expectedExchangeCalls)
+		}
+	}
+}
+
+func TestTokenBrokerDedupesConcurrentExchanges(t *testing.T) {
+	t.Parallel()
+	b := newTokenBroker(10)
+	var exchangeCalls int32
+	release := make(chan struct{})
+	exchange := func() (*oauth2.Token, error) {
+		atomic.AddInt32(&exchangeCalls, 1)
+		<-release
+
+		return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.getToken("ns/sa/", exchange); err != nil {
+				t.Errorf("got error %v, expected nil", err)
+			}
+		}()
+	}
+	// Give the goroutines time to join the in-flight exchange.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if exchangeCalls != 1 {
+		t.Errorf("got %v token exchanges, expected 1", exchangeCalls)
+	}
+}
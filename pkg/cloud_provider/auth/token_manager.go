@@ -18,6 +18,9 @@ limitations under the License.
 package auth
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/metadata"
 	"golang.org/x/oauth2"
@@ -31,17 +34,26 @@ const (
 
 type TokenManager interface {
 	GetTokenSourceFromK8sServiceAccount(saNamespace, saName, saToken, tsEndpoint string) oauth2.TokenSource
+	GetDownscopedTokenSource(ts oauth2.TokenSource, boundary AccessBoundary, tsEndpoint string) oauth2.TokenSource
+	ResolveIdentity(ctx context.Context, saNamespace, saName string) (*Identity, error)
 }
 
 type tokenManager struct {
 	meta       metadata.Service
 	k8sClients clientset.Interface
+	userAgent  string
+	broker     *tokenBroker
 }
 
-func NewTokenManager(meta metadata.Service, clientset clientset.Interface) TokenManager {
+// NewTokenManager returns a TokenManager that sets the userAgent on all the STS and IAM API calls.
+// The GCP tokens are cached per Kubernetes service account,
+// and at most maxConcurrentExchanges token exchanges run concurrently.
+func NewTokenManager(meta metadata.Service, clientset clientset.Interface, userAgent string, maxConcurrentExchanges int) TokenManager {
 	tm := tokenManager{
 		meta:       meta,
 		k8sClients: clientset,
+		userAgent:  userAgent,
+		broker:     newTokenBroker(maxConcurrentExchanges),
 	}
 
 	return &tm
@@ -55,5 +67,29 @@ func (tm *tokenManager) GetTokenSourceFromK8sServiceAccount(saNamespace, saName,
 		k8sSAToken:     saToken,
 		k8sClients:     tm.k8sClients,
 		endpoint:       tsEndpoint,
+		userAgent:      tm.userAgent,
+		broker:         tm.broker,
 	}
 }
+
+// GetDownscopedTokenSource returns a token source of the tokens of ts limited to the access boundary.
+// The downscoped token is reused until it expires.
+func (tm *tokenManager) GetDownscopedTokenSource(ts oauth2.TokenSource, boundary AccessBoundary, tsEndpoint string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &DownscopedTokenSource{
+		source:    ts,
+		boundary:  boundary,
+		endpoint:  tsEndpoint,
+		userAgent: tm.userAgent,
+	})
+}
+
+// ResolveIdentity returns the GCP principals that the Kubernetes service account is exchanged for,
+// without exchanging any token.
+func (tm *tokenManager) ResolveIdentity(ctx context.Context, saNamespace, saName string) (*Identity, error) {
+	gcpSAName, err := tm.k8sClients.GetGCPServiceAccountName(ctx, saNamespace, saName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCP SA from Kubernetes SA [%s/%s] annotation: %w", saNamespace, saName, err)
+	}
+
+	return newIdentity(tm.meta.GetIdentityPool(), saNamespace, saName, gcpSAName), nil
+}
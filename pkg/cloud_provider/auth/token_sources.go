@@ -28,6 +28,7 @@ import (
 	"cloud.google.com/go/iam/credentials/apiv1/credentialspb"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/metadata"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	sts "google.golang.org/api/sts/v1"
@@ -42,11 +43,23 @@ type GCPTokenSource struct {
 	k8sSANamespace string
 	k8sSAToken     string
 	k8sClients     clientset.Interface
-	endpoint 			 string
+	endpoint       string
+	userAgent      string
+	broker         *tokenBroker
 }
 
-// Token exchanges a GCP IAM SA Token with a Kubernetes Service Account token.
+// Token returns a GCP IAM SA Token for the Kubernetes Service Account,
+// using the token broker cache if available.
 func (ts *GCPTokenSource) Token() (*oauth2.Token, error) {
+	if ts.broker == nil {
+		return ts.exchangeToken()
+	}
+
+	return ts.broker.getToken(fmt.Sprintf("%s/%s/%s", ts.k8sSANamespace, ts.k8sSAName, ts.endpoint), ts.exchangeToken)
+}
+
+// exchangeToken exchanges a GCP IAM SA Token with a Kubernetes Service Account token.
+func (ts *GCPTokenSource) exchangeToken() (*oauth2.Token, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
@@ -109,8 +122,7 @@ func (ts *GCPTokenSource) fetchK8sSAToken(ctx context.Context) (*oauth2.Token, e
 // fetch GCP IdentityBindingToken using the Kubernetes Service Account token
 // by calling Security Token Service (STS) API.
 func (ts *GCPTokenSource) fetchIdentityBindingToken(ctx context.Context, k8sSAToken *oauth2.Token) (*oauth2.Token, error) {
-
-	stsOpts := []option.ClientOption{option.WithHTTPClient(&http.Client{})}
+	stsOpts := []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: util.NewUserAgentTransport(nil, ts.userAgent)})}
 	if ts.endpoint != "" {
 		stsOpts = append(stsOpts, option.WithEndpoint(ts.endpoint))
 	}
@@ -148,10 +160,11 @@ func (ts *GCPTokenSource) fetchIdentityBindingToken(ctx context.Context, k8sSATo
 
 // fetch GCP service account token by calling the IAM credentials endpoint using an IdentityBindingToken.
 func (ts *GCPTokenSource) fetchGCPSAToken(ctx context.Context, identityBindingToken *oauth2.Token) (*oauth2.Token, error) {
-	gcpSAClient, err := credentials.NewIamCredentialsClient(
-		ctx,
-		option.WithTokenSource(oauth2.StaticTokenSource(identityBindingToken)),
-	)
+	opts := []option.ClientOption{option.WithTokenSource(oauth2.StaticTokenSource(identityBindingToken))}
+	if ts.userAgent != "" {
+		opts = append(opts, option.WithUserAgent(ts.userAgent))
+	}
+	gcpSAClient, err := credentials.NewIamCredentialsClient(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("create credentials client error: %w", err)
 	}
@@ -19,32 +19,88 @@ package clientset
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
 	appsv1 "k8s.io/api/apps/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
+// informerResyncPeriod is the resync period of the pod and node informers.
+// The informers rely on watch events, so the periodic resync is only a safety net.
+const informerResyncPeriod = 10 * time.Minute
+
+// Lease timings of the leader election, the defaults of the Kubernetes controllers.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
 type Interface interface {
+	ConfigurePodLister(nodeName string)
+	ConfigureNodeLister(nodeName string)
 	GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error)
+	ListNodePods() ([]*v1.Pod, error)
+	GetNode(ctx context.Context, name string) (*v1.Node, error)
 	GetDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error)
 	CreateServiceAccountToken(ctx context.Context, namespace, name string, tokenRequest *authenticationv1.TokenRequest) (*authenticationv1.TokenRequest, error)
 	GetGCPServiceAccountName(ctx context.Context, namespace, name string) (string, error)
+	GetServerVersion() (string, error)
+	GetCSINode(ctx context.Context, name string) (*storagev1.CSINode, error)
+	ListPersistentVolumes(ctx context.Context) ([]v1.PersistentVolume, error)
+	PatchPersistentVolumeAnnotations(ctx context.Context, name string, annotations map[string]*string) error
+	GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (*v1.PersistentVolumeClaim, error)
+	GetPersistentVolume(ctx context.Context, name string) (*v1.PersistentVolume, error)
+	PatchPodCondition(ctx context.Context, namespace, name string, condition v1.PodCondition) error
+	NewEventRecorder(component string) record.EventRecorder
+	RunWithLeaderElection(ctx context.Context, namespace, name, identity string, run func(ctx context.Context))
 }
 
 type Clientset struct {
 	k8sClients kubernetes.Interface
+	podLister  listersv1.PodLister
+	nodeLister listersv1.NodeLister
 }
 
-func New(kubeconfigPath string) (Interface, error) {
-	var err error
+func New(kubeconfigPath string, qps float32, burst int) (Interface, error) {
+	rc, err := NewRestConfig(kubeconfigPath, qps, burst)
+	if err != nil {
+		klog.Fatalf("Failed to read kubeconfig: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		klog.Fatal("failed to configure k8s client")
+	}
+
+	return &Clientset{k8sClients: clientset}, nil
+}
+
+// NewRestConfig returns the client config read from the kubeconfig path, or the in-cluster config if the path is empty.
+func NewRestConfig(kubeconfigPath string, qps float32, burst int) (*rest.Config, error) {
 	var rc *rest.Config
+	var err error
 	if kubeconfigPath != "" {
 		klog.V(4).Infof("using kubeconfig path %q", kubeconfigPath)
 		rc, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
@@ -53,18 +109,93 @@ func New(kubeconfigPath string) (Interface, error) {
 		rc, err = rest.InClusterConfig()
 	}
 	if err != nil {
-		klog.Fatalf("Failed to read kubeconfig: %v", err)
+		return nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(rc)
-	if err != nil {
-		klog.Fatal("failed to configure k8s client")
+	ConfigureRestConfig(rc, qps, burst)
+
+	return rc, nil
+}
+
+// ConfigureRestConfig sets the client-side rate limits of the client config, and counts the API requests in the driver metrics.
+// The client-go defaults are kept if qps or burst is not positive.
+func ConfigureRestConfig(rc *rest.Config, qps float32, burst int) {
+	if qps > 0 {
+		rc.QPS = qps
+	}
+	if burst > 0 {
+		rc.Burst = burst
 	}
+	rc.Wrap(metrics.NewKubeAPIRoundTripper)
+	klog.V(4).Infof("using Kubernetes API client QPS %v and burst %v", rc.QPS, rc.Burst)
+}
 
-	return &Clientset{k8sClients: clientset}, nil
+// ConfigurePodLister starts an informer that caches the Pods scheduled to the node,
+// so that GetPod does not call the API server on every lookup.
+// The cache is bounded by the number of Pods on the node.
+func (c *Clientset) ConfigurePodLister(nodeName string) {
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(
+		c.k8sClients,
+		informerResyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+		}),
+	)
+	podInformer := informerFactory.Core().V1().Pods()
+	if err := podInformer.Informer().SetTransform(stripManagedFields); err != nil {
+		klog.Warningf("failed to set the pod informer transform: %v", err)
+	}
+	c.podLister = podInformer.Lister()
+
+	ctx := context.Background()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+	klog.Infof("pod informer for node %q synced", nodeName)
+}
+
+// ConfigureNodeLister starts an informer that caches the given node object.
+func (c *Clientset) ConfigureNodeLister(nodeName string) {
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(
+		c.k8sClients,
+		informerResyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		}),
+	)
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	if err := nodeInformer.Informer().SetTransform(stripManagedFields); err != nil {
+		klog.Warningf("failed to set the node informer transform: %v", err)
+	}
+	c.nodeLister = nodeInformer.Lister()
+
+	ctx := context.Background()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+	klog.Infof("node informer for node %q synced", nodeName)
+}
+
+// stripManagedFields drops the managed fields to reduce the informer cache memory usage.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, ok := obj.(metav1.ObjectMetaAccessor); ok {
+		accessor.GetObjectMeta().SetManagedFields(nil)
+	}
+
+	return obj, nil
 }
 
 func (c *Clientset) GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error) {
+	if c.podLister != nil {
+		pod, err := c.podLister.Pods(namespace).Get(name)
+		if err == nil {
+			return pod, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		// The informer may not have observed a newly created Pod yet, fall back to the API server.
+		klog.V(4).Infof("pod %s/%s not found in the informer cache, calling the API server", namespace, name)
+	}
+
 	pod, err := c.k8sClients.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
@@ -73,6 +204,36 @@ func (c *Clientset) GetPod(ctx context.Context, namespace, name string) (*v1.Pod
 	return pod, nil
 }
 
+// ListNodePods returns the Pods scheduled to the node from the informer cache.
+// It requires the pod lister configured by ConfigurePodLister.
+func (c *Clientset) ListNodePods() ([]*v1.Pod, error) {
+	if c.podLister == nil {
+		return nil, fmt.Errorf("the pod lister is not configured")
+	}
+
+	return c.podLister.List(labels.Everything())
+}
+
+func (c *Clientset) GetNode(ctx context.Context, name string) (*v1.Node, error) {
+	if c.nodeLister != nil {
+		node, err := c.nodeLister.Get(name)
+		if err == nil {
+			return node, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		klog.V(4).Infof("node %q not found in the informer cache, calling the API server", name)
+	}
+
+	node, err := c.k8sClients.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
 func (c *Clientset) GetDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
 	ds, err := c.k8sClients.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
@@ -111,3 +272,128 @@ func (c *Clientset) GetGCPServiceAccountName(ctx context.Context, namespace, nam
 
 	return resp.Annotations["iam.gke.io/gcp-service-account"], nil
 }
+
+func (c *Clientset) GetServerVersion() (string, error) {
+	v, err := c.k8sClients.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to call Kubernetes ServerVersion API: %w", err)
+	}
+
+	return v.GitVersion, nil
+}
+
+func (c *Clientset) GetCSINode(ctx context.Context, name string) (*storagev1.CSINode, error) {
+	csiNode, err := c.k8sClients.StorageV1().CSINodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return csiNode, nil
+}
+
+// ListPersistentVolumes returns all the PersistentVolumes of the cluster.
+func (c *Clientset) ListPersistentVolumes(ctx context.Context) ([]v1.PersistentVolume, error) {
+	pvs, err := c.k8sClients.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Kubernetes PersistentVolume.List API: %w", err)
+	}
+
+	return pvs.Items, nil
+}
+
+// PatchPersistentVolumeAnnotations sets the annotations of the PersistentVolume, and removes the annotations with a nil value.
+func (c *Clientset) PatchPersistentVolumeAnnotations(ctx context.Context, name string, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.k8sClients.CoreV1().PersistentVolumes().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to call Kubernetes PersistentVolume.Patch API: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Clientset) GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (*v1.PersistentVolumeClaim, error) {
+	pvc, err := c.k8sClients.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return pvc, nil
+}
+
+func (c *Clientset) GetPersistentVolume(ctx context.Context, name string) (*v1.PersistentVolume, error) {
+	pv, err := c.k8sClients.CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return pv, nil
+}
+
+// PatchPodCondition adds the condition to the Pod status, or replaces the condition of the same type.
+func (c *Clientset) PatchPodCondition(ctx context.Context, namespace, name string, condition v1.PodCondition) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.PodCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.k8sClients.CoreV1().Pods(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status"); err != nil {
+		return fmt.Errorf("failed to call Kubernetes Pod.PatchStatus API: %w", err)
+	}
+
+	return nil
+}
+
+// NewEventRecorder returns an EventRecorder that sends events to the API server on behalf of the component.
+func (c *Clientset) NewEventRecorder(component string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedv1.EventSinkImpl{Interface: c.k8sClients.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component})
+}
+
+// RunWithLeaderElection runs the function while the identity holds the Lease of the name in the namespace,
+// so that only one replica of the controller runs it. The context of the function is cancelled when the leadership is lost,
+// and the leadership is tried again until the context is cancelled.
+func (c *Clientset) RunWithLeaderElection(ctx context.Context, namespace, name, identity string, run func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     c.k8sClients.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	for ctx.Err() == nil {
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: run,
+				OnStoppedLeading: func() {
+					klog.Infof("%q is no longer the leader of the Lease %s/%s", identity, namespace, name)
+				},
+			},
+		})
+		if err != nil {
+			klog.Errorf("failed to set up the leader election of the Lease %s/%s: %v", namespace, name, err)
+
+			return
+		}
+		le.Run(ctx)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientset
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPod(t *testing.T) {
+	t.Parallel()
+	cachedPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "cached-pod", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "test-node"},
+	}
+	k8sClients := fake.NewSimpleClientset(cachedPod)
+	c := &Clientset{k8sClients: k8sClients}
+	c.ConfigurePodLister("test-node")
+
+	// Create a Pod after the informer synced to exercise the API server fallback.
+	newPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "new-pod", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "test-node"},
+	}
+	if _, err := k8sClients.CoreV1().Pods("default").Create(context.TODO(), newPod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create pod: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		podName   string
+		expectErr bool
+	}{
+		{
+			name:    "pod in the informer cache",
+			podName: "cached-pod",
+		},
+		{
+			name:    "pod not in the informer cache yet",
+			podName: "new-pod",
+		},
+		{
+			name:      "pod does not exist",
+			podName:   "non-existing-pod",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		pod, err := c.GetPod(context.TODO(), "default", test.podName)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test %q failed: expected error, got nil", test.name)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %q failed: got error %q, expected nil", test.name, err)
+
+			continue
+		}
+		if pod.Name != test.podName {
+			t.Errorf("test %q failed: got pod %q, expected %q", test.name, pod.Name, test.podName)
+		}
+	}
+}
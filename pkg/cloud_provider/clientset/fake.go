@@ -24,11 +24,33 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 type FakeClientset struct{}
 
+func (c *FakeClientset) ConfigurePodLister(_ string) {}
+
+func (c *FakeClientset) ConfigureNodeLister(_ string) {}
+
+func (c *FakeClientset) GetNode(_ context.Context, name string) (*v1.Node, error) {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				v1.LabelTopologyZone:   "us-central1-c",
+				v1.LabelTopologyRegion: "us-central1",
+			},
+		},
+	}, nil
+}
+
+func (c *FakeClientset) ListNodePods() ([]*v1.Pod, error) {
+	return []*v1.Pod{}, nil
+}
+
 func (c *FakeClientset) GetPod(_ context.Context, namespace, name string) (*v1.Pod, error) {
 	config := webhook.FakeConfig()
 	pod := &v1.Pod{
@@ -60,3 +82,43 @@ func (c *FakeClientset) CreateServiceAccountToken(_ context.Context, _, _ string
 func (c *FakeClientset) GetGCPServiceAccountName(_ context.Context, _, _ string) (string, error) {
 	return "", nil
 }
+
+func (c *FakeClientset) GetServerVersion() (string, error) {
+	return "v1.27.3-gke.100", nil
+}
+
+func (c *FakeClientset) GetCSINode(_ context.Context, name string) (*storagev1.CSINode, error) {
+	return &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}, nil
+}
+
+func (c *FakeClientset) ListPersistentVolumes(_ context.Context) ([]v1.PersistentVolume, error) {
+	return []v1.PersistentVolume{}, nil
+}
+
+func (c *FakeClientset) PatchPersistentVolumeAnnotations(_ context.Context, _ string, _ map[string]*string) error {
+	return nil
+}
+
+func (c *FakeClientset) GetPersistentVolumeClaim(_ context.Context, namespace, name string) (*v1.PersistentVolumeClaim, error) {
+	return &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}, nil
+}
+
+func (c *FakeClientset) GetPersistentVolume(_ context.Context, name string) (*v1.PersistentVolume, error) {
+	return &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+}
+
+func (c *FakeClientset) PatchPodCondition(_ context.Context, _, _ string, _ v1.PodCondition) error {
+	return nil
+}
+
+func (c *FakeClientset) NewEventRecorder(_ string) record.EventRecorder {
+	return record.NewFakeRecorder(100)
+}
+
+func (c *FakeClientset) RunWithLeaderElection(ctx context.Context, _, _, _ string, run func(ctx context.Context)) {
+	run(ctx)
+}
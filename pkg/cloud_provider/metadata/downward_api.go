@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"os"
+)
+
+// Environment variables read by the downward API metadata service.
+// They are typically set via the downward API, e.g. from the driver Pod annotations.
+const (
+	EnvProjectID        = "GCSFUSE_CSI_PROJECT_ID"
+	EnvIdentityPool     = "GCSFUSE_CSI_IDENTITY_POOL"
+	EnvIdentityProvider = "GCSFUSE_CSI_IDENTITY_PROVIDER"
+)
+
+// NewDownwardAPIMetadataService returns a metadata Service using the values from environment variables.
+// Non-empty projectID, identityPool, and identityProvider override the environment variables.
+func NewDownwardAPIMetadataService(projectID, identityPool, identityProvider string) (Service, error) {
+	if projectID == "" {
+		projectID = os.Getenv(EnvProjectID)
+	}
+
+	if identityPool == "" {
+		identityPool = os.Getenv(EnvIdentityPool)
+	}
+
+	if identityProvider == "" {
+		identityProvider = os.Getenv(EnvIdentityProvider)
+	}
+
+	return NewStaticMetadataService(projectID, identityPool, identityProvider)
+}
@@ -28,12 +28,44 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// Sources of the metadata service, selectable by the driver flag.
+const (
+	// SourceGKE reads the metadata from the GKE metadata server and the gke-metadata-server DaemonSet.
+	SourceGKE = "gke"
+	// SourceStatic uses the values provided by the driver flags.
+	SourceStatic = "static"
+	// SourceDownwardAPI uses the values provided by environment variables, typically set via the downward API.
+	SourceDownwardAPI = "downward-api"
+)
+
 type Service interface {
 	GetProjectID() string
 	GetIdentityPool() string
 	GetIdentityProvider() string
 }
 
+// Config contains the explicit metadata values. Non-empty values override the values from the metadata source.
+type Config struct {
+	Source           string
+	ProjectID        string
+	IdentityPool     string
+	IdentityProvider string
+}
+
+// New returns a metadata Service for the configured source.
+func New(config *Config, clientset clientset.Interface) (Service, error) {
+	switch config.Source {
+	case SourceGKE, "":
+		return NewMetadataService(config.ProjectID, config.IdentityPool, config.IdentityProvider, clientset)
+	case SourceStatic:
+		return NewStaticMetadataService(config.ProjectID, config.IdentityPool, config.IdentityProvider)
+	case SourceDownwardAPI:
+		return NewDownwardAPIMetadataService(config.ProjectID, config.IdentityPool, config.IdentityProvider)
+	default:
+		return nil, fmt.Errorf("invalid metadata source %q, must be one of %q, %q, %q", config.Source, SourceGKE, SourceStatic, SourceDownwardAPI)
+	}
+}
+
 type metadataServiceManager struct {
 	projectID        string
 	identityPool     string
@@ -42,10 +74,15 @@ type metadataServiceManager struct {
 
 var _ Service = &metadataServiceManager{}
 
-func NewMetadataService(identityPool, identityProvider string, clientset clientset.Interface) (Service, error) {
-	projectID, err := metadata.ProjectID()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get project: %w", err)
+// NewMetadataService returns a metadata Service using the GKE metadata server.
+// Non-empty projectID, identityPool, and identityProvider override the discovered values.
+func NewMetadataService(projectID, identityPool, identityProvider string, clientset clientset.Interface) (Service, error) {
+	if projectID == "" {
+		var err error
+		projectID, err = metadata.ProjectID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project: %w", err)
+		}
 	}
 
 	if identityPool == "" {
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Setenv(EnvProjectID, "env-project")
+	t.Setenv(EnvIdentityPool, "")
+	t.Setenv(EnvIdentityProvider, "https://env-provider")
+
+	cases := []struct {
+		name                     string
+		config                   *Config
+		expectedProjectID        string
+		expectedIdentityPool     string
+		expectedIdentityProvider string
+		expectErr                bool
+	}{
+		{
+			name: "static source",
+			config: &Config{
+				Source:           SourceStatic,
+				ProjectID:        "test-project",
+				IdentityProvider: "https://test-provider",
+			},
+			expectedProjectID:        "test-project",
+			expectedIdentityPool:     "test-project.svc.id.goog",
+			expectedIdentityProvider: "https://test-provider",
+		},
+		{
+			name: "static source with identity pool override",
+			config: &Config{
+				Source:           SourceStatic,
+				ProjectID:        "test-project",
+				IdentityPool:     "test-pool",
+				IdentityProvider: "https://test-provider",
+			},
+			expectedProjectID:        "test-project",
+			expectedIdentityPool:     "test-pool",
+			expectedIdentityProvider: "https://test-provider",
+		},
+		{
+			name: "static source without project ID",
+			config: &Config{
+				Source:           SourceStatic,
+				IdentityProvider: "https://test-provider",
+			},
+			expectErr: true,
+		},
+		{
+			name: "static source without identity provider",
+			config: &Config{
+				Source:    SourceStatic,
+				ProjectID: "test-project",
+			},
+			expectErr: true,
+		},
+		{
+			name: "downward API source",
+			config: &Config{
+				Source: SourceDownwardAPI,
+			},
+			expectedProjectID:        "env-project",
+			expectedIdentityPool:     "env-project.svc.id.goog",
+			expectedIdentityProvider: "https://env-provider",
+		},
+		{
+			name: "downward API source with project ID override",
+			config: &Config{
+				Source:    SourceDownwardAPI,
+				ProjectID: "test-project",
+			},
+			expectedProjectID:        "test-project",
+			expectedIdentityPool:     "test-project.svc.id.goog",
+			expectedIdentityProvider: "https://env-provider",
+		},
+		{
+			name: "invalid source",
+			config: &Config{
+				Source: "invalid",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		s, err := New(test.config, nil)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test %q failed: expected error, got nil", test.name)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %q failed: got error %q, expected nil", test.name, err)
+
+			continue
+		}
+		if s.GetProjectID() != test.expectedProjectID {
+			t.Errorf("test %q failed: got project ID %q, expected %q", test.name, s.GetProjectID(), test.expectedProjectID)
+		}
+		if s.GetIdentityPool() != test.expectedIdentityPool {
+			t.Errorf("test %q failed: got identity pool %q, expected %q", test.name, s.GetIdentityPool(), test.expectedIdentityPool)
+		}
+		if s.GetIdentityProvider() != test.expectedIdentityProvider {
+			t.Errorf("test %q failed: got identity provider %q, expected %q", test.name, s.GetIdentityProvider(), test.expectedIdentityProvider)
+		}
+	}
+}
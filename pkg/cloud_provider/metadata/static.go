@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+)
+
+type staticService struct {
+	projectID        string
+	identityPool     string
+	identityProvider string
+}
+
+var _ Service = &staticService{}
+
+// NewStaticMetadataService returns a metadata Service using the explicitly provided values,
+// for environments where the GKE metadata server is not available.
+func NewStaticMetadataService(projectID, identityPool, identityProvider string) (Service, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("project ID must be provided")
+	}
+
+	if identityPool == "" {
+		identityPool = fmt.Sprintf("%s.svc.id.goog", projectID)
+	}
+
+	if identityProvider == "" {
+		return nil, fmt.Errorf("identity provider must be provided")
+	}
+
+	return &staticService{
+		projectID:        projectID,
+		identityPool:     identityPool,
+		identityProvider: identityProvider,
+	}, nil
+}
+
+func (s *staticService) GetProjectID() string {
+	return s.projectID
+}
+
+func (s *staticService) GetIdentityPool() string {
+	return s.identityPool
+}
+
+func (s *staticService) GetIdentityProvider() string {
+	return s.identityProvider
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BucketCache caches the CheckBucketExists and GetBucket results per identity and bucket,
+// so that scaling up identical Pods does not issue identical metadata calls.
+// Only successful results are cached, so that fixed permissions or newly created buckets take effect immediately.
+type BucketCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*bucketCacheEntry
+}
+
+type bucketCacheEntry struct {
+	bucket *ServiceBucket
+	exists bool
+	expiry time.Time
+}
+
+func NewBucketCache(ttl time.Duration) *BucketCache {
+	return &BucketCache{
+		ttl:     ttl,
+		entries: map[string]*bucketCacheEntry{},
+	}
+}
+
+// NewCachedService wraps the Service with the cache.
+// The identity is part of the cache key because bucket access depends on the caller credentials.
+func (c *BucketCache) NewCachedService(s Service, identity string) Service {
+	return &cachedService{
+		Service:  s,
+		cache:    c,
+		identity: identity,
+	}
+}
+
+func (c *BucketCache) get(key string) *bucketCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(e.expiry) {
+		delete(c.entries, key)
+
+		return nil
+	}
+
+	return e
+}
+
+func (c *BucketCache) set(key string, update func(e *bucketCacheEntry)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiry) {
+			delete(c.entries, k)
+		}
+	}
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &bucketCacheEntry{}
+		c.entries[key] = e
+	}
+	update(e)
+	e.expiry = now.Add(c.ttl)
+}
+
+type cachedService struct {
+	Service
+	cache    *BucketCache
+	identity string
+}
+
+func (s *cachedService) key(bucketName string) string {
+	return s.identity + "/" + bucketName
+}
+
+func (s *cachedService) CheckBucketExists(ctx context.Context, obj *ServiceBucket) (bool, error) {
+	key := s.key(obj.Name)
+	if e := s.cache.get(key); e != nil && e.exists {
+		return true, nil
+	}
+
+	exists, err := s.Service.CheckBucketExists(ctx, obj)
+	if exists {
+		s.cache.set(key, func(e *bucketCacheEntry) { e.exists = true })
+	}
+
+	return exists, err
+}
+
+func (s *cachedService) GetBucket(ctx context.Context, obj *ServiceBucket) (*ServiceBucket, error) {
+	key := s.key(obj.Name)
+	if e := s.cache.get(key); e != nil && e.bucket != nil {
+		return e.bucket, nil
+	}
+
+	bucket, err := s.Service.GetBucket(ctx, obj)
+	if err == nil && bucket != nil {
+		s.cache.set(key, func(e *bucketCacheEntry) {
+			e.bucket = bucket
+			e.exists = true
+		})
+	}
+
+	return bucket, err
+}
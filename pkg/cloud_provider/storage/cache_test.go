@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type countingService struct {
+	Service
+	exists       bool
+	err          error
+	checkCalls   int
+	getCalls     int
+	bucketToFind *ServiceBucket
+}
+
+func (s *countingService) CheckBucketExists(_ context.Context, _ *ServiceBucket) (bool, error) {
+	s.checkCalls++
+
+	return s.exists, s.err
+}
+
+func (s *countingService) GetBucket(_ context.Context, _ *ServiceBucket) (*ServiceBucket, error) {
+	s.getCalls++
+
+	return s.bucketToFind, s.err
+}
+
+func TestBucketCache(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name               string
+		ttl                time.Duration
+		service            *countingService
+		identities         []string
+		expectedCheckCalls int
+		expectedGetCalls   int
+	}{
+		{
+			name:               "existing bucket is cached",
+			ttl:                time.Minute,
+			service:            &countingService{exists: true, bucketToFind: &ServiceBucket{Name: "bucket"}},
+			identities:         []string{"ns/sa", "ns/sa", "ns/sa"},
+			expectedCheckCalls: 1,
+			expectedGetCalls:   1,
+		},
+		{
+			name:               "cache is per identity",
+			ttl:                time.Minute,
+			service:            &countingService{exists: true, bucketToFind: &ServiceBucket{Name: "bucket"}},
+			identities:         []string{"ns/sa1", "ns/sa2", "ns/sa1"},
+			expectedCheckCalls: 2,
+			expectedGetCalls:   2,
+		},
+		{
+			name:               "errors are not cached",
+			ttl:                time.Minute,
+			service:            &countingService{err: errors.New("permission denied")},
+			identities:         []string{"ns/sa", "ns/sa"},
+			expectedCheckCalls: 2,
+			expectedGetCalls:   2,
+		},
+		{
+			name:               "expired entries are not used",
+			ttl:                -time.Second,
+			service:            &countingService{exists: true, bucketToFind: &ServiceBucket{Name: "bucket"}},
+			identities:         []string{"ns/sa", "ns/sa"},
+			expectedCheckCalls: 2,
+			expectedGetCalls:   2,
+		},
+	}
+
+	for _, test := range cases {
+		cache := NewBucketCache(test.ttl)
+		for _, identity := range test.identities {
+			s := cache.NewCachedService(test.service, identity)
+			_, _ = s.CheckBucketExists(context.TODO(), &ServiceBucket{Name: "bucket"})
+			_, _ = s.GetBucket(context.TODO(), &ServiceBucket{Name: "bucket"})
+		}
+
+		if test.service.checkCalls != test.expectedCheckCalls {
+			t.Errorf("test %q failed: got %v CheckBucketExists calls, expected %v", test.name, test.service.checkCalls, test.expectedCheckCalls)
+		}
+		if test.service.getCalls != test.expectedGetCalls {
+			t.Errorf("test %q failed: got %v GetBucket calls, expected %v", test.name, test.service.getCalls, test.expectedGetCalls)
+		}
+	}
+}
@@ -19,9 +19,11 @@ package storage
 
 import (
 	"context"
+	"net/http"
 
 	"cloud.google.com/go/storage"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 )
 
 type fakeService struct {
@@ -30,9 +32,10 @@ type fakeService struct {
 
 type fakeServiceManager struct {
 	createdBuckets map[string]*ServiceBucket
+	iamPolicies    map[string]map[string][]string
 }
 
-func (manager *fakeServiceManager) SetupService(_ context.Context, _ oauth2.TokenSource, _ string) (Service, error) {
+func (manager *fakeServiceManager) SetupService(_ context.Context, _ oauth2.TokenSource, _, _ string) (Service, error) {
 	return &fakeService{sm: *manager}, nil
 }
 
@@ -41,16 +44,22 @@ func (manager *fakeServiceManager) SetupServiceWithDefaultCredential(_ context.C
 }
 
 func NewFakeServiceManager() ServiceManager {
-	return &fakeServiceManager{createdBuckets: map[string]*ServiceBucket{}}
+	return &fakeServiceManager{createdBuckets: map[string]*ServiceBucket{}, iamPolicies: map[string]map[string][]string{}}
 }
 
 func (service *fakeService) CreateBucket(_ context.Context, obj *ServiceBucket) (*ServiceBucket, error) {
+	if _, ok := service.sm.createdBuckets[obj.Name]; ok {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: "the bucket already exists"}
+	}
+
 	sb := &ServiceBucket{
-		Project:   obj.Project,
-		Location:  obj.Location,
-		Name:      obj.Name,
-		SizeBytes: obj.SizeBytes,
-		Labels:    obj.Labels,
+		Project:      obj.Project,
+		Location:     obj.Location,
+		LocationType: obj.LocationType,
+		StorageClass: obj.StorageClass,
+		Name:         obj.Name,
+		SizeBytes:    obj.SizeBytes,
+		Labels:       obj.Labels,
 	}
 
 	service.sm.createdBuckets[obj.Name] = sb
@@ -70,10 +79,27 @@ func (service *fakeService) GetBucket(_ context.Context, obj *ServiceBucket) (*S
 	return nil, storage.ErrBucketNotExist
 }
 
-func (service *fakeService) SetIAMPolicy(_ context.Context, _ *ServiceBucket, _, _ string) error {
+func (service *fakeService) SetIAMPolicy(_ context.Context, obj *ServiceBucket, member, roleName string) error {
+	if _, ok := service.sm.iamPolicies[obj.Name]; !ok {
+		service.sm.iamPolicies[obj.Name] = map[string][]string{}
+	}
+	service.sm.iamPolicies[obj.Name][roleName] = append(service.sm.iamPolicies[obj.Name][roleName], member)
+
 	return nil
 }
 
-func (service *fakeService) CheckBucketExists(_ context.Context, _ *ServiceBucket) (bool, error) {
+func (service *fakeService) GetIAMPolicy(_ context.Context, obj *ServiceBucket) (map[string][]string, error) {
+	if _, ok := service.sm.createdBuckets[obj.Name]; !ok {
+		return nil, storage.ErrBucketNotExist
+	}
+
+	return service.sm.iamPolicies[obj.Name], nil
+}
+
+func (service *fakeService) CheckBucketExists(_ context.Context, obj *ServiceBucket) (bool, error) {
+	if _, ok := service.sm.createdBuckets[obj.Name]; !ok {
+		return false, storage.ErrBucketNotExist
+	}
+
 	return true, nil
 }
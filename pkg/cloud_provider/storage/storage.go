@@ -21,22 +21,54 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/iam"
 	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 )
 
+// Bucket location types, see https://cloud.google.com/storage/docs/locations.
+const (
+	locationTypeRegion      = "region"
+	locationTypeDualRegion  = "dual-region"
+	locationTypeMultiRegion = "multi-region"
+)
+
+// regionalEndpointLocations are the regions of the GCS regional endpoints, see https://cloud.google.com/storage/docs/regional-endpoints.
+// The buckets in the other regions use the global endpoint, because the regional endpoint hostname does not resolve.
+var regionalEndpointLocations = map[string]bool{
+	"europe-west1": true,
+	"europe-west3": true,
+	"europe-west4": true,
+	"europe-west8": true,
+	"europe-west9": true,
+	"me-central2":  true,
+	"us-central1":  true,
+	"us-east1":     true,
+	"us-east4":     true,
+	"us-east5":     true,
+	"us-south1":    true,
+	"us-west1":     true,
+	"us-west2":     true,
+	"us-west3":     true,
+	"us-west4":     true,
+}
+
 type ServiceBucket struct {
 	Project                        string
 	Name                           string
 	Location                       string
+	LocationType                   string
+	StorageClass                   string
 	SizeBytes                      int64
 	Labels                         map[string]string
 	EnableUniformBucketLevelAccess bool
@@ -47,11 +79,12 @@ type Service interface {
 	GetBucket(ctx context.Context, b *ServiceBucket) (*ServiceBucket, error)
 	DeleteBucket(ctx context.Context, b *ServiceBucket) error
 	SetIAMPolicy(ctx context.Context, obj *ServiceBucket, member, roleName string) error
+	GetIAMPolicy(ctx context.Context, obj *ServiceBucket) (map[string][]string, error)
 	CheckBucketExists(ctx context.Context, obj *ServiceBucket) (bool, error)
 }
 
 type ServiceManager interface {
-	SetupService(ctx context.Context, ts oauth2.TokenSource, storageEndpoint string) (Service, error)
+	SetupService(ctx context.Context, ts oauth2.TokenSource, storageEndpoint, quotaProject string) (Service, error)
 	SetupServiceWithDefaultCredential(ctx context.Context, storageEndpoint string) (Service, error)
 }
 
@@ -59,25 +92,39 @@ type gcsService struct {
 	storageClient *storage.Client
 }
 
-type gcsServiceManager struct{}
+type gcsServiceManager struct {
+	userAgent string
+}
 
-func NewGCSServiceManager() (ServiceManager, error) {
-	return &gcsServiceManager{}, nil
+// NewGCSServiceManager returns a ServiceManager that sets the userAgent on all the GCS API calls.
+func NewGCSServiceManager(userAgent string) (ServiceManager, error) {
+	return &gcsServiceManager{userAgent: userAgent}, nil
 }
 
-func (manager *gcsServiceManager) SetupService(ctx context.Context, ts oauth2.TokenSource, storageEndpoint string) (Service, error) {
+// SetupService returns a Service authenticated by the token source.
+// If quotaProject is not empty, the API quota and billing are attributed to the quota project.
+func (manager *gcsServiceManager) SetupService(ctx context.Context, ts oauth2.TokenSource, storageEndpoint, quotaProject string) (Service, error) {
+	var tokenErr error
 	if err := wait.PollUntilContextTimeout(ctx, 5*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
-		if _, err := ts.Token(); err != nil {
-			klog.Errorf("error fetching initial token: %v", err)
+		if _, tokenErr = ts.Token(); tokenErr != nil {
+			klog.Errorf("error fetching initial token: %v", tokenErr)
 
 			return false, nil
 		}
 
 		return true, nil
 	}); err != nil {
+		// Surface the last token error so that callers can tell why the token exchange failed,
+		// for example a missing IAM binding or a wrong Kubernetes service account annotation.
+		if tokenErr != nil {
+			return nil, fmt.Errorf("%w, last token fetch error: %v", err, tokenErr)
+		}
+
 		return nil, err
 	}
 	client := oauth2.NewClient(ctx, ts)
+	// option.WithUserAgent does not take effect when option.WithHTTPClient is used.
+	client.Transport = util.NewQuotaProjectTransport(util.NewUserAgentTransport(client.Transport, manager.userAgent), quotaProject)
 	storageOpts := []option.ClientOption{option.WithHTTPClient(client)}
 	if storageEndpoint != "" {
 		storageOpts = append(storageOpts, option.WithEndpoint(storageEndpoint))
@@ -93,6 +140,9 @@ func (manager *gcsServiceManager) SetupService(ctx context.Context, ts oauth2.To
 
 func (manager *gcsServiceManager) SetupServiceWithDefaultCredential(ctx context.Context, storageEndpoint string) (Service, error) {
 	storageOpts := []option.ClientOption{}
+	if manager.userAgent != "" {
+		storageOpts = append(storageOpts, option.WithUserAgent(manager.userAgent))
+	}
 	if storageEndpoint != "" {
 		storageOpts = append(storageOpts, option.WithEndpoint(storageEndpoint))
 	}
@@ -205,40 +255,66 @@ func (service *gcsService) SetIAMPolicy(ctx context.Context, obj *ServiceBucket,
 	return nil
 }
 
+// GetIAMPolicy returns the members of each role in the bucket IAM policy.
+func (service *gcsService) GetIAMPolicy(ctx context.Context, obj *ServiceBucket) (map[string][]string, error) {
+	policy, err := service.storageClient.Bucket(obj.Name).IAM().Policy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket %q IAM policy: %w", obj.Name, err)
+	}
+
+	bindings := map[string][]string{}
+	for _, role := range policy.Roles() {
+		bindings[string(role)] = policy.Members(role)
+	}
+
+	return bindings, nil
+}
+
 func cloudBucketToServiceBucket(attrs *storage.BucketAttrs) (*ServiceBucket, error) {
 	return &ServiceBucket{
-		Location: attrs.Location,
-		Name:     attrs.Name,
-		Labels:   attrs.Labels,
+		Location:     attrs.Location,
+		LocationType: attrs.LocationType,
+		StorageClass: attrs.StorageClass,
+		Name:         attrs.Name,
+		Labels:       attrs.Labels,
 	}, nil
 }
 
-func CompareBuckets(a, b *ServiceBucket) error {
-	mismatches := []string{}
-	if a.Name != b.Name {
-		mismatches = append(mismatches, "bucket name")
-	}
-	if a.Project != b.Project {
-		mismatches = append(mismatches, "bucket project")
-	}
-	if a.Location != b.Location {
-		mismatches = append(mismatches, "bucket location")
-	}
-	if a.SizeBytes != b.SizeBytes {
-		mismatches = append(mismatches, "bucket size")
+// GetRegionalEndpoint returns the GCS regional endpoint for buckets in a single region with a regional endpoint.
+// Dual-region, multi-region, and unknown location types, and the regions without a regional endpoint,
+// return an empty string to use the global endpoint.
+func GetRegionalEndpoint(b *ServiceBucket) string {
+	if b == nil || b.Location == "" {
+		return ""
 	}
 
-	if len(mismatches) > 0 {
-		return fmt.Errorf("bucket %q and bucket %q do not match: [%s]", a.Name, b.Name, strings.Join(mismatches, ", "))
-	}
+	switch strings.ToLower(b.LocationType) {
+	case locationTypeRegion:
+		location := strings.ToLower(b.Location)
+		if !regionalEndpointLocations[location] {
+			return ""
+		}
 
-	return nil
+		return fmt.Sprintf("https://storage.%v.rep.googleapis.com", location)
+	case locationTypeDualRegion, locationTypeMultiRegion:
+		// The bucket data spans several regions, served by the global endpoint.
+		return ""
+	default:
+		return ""
+	}
 }
 
 func IsNotExistErr(err error) bool {
 	return errors.Is(err, storage.ErrBucketNotExist)
 }
 
+// IsAlreadyExistErr returns true if the bucket creation failed because the bucket already exists.
+func IsAlreadyExistErr(err error) bool {
+	var apiErr *googleapi.Error
+
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
 func IsPermissionDeniedErr(err error) bool {
 	return strings.Contains(err.Error(), "does not have storage.objects.list access to the Google Cloud Storage bucket.")
 }
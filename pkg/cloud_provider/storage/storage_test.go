@@ -18,78 +18,83 @@ limitations under the License.
 package storage
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"golang.org/x/oauth2"
 )
 
-func TestCompareBuckets(t *testing.T) {
+func TestGetRegionalEndpoint(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
-		name               string
-		a                  *ServiceBucket
-		b                  *ServiceBucket
-		expectedMismatches []string
+		name             string
+		bucket           *ServiceBucket
+		expectedEndpoint string
 	}{
 		{
-			name: "matches equal",
-			a: &ServiceBucket{
-				Name:      "name",
-				Project:   "project",
-				Location:  "location",
-				SizeBytes: 10 * util.Mb,
-			},
-			b: &ServiceBucket{
-				Name:      "name",
-				Project:   "project",
-				Location:  "location",
-				SizeBytes: 10 * util.Mb,
-			},
+			name:             "regional bucket",
+			bucket:           &ServiceBucket{Name: "name", Location: "US-CENTRAL1", LocationType: "region"},
+			expectedEndpoint: "https://storage.us-central1.rep.googleapis.com",
 		},
 		{
-			name: "nothing matches",
-			a: &ServiceBucket{
-				Name:      "name1",
-				Project:   "project1",
-				Location:  "location1",
-				SizeBytes: 10 * util.Mb,
-			},
-			b: &ServiceBucket{
-				Name:      "name2",
-				Project:   "project2",
-				Location:  "location2",
-				SizeBytes: 20 * util.Mb,
-			},
-			expectedMismatches: []string{
-				"bucket name",
-				"bucket project",
-				"bucket location",
-				"bucket size",
-			},
+			name:   "regional bucket in a region without a regional endpoint",
+			bucket: &ServiceBucket{Name: "name", Location: "AFRICA-SOUTH1", LocationType: "region"},
+		},
+		{
+			name:   "dual-region bucket",
+			bucket: &ServiceBucket{Name: "name", Location: "NAM4", LocationType: "dual-region"},
+		},
+		{
+			name:   "multi-region bucket",
+			bucket: &ServiceBucket{Name: "name", Location: "US", LocationType: "multi-region"},
+		},
+		{
+			name:   "unknown location type",
+			bucket: &ServiceBucket{Name: "name", Location: "US-CENTRAL1"},
+		},
+		{
+			name: "nil bucket",
 		},
 	}
 
 	for _, test := range cases {
-		err := CompareBuckets(test.a, test.b)
-		if len(test.expectedMismatches) == 0 {
-			if err != nil {
-				t.Errorf("test %v failed:\nexpected match,\ngot error %q", test.name, err)
-			}
-		} else {
-			if err == nil {
-				t.Errorf("test %v failed:\nexpected mismatches %q,\ngot success", test.expectedMismatches, test.name)
-			} else {
-				missedMismatches := []string{}
-				for _, mismatch := range test.expectedMismatches {
-					if !strings.Contains(err.Error(), mismatch) {
-						missedMismatches = append(missedMismatches, mismatch)
-					}
-				}
-				if len(missedMismatches) > 0 {
-					t.Errorf("test %q failed:\nexpected mismatches %q,\nmissed mismatches %q", test.name, test.expectedMismatches, missedMismatches)
-				}
-			}
+		endpoint := GetRegionalEndpoint(test.bucket)
+		if endpoint != test.expectedEndpoint {
+			t.Errorf("test %q failed:\ngot endpoint %q,\nexpected endpoint %q", test.name, endpoint, test.expectedEndpoint)
 		}
 	}
 }
+
+type errorTokenSource struct {
+	err error
+}
+
+func (ts *errorTokenSource) Token() (*oauth2.Token, error) {
+	return nil, ts.err
+}
+
+func TestSetupServiceSurfacesTokenError(t *testing.T) {
+	t.Parallel()
+	manager, err := NewGCSServiceManager("")
+	if err != nil {
+		t.Fatalf("failed to create service manager: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	tokenErr := errors.New("fetch GCP service account token error: rpc error: code = NotFound")
+	_, err = manager.SetupService(ctx, &errorTokenSource{err: tokenErr}, "", "")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap %v, got %v", context.DeadlineExceeded, err)
+	}
+	if !strings.Contains(err.Error(), tokenErr.Error()) {
+		t.Errorf("expected error to contain %q, got %q", tokenErr.Error(), err.Error())
+	}
+}
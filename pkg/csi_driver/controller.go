@@ -19,11 +19,13 @@ package driver
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -41,14 +43,15 @@ const (
 	ParameterKeyPVCNamespace = "csi.storage.k8s.io/pvc/namespace"
 	ParameterKeyPVName       = "csi.storage.k8s.io/pv/name"
 
-	// User provided labels.
-	ParameterKeyLabels = "labels"
-
 	// Keys for tags to attach to the provisioned disk.
 	tagKeyCreatedForClaimNamespace = "kubernetes_io_created-for_pvc_namespace"
 	tagKeyCreatedForClaimName      = "kubernetes_io_created-for_pvc_name"
 	tagKeyCreatedForVolumeName     = "kubernetes_io_created-for_pv_name"
 	tagKeyCreatedBy                = "storage_gke_io_created-by"
+	// The bucket attributes do not have a size, so the requested capacity is recorded to detect conflicting retries.
+	tagKeyCapacityBytes = "storage_gke_io_capacity-bytes"
+	// The bucket attributes only have the project number, so the requested project ID is recorded to detect conflicting retries.
+	tagKeyProjectID = "storage_gke_io_project-id"
 )
 
 // controllerServer handles volume provisioning.
@@ -85,13 +88,13 @@ func (s *controllerServer) ValidateVolumeCapabilities(ctx context.Context, req *
 
 	storageService, err := s.prepareStorageService(ctx, req.GetSecrets())
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "failed to prepare storage service: %v", err)
+		return nil, err
 	}
 
 	// Check that the volume exists
 	newBucket, err := storageService.GetBucket(ctx, &storage.ServiceBucket{Name: volumeID})
 	if err != nil && !storage.IsNotExistErr(err) {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(storageErrorCode(err), err.Error())
 	}
 	if newBucket == nil {
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("volume %v doesn't exist", volumeID))
@@ -152,40 +155,75 @@ func (s *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolu
 
 	storageService, err := s.prepareStorageService(ctx, secrets)
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "failed to prepare storage service: %v", err)
+		return nil, err
+	}
+
+	// Add labels
+	labels, err := extractLabels(param, s.driver.config.Name)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	labels[tagKeyCapacityBytes] = strconv.FormatInt(capBytes, 10)
+	labels[tagKeyProjectID] = projectID
+	newBucket.Labels = labels
 
-	// Check if the bucket already exists
+	// Check if the bucket already exists, e.g. the bucket was created by a CreateVolume call
+	// that timed out, or by the previous leader of the provisioner before a failover.
 	bucket, err := storageService.GetBucket(ctx, newBucket)
 	if err != nil && !storage.IsNotExistErr(err) {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(storageErrorCode(err), err.Error())
 	}
-	if bucket != nil {
-		klog.V(4).Infof("Found existing bucket %+v, current bucket %+v\n", bucket, newBucket)
-		// Bucket already exists, check if it meets the request
-		if err = storage.CompareBuckets(newBucket, bucket); err != nil {
-			return nil, status.Error(codes.AlreadyExists, err.Error())
+	if bucket == nil {
+		// Create the bucket
+		bucket, err = storageService.CreateBucket(ctx, newBucket)
+		if storage.IsAlreadyExistErr(err) {
+			// The bucket was created concurrently, e.g. by the previous leader of the provisioner.
+			klog.V(4).Infof("Bucket %q was created concurrently, checking the existing bucket", newBucket.Name)
+			bucket, err = storageService.GetBucket(ctx, newBucket)
 		}
-	} else {
-		// Add labels
-		labels, err := extractLabels(param, s.driver.config.Name)
 		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, err.Error())
+			return nil, status.Error(storageErrorCode(err), err.Error())
 		}
-		newBucket.Labels = labels
+	}
 
-		// Create the bucket
-		var createErr error
-		bucket, createErr = storageService.CreateBucket(ctx, newBucket)
-		if createErr != nil {
-			return nil, status.Error(codes.Internal, createErr.Error())
-		}
+	klog.V(4).Infof("Found bucket %+v, requested bucket %+v", bucket, newBucket)
+	if err := checkBucketCreatedForVolume(bucket, newBucket); err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
 	}
-	resp := &csi.CreateVolumeResponse{Volume: bucketToCSIVolume(bucket)}
+
+	// The bucket attributes do not have the size, so the requested size is returned.
+	resp := &csi.CreateVolumeResponse{Volume: bucketToCSIVolume(newBucket)}
 
 	return resp, nil
 }
 
+// checkBucketCreatedForVolume returns an error if the existing bucket was not created by the driver for the requested volume,
+// so that the retries of CreateVolume succeed, and a bucket of another user is never provisioned as a volume.
+func checkBucketCreatedForVolume(existing, requested *storage.ServiceBucket) error {
+	if existing.Labels[tagKeyCreatedBy] != requested.Labels[tagKeyCreatedBy] {
+		return fmt.Errorf("bucket %q already exists and was not created by the CSI driver", requested.Name)
+	}
+
+	if volumeName, ok := requested.Labels[tagKeyCreatedForVolumeName]; ok && existing.Labels[tagKeyCreatedForVolumeName] != volumeName {
+		return fmt.Errorf("bucket %q already exists and was created for volume %q", requested.Name, existing.Labels[tagKeyCreatedForVolumeName])
+	}
+
+	// The buckets created before the project and capacity labels were added are not checked.
+	if project, ok := existing.Labels[tagKeyProjectID]; ok && project != requested.Project {
+		return fmt.Errorf("bucket %q already exists in a different project %q", requested.Name, project)
+	}
+
+	if requested.Location != "" && !strings.EqualFold(existing.Location, requested.Location) {
+		return fmt.Errorf("bucket %q already exists in a different location %q", requested.Name, existing.Location)
+	}
+
+	if capacity, ok := existing.Labels[tagKeyCapacityBytes]; ok && capacity != requested.Labels[tagKeyCapacityBytes] {
+		return fmt.Errorf("bucket %q already exists with a different capacity of %v bytes", requested.Name, capacity)
+	}
+
+	return nil
+}
+
 func (s *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 	// Validate arguments
 	volumeID := req.GetVolumeId()
@@ -200,19 +238,20 @@ func (s *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolu
 
 	storageService, err := s.prepareStorageService(ctx, req.GetSecrets())
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "failed to prepare storage service: %v", err)
+		return nil, err
 	}
 
 	// Delete the volume
 	err = storageService.DeleteBucket(ctx, &storage.ServiceBucket{Name: volumeID})
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(storageErrorCode(err), err.Error())
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
 }
 
 // prepareStorageService prepares the GCS Storage Service using CreateVolume/DeleteVolume sercets.
+// The returned error is a gRPC status error: InvalidArgument if a secret is missing, Unauthenticated otherwise.
 func (s *controllerServer) prepareStorageService(ctx context.Context, secrets map[string]string) (storage.Service, error) {
 	serviceAccountName, ok := secrets["serviceAccountName"]
 	if !ok {
@@ -224,9 +263,9 @@ func (s *controllerServer) prepareStorageService(ctx context.Context, secrets ma
 	}
 
 	ts := s.driver.config.TokenManager.GetTokenSourceFromK8sServiceAccount(serviceAccountNamespace, serviceAccountName, "", s.driver.config.TsEndpoint)
-	storageService, err := s.storageServiceManager.SetupService(ctx, ts, s.driver.config.StorageEndpoint)
+	storageService, err := s.storageServiceManager.SetupService(ctx, ts, s.driver.config.StorageEndpoint, s.driver.config.QuotaProject)
 	if err != nil {
-		return nil, fmt.Errorf("storage service manager failed to setup service: %w", err)
+		return nil, status.Errorf(codes.Unauthenticated, "failed to prepare storage service: storage service manager failed to setup service: %v", err)
 	}
 
 	return storageService, nil
@@ -288,7 +327,7 @@ func extractLabels(parameters map[string]string, driverName string) (map[string]
 			labels[tagKeyCreatedForClaimNamespace] = v
 		case ParameterKeyPVName:
 			labels[tagKeyCreatedForVolumeName] = v
-		case ParameterKeyLabels:
+		case volumespec.ParameterKeyLabels:
 			var err error
 			scLabels, err = util.ConvertLabelsStringToMap(v)
 			if err != nil {
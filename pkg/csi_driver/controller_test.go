@@ -19,10 +19,12 @@ package driver
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
@@ -42,11 +44,30 @@ func initTestController(t *testing.T) csi.ControllerServer {
 
 func TestCreateVolume(t *testing.T) {
 	t.Parallel()
+	testVolumeCapabilities := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	testSecrets := map[string]string{
+		"projectID":               "test-project",
+		"serviceAccountName":      "test-sa-name",
+		"serviceAccountNamespace": "test-sa-namespace",
+	}
+	// The created-by label of the test driver.
+	testCreatedBy := "test-driver"
+
 	cases := []struct {
-		name      string
-		req       *csi.CreateVolumeRequest
-		resp      *csi.CreateVolumeResponse
-		expectErr error
+		name           string
+		existingBucket *storage.ServiceBucket
+		req            *csi.CreateVolumeRequest
+		resp           *csi.CreateVolumeResponse
+		expectErr      error
 	}{
 		{
 			name: "valid defaults",
@@ -75,6 +96,89 @@ func TestCreateVolume(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "retry after the bucket was created for the volume",
+			existingBucket: &storage.ServiceBucket{
+				Name:   testVolumeID,
+				Labels: map[string]string{tagKeyCreatedBy: testCreatedBy, tagKeyCreatedForVolumeName: testVolumeID},
+			},
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            testSecrets,
+				Parameters:         map[string]string{ParameterKeyPVName: testVolumeID},
+			},
+			resp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					CapacityBytes: 1 * util.Mb,
+					VolumeId:      testVolumeID,
+				},
+			},
+		},
+		{
+			name: "retry with a different capacity",
+			existingBucket: &storage.ServiceBucket{
+				Name:   testVolumeID,
+				Labels: map[string]string{tagKeyCreatedBy: testCreatedBy, tagKeyCreatedForVolumeName: testVolumeID, tagKeyCapacityBytes: "1048576"},
+			},
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 2 * util.Mb},
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            testSecrets,
+				Parameters:         map[string]string{ParameterKeyPVName: testVolumeID},
+			},
+			expectErr: status.Error(codes.AlreadyExists, fmt.Sprintf("bucket %q already exists with a different capacity of %v bytes", testVolumeID, "1048576")),
+		},
+		{
+			name: "retry with a different project",
+			existingBucket: &storage.ServiceBucket{
+				Name:   testVolumeID,
+				Labels: map[string]string{tagKeyCreatedBy: testCreatedBy, tagKeyCreatedForVolumeName: testVolumeID, tagKeyProjectID: "other-project"},
+			},
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            testSecrets,
+				Parameters:         map[string]string{ParameterKeyPVName: testVolumeID},
+			},
+			expectErr: status.Error(codes.AlreadyExists, fmt.Sprintf("bucket %q already exists in a different project %q", testVolumeID, "other-project")),
+		},
+		{
+			name: "existing bucket not created by the driver",
+			existingBucket: &storage.ServiceBucket{
+				Name: testVolumeID,
+			},
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            testSecrets,
+			},
+			expectErr: status.Error(codes.AlreadyExists, fmt.Sprintf("bucket %q already exists and was not created by the CSI driver", testVolumeID)),
+		},
+		{
+			name: "existing bucket created for another volume",
+			existingBucket: &storage.ServiceBucket{
+				Name:   testVolumeID,
+				Labels: map[string]string{tagKeyCreatedBy: testCreatedBy, tagKeyCreatedForVolumeName: "other-volume"},
+			},
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            testSecrets,
+				Parameters:         map[string]string{ParameterKeyPVName: testVolumeID},
+			},
+			expectErr: status.Error(codes.AlreadyExists, fmt.Sprintf("bucket %q already exists and was created for volume %q", testVolumeID, "other-volume")),
+		},
+		{
+			name: "missing service account secret",
+			req: &csi.CreateVolumeRequest{
+				Name:               testVolumeID,
+				VolumeCapabilities: testVolumeCapabilities,
+				Secrets:            map[string]string{"projectID": "test-project", "serviceAccountNamespace": "test-sa-namespace"},
+			},
+			expectErr: status.Error(codes.InvalidArgument, "serviceAccountName must be provided in secret"),
+		},
 		{
 			name: "empty name",
 			req: &csi.CreateVolumeRequest{
@@ -95,6 +199,15 @@ func TestCreateVolume(t *testing.T) {
 
 	for _, test := range cases {
 		cs := initTestController(t)
+		if test.existingBucket != nil {
+			ss, err := cs.(*controllerServer).storageServiceManager.SetupServiceWithDefaultCredential(context.TODO(), "")
+			if err != nil {
+				t.Fatalf("test %q failed to set up the storage service: %v", test.name, err)
+			}
+			if _, err := ss.CreateBucket(context.TODO(), test.existingBucket); err != nil {
+				t.Fatalf("test %q failed to create the bucket: %v", test.name, err)
+			}
+		}
 		resp, err := cs.CreateVolume(context.TODO(), test.req)
 		if test.expectErr == nil && err != nil {
 			t.Errorf("test %q failed:\ngot error %q,\nexpected error nil", test.name, err)
@@ -0,0 +1,308 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"k8s.io/klog/v2"
+	mount "k8s.io/mount-utils"
+)
+
+// The file descriptor handoff status of a volume, derived from the files in the sidecar container volume.
+const (
+	// fdStatusWaiting means the socket exists, and the sidecar container has not received the file descriptor.
+	fdStatusWaiting = "waiting"
+	// fdStatusReceived means the sidecar container received the file descriptor, and gcsfuse is not ready yet.
+	fdStatusReceived = "received"
+	// fdStatusReady means gcsfuse is serving the file system.
+	fdStatusReady = "ready"
+	// fdStatusNone means the fuse file system is not mounted, so no file descriptor is opened.
+	fdStatusNone = "none"
+	// fdStatusUnknown means the sidecar container volume of the target path cannot be found.
+	fdStatusUnknown = "unknown"
+)
+
+const stateSocketPath = "/debug/state"
+
+// nodeState is a snapshot of the node server state for troubleshooting wedged mounts.
+type nodeState struct {
+	Timestamp          time.Time     `json:"timestamp"`
+	NodeID             string        `json:"nodeID"`
+	DriverVersion      string        `json:"driverVersion"`
+	InFlightOperations []string      `json:"inFlightOperations"`
+	Volumes            []volumeState `json:"volumes"`
+}
+
+// volumeState describes a gcsfuse volume mounted on the node.
+type volumeState struct {
+	TargetPath        string `json:"targetPath"`
+	PodUID            string `json:"podUID"`
+	VolumeName        string `json:"volumeName"`
+	Bucket            string `json:"bucket"`
+	Mounted           bool   `json:"mounted"`
+	FDStatus          string `json:"fdStatus"`
+	SocketPath        string `json:"socketPath"`
+	SocketExists      bool   `json:"socketExists"`
+	SidecarError      string `json:"sidecarError,omitempty"`
+	LastMountError    string `json:"lastMountError,omitempty"`
+	MountFailureCount int    `json:"mountFailureCount,omitempty"`
+	OperationPending  bool   `json:"operationPending"`
+}
+
+// dumpState collects the current mounts, in-flight operations, socket paths, and per-volume status.
+// The volumes failing to mount before the fuse file system is mounted are listed with their last mount error.
+func (s *nodeServer) dumpState() (*nodeState, error) {
+	mps, err := s.mounter.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	inFlight := s.volumeLocks.List()
+	pending := map[string]bool{}
+	for _, p := range inFlight {
+		pending[p] = true
+	}
+
+	state := &nodeState{
+		Timestamp:          time.Now(),
+		NodeID:             s.driver.config.NodeID,
+		DriverVersion:      s.driver.config.Version,
+		InFlightOperations: inFlight,
+		Volumes:            []volumeState{},
+	}
+
+	mountErrors := s.mountErrors.list()
+	for _, mp := range mps {
+		if !strings.HasPrefix(mp.Type, "fuse") {
+			continue
+		}
+
+		vs, err := newVolumeState(mp.Path)
+		if err != nil {
+			continue
+		}
+		vs.Bucket = mp.Device
+		vs.Mounted = true
+		vs.OperationPending = pending[mp.Path]
+		if r, ok := mountErrors[mp.Path]; ok {
+			vs.LastMountError = r.err.Error()
+			vs.MountFailureCount = r.count
+			delete(mountErrors, mp.Path)
+		}
+
+		state.Volumes = append(state.Volumes, vs)
+	}
+
+	failedTargetPaths := make([]string, 0, len(mountErrors))
+	for targetPath := range mountErrors {
+		failedTargetPaths = append(failedTargetPaths, targetPath)
+	}
+	sort.Strings(failedTargetPaths)
+	for _, targetPath := range failedTargetPaths {
+		vs, err := newVolumeState(targetPath)
+		if err != nil {
+			continue
+		}
+		vs.FDStatus = fdStatusNone
+		vs.OperationPending = pending[targetPath]
+		vs.LastMountError = mountErrors[targetPath].err.Error()
+		vs.MountFailureCount = mountErrors[targetPath].count
+
+		state.Volumes = append(state.Volumes, vs)
+	}
+
+	return state, nil
+}
+
+// newVolumeState returns the state of the volume at the target path from the files in the sidecar container volume.
+func newVolumeState(targetPath string) (volumeState, error) {
+	podUID, volumeName, err := util.ParsePodIDVolumeFromTargetpath(targetPath)
+	if err != nil {
+		return volumeState{}, err
+	}
+
+	vs := volumeState{
+		TargetPath: targetPath,
+		PodUID:     podUID,
+		VolumeName: volumeName,
+		FDStatus:   fdStatusUnknown,
+	}
+
+	emptyDirBasePath, err := util.PrepareEmptyDir(targetPath, false)
+	if err != nil {
+		return vs, nil
+	}
+
+	vs.SocketPath = emptyDirBasePath + "/socket"
+	_, err = os.Stat(vs.SocketPath)
+	vs.SocketExists = err == nil
+	if errMsg, err := os.ReadFile(emptyDirBasePath + "/error"); err == nil {
+		vs.SidecarError = summarizeSidecarError(string(errMsg))
+	}
+
+	// The sidecar container deletes the socket after receiving the file descriptor.
+	switch _, err := os.Stat(filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName)); {
+	case vs.SocketExists:
+		vs.FDStatus = fdStatusWaiting
+	case err == nil:
+		vs.FDStatus = fdStatusReady
+	default:
+		vs.FDStatus = fdStatusReceived
+	}
+
+	return vs, nil
+}
+
+// DumpState returns the node server state as JSON.
+func (driver *GCSDriver) DumpState() ([]byte, error) {
+	s, ok := driver.ns.(*nodeServer)
+	if !ok {
+		return nil, fmt.Errorf("the node service is not running")
+	}
+
+	state, err := s.dumpState()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
+
+// LogState writes the node server state as JSON to the logs.
+func (driver *GCSDriver) LogState() {
+	state, err := driver.DumpState()
+	if err != nil {
+		klog.Errorf("failed to dump the node state: %v", err)
+
+		return
+	}
+
+	klog.Infof("node state: %s", state)
+}
+
+// StateHandler returns an HTTP handler that serves the node server state as JSON.
+func (driver *GCSDriver) StateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		state, err := driver.DumpState()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(state); err != nil {
+			klog.Errorf("failed to write the node state: %v", err)
+		}
+	})
+}
+
+// ServeStateSocket serves the node server state and the mounted volumes as JSON on the unix domain socket,
+// which are read by the --dump-state and --list-volumes modes.
+// The socket is only reachable from inside the node driver container, so reading it requires the permission to exec into the node driver Pods.
+func (driver *GCSDriver) ServeStateSocket(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the stale state socket %q: %w", socketPath, err)
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on the state socket %q: %w", socketPath, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(stateSocketPath, driver.StateHandler())
+	mux.Handle(volumesSocketPath, driver.VolumesHandler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("failed to serve the node state on %q: %v", socketPath, err)
+		}
+	}()
+
+	return nil
+}
+
+// FetchState reads the node server state from the state socket of the running node driver.
+func FetchState(ctx context.Context, socketPath string) ([]byte, error) {
+	return fetchFromStateSocket(ctx, socketPath, stateSocketPath)
+}
+
+// fetchFromStateSocket reads the path served on the state socket of the running node driver.
+func fetchFromStateSocket(ctx context.Context, socketPath, path string) ([]byte, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the node state from %q: %w", socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the node state from %q: %w", socketPath, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read the node state from %q: %s", socketPath, strings.TrimSpace(string(b)))
+	}
+
+	return b, nil
+}
+
+// DumpLocalState collects the node state from the mounts and the sidecar container files on the node,
+// when the node driver is not running or not responding. The in-flight operations and the mount errors
+// are only known to the running node driver, so they are not included.
+func DumpLocalState(nodeID, version string) ([]byte, error) {
+	s := &nodeServer{
+		driver:      &GCSDriver{config: &GCSDriverConfig{NodeID: nodeID, Version: version}},
+		mounter:     mount.New(""),
+		volumeLocks: util.NewVolumeLocks(),
+	}
+
+	state, err := s.dumpState()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"k8s.io/client-go/util/flowcontrol"
+	mount "k8s.io/mount-utils"
+)
+
+func TestNodeDumpState(t *testing.T) {
+	t.Parallel()
+	base, err := os.MkdirTemp("", "node-dump-state-")
+	if err != nil {
+		t.Fatalf("failed to setup testdir: %v", err)
+	}
+	defer os.RemoveAll(base)
+
+	podDir := filepath.Join(base, "var/lib/kubelet/pods/test-pod-id")
+	healthyTargetPath := filepath.Join(podDir, "volumes/kubernetes.io~csi/healthy-volume/mount")
+	failedTargetPath := filepath.Join(podDir, "volumes/kubernetes.io~csi/failed-volume/mount")
+	notMountedTargetPath := filepath.Join(podDir, "volumes/kubernetes.io~csi/not-mounted-volume/mount")
+
+	// The socket is not consumed by the sidecar container for the failed volume.
+	for _, tp := range []string{healthyTargetPath, failedTargetPath} {
+		emptyDirBasePath, err := util.PrepareEmptyDir(tp, true)
+		if err != nil {
+			t.Fatalf("failed to prepare emptyDir path: %v", err)
+		}
+		if tp == healthyTargetPath {
+			if err := os.WriteFile(filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName), nil, 0o600); err != nil {
+				t.Fatalf("failed to create ready file: %v", err)
+			}
+		}
+		if tp == failedTargetPath {
+			if err := os.WriteFile(emptyDirBasePath+"/socket", nil, 0o600); err != nil {
+				t.Fatalf("failed to create socket file: %v", err)
+			}
+			if err := os.WriteFile(emptyDirBasePath+"/error", []byte("gcsfuse exited with error: signal: killed\n"), 0o600); err != nil {
+				t.Fatalf("failed to create error file: %v", err)
+			}
+		}
+	}
+
+	env := initTestNodeServer(t)
+	env.fm.MountPoints = []mount.MountPoint{
+		{Device: "healthy-bucket", Path: healthyTargetPath, Type: "fuse"},
+		{Device: "failed-bucket", Path: failedTargetPath, Type: "fuse"},
+		{Device: "/dev/sda1", Path: "/var/lib/kubelet", Type: "ext4"},
+	}
+	s, ok := env.ns.(*nodeServer)
+	if !ok {
+		t.Fatalf("failed to cast the node server")
+	}
+	s.volumeLocks.TryAcquire(failedTargetPath)
+	s.mountErrors = newMountErrorTracker(flowcontrol.NewBackOff(time.Second, time.Minute))
+	s.mountErrors.record(context.TODO(), notMountedTargetPath, errors.New("bucket not found"))
+	s.mountErrors.record(context.TODO(), notMountedTargetPath, errors.New("bucket not found"))
+
+	state, err := s.dumpState()
+	if err != nil {
+		t.Fatalf("failed to dump state: %v", err)
+	}
+
+	expectedVolumes := []volumeState{
+		{
+			TargetPath: healthyTargetPath,
+			PodUID:     "test-pod-id",
+			VolumeName: "healthy-volume",
+			Bucket:     "healthy-bucket",
+			Mounted:    true,
+			FDStatus:   fdStatusReady,
+			SocketPath: filepath.Join(podDir, "volumes/kubernetes.io~empty-dir/gke-gcsfuse-tmp/.volumes/healthy-volume/socket"),
+		},
+		{
+			TargetPath:       failedTargetPath,
+			PodUID:           "test-pod-id",
+			VolumeName:       "failed-volume",
+			Bucket:           "failed-bucket",
+			Mounted:          true,
+			FDStatus:         fdStatusWaiting,
+			SocketPath:       filepath.Join(podDir, "volumes/kubernetes.io~empty-dir/gke-gcsfuse-tmp/.volumes/failed-volume/socket"),
+			SocketExists:     true,
+			SidecarError:     "gcsfuse exited with error: signal: killed",
+			OperationPending: true,
+		},
+		{
+			TargetPath:        notMountedTargetPath,
+			PodUID:            "test-pod-id",
+			VolumeName:        "not-mounted-volume",
+			FDStatus:          fdStatusNone,
+			SocketPath:        filepath.Join(podDir, "volumes/kubernetes.io~empty-dir/gke-gcsfuse-tmp/.volumes/not-mounted-volume/socket"),
+			LastMountError:    "bucket not found",
+			MountFailureCount: 2,
+		},
+	}
+	if !reflect.DeepEqual(state.Volumes, expectedVolumes) {
+		t.Errorf("got volumes %+v, expected %+v", state.Volumes, expectedVolumes)
+	}
+	if !reflect.DeepEqual(state.InFlightOperations, []string{failedTargetPath}) {
+		t.Errorf("got in-flight operations %v, expected %v", state.InFlightOperations, []string{failedTargetPath})
+	}
+}
+
+func TestServeStateSocket(t *testing.T) {
+	t.Parallel()
+	mounter := mount.NewFakeMounter([]mount.MountPoint{
+		{Device: "test-bucket", Path: "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/test-volume/mount", Type: "fuse"},
+	})
+	driver := initTestDriver(t, mounter)
+	driver.ns = newNodeServer(driver, mounter)
+
+	socketPath := filepath.Join(t.TempDir(), "state.sock")
+	if err := driver.ServeStateSocket(socketPath); err != nil {
+		t.Fatalf("failed to serve the state socket: %v", err)
+	}
+
+	b, err := FetchState(context.TODO(), socketPath)
+	if err != nil {
+		t.Fatalf("failed to fetch the state: %v", err)
+	}
+
+	state := &nodeState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		t.Fatalf("failed to parse the state: %v", err)
+	}
+	if len(state.Volumes) != 1 || state.Volumes[0].Bucket != "test-bucket" || state.Volumes[0].VolumeName != "test-volume" {
+		t.Errorf("got volumes %+v, expected volume test-volume of bucket test-bucket", state.Volumes)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	troubleshootingDocLink = "https://github.com/GoogleCloudPlatform/gcs-fuse-csi-driver/blob/main/docs/troubleshooting.md"
+
+	// maxSidecarErrorLength caps the sidecar error included in the error message,
+	// so that the FailedMount Pod events do not contain the full gcsfuse usage dump.
+	maxSidecarErrorLength = 512
+)
+
+// mountErrorCategory classifies NodePublishVolume failures,
+// so that the FailedMount Pod events emitted by kubelet are actionable.
+type mountErrorCategory struct {
+	name string
+	hint string
+}
+
+var (
+	mountErrorWorkloadIdentity = &mountErrorCategory{
+		name: "WorkloadIdentityNotConfigured",
+		hint: "make sure Workload Identity is enabled on the cluster and node pool, and the Pod Kubernetes service account is bound to a GCP service account",
+	}
+	mountErrorIAMPermissionDenied = &mountErrorCategory{
+		name: "IAMPermissionDenied",
+		hint: "grant the GCP service account bound to the Pod Kubernetes service account a Cloud Storage role on the bucket, e.g. roles/storage.objectViewer",
+	}
+	mountErrorBucketNotFound = &mountErrorCategory{
+		name: "BucketNotFound",
+		hint: "make sure the bucket exists and the bucket name is specified correctly",
+	}
+	mountErrorSidecarNotInjected = &mountErrorCategory{
+		name: "SidecarNotInjected",
+		hint: "add the annotation gke-gcsfuse/volumes: \"true\" to the Pod",
+	}
+	mountErrorInvalidFlag = &mountErrorCategory{
+		name: "InvalidMountFlag",
+		hint: "remove or fix the invalid gcsfuse flags in mountOptions",
+	}
+	mountErrorSidecarOOM = &mountErrorCategory{
+		name: "SidecarOOM",
+		hint: "increase the sidecar container memory limit using the Pod annotation gke-gcsfuse/memory-limit",
+	}
+	mountErrorHandshakeTimeout = &mountErrorCategory{
+		name: "MountHandshakeTimeout",
+		hint: "check the status and logs of the gke-gcsfuse-sidecar container, and make sure it is not blocked by an init container or a service mesh proxy; recreate the Pod to retry the mount",
+	}
+	mountErrorBucketNotAllowed = &mountErrorCategory{
+		name: "BucketNotAllowed",
+		hint: "ask the cluster administrator to add the bucket to the bucketAllowlist of the GCSFuseCSIDriverConfig",
+	}
+	mountErrorMountOptionNotAllowed = &mountErrorCategory{
+		name: "MountOptionNotAllowed",
+		hint: "remove the mount option, or ask the cluster administrator to add it to the mountOptionAllowlist of the GCSFuseCSIDriverConfig",
+	}
+)
+
+// newMountError returns a gRPC status error whose message contains the error category, a remediation hint, and a docs link.
+func newMountError(code codes.Code, category *mountErrorCategory, format string, a ...interface{}) error {
+	return status.Errorf(code, "[%v] %v. Hint: %v. See %v", category.name, fmt.Sprintf(format, a...), category.hint, troubleshootingDocLink)
+}
+
+// storageErrorCode returns the gRPC code of a Cloud Storage API error.
+// The transient errors are mapped to the codes the CSI sidecars retry, e.g. Unavailable and ResourceExhausted,
+// because the external-provisioner treats the other codes, including Internal, as final.
+func storageErrorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		return s.Code()
+	}
+
+	switch {
+	case storage.IsNotExistErr(err):
+		return codes.NotFound
+	case storage.IsPermissionDeniedErr(err):
+		return codes.PermissionDenied
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return codes.Internal
+	}
+
+	switch {
+	case apiErr.Code == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case apiErr.Code == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case apiErr.Code == http.StatusForbidden:
+		return codes.PermissionDenied
+	case apiErr.Code == http.StatusNotFound:
+		return codes.NotFound
+	case apiErr.Code == http.StatusConflict:
+		// e.g. a bucket being deleted while an object is written to it.
+		return codes.Aborted
+	case apiErr.Code == http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case apiErr.Code == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case apiErr.Code >= http.StatusInternalServerError:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// kubeAPIErrorCode returns the gRPC code of a Kubernetes API server error.
+func kubeAPIErrorCode(err error) codes.Code {
+	switch {
+	case apierrors.IsNotFound(err):
+		return codes.NotFound
+	case apierrors.IsForbidden(err):
+		return codes.PermissionDenied
+	case apierrors.IsTooManyRequests(err):
+		return codes.ResourceExhausted
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err):
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// summarizeSidecarError returns the most relevant line of the sidecar container error output.
+func summarizeSidecarError(errMsg string) string {
+	summary := ""
+	for _, l := range strings.Split(errMsg, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if strings.Contains(l, "Incorrect Usage") {
+			summary = l
+
+			break
+		}
+		summary = l
+	}
+
+	if len(summary) > maxSidecarErrorLength {
+		summary = summary[:maxSidecarErrorLength] + "..."
+	}
+
+	return summary
+}
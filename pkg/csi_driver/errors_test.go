@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestNewMountError(t *testing.T) {
+	t.Parallel()
+	err := newMountError(codes.NotFound, mountErrorBucketNotFound, "failed to get GCS bucket %q", "test-bucket")
+
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("got code %v, expected %v", code, codes.NotFound)
+	}
+
+	msg := status.Convert(err).Message()
+	for _, s := range []string{"[BucketNotFound]", `failed to get GCS bucket "test-bucket"`, mountErrorBucketNotFound.hint, troubleshootingDocLink} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("got message %q, expected it to contain %q", msg, s)
+		}
+	}
+}
+
+func TestSummarizeSidecarError(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name            string
+		errMsg          string
+		expectedSummary string
+	}{
+		{
+			name:            "single line",
+			errMsg:          "signal: killed\n",
+			expectedSummary: "signal: killed",
+		},
+		{
+			name:            "incorrect usage with usage dump",
+			errMsg:          "Incorrect Usage. flag provided but not defined: -foo\n\nNAME:\n   gcsfuse - Mount a GCS bucket\n\nUSAGE:\n   gcsfuse [flags] bucket mountpoint\n",
+			expectedSummary: "Incorrect Usage. flag provided but not defined: -foo",
+		},
+		{
+			name:            "last line is used",
+			errMsg:          "mountWithArgs: error\n  daemonize.Run: readFromProcess: sub-process: exit status 1\n\n",
+			expectedSummary: "daemonize.Run: readFromProcess: sub-process: exit status 1",
+		},
+		{
+			name:            "long line is truncated",
+			errMsg:          strings.Repeat("a", maxSidecarErrorLength+10),
+			expectedSummary: strings.Repeat("a", maxSidecarErrorLength) + "...",
+		},
+	}
+
+	for _, test := range cases {
+		summary := summarizeSidecarError(test.errMsg)
+		if summary != test.expectedSummary {
+			t.Errorf("test %q failed:\ngot summary %q,\nexpected summary %q", test.name, summary, test.expectedSummary)
+		}
+	}
+}
+
+func TestStorageErrorCode(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name         string
+		err          error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "bucket not exist",
+			err:          fmt.Errorf("failed to get bucket: %w", gcs.ErrBucketNotExist),
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "permission denied",
+			err:          errors.New("sa@test-project.iam.gserviceaccount.com does not have storage.objects.list access to the Google Cloud Storage bucket."),
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "deadline exceeded",
+			err:          fmt.Errorf("failed to get bucket: %w", context.DeadlineExceeded),
+			expectedCode: codes.DeadlineExceeded,
+		},
+		{
+			name:         "gRPC status error",
+			err:          status.Error(codes.InvalidArgument, "serviceAccountName must be provided in secret"),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "invalid bucket name",
+			err:          &googleapi.Error{Code: http.StatusBadRequest},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "forbidden",
+			err:          fmt.Errorf("CreateBucket operation failed: %w", &googleapi.Error{Code: http.StatusForbidden}),
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "bucket not empty",
+			err:          &googleapi.Error{Code: http.StatusConflict},
+			expectedCode: codes.Aborted,
+		},
+		{
+			name:         "rate limited",
+			err:          &googleapi.Error{Code: http.StatusTooManyRequests},
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			name:         "server error",
+			err:          &googleapi.Error{Code: http.StatusServiceUnavailable},
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "unknown error",
+			err:          errors.New("unknown error"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, test := range cases {
+		if code := storageErrorCode(test.err); code != test.expectedCode {
+			t.Errorf("test %q failed: got code %v, expected %v", test.name, code, test.expectedCode)
+		}
+	}
+}
+
+func TestKubeAPIErrorCode(t *testing.T) {
+	t.Parallel()
+	podResource := schema.GroupResource{Resource: "pods"}
+	cases := []struct {
+		name         string
+		err          error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "not found",
+			err:          apierrors.NewNotFound(podResource, "test-pod"),
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "forbidden",
+			err:          apierrors.NewForbidden(podResource, "test-pod", errors.New("forbidden")),
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "too many requests",
+			err:          apierrors.NewTooManyRequests("too many requests", 1),
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			name:         "service unavailable",
+			err:          apierrors.NewServiceUnavailable("unavailable"),
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "unknown error",
+			err:          errors.New("unknown error"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, test := range cases {
+		if code := kubeAPIErrorCode(test.err); code != test.expectedCode {
+			t.Errorf("test %q failed: got code %v, expected %v", test.name, code, test.expectedCode)
+		}
+	}
+}
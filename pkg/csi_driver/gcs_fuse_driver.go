@@ -18,19 +18,30 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/auth"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/tracing"
 	"k8s.io/klog/v2"
 	"k8s.io/mount-utils"
 )
 
-const DefaultName = "gcsfuse.csi.storage.gke.io"
+// DefaultName is the default name of the driver, registered with the kubelet and set in the CSIDriver object.
+const DefaultName = volumespec.DriverName
 
 type GCSDriverConfig struct {
 	Name                  string // Driver name
@@ -43,13 +54,64 @@ type GCSDriverConfig struct {
 	Mounter               mount.Interface
 	K8sClients            clientset.Interface
 	SidecarImage          string
-	StorageEndpoint 			string
-	TsEndpoint 						string
+	StorageEndpoint       string
+	TsEndpoint            string
+	QuotaProject          string
+	// EnableRegionalEndpoint makes gcsfuse use the regional endpoint of buckets in a single region.
+	EnableRegionalEndpoint bool
+	// EnableTokenDownscoping limits the tokens of the node driver bucket checks to reading the volume bucket,
+	// and the tokens served to the sidecar containers to the bucket and the access of the volume, with a Credential Access Boundary.
+	EnableTokenDownscoping bool
+	// BucketCacheTTL is the TTL of the cached bucket metadata lookups. Zero disables the cache.
+	BucketCacheTTL time.Duration
+	MetricsManager *metrics.Manager
+	// PodNamespace and PodName identify the driver Pod, used to report the container restarts of the node driver,
+	// and to elect the leader of the controller replicas.
+	PodNamespace string
+	PodName      string
+	// EnableIdentityAuditEvents records an event on the workload Pod with the GCP identity chain used for each volume mount.
+	EnableIdentityAuditEvents bool
+	// EnableMountConfigEvents records an event on the workload Pod with the resolved mount options of each volume mount.
+	EnableMountConfigEvents bool
+	// MountErrorBackoffMax is the maximum backoff of the retries of repeatedly failing mounts. Zero disables the backoff.
+	MountErrorBackoffMax time.Duration
+	// DriverConfig provides the cluster-wide bucket and mount option policies, and the default mount options.
+	// If nil, all the buckets and mount options are allowed.
+	DriverConfig *driverconfig.Watcher
+	// EnableMachineTypeDefaults applies the recommended gcsfuse mount options of the node machine family
+	// to the volumes that do not set them.
+	EnableMachineTypeDefaults bool
+	// EnableReadyCondition sets the gke-gcsfuse/volumes-ready condition of the Pods once all their gcsfuse volumes are mounted.
+	EnableReadyCondition bool
+	// SharedCacheDir is the node directory shared as the gcsfuse cache directory by the read-only volumes
+	// with the fileCacheShared volume attribute. If empty, the volume attribute is not supported.
+	SharedCacheDir string
+	// SharedCacheMaxSizeMB caps the file-cache-max-size-mb mount option of the volumes using the shared cache directory.
+	// Zero keeps the mount option of the volume.
+	SharedCacheMaxSizeMB int
+	// OrphanCleanupInterval is the interval of removing the sidecar volume directories of the Pods that no longer exist.
+	// Zero disables the cleanup.
+	OrphanCleanupInterval time.Duration
+	// PVStatusInterval is the interval of annotating the PersistentVolumes of the driver with the attributes of their buckets.
+	// Zero disables the annotations.
+	PVStatusInterval time.Duration
+	// ThrottlingCheckInterval is the interval of reporting the CPU throttling of the sidecar containers on the node as Pod events.
+	// Zero disables the events.
+	ThrottlingCheckInterval time.Duration
+	// MaxConcurrentUnmounts is the maximum number of the volumes unmounted concurrently by NodeUnpublishVolume.
+	MaxConcurrentUnmounts int
+	// KubeletRootDir is the root directory of the kubelet, where the pods directory has the volumes of the Pods on the node.
+	KubeletRootDir string
+	// TracerProvider traces the CSI calls, whose trace IDs are attached to the latency metrics as exemplars.
+	// If nil, the CSI calls are not traced.
+	TracerProvider trace.TracerProvider
 }
 
 type GCSDriver struct {
 	config *GCSDriverConfig
 
+	recorder record.EventRecorder
+
 	// CSI RPC servers
 	ids csi.IdentityServer
 	ns  csi.NodeServer
@@ -89,6 +151,7 @@ func NewGCSDriver(config *GCSDriverConfig) (*GCSDriver, error) {
 	// Setup RPC servers
 	driver.ids = newIdentityServer(driver)
 	if config.RunNode {
+		driver.recorder = config.K8sClients.NewEventRecorder(config.Name)
 		nscap := []csi.NodeServiceCapability_RPC_Type{}
 		driver.ns = newNodeServer(driver, config.Mounter)
 		driver.addNodeServiceCapabilities(nscap)
@@ -190,7 +253,38 @@ func (driver *GCSDriver) ValidateControllerServiceRequest(c csi.ControllerServic
 func (driver *GCSDriver) Run(endpoint string) {
 	klog.Infof("Running driver: %v", driver.config.Name)
 
-	s := NewNonBlockingGRPCServer()
+	interceptors := []grpc.UnaryServerInterceptor{}
+	// The tracing interceptor starts the span before the metrics interceptor observes the latency with the trace ID.
+	if driver.config.TracerProvider != nil {
+		interceptors = append(interceptors, otelgrpc.UnaryServerInterceptor(
+			otelgrpc.WithTracerProvider(driver.config.TracerProvider), otelgrpc.WithPropagators(tracing.Propagators())))
+	}
+	if driver.config.MetricsManager != nil {
+		interceptors = append(interceptors, driver.config.MetricsManager.UnaryServerInterceptor(driver.config.Name))
+	}
+
+	if driver.config.RunNode {
+		go newNodeHealthMonitor(driver.config, driver.recorder).run(context.Background())
+		if driver.config.OrphanCleanupInterval > 0 {
+			go newOrphanedDirJanitor(driver.config).run(context.Background(), driver.config.OrphanCleanupInterval)
+		}
+		if driver.config.ThrottlingCheckInterval > 0 {
+			go newSidecarThrottlingReporter(driver.config, driver.recorder).run(context.Background(), driver.config.ThrottlingCheckInterval)
+		}
+	}
+
+	if driver.config.RunController && driver.config.PVStatusInterval > 0 {
+		// Only the leader of the controller replicas updates the PersistentVolumes.
+		if driver.config.PodNamespace == "" || driver.config.PodName == "" {
+			klog.Error("the POD_NAMESPACE and POD_NAME environment variables are not set, the PersistentVolume status is not updated")
+		} else {
+			go driver.config.K8sClients.RunWithLeaderElection(context.Background(), driver.config.PodNamespace, pvStatusLeaseName, driver.config.PodName, func(ctx context.Context) {
+				newPVStatusUpdater(driver.config).run(ctx)
+			})
+		}
+	}
+
+	s := NewNonBlockingGRPCServer(interceptors...)
 	s.Start(endpoint, driver.ids, driver.cs, driver.ns)
 	s.Wait()
 }
@@ -70,21 +70,27 @@ func TestGetPluginCapabilities(t *testing.T) {
 		t.Fatalf("GetPluginCapabilities resp is nil")
 	}
 
-	if len(resp.Capabilities) != 1 {
+	expectedServiceTypes := []csi.PluginCapability_Service_Type{
+		csi.PluginCapability_Service_CONTROLLER_SERVICE,
+		csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+	}
+	if len(resp.Capabilities) != len(expectedServiceTypes) {
 		t.Fatalf("returned %v capabilities", len(resp.Capabilities))
 	}
 
-	if resp.Capabilities[0].Type == nil {
-		t.Fatalf("returned nil capability type")
-	}
+	for i, expected := range expectedServiceTypes {
+		if resp.Capabilities[i].Type == nil {
+			t.Fatalf("returned nil capability type")
+		}
 
-	service := resp.Capabilities[0].GetService()
-	if service == nil {
-		t.Fatalf("returned nil capability service")
-	}
+		service := resp.Capabilities[i].GetService()
+		if service == nil {
+			t.Fatalf("returned nil capability service")
+		}
 
-	if serviceType := service.GetType(); serviceType != csi.PluginCapability_Service_CONTROLLER_SERVICE {
-		t.Fatalf("returned %v capability service", serviceType)
+		if serviceType := service.GetType(); serviceType != expected {
+			t.Fatalf("returned %v capability service, expected %v", serviceType, expected)
+		}
 	}
 }
 
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultKubeletRootDir is the default value of the kubelet --root-dir flag.
+const DefaultKubeletRootDir = "/var/lib/kubelet"
+
+// kubeletRootDirs are the kubelet root directories of the Kubernetes distributions, in the order of detection.
+var kubeletRootDirs = []string{
+	DefaultKubeletRootDir,
+	// microk8s
+	"/var/snap/microk8s/common/var/lib/kubelet",
+	// k0s
+	"/var/lib/k0s/kubelet",
+}
+
+// DetectKubeletRootDir returns the first known kubelet root directory with a pods directory mounted in the node driver container,
+// or the default kubelet root directory if none is found.
+func DetectKubeletRootDir() string {
+	return detectKubeletRootDir("/", kubeletRootDirs)
+}
+
+func detectKubeletRootDir(root string, candidates []string) string {
+	for _, dir := range candidates {
+		if info, err := os.Stat(filepath.Join(root, dir, "pods")); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+
+	return DefaultKubeletRootDir
+}
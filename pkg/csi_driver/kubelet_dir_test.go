@@ -0,0 +1,66 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectKubeletRootDir(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		podsDirs []string
+		expected string
+	}{
+		{
+			name:     "no pods directory",
+			expected: DefaultKubeletRootDir,
+		},
+		{
+			name:     "default kubelet root directory",
+			podsDirs: []string{"/var/lib/kubelet/pods"},
+			expected: DefaultKubeletRootDir,
+		},
+		{
+			name:     "microk8s kubelet root directory",
+			podsDirs: []string{"/var/snap/microk8s/common/var/lib/kubelet/pods"},
+			expected: "/var/snap/microk8s/common/var/lib/kubelet",
+		},
+		{
+			name:     "default kubelet root directory takes precedence",
+			podsDirs: []string{"/var/lib/k0s/kubelet/pods", "/var/lib/kubelet/pods"},
+			expected: DefaultKubeletRootDir,
+		},
+	}
+
+	for _, tc := range testCases {
+		root := t.TempDir()
+		for _, dir := range tc.podsDirs {
+			if err := os.MkdirAll(filepath.Join(root, dir), 0o750); err != nil {
+				t.Fatalf("failed to create the pods directory: %v", err)
+			}
+		}
+
+		if got := detectKubeletRootDir(root, kubeletRootDirs); got != tc.expected {
+			t.Errorf("test %q failed: got %q, expected %q", tc.name, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	nodeLabelInstanceType           = v1.LabelInstanceTypeStable
+	nodeLabelInstanceTypeDeprecated = v1.LabelInstanceType
+)
+
+var (
+	// acceleratorMountOptions follow the gcsfuse tuning guidance for AI/ML training and serving workloads:
+	// many parallel readers of large objects, so more connections, a larger sequential read size,
+	// and a larger stat cache for the datasets with many files.
+	acceleratorMountOptions = []string{
+		"max-conns-per-host=100",
+		"sequential-read-size-mb=1024",
+		"stat-cache-capacity=100000",
+	}
+
+	// highPerformanceMountOptions follow the gcsfuse tuning guidance for the compute and memory optimized machines,
+	// which have the network bandwidth to serve more parallel requests than the gcsfuse defaults allow.
+	highPerformanceMountOptions = []string{
+		"max-conns-per-host=50",
+		"stat-cache-capacity=20000",
+	}
+
+	// machineFamilyMountOptions are the recommended gcsfuse mount options of each machine family.
+	// The machine families not listed here, e.g. the shared-core and general-purpose machines, use the gcsfuse defaults.
+	machineFamilyMountOptions = map[string][]string{
+		"a2":    acceleratorMountOptions,
+		"a3":    acceleratorMountOptions,
+		"g2":    acceleratorMountOptions,
+		"ct4p":  acceleratorMountOptions,
+		"ct5e":  acceleratorMountOptions,
+		"ct5l":  acceleratorMountOptions,
+		"ct5lp": acceleratorMountOptions,
+		"ct5p":  acceleratorMountOptions,
+		"c2":    highPerformanceMountOptions,
+		"c2d":   highPerformanceMountOptions,
+		"c3":    highPerformanceMountOptions,
+		"c3d":   highPerformanceMountOptions,
+		"h3":    highPerformanceMountOptions,
+		"m1":    highPerformanceMountOptions,
+		"m2":    highPerformanceMountOptions,
+		"m3":    highPerformanceMountOptions,
+	}
+)
+
+// machineFamily returns the machine family of the machine type, e.g. a3 for a3-highgpu-8g.
+func machineFamily(machineType string) string {
+	family, _, _ := strings.Cut(strings.ToLower(machineType), "-")
+
+	return family
+}
+
+// machineTypeMountOptions returns the recommended gcsfuse mount options of the machine family of the node.
+// The machine type is read from the instance type label, which the cloud provider sets from the instance metadata.
+// Failing to get the node does not fail the mount, gcsfuse uses its defaults.
+func (s *nodeServer) machineTypeMountOptions(ctx context.Context) []string {
+	node, err := s.k8sClients.GetNode(ctx, s.driver.config.NodeID)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "failed to get the node, skipping the machine type mount options")
+
+		return nil
+	}
+
+	machineType := node.Labels[nodeLabelInstanceType]
+	if machineType == "" {
+		machineType = node.Labels[nodeLabelInstanceTypeDeprecated]
+	}
+
+	return machineFamilyMountOptions[machineFamily(machineType)]
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// mountErrorInitialBackoff is the backoff after the first mount failure of a target path.
+	mountErrorInitialBackoff = time.Second
+	// mountErrorRecordTTL is how long the mount error of a target path is kept after the last retry.
+	mountErrorRecordTTL = 10 * time.Minute
+)
+
+// mountErrorTracker suppresses the retries of repeatedly failing mounts with exponential backoff.
+// A suppressed retry returns the last error unchanged without calling the GCS, STS, or Kubernetes APIs,
+// so the identical FailedMount events are aggregated by the kubelet into one event with a count and last seen time.
+type mountErrorTracker struct {
+	backoff *flowcontrol.Backoff
+
+	mu     sync.Mutex
+	errors map[string]*mountErrorRecord
+}
+
+type mountErrorRecord struct {
+	err       error
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+func newMountErrorTracker(backoff *flowcontrol.Backoff) *mountErrorTracker {
+	return &mountErrorTracker{
+		backoff: backoff,
+		errors:  map[string]*mountErrorRecord{},
+	}
+}
+
+// suppressedError returns the last mount error of the target path if the target path is in backoff.
+func (t *mountErrorTracker) suppressedError(targetPath string) error {
+	if t == nil || !t.backoff.IsInBackOffSinceUpdate(targetPath, t.backoff.Clock.Now()) {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.errors[targetPath]
+	if !ok {
+		return nil
+	}
+	metrics.MountRetrySuppressedTotal.Inc()
+
+	return r.err
+}
+
+// record updates the backoff of the target path with the mount result.
+func (t *mountErrorTracker) record(ctx context.Context, targetPath string, err error) {
+	if t == nil || targetPath == "" {
+		return
+	}
+
+	now := t.backoff.Clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil {
+		t.forgetLocked(targetPath)
+
+		return
+	}
+
+	// Do not back off the retries rejected because of a concurrent operation on the same target path.
+	if status.Code(err) == codes.Aborted {
+		return
+	}
+
+	t.backoff.Next(targetPath, now)
+	r, ok := t.errors[targetPath]
+	if !ok || r.err.Error() != err.Error() {
+		r = &mountErrorRecord{firstSeen: now}
+		t.errors[targetPath] = r
+	}
+	r.err = err
+	r.count++
+	r.lastSeen = now
+
+	klog.FromContext(ctx).Info("mount failed, suppressing the retries with backoff",
+		"failureCount", r.count, "firstSeen", r.firstSeen, "backoff", t.backoff.Get(targetPath))
+
+	t.gcLocked(now)
+}
+
+// forget drops the mount error of the target path, e.g. when the volume is unpublished.
+func (t *mountErrorTracker) forget(targetPath string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forgetLocked(targetPath)
+}
+
+// list returns a copy of the mount errors of the target paths.
+func (t *mountErrorTracker) list() map[string]mountErrorRecord {
+	records := map[string]mountErrorRecord{}
+	if t == nil {
+		return records
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for targetPath, r := range t.errors {
+		records[targetPath] = *r
+	}
+
+	return records
+}
+
+func (t *mountErrorTracker) forgetLocked(targetPath string) {
+	delete(t.errors, targetPath)
+	t.backoff.DeleteEntry(targetPath)
+}
+
+// gcLocked drops the mount errors of the target paths that are not retried anymore, e.g. the Pod was deleted.
+func (t *mountErrorTracker) gcLocked(now time.Time) {
+	for targetPath, r := range t.errors {
+		if now.Sub(r.lastSeen) > mountErrorRecordTTL {
+			t.forgetLocked(targetPath)
+		}
+	}
+	t.backoff.GC()
+}
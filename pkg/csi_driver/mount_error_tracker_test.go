@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/util/flowcontrol"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestMountErrorTracker(t *testing.T) {
+	t.Parallel()
+	targetPath := "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/test-volume/mount"
+	mountErr := status.Error(codes.NotFound, "bucket not found")
+	abortedErr := status.Error(codes.Aborted, "operation already exists")
+
+	testCases := []struct {
+		name                string
+		errs                []error
+		elapsed             time.Duration
+		expectSuppressedErr error
+	}{
+		{
+			name:                "should suppress the retry within the backoff",
+			errs:                []error{mountErr},
+			elapsed:             500 * time.Millisecond,
+			expectSuppressedErr: mountErr,
+		},
+		{
+			name:    "should not suppress the retry after the backoff",
+			errs:    []error{mountErr},
+			elapsed: 2 * time.Second,
+		},
+		{
+			name:                "should double the backoff of repeating failures",
+			errs:                []error{mountErr, mountErr},
+			elapsed:             1500 * time.Millisecond,
+			expectSuppressedErr: mountErr,
+		},
+		{
+			name:    "should reset the backoff after a successful mount",
+			errs:    []error{mountErr, nil},
+			elapsed: 0,
+		},
+		{
+			name:    "should not back off aborted operations",
+			errs:    []error{abortedErr},
+			elapsed: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		clock := testingclock.NewFakeClock(time.Now())
+		tracker := newMountErrorTracker(flowcontrol.NewFakeBackOff(time.Second, time.Minute, clock))
+		for _, err := range tc.errs {
+			tracker.record(context.TODO(), targetPath, err)
+		}
+		clock.Step(tc.elapsed)
+
+		if err := tracker.suppressedError(targetPath); err != tc.expectSuppressedErr { //nolint:errorlint
+			t.Errorf("got suppressed error %v, expected %v", err, tc.expectSuppressedErr)
+		}
+	}
+}
+
+func TestMountErrorTrackerForget(t *testing.T) {
+	t.Parallel()
+	targetPath := "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/test-volume/mount"
+	clock := testingclock.NewFakeClock(time.Now())
+	tracker := newMountErrorTracker(flowcontrol.NewFakeBackOff(time.Second, time.Minute, clock))
+
+	tracker.record(context.TODO(), targetPath, status.Error(codes.NotFound, "bucket not found"))
+	tracker.forget(targetPath)
+	if err := tracker.suppressedError(targetPath); err != nil {
+		t.Errorf("got suppressed error %v after the target path was unpublished, expected nil", err)
+	}
+
+	tracker.record(context.TODO(), targetPath, status.Error(codes.NotFound, "bucket not found"))
+	clock.Step(mountErrorRecordTTL + time.Second)
+	tracker.record(context.TODO(), "other-target-path", status.Error(codes.NotFound, "bucket not found"))
+	if _, ok := tracker.errors[targetPath]; ok {
+		t.Errorf("expected the stale mount error of %q to be garbage collected", targetPath)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const volumesSocketPath = "/debug/volumes"
+
+// MountedVolume is a gcsfuse volume mounted on the node, listed for the doctor CLI and the fleet inventory tools.
+type MountedVolume struct {
+	PodNamespace string `json:"podNamespace,omitempty"`
+	PodName      string `json:"podName,omitempty"`
+	PodUID       string `json:"podUID"`
+	VolumeName   string `json:"volumeName"`
+	Bucket       string `json:"bucket"`
+	TargetPath   string `json:"targetPath"`
+	// MountOptions are the resolved gcsfuse mount options with the sensitive values redacted.
+	// They are only known for the volumes published since the node driver started.
+	MountOptions []string `json:"mountOptions,omitempty"`
+}
+
+// mountRecord is the Pod and the mount options of a published target path, which are not in the mount table.
+type mountRecord struct {
+	podNamespace string
+	podName      string
+	options      []string
+}
+
+// recordMount remembers the Pod and the redacted mount options of the published target path.
+func (s *nodeServer) recordMount(targetPath string, pod *v1.Pod, options []string) {
+	s.mountRecordsMu.Lock()
+	defer s.mountRecordsMu.Unlock()
+	s.mountRecords[targetPath] = mountRecord{
+		podNamespace: pod.Namespace,
+		podName:      pod.Name,
+		options:      util.RedactMountOptions(options),
+	}
+}
+
+// forgetMount drops the record of the unpublished target path.
+func (s *nodeServer) forgetMount(targetPath string) {
+	s.mountRecordsMu.Lock()
+	defer s.mountRecordsMu.Unlock()
+	delete(s.mountRecords, targetPath)
+}
+
+// listMountedVolumes returns the gcsfuse volumes in the mount table of the node.
+// The Pods of the volumes without a record, e.g. mounted before the node driver restarted, are looked up in the Pod informer cache.
+func (s *nodeServer) listMountedVolumes() ([]MountedVolume, error) {
+	mps, err := s.mounter.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	var pods map[string]*v1.Pod
+	volumes := []MountedVolume{}
+	for _, mp := range mps {
+		if !strings.HasPrefix(mp.Type, "fuse") {
+			continue
+		}
+		podUID, volumeName, err := util.ParsePodIDVolumeFromTargetpath(mp.Path)
+		if err != nil {
+			continue
+		}
+
+		mv := MountedVolume{
+			PodUID:     podUID,
+			VolumeName: volumeName,
+			Bucket:     mp.Device,
+			TargetPath: mp.Path,
+		}
+		s.mountRecordsMu.Lock()
+		r, ok := s.mountRecords[mp.Path]
+		s.mountRecordsMu.Unlock()
+		if ok {
+			mv.PodNamespace, mv.PodName, mv.MountOptions = r.podNamespace, r.podName, r.options
+		} else {
+			if pods == nil {
+				pods = s.nodePodsByUID()
+			}
+			if pod, ok := pods[podUID]; ok {
+				mv.PodNamespace, mv.PodName = pod.Namespace, pod.Name
+			}
+		}
+
+		volumes = append(volumes, mv)
+	}
+
+	return volumes, nil
+}
+
+// nodePodsByUID returns the Pods on the node from the Pod informer cache by UID, or an empty map if the cache is not available.
+func (s *nodeServer) nodePodsByUID() map[string]*v1.Pod {
+	pods := map[string]*v1.Pod{}
+	if s.k8sClients == nil {
+		return pods
+	}
+
+	list, err := s.k8sClients.ListNodePods()
+	if err != nil {
+		klog.V(4).Infof("failed to list the Pods on the node: %v", err)
+
+		return pods
+	}
+	for _, pod := range list {
+		pods[string(pod.UID)] = pod
+	}
+
+	return pods
+}
+
+// ListMountedVolumes returns the gcsfuse volumes mounted on the node as JSON.
+func (driver *GCSDriver) ListMountedVolumes() ([]byte, error) {
+	s, ok := driver.ns.(*nodeServer)
+	if !ok {
+		return nil, fmt.Errorf("the node service is not running")
+	}
+
+	volumes, err := s.listMountedVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(volumes)
+}
+
+// VolumesHandler returns an HTTP handler that serves the gcsfuse volumes mounted on the node as JSON.
+func (driver *GCSDriver) VolumesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		volumes, err := driver.ListMountedVolumes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(volumes); err != nil {
+			klog.Errorf("failed to write the mounted volumes: %v", err)
+		}
+	})
+}
+
+// FetchVolumes reads the gcsfuse volumes mounted on the node from the state socket of the running node driver.
+func FetchVolumes(ctx context.Context, socketPath string) ([]byte, error) {
+	return fetchFromStateSocket(ctx, socketPath, volumesSocketPath)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mount "k8s.io/mount-utils"
+)
+
+type fakeNodePodsClientset struct {
+	clientset.FakeClientset
+}
+
+func (c *fakeNodePodsClientset) ListNodePods() ([]*v1.Pod, error) {
+	return []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "restarted-pod", Namespace: "test-ns", UID: "restarted-pod-id"}}}, nil
+}
+
+func TestListMountedVolumes(t *testing.T) {
+	t.Parallel()
+	recordedTargetPath := "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/test-volume/mount"
+	restartedTargetPath := "/var/lib/kubelet/pods/restarted-pod-id/volumes/kubernetes.io~csi/pv-test/mount"
+	mounter := mount.NewFakeMounter([]mount.MountPoint{
+		{Device: "test-bucket", Path: recordedTargetPath, Type: "fuse"},
+		{Device: "other-bucket", Path: restartedTargetPath, Type: "fuse"},
+		{Device: "/dev/sda1", Path: "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/pd/mount", Type: "ext4"},
+	})
+	driver := initTestDriver(t, mounter)
+	ns := newNodeServer(driver, mounter).(*nodeServer)
+	ns.k8sClients = &fakeNodePodsClientset{}
+	driver.ns = ns
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-ns", UID: "test-pod-id"}}
+	ns.recordMount(recordedTargetPath, pod, []string{"implicit-dirs", "token-url=https://example.com"})
+
+	socketPath := filepath.Join(t.TempDir(), "state.sock")
+	if err := driver.ServeStateSocket(socketPath); err != nil {
+		t.Fatalf("failed to serve the state socket: %v", err)
+	}
+	b, err := FetchVolumes(context.TODO(), socketPath)
+	if err != nil {
+		t.Fatalf("failed to fetch the mounted volumes: %v", err)
+	}
+	volumes := []MountedVolume{}
+	if err := json.Unmarshal(b, &volumes); err != nil {
+		t.Fatalf("failed to parse the mounted volumes: %v", err)
+	}
+
+	expected := []MountedVolume{
+		{
+			PodNamespace: "test-ns",
+			PodName:      "test-pod",
+			PodUID:       "test-pod-id",
+			VolumeName:   "test-volume",
+			Bucket:       "test-bucket",
+			TargetPath:   recordedTargetPath,
+			MountOptions: []string{"implicit-dirs", "token-url=REDACTED"},
+		},
+		{
+			PodNamespace: "test-ns",
+			PodName:      "restarted-pod",
+			PodUID:       "restarted-pod-id",
+			VolumeName:   "pv-test",
+			Bucket:       "other-bucket",
+			TargetPath:   restartedTargetPath,
+		},
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("got volumes %+v, expected %+v", volumes, expected)
+	}
+
+	ns.forgetMount(recordedTargetPath)
+	if got, _ := ns.listMountedVolumes(); got[0].MountOptions != nil {
+		t.Errorf("got mount options %v after the volume was unpublished, expected none", got[0].MountOptions)
+	}
+}
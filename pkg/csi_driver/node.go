@@ -19,37 +19,53 @@ package driver
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/auth"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	csimounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_mounter"
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 	mount "k8s.io/mount-utils"
 )
 
-// NodePublishVolume VolumeContext parameters.
 const (
-	VolumeContextKeyServiceAccountName = "csi.storage.k8s.io/serviceAccount.name"
-	//nolint:gosec
-	VolumeContextKeyServiceAccountToken = "csi.storage.k8s.io/serviceAccount.tokens"
-	VolumeContextKeyPodName             = "csi.storage.k8s.io/pod.name"
-	VolumeContextKeyPodNamespace        = "csi.storage.k8s.io/pod.namespace"
-	VolumeContextKeyEphemeral           = "csi.storage.k8s.io/ephemeral"
-	VolumeContextKeyBucketName          = "bucketName"
-	VolumeContextKeyMountOptions        = "mountOptions"
-
 	UmountTimeout = time.Second * 5
+
+	eventReasonIdentityResolved   = "GCPIdentityResolved"
+	eventReasonStagingSpaceTooLow = "StagingSpaceTooLow"
+	eventReasonMountOptions       = "MountOptionsResolved"
+	eventReasonDeprecatedOption   = "DeprecatedMountOption"
+
+	// bucketEndpointCacheTTL is how long the bucket location looked up for the regional endpoint is cached.
+	bucketEndpointCacheTTL = time.Minute * 10
+)
+
+// Topology keys of the accessible topology of the node, the same as the well-known node labels.
+const (
+	TopologyKeyZone   = v1.LabelTopologyZone
+	TopologyKeyRegion = v1.LabelTopologyRegion
 )
 
 // nodeServer handles mounting and unmounting of GCS FUSE volumes on a node.
@@ -59,22 +75,70 @@ type nodeServer struct {
 	mounter               mount.Interface
 	volumeLocks           *util.VolumeLocks
 	k8sClients            clientset.Interface
+	bucketCache           *storage.BucketCache
+	mountErrors           *mountErrorTracker
+	unmounts              *unmountQueue
+
+	// endpointCache caches the bucket locations looked up for the regional endpoint,
+	// so that a bucket recreated in another location picks up the new endpoint after the TTL.
+	endpointCache *storage.BucketCache
+
+	// mountRecords are the Pods and the mount options of the published target paths, listed by the --list-volumes mode.
+	mountRecords   map[string]mountRecord
+	mountRecordsMu sync.Mutex
+
+	// tokenServers serve the downscoped tokens of the mounted volumes to the sidecar containers.
+	tokenServers *volumeTokenServers
 }
 
 func newNodeServer(driver *GCSDriver, mounter mount.Interface) csi.NodeServer {
+	var bucketCache *storage.BucketCache
+	if driver.config.BucketCacheTTL > 0 {
+		bucketCache = storage.NewBucketCache(driver.config.BucketCacheTTL)
+	}
+	var mountErrors *mountErrorTracker
+	if driver.config.MountErrorBackoffMax > 0 {
+		mountErrors = newMountErrorTracker(flowcontrol.NewBackOff(mountErrorInitialBackoff, driver.config.MountErrorBackoffMax))
+	}
+
 	return &nodeServer{
 		driver:                driver,
 		storageServiceManager: driver.config.StorageServiceManager,
 		mounter:               mounter,
 		volumeLocks:           util.NewVolumeLocks(),
 		k8sClients:            driver.config.K8sClients,
+		endpointCache:         storage.NewBucketCache(bucketEndpointCacheTTL),
+		mountRecords:          map[string]mountRecord{},
+		bucketCache:           bucketCache,
+		mountErrors:           mountErrors,
+		unmounts:              newUnmountQueue(mounter, driver.config.MaxConcurrentUnmounts),
+		tokenServers:          newVolumeTokenServers(),
 	}
 }
 
-func (s *nodeServer) NodeGetInfo(_ context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	return &csi.NodeGetInfoResponse{
+// NodeGetInfo returns the zone and region labels of the node as the accessible topology,
+// which the kubelet registers as the topology keys of the driver in the CSINode object.
+func (s *nodeServer) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	node, err := s.k8sClients.GetNode(ctx, s.driver.config.NodeID)
+	if err != nil {
+		return nil, status.Errorf(kubeAPIErrorCode(err), "failed to get node %q: %v", s.driver.config.NodeID, err)
+	}
+
+	segments := map[string]string{}
+	for _, key := range []string{TopologyKeyZone, TopologyKeyRegion} {
+		if v := node.Labels[key]; v != "" {
+			segments[key] = v
+		}
+	}
+
+	resp := &csi.NodeGetInfoResponse{
 		NodeId: s.driver.config.NodeID,
-	}, nil
+	}
+	if len(segments) > 0 {
+		resp.AccessibleTopology = &csi.Topology{Segments: segments}
+	}
+
+	return resp, nil
 }
 
 func (s *nodeServer) NodeGetCapabilities(_ context.Context, _ *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
@@ -84,6 +148,23 @@ func (s *nodeServer) NodeGetCapabilities(_ context.Context, _ *csi.NodeGetCapabi
 }
 
 func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	// Repeating mount failures of the same target path return the previous error until the backoff expires.
+	targetPath := req.GetTargetPath()
+	if err := s.mountErrors.suppressedError(targetPath); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.publishVolume(ctx, req)
+	s.mountErrors.record(ctx, targetPath, err)
+
+	return resp, err
+}
+
+func (s *nodeServer) publishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	timer := metrics.NewMountPhaseTimer()
+	traceID := metrics.TraceID(ctx)
+	timer.SetTraceID(traceID)
+
 	// Validate arguments
 	bucketName := req.GetVolumeId()
 	vc := req.GetVolumeContext()
@@ -95,22 +176,111 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	if capMount := req.GetVolumeCapability().GetMount(); capMount != nil {
 		fuseMountOptions = joinMountOptions(fuseMountOptions, capMount.GetMountFlags())
 	}
-	if mountOptions, ok := vc[VolumeContextKeyMountOptions]; ok {
-		fuseMountOptions = joinMountOptions(fuseMountOptions, strings.Split(mountOptions, ","))
+	if mountOptions, ok := vc[volumespec.VolumeContextKeyMountOptions]; ok {
+		fuseMountOptions = joinMountOptions(fuseMountOptions, driverconfig.SplitMountOptions(mountOptions))
 	}
+	fuseMountOptions = removeInternalMountOptions(fuseMountOptions)
+	fuseMountOptions, deprecationWarnings := volumespec.TranslateMountOptions(fuseMountOptions)
 
-	if vc[VolumeContextKeyEphemeral] == "true" {
-		bucketName = vc[VolumeContextKeyBucketName]
+	driverConfig := s.driver.config.DriverConfig.Get()
+	for _, o := range fuseMountOptions {
+		if o != "" && !driverConfig.IsMountOptionAllowed(o) {
+			return nil, newMountError(codes.InvalidArgument, mountErrorMountOptionNotAllowed, "mount option %q is not allowed by the driver config", o)
+		}
+	}
+	// The options of the parallel download and requestPriority volume attributes are generated by the driver, so the allowlist does not apply.
+	downloadOptions, err := webhook.ParallelDownloadMountOptions(vc)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext is invalid: %v", err)
+	}
+	fuseMountOptions = driverconfig.MergeMountOptions(fuseMountOptions, downloadOptions)
+	if priority, ok := vc[volumespec.VolumeContextKeyRequestPriority]; ok {
+		priorityOptions, ok := volumespec.RequestPriorityMountOptions[priority]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be one of %q and %q, got %q", volumespec.VolumeContextKeyRequestPriority, volumespec.RequestPriorityLatencySensitive, volumespec.RequestPriorityThroughputBatch, priority)
+		}
+		fuseMountOptions = driverconfig.MergeMountOptions(fuseMountOptions, priorityOptions)
+	}
+	fuseMountOptions = driverConfig.ApplyDefaultMountOptions(fuseMountOptions, vc[volumespec.VolumeContextKeyPodNamespace])
+	if s.driver.config.EnableMachineTypeDefaults {
+		machineTypeOptions := []string{}
+		for _, o := range s.machineTypeMountOptions(ctx) {
+			if driverConfig.IsMountOptionAllowed(o) {
+				machineTypeOptions = append(machineTypeOptions, o)
+			}
+		}
+		fuseMountOptions = driverconfig.MergeMountOptions(fuseMountOptions, machineTypeOptions)
+	}
+	// The parallel downloads fill the file cache, so they are a no-op without it.
+	if downloadOptions != nil && !hasFileCache(fuseMountOptions) {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q and %q require the file cache, set the file-cache-max-size-mb mount option", webhook.VolumeAttributeDownloadChunkSizeMb, webhook.VolumeAttributeMaxParallelDownloads)
+	}
+
+	if interval, ok := vc[volumespec.VolumeContextKeyMetricsExportInterval]; ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < volumespec.MinMetricsExportInterval {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be a duration of at least %v, got %q", volumespec.VolumeContextKeyMetricsExportInterval, volumespec.MinMetricsExportInterval, interval)
+		}
+		fuseMountOptions = joinMountOptions(fuseMountOptions, []string{"stackdriver-export-interval=" + d.String()})
+	}
+
+	if vc[volumespec.VolumeContextKeyEphemeral] == "true" {
+		bucketName = vc[volumespec.VolumeContextKeyBucketName]
 		if len(bucketName) == 0 {
-			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be provided for ephemeral storage", VolumeContextKeyBucketName)
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be provided for ephemeral storage", volumespec.VolumeContextKeyBucketName)
+		}
+	}
+
+	skipBucketAccessCheck := false
+	if v, ok := vc[volumespec.VolumeContextKeySkipBucketAccessCheck]; ok {
+		var err error
+		if skipBucketAccessCheck, err = strconv.ParseBool(v); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be a boolean, got %q", volumespec.VolumeContextKeySkipBucketAccessCheck, v)
 		}
 	}
 
+	if v, ok := vc[volumespec.VolumeContextKeyFileCacheShared]; ok {
+		fileCacheShared, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be a boolean, got %q", volumespec.VolumeContextKeyFileCacheShared, v)
+		}
+		if fileCacheShared {
+			if s.driver.config.SharedCacheDir == "" {
+				return nil, status.Errorf(codes.FailedPrecondition, "NodePublishVolume VolumeContext %q is set, but the node driver shared cache directory is not configured", volumespec.VolumeContextKeyFileCacheShared)
+			}
+			if !sets.NewString(fuseMountOptions...).Has("ro") {
+				return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q is only supported by read-only volumes", volumespec.VolumeContextKeyFileCacheShared)
+			}
+			// The cache is only shared by the Pods of the same namespace and service account,
+			// so that the cached objects are not readable by the Pods of other identities.
+			namespace, serviceAccount := vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyServiceAccountName]
+			if namespace == "" || serviceAccount == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q requires the Pod namespace and service account", volumespec.VolumeContextKeyFileCacheShared)
+			}
+			fuseMountOptions = capFileCacheSize(fuseMountOptions, s.driver.config.SharedCacheMaxSizeMB)
+			fuseMountOptions = joinMountOptions(fuseMountOptions, []string{volumespec.SharedCacheDirMountOptionKey + "=" + filepath.Join(s.driver.config.SharedCacheDir, namespace, serviceAccount, bucketName)})
+		}
+	}
+
+	stagingSize, err := webhook.VolumeStagingSize(vc)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext is invalid: %v", err)
+	}
+
+	if !driverConfig.IsBucketAllowed(bucketName) {
+		return nil, newMountError(codes.PermissionDenied, mountErrorBucketNotAllowed, "bucket %q is not allowed by the driver config", bucketName)
+	}
+
 	targetPath := req.GetTargetPath()
 	if len(targetPath) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume target path must be provided")
 	}
 
+	logger := klog.LoggerWithValues(klog.FromContext(ctx),
+		util.LogKeyBucket, bucketName,
+		util.LogKeyPod, klog.KRef(vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyPodName]))
+	ctx = klog.NewContext(ctx, logger)
+
 	if err := s.driver.validateVolumeCapabilities([]*csi.VolumeCapability{req.GetVolumeCapability()}); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -121,38 +291,73 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	}
 	defer s.volumeLocks.Release(targetPath)
 
+	// The kubelet retries NodePublishVolume until it succeeds, so the target path may be already mounted by a previous call.
+	mp, err := s.findMountPoint(targetPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check if path %q is already mounted: %v", targetPath, err)
+	}
+	if mp != nil && mp.Device != bucketName {
+		return nil, status.Errorf(codes.AlreadyExists, "target path %q is already mounted with bucket %q", targetPath, mp.Device)
+	}
+
+	timer.ObservePhase(metrics.MountPhaseValidation)
+
+	// The kubelet republishes the mounted volumes to refresh the service account tokens until the Pod is deleted.
+	// The republish of a deleted or terminating Pod succeeds without exchanging tokens or checking the sidecar container,
+	// so that large scale-downs do not produce auth errors and FailedMount events for Pods that are going away.
+	pod, err := s.k8sClients.GetPod(ctx, vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyPodName])
+	if err != nil {
+		if mp != nil && apierrors.IsNotFound(err) {
+			logger.V(4).Info("NodePublishVolume skipped, the Pod was deleted")
+
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
+
+		return nil, status.Errorf(kubeAPIErrorCode(err), "failed to get pod: %v", err)
+	}
+	podIsTerminating := pod.DeletionTimestamp != nil
+	if podIsTerminating && mp == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the Pod is terminating, skipping the mount")
+	}
+
 	// Check if the given Service Account has the access to the GCS bucket, and the bucket exists.
-	if bucketName != "_" {
-		storageService, err := s.prepareStorageService(ctx, req.GetVolumeContext())
+	// The check is skipped if the target path is already mounted, because the bucket was checked by the previous call.
+	if bucketName != "_" && mp == nil {
+		storageService, err := s.prepareStorageService(ctx, req.GetVolumeContext(), bucketName)
 		if err != nil {
-			return nil, status.Errorf(codes.Unauthenticated, "failed to prepare storage service: %v", err)
+			return nil, newMountError(codes.Unauthenticated, mountErrorWorkloadIdentity, "failed to prepare storage service: %v", err)
 		}
+		timer.ObservePhase(metrics.MountPhaseToken)
 
-		if exist, err := storageService.CheckBucketExists(ctx, &storage.ServiceBucket{Name: bucketName}); !exist {
-			code := codes.Internal
+		if skipBucketAccessCheck {
+			klog.FromContext(ctx).Info("skipping the bucket access check", "volumeAttribute", volumespec.VolumeContextKeySkipBucketAccessCheck)
+		} else if exist, err := storageService.CheckBucketExists(ctx, &storage.ServiceBucket{Name: bucketName}); !exist {
 			if storage.IsNotExistErr(err) {
-				code = codes.NotFound
+				return nil, newMountError(codes.NotFound, mountErrorBucketNotFound, "failed to get GCS bucket %q: %v", bucketName, err)
 			}
 
 			if storage.IsPermissionDeniedErr(err) {
-				code = codes.PermissionDenied
+				return nil, newMountError(codes.PermissionDenied, mountErrorIAMPermissionDenied, "failed to get GCS bucket %q: %v", bucketName, err)
 			}
 
-			return nil, status.Errorf(code, "failed to get GCS bucket %q: %v", bucketName, err)
+			return nil, status.Errorf(storageErrorCode(err), "failed to get GCS bucket %q: %v", bucketName, err)
 		}
+
+		if s.driver.config.EnableRegionalEndpoint && s.driver.config.StorageEndpoint == "" {
+			if endpoint := s.getRegionalEndpoint(ctx, storageService, bucketName); endpoint != "" {
+				fuseMountOptions = joinMountOptions(fuseMountOptions, []string{volumespec.StorageEndpointMountOptionKey + "=" + endpoint})
+			}
+		}
+		timer.ObservePhase(metrics.MountPhaseBucketCheck)
 	}
 
 	// Check if the sidecar container was injected into the Pod
-	pod, err := s.k8sClients.GetPod(ctx, vc[VolumeContextKeyPodNamespace], vc[VolumeContextKeyPodName])
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get pod: %v", err)
-	}
-	if !webhook.ValidatePodHasSidecarContainerInjected(s.driver.config.SidecarImage, pod) {
+	if !isSidecarInjected(pod, s.driver.config.SidecarImage, driverConfig) {
 		if pod.Annotations[webhook.AnnotationGcsfuseVolumeEnableKey] != "true" {
-			return nil, status.Error(codes.FailedPrecondition, "failed to find the sidecar container in Pod spec")
+			return nil, newMountError(codes.FailedPrecondition, mountErrorSidecarNotInjected, "failed to find the sidecar container in Pod spec")
 		}
 
-		return nil, status.Error(codes.Internal, "the webhook failed to inject the sidecar container into the Pod spec")
+		return nil, status.Error(codes.FailedPrecondition, "the webhook failed to inject the sidecar container into the Pod spec")
 	}
 
 	// Check if the Pod is owned by a Job
@@ -167,9 +372,10 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 
 	podRestartPolicyIsNever := pod.Spec.RestartPolicy == v1.RestartPolicyNever
 
-	// Check if all the containers besides the sidecar container exited
+	// Check if all the containers besides the sidecar container exited.
+	// The containers of a terminating Pod are not restarted, so the sidecar container exits as soon as the other containers exit.
 	sidecarShouldExit := true
-	if isOwnedByJob || podRestartPolicyIsNever {
+	if isOwnedByJob || podRestartPolicyIsNever || podIsTerminating {
 		for _, cs := range pod.Status.ContainerStatuses {
 			if cs.Name != webhook.SidecarContainerName && cs.State.Terminated == nil {
 				sidecarShouldExit = false
@@ -186,8 +392,8 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	}
 
 	// Put an exit file to notify the sidecar container to exit
-	if (isOwnedByJob || podRestartPolicyIsNever) && sidecarShouldExit {
-		klog.V(4).Info("all the other containers terminated in the Pod, put the exit file.")
+	if (isOwnedByJob || podRestartPolicyIsNever || podIsTerminating) && sidecarShouldExit {
+		logger.V(4).Info("all the other containers terminated in the Pod, put the exit file")
 		exitFilePath := filepath.Dir(emptyDirBasePath) + "/exit"
 		f, err := os.Create(exitFilePath)
 		if err != nil {
@@ -200,6 +406,12 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 		}
 	}
 
+	if podIsTerminating {
+		logger.V(4).Info("NodePublishVolume succeeded, the Pod is terminating")
+
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
 	// Check if there is any error from the sidecar container
 	errMsg, err := os.ReadFile(emptyDirBasePath + "/error")
 	if err != nil && !os.IsNotExist(err) {
@@ -207,16 +419,45 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	}
 	if err == nil && len(errMsg) > 0 {
 		errMsgStr := string(errMsg)
-		code := codes.Internal
+		summary := summarizeSidecarError(errMsgStr)
+		logger.Error(nil, "the sidecar container failed", "sidecarError", errMsgStr)
+
 		if strings.Contains(errMsgStr, "Incorrect Usage") {
-			code = codes.InvalidArgument
+			return nil, newMountError(codes.InvalidArgument, mountErrorInvalidFlag, "the sidecar container failed with error: %v", summary)
 		}
 
 		if strings.Contains(errMsgStr, "signal: killed") {
-			code = codes.ResourceExhausted
+			return nil, newMountError(codes.ResourceExhausted, mountErrorSidecarOOM, "the sidecar container failed with error: %v", summary)
 		}
 
-		return nil, status.Errorf(code, "the sidecar container failed with error: %v", errMsgStr)
+		return nil, status.Errorf(codes.Internal, "the sidecar container failed with error: %v", summary)
+	}
+
+	// Check if the mount handshake with the sidecar container timed out
+	handshakeTimeout, err := csimounter.ReadHandshakeTimeout(emptyDirBasePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check the mount handshake: %v", err)
+	}
+	if handshakeTimeout != nil {
+		_, readyErr := os.Stat(filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName))
+		switch {
+		case readyErr == nil && handshakeTimeout.Phase == metrics.MountPhaseGCSFuseReady:
+			// gcsfuse became ready after the deadline, so the mount is healthy.
+			logger.Info("gcsfuse became ready after the mount handshake timed out", "timeout", handshakeTimeout.Timeout)
+			if err := os.Remove(filepath.Join(emptyDirBasePath, csimounter.HandshakeTimeoutFileName)); err != nil {
+				logger.Error(err, "failed to remove the handshake timeout file")
+			}
+		case handshakeTimeout.Phase == metrics.MountPhaseFDHandoff && mp == nil:
+			// The mounter unmounted the target path after the handoff failed,
+			// so report the timeout once and let the next retry mount the target path again.
+			if err := os.Remove(filepath.Join(emptyDirBasePath, csimounter.HandshakeTimeoutFileName)); err != nil {
+				logger.Error(err, "failed to remove the handshake timeout file")
+			}
+
+			return nil, newMountError(codes.DeadlineExceeded, mountErrorHandshakeTimeout, "the mount handshake is stuck in phase %q: %v", handshakeTimeout.Phase, handshakeTimeout.Description())
+		default:
+			return nil, newMountError(codes.DeadlineExceeded, mountErrorHandshakeTimeout, "the mount handshake is stuck in phase %q: %v", handshakeTimeout.Phase, handshakeTimeout.Description())
+		}
 	}
 
 	// Check if the sidecar container terminated
@@ -230,43 +471,108 @@ func (s *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 			}
 
 			if reason == "OOMKilled" {
-				return nil, status.Errorf(codes.ResourceExhausted, "the sidecar container terminated due to OOMKilled")
+				return nil, newMountError(codes.ResourceExhausted, mountErrorSidecarOOM, "the sidecar container terminated due to OOMKilled")
 			} else if reason != "" {
 				return nil, status.Errorf(codes.Internal, "the sidecar container terminated due to %v", reason)
 			}
 		}
 	}
 
-	// TODO: Check if the socket listener timed out
-
-	// Check if the target path is already mounted
-	mounted, err := s.isDirMounted(targetPath)
+	// The tokens are served again on the republish of a mounted volume, to refresh the service account token
+	// and to restart the server after the node driver restarted.
+	tokenServer, err := s.serveVolumeTokens(vc, bucketName, targetPath, fuseMountOptions)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to check if path %q is already mounted: %v", targetPath, err)
+		return nil, status.Errorf(codes.Internal, "failed to serve the tokens of the volume: %v", err)
 	}
 
-	if mounted {
+	if mp != nil {
 		// Already mounted
-		klog.V(4).Infof("NodePublishVolume succeeded on volume %q to target path %q, mount already exists.", bucketName, targetPath)
+		logger.V(4).Info("NodePublishVolume succeeded, mount already exists")
+		s.recordMount(targetPath, pod, fuseMountOptions)
+		s.updateVolumesReadyCondition(ctx, pod)
 
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
-	klog.V(4).Infof("NodePublishVolume attempting mkdir for path %q", targetPath)
+	timer.ObservePhase(metrics.MountPhasePodCheck)
+
+	logger.V(4).Info("NodePublishVolume attempting mkdir for target path")
 	if err := os.MkdirAll(targetPath, 0o750); err != nil {
 		return nil, status.Errorf(codes.Internal, "mkdir failed for path %q: %v", targetPath, err)
 	}
 
 	// Start to mount
-	if err = s.mounter.Mount(bucketName, targetPath, "fuse", fuseMountOptions); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to mount volume %q to target path %q: %v", bucketName, targetPath, err)
+	mountOptions := fuseMountOptions
+	if traceID != "" {
+		mountOptions = joinMountOptions(mountOptions, []string{volumespec.TraceIDMountOptionKey + "=" + traceID})
+	}
+	if tokenServer {
+		mountOptions = joinMountOptions(mountOptions, []string{volumespec.TokenServerMountOptionKey + "=true"})
 	}
+	if err = s.mounter.Mount(bucketName, targetPath, "fuse", mountOptions); err != nil {
+		s.tokenServers.stop(targetPath)
 
-	klog.V(4).Infof("NodePublishVolume succeeded on volume %q to target path %q", bucketName, targetPath)
+		return nil, status.Errorf(codes.Internal, "failed to mount volume %q to target path %q: %v", bucketName, targetPath, err)
+	}
+	timer.ObservePhase(metrics.MountPhaseMount)
+
+	logger.V(4).Info("NodePublishVolume succeeded")
+	s.auditIdentity(ctx, pod, vc, bucketName)
+	s.checkStagingSpace(pod, bucketName, stagingSize)
+	s.echoMountOptions(ctx, pod, bucketName, fuseMountOptions)
+	s.recordMount(targetPath, pod, fuseMountOptions)
+	s.updateVolumesReadyCondition(ctx, pod)
+	for _, w := range deprecationWarnings {
+		logger.Info("translated a deprecated mount option", "warning", w)
+		s.driver.recorder.Eventf(pod, v1.EventTypeWarning, eventReasonDeprecatedOption,
+			"Bucket %q: %v. Update the mountOptions of the volume", bucketName, w)
+	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (s *nodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+// echoMountOptions logs the resolved mount options of the volume with the sensitive values redacted,
+// so that the options applied after merging the volume attributes and the defaults can be checked
+// without reproducing the environment.
+func (s *nodeServer) echoMountOptions(ctx context.Context, pod *v1.Pod, bucketName string, options []string) {
+	redacted := util.RedactMountOptions(options)
+	klog.FromContext(ctx).Info("resolved the gcsfuse mount options", "mountOptions", redacted)
+
+	if s.driver.config.EnableMountConfigEvents {
+		s.driver.recorder.Eventf(pod, v1.EventTypeNormal, eventReasonMountOptions,
+			"Bucket %q is mounted with the options %q", bucketName, strings.Join(redacted, ","))
+	}
+}
+
+// checkStagingSpace records a warning event on the Pod if the sidecar container emptyDir cannot fit
+// the staging space required by the volume attributes, because the Pod would be evicted when writing large files.
+// The webhook sizes the emptyDir for the CSI ephemeral volumes, so this mainly catches the PersistentVolumes.
+func (s *nodeServer) checkStagingSpace(pod *v1.Pod, bucketName string, stagingSize resource.Quantity) {
+	if stagingSize.IsZero() {
+		return
+	}
+
+	var available *resource.Quantity
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == webhook.SidecarContainerVolumeName && v.EmptyDir != nil && v.EmptyDir.SizeLimit != nil {
+			available = v.EmptyDir.SizeLimit
+		}
+	}
+	if available == nil {
+		for _, c := range pod.Spec.Containers {
+			if q, ok := c.Resources.Limits[v1.ResourceEphemeralStorage]; ok && c.Name == webhook.SidecarContainerName {
+				available = &q
+			}
+		}
+	}
+
+	if available != nil && stagingSize.Cmp(*available) > 0 {
+		s.driver.recorder.Eventf(pod, v1.EventTypeWarning, eventReasonStagingSpaceTooLow,
+			"Bucket %q requires %v staging space for the written files, but the gcsfuse sidecar container has %v, the Pod may be evicted when writing large files. Set the Pod annotation %q to at least the total staging space of the volumes",
+			bucketName, stagingSize.String(), available.String(), "gke-gcsfuse/ephemeral-storage-limit")
+	}
+}
+
+func (s *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	// Validate arguments
 	targetPath := req.GetTargetPath()
 	if len(targetPath) == 0 {
@@ -278,51 +584,87 @@ func (s *nodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpubli
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, targetPath)
 	}
 	defer s.volumeLocks.Release(targetPath)
+	s.mountErrors.forget(targetPath)
 
-	// Check if the target path is already mounted
-	if mounted, err := s.isDirMounted(targetPath); mounted || err != nil {
-		if err != nil {
-			klog.Errorf("failed to check if path %q is already mounted: %v", targetPath, err)
-		}
+	// The unmounts are queued, so that the mass Pod evictions of node drains are batched with bounded concurrency.
+	if err := s.unmounts.run(ctx, targetPath, func(mounted bool) error {
+		return s.unmountTargetPath(ctx, targetPath, mounted)
+	}); err != nil {
+		return nil, err
+	}
+	s.forgetMount(targetPath)
+	s.tokenServers.stop(targetPath)
+
+	klog.FromContext(ctx).V(4).Info("NodeUnpublishVolume succeeded")
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// unmountTargetPath unmounts the target path if it is mounted, and cleans up the mount point.
+func (s *nodeServer) unmountTargetPath(ctx context.Context, targetPath string, mounted bool) error {
+	logger := klog.FromContext(ctx)
+
+	if mounted {
 		// Force unmount the target path
 		// Try to do force unmount firstly because if the file descriptor was not closed,
 		// mount.CleanupMountPoint() call will hang.
 		forceUnmounter, ok := s.mounter.(mount.MounterForceUnmounter)
 		if ok {
-			if err = forceUnmounter.UnmountWithForce(targetPath, UmountTimeout); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to force unmount target path %q: %v", targetPath, err)
+			if err := forceUnmounter.UnmountWithForce(targetPath, UmountTimeout); err != nil {
+				return status.Errorf(codes.Internal, "failed to force unmount target path %q: %v", targetPath, err)
 			}
 		} else {
-			klog.Warningf("failed to cast the mounter to a forceUnmounter, proceed with the default mounter Unmount")
-			if err = s.mounter.Unmount(targetPath); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to unmount target path %q: %v", targetPath, err)
+			logger.Info("failed to cast the mounter to a forceUnmounter, proceed with the default mounter Unmount")
+			if err := s.mounter.Unmount(targetPath); err != nil {
+				return status.Errorf(codes.Internal, "failed to unmount target path %q: %v", targetPath, err)
 			}
 		}
 	}
 
 	// Cleanup the mount point
 	if err := mount.CleanupMountPoint(targetPath, s.mounter, false /* bind mount */); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to cleanup the mount point %q: %v", targetPath, err)
+		return status.Errorf(codes.Internal, "failed to cleanup the mount point %q: %v", targetPath, err)
 	}
 
-	klog.V(4).Infof("NodeUnpublishVolume succeeded on target path %q", targetPath)
+	// The shared cache directory mounted in the sidecar container emptyDir would prevent removing the emptyDir.
+	if err := csimounter.UnmountSharedCacheDir(s.mounter, targetPath); err != nil {
+		return status.Errorf(codes.Internal, "failed to unmount the shared cache directory of the target path %q: %v", targetPath, err)
+	}
 
-	return &csi.NodeUnpublishVolumeResponse{}, nil
+	return nil
 }
 
-// isDirMounted checks if the path is already a mount point.
-func (s *nodeServer) isDirMounted(targetPath string) (bool, error) {
+// findMountPoint returns the mount point of the path, or nil if the path is not a mount point.
+func (s *nodeServer) findMountPoint(targetPath string) (*mount.MountPoint, error) {
 	mps, err := s.mounter.List()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for _, m := range mps {
-		if m.Path == targetPath {
-			return true, nil
+	for i := range mps {
+		if mps[i].Path == targetPath {
+			return &mps[i], nil
 		}
 	}
 
-	return false, nil
+	return nil, nil
+}
+
+// isSidecarInjected returns true if the sidecar container with the driver sidecar image, or the sidecar or canary image of the driver config, was injected.
+func isSidecarInjected(pod *v1.Pod, sidecarImage string, driverConfig *driverconfig.Spec) bool {
+	if webhook.ValidatePodHasSidecarContainerInjected(sidecarImage, pod) {
+		return true
+	}
+	if driverConfig == nil {
+		return false
+	}
+
+	for _, image := range []string{driverConfig.Sidecar.Image, driverConfig.Sidecar.CanaryImage} {
+		if image != "" && webhook.ValidatePodHasSidecarContainerInjected(image, pod) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // joinMountOptions joins mount options eliminating duplicates.
@@ -342,13 +684,141 @@ func joinMountOptions(userOptions []string, systemOptions []string) []string {
 	return allMountOptions.List()
 }
 
+// removeInternalMountOptions removes the storage endpoint, shared cache directory, and trace ID mount options,
+// which are only allowed to be set by the node server.
+func removeInternalMountOptions(options []string) []string {
+	filteredOptions := []string{}
+	for _, o := range options {
+		if strings.HasPrefix(o, volumespec.StorageEndpointMountOptionKey+"=") || strings.HasPrefix(o, volumespec.SharedCacheDirMountOptionKey+"=") ||
+			strings.HasPrefix(o, volumespec.TraceIDMountOptionKey+"=") || strings.HasPrefix(o, volumespec.TokenServerMountOptionKey+"=") {
+			klog.Warningf("got disallowed mount option %q. Will discard it and continue to mount.", o)
+
+			continue
+		}
+		filteredOptions = append(filteredOptions, o)
+	}
+
+	return filteredOptions
+}
+
+// hasFileCache returns true if the mount options enable the gcsfuse file cache.
+// The file cache is disabled by default, and a file-cache-max-size-mb of -1 means unlimited.
+func hasFileCache(options []string) bool {
+	for _, o := range options {
+		if v, ok := strings.CutPrefix(strings.TrimLeft(o, "-"), "file-cache-max-size-mb="); ok && v != "0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// capFileCacheSize lowers the file-cache-max-size-mb mount option to maxSizeMB if it is unlimited or larger,
+// so that the shared cache directory of the node does not fill the node disk. Zero maxSizeMB keeps the options.
+func capFileCacheSize(options []string, maxSizeMB int) []string {
+	if maxSizeMB <= 0 {
+		return options
+	}
+
+	capped := make([]string, 0, len(options))
+	for _, o := range options {
+		if v, ok := strings.CutPrefix(strings.TrimLeft(o, "-"), "file-cache-max-size-mb="); ok {
+			if size, err := strconv.Atoi(v); err == nil && (size < 0 || size > maxSizeMB) {
+				o = fmt.Sprintf("file-cache-max-size-mb=%d", maxSizeMB)
+			}
+		}
+		capped = append(capped, o)
+	}
+
+	return capped
+}
+
+// getRegionalEndpoint looks up the bucket location, cached for bucketEndpointCacheTTL,
+// and returns the regional endpoint if the bucket is in a single region.
+// An empty string is returned for dual-region and multi-region buckets, or if the bucket location cannot be looked up,
+// so that gcsfuse falls back to the global endpoint.
+func (s *nodeServer) getRegionalEndpoint(ctx context.Context, storageService storage.Service, bucketName string) string {
+	bucket, err := s.endpointCache.NewCachedService(storageService, "").GetBucket(ctx, &storage.ServiceBucket{Name: bucketName})
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "failed to get the bucket location, using the global endpoint")
+
+		return ""
+	}
+
+	endpoint := storage.GetRegionalEndpoint(bucket)
+	klog.FromContext(ctx).V(4).Info("looked up the bucket location", "location", bucket.Location, "locationType", bucket.LocationType, "endpoint", endpoint)
+
+	return endpoint
+}
+
+// auditIdentity records the GCP principals resolved for the volume mount,
+// so that security teams can audit which identity accessed the bucket from which Pod.
+func (s *nodeServer) auditIdentity(ctx context.Context, pod *v1.Pod, vc map[string]string, bucketName string) {
+	logger := klog.FromContext(ctx)
+	identity, err := s.driver.config.TokenManager.ResolveIdentity(ctx, vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyServiceAccountName])
+	if err != nil {
+		logger.Error(err, "failed to resolve the GCP identity for the volume mount audit")
+
+		return
+	}
+
+	logger.Info("resolved the GCP identity for the volume mount",
+		"kubernetesServiceAccount", identity.KubernetesServiceAccount,
+		"federatedPrincipal", identity.FederatedPrincipal,
+		"impersonatedServiceAccount", identity.ImpersonatedServiceAccount,
+		"principal", identity.Principal())
+
+	if s.driver.config.EnableIdentityAuditEvents {
+		s.driver.recorder.Eventf(pod, v1.EventTypeNormal, eventReasonIdentityResolved,
+			"Bucket %q is accessed with the GCP identity chain %v", bucketName, identity.Chain())
+	}
+}
+
+// serveVolumeTokens serves the tokens of the volume to the sidecar container if token downscoping is enabled,
+// limited to the bucket, the only-dir prefix, and reading if the volume is read-only. It returns true if the tokens are served.
+func (s *nodeServer) serveVolumeTokens(vc map[string]string, bucketName, targetPath string, options []string) (bool, error) {
+	// The tokens of the dynamic mounts cannot be limited to one bucket.
+	if !s.driver.config.EnableTokenDownscoping || bucketName == "_" {
+		return false, nil
+	}
+	listener, ok := s.mounter.(tokenSocketListener)
+	if !ok {
+		return false, nil
+	}
+
+	boundary := auth.AccessBoundary{BucketName: bucketName, ReadOnly: sets.NewString(options...).Has("ro")}
+	for _, o := range options {
+		if prefix, ok := strings.CutPrefix(o, "only-dir="); ok {
+			boundary.ObjectPrefix = prefix
+		}
+	}
+	ts := s.driver.config.TokenManager.GetTokenSourceFromK8sServiceAccount(vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyServiceAccountName], vc[volumespec.VolumeContextKeyServiceAccountToken], s.driver.config.TsEndpoint)
+	ts = s.driver.config.TokenManager.GetDownscopedTokenSource(ts, boundary, s.driver.config.TsEndpoint)
+
+	return true, s.tokenServers.serve(targetPath, func() (net.Listener, error) { return listener.ListenTokenSocket(targetPath) }, ts)
+}
+
 // prepareStorageService prepares the GCS Storage Service using the Kubernetes Service Account from VolumeContext.
-func (s *nodeServer) prepareStorageService(ctx context.Context, vc map[string]string) (storage.Service, error) {
-	ts := s.driver.config.TokenManager.GetTokenSourceFromK8sServiceAccount(vc[VolumeContextKeyPodNamespace], vc[VolumeContextKeyServiceAccountName], vc[VolumeContextKeyServiceAccountToken], s.driver.config.TsEndpoint)
-	storageService, err := s.storageServiceManager.SetupService(ctx, ts, s.driver.config.StorageEndpoint)
+// If token downscoping is enabled, the Storage Service can only read the bucket.
+func (s *nodeServer) prepareStorageService(ctx context.Context, vc map[string]string, bucketName string) (storage.Service, error) {
+	ts := s.driver.config.TokenManager.GetTokenSourceFromK8sServiceAccount(vc[volumespec.VolumeContextKeyPodNamespace], vc[volumespec.VolumeContextKeyServiceAccountName], vc[volumespec.VolumeContextKeyServiceAccountToken], s.driver.config.TsEndpoint)
+	if s.driver.config.EnableTokenDownscoping {
+		ts = s.driver.config.TokenManager.GetDownscopedTokenSource(ts, auth.AccessBoundary{BucketName: bucketName, ReadOnly: true}, s.driver.config.TsEndpoint)
+	}
+	// The quotaProject volume attribute overrides the driver-wide quota project.
+	quotaProject := s.driver.config.QuotaProject
+	if qp, ok := vc[volumespec.VolumeContextKeyQuotaProject]; ok && qp != "" {
+		quotaProject = qp
+	}
+
+	storageService, err := s.storageServiceManager.SetupService(ctx, ts, s.driver.config.StorageEndpoint, quotaProject)
 	if err != nil {
 		return nil, fmt.Errorf("storage service manager failed to setup service: %w", err)
 	}
 
+	if s.bucketCache != nil {
+		storageService = s.bucketCache.NewCachedService(storageService, vc[volumespec.VolumeContextKeyPodNamespace]+"/"+vc[volumespec.VolumeContextKeyServiceAccountName])
+	}
+
 	return storageService, nil
 }
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// nodeHealthCheckInterval is the interval of checking the driver registration and the node driver Pod restarts.
+	nodeHealthCheckInterval = time.Minute
+
+	eventReasonPluginNotRegistered = "PluginNotRegistered"
+	eventReasonPluginRegistered    = "PluginRegistered"
+	eventReasonContainerRestarted  = "ContainerRestarted"
+)
+
+// nodeHealthMonitor reports the driver registration with the kubelet, and the restarts of
+// the node driver Pod containers, as metrics and events.
+type nodeHealthMonitor struct {
+	driverName   string
+	nodeName     string
+	podNamespace string
+	podName      string
+	k8sClients   clientset.Interface
+	recorder     record.EventRecorder
+
+	// registered is nil until the first successful registration check.
+	registered    *bool
+	restartCounts map[string]int32
+}
+
+func newNodeHealthMonitor(config *GCSDriverConfig, recorder record.EventRecorder) *nodeHealthMonitor {
+	return &nodeHealthMonitor{
+		driverName:    config.Name,
+		nodeName:      config.NodeID,
+		podNamespace:  config.PodNamespace,
+		podName:       config.PodName,
+		k8sClients:    config.K8sClients,
+		recorder:      recorder,
+		restartCounts: map[string]int32{},
+	}
+}
+
+// run checks the node health periodically until the context is cancelled.
+// The first check is delayed by one interval to give the node-driver-registrar time to register the driver.
+func (m *nodeHealthMonitor) run(ctx context.Context) {
+	metrics.NodeDriverStartTime.Set(float64(time.Now().Unix()))
+
+	ticker := time.NewTicker(nodeHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkRegistration(ctx)
+			m.checkRestarts(ctx)
+		}
+	}
+}
+
+// checkRegistration checks if the kubelet has the driver registered in the CSINode object.
+// An event is recorded on the Node when the registration status changes.
+func (m *nodeHealthMonitor) checkRegistration(ctx context.Context) {
+	registered := false
+	csiNode, err := m.k8sClients.GetCSINode(ctx, m.nodeName)
+	switch {
+	case err == nil:
+		for _, d := range csiNode.Spec.Drivers {
+			if d.Name == m.driverName {
+				registered = true
+
+				break
+			}
+		}
+	case !apierrors.IsNotFound(err):
+		metrics.NodePluginRegistrationCheckErrorTotal.Inc()
+		klog.Errorf("failed to get CSINode %q: %v", m.nodeName, err)
+
+		return
+	}
+
+	if registered {
+		metrics.NodePluginRegistered.Set(1)
+	} else {
+		metrics.NodePluginRegistered.Set(0)
+	}
+
+	// The kubelet uses the node name as the UID of the Node object reference for events.
+	nodeRef := &v1.ObjectReference{Kind: "Node", Name: m.nodeName, UID: types.UID(m.nodeName)}
+	switch {
+	case !registered && (m.registered == nil || *m.registered):
+		klog.Warningf("the CSI driver %q is not registered with the kubelet on node %q", m.driverName, m.nodeName)
+		m.recorder.Eventf(nodeRef, v1.EventTypeWarning, eventReasonPluginNotRegistered,
+			"The CSI driver %v is not registered with the kubelet, volumes using the driver cannot be mounted on this node", m.driverName)
+	case registered && m.registered != nil && !*m.registered:
+		m.recorder.Eventf(nodeRef, v1.EventTypeNormal, eventReasonPluginRegistered,
+			"The CSI driver %v is registered with the kubelet", m.driverName)
+	}
+	m.registered = &registered
+}
+
+// checkRestarts reports the restart count of each container in the node driver Pod.
+// An event is recorded on the Pod when a new restart is observed.
+func (m *nodeHealthMonitor) checkRestarts(ctx context.Context) {
+	if m.podName == "" || m.podNamespace == "" {
+		return
+	}
+
+	pod, err := m.k8sClients.GetPod(ctx, m.podNamespace, m.podName)
+	if err != nil {
+		klog.Errorf("failed to get the node driver Pod %s/%s: %v", m.podNamespace, m.podName, err)
+
+		return
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		metrics.NodeContainerRestarts.WithLabelValues(cs.Name).Set(float64(cs.RestartCount))
+
+		if cs.RestartCount > m.restartCounts[cs.Name] {
+			reason, exitCode := "unknown", int32(0)
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				reason, exitCode = t.Reason, t.ExitCode
+			}
+			m.recorder.Eventf(pod, v1.EventTypeWarning, eventReasonContainerRestarted,
+				"Container %v restarted %v times, last termination reason: %v, exit code: %v", cs.Name, cs.RestartCount, reason, exitCode)
+		}
+		m.restartCounts[cs.Name] = cs.RestartCount
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeHealthClientset struct {
+	clientset.FakeClientset
+	csiNodeDrivers []string
+	pod            *v1.Pod
+}
+
+func (c *fakeHealthClientset) GetCSINode(_ context.Context, name string) (*storagev1.CSINode, error) {
+	csiNode := &storagev1.CSINode{}
+	csiNode.Name = name
+	for _, d := range c.csiNodeDrivers {
+		csiNode.Spec.Drivers = append(csiNode.Spec.Drivers, storagev1.CSINodeDriver{Name: d})
+	}
+
+	return csiNode, nil
+}
+
+func (c *fakeHealthClientset) GetPod(_ context.Context, _, _ string) (*v1.Pod, error) {
+	return c.pod, nil
+}
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	events := []string{}
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestNodeHealthMonitorCheckRegistration(t *testing.T) {
+	t.Parallel()
+	fakeClients := &fakeHealthClientset{}
+	recorder := record.NewFakeRecorder(10)
+	m := newNodeHealthMonitor(&GCSDriverConfig{Name: DefaultName, NodeID: "test-node", K8sClients: fakeClients}, recorder)
+
+	cases := []struct {
+		name           string
+		drivers        []string
+		expectedEvents []string
+	}{
+		{
+			name:           "not registered on the first check",
+			drivers:        []string{"pd.csi.storage.gke.io"},
+			expectedEvents: []string{"Warning PluginNotRegistered The CSI driver gcsfuse.csi.storage.gke.io is not registered with the kubelet, volumes using the driver cannot be mounted on this node"},
+		},
+		{
+			name:           "still not registered",
+			drivers:        []string{},
+			expectedEvents: []string{},
+		},
+		{
+			name:           "registered",
+			drivers:        []string{DefaultName},
+			expectedEvents: []string{"Normal PluginRegistered The CSI driver gcsfuse.csi.storage.gke.io is registered with the kubelet"},
+		},
+		{
+			name:           "still registered",
+			drivers:        []string{DefaultName},
+			expectedEvents: []string{},
+		},
+		{
+			name:           "deregistered",
+			drivers:        []string{},
+			expectedEvents: []string{"Warning PluginNotRegistered The CSI driver gcsfuse.csi.storage.gke.io is not registered with the kubelet, volumes using the driver cannot be mounted on this node"},
+		},
+	}
+
+	for _, test := range cases {
+		fakeClients.csiNodeDrivers = test.drivers
+		m.checkRegistration(context.TODO())
+		events := drainEvents(recorder)
+		if !reflect.DeepEqual(events, test.expectedEvents) {
+			t.Errorf("test %q failed:\ngot events %v,\nexpected %v", test.name, events, test.expectedEvents)
+		}
+	}
+}
+
+func TestNodeHealthMonitorCheckRestarts(t *testing.T) {
+	t.Parallel()
+	fakeClients := &fakeHealthClientset{}
+	recorder := record.NewFakeRecorder(10)
+	m := newNodeHealthMonitor(&GCSDriverConfig{Name: DefaultName, NodeID: "test-node", K8sClients: fakeClients, PodNamespace: "gcs-fuse-csi-driver", PodName: "gcsfusecsi-node-test"}, recorder)
+
+	newPod := func(restartCount int32) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			{Name: "csi-driver-registrar"},
+			{
+				Name:         "gcs-fuse-csi-driver",
+				RestartCount: restartCount,
+				LastTerminationState: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 2},
+				},
+			},
+		}
+
+		return pod
+	}
+
+	cases := []struct {
+		name           string
+		pod            *v1.Pod
+		expectedEvents []string
+	}{
+		{
+			name:           "no restarts",
+			pod:            newPod(0),
+			expectedEvents: []string{},
+		},
+		{
+			name:           "driver container restarted",
+			pod:            newPod(1),
+			expectedEvents: []string{"Warning ContainerRestarted Container gcs-fuse-csi-driver restarted 1 times, last termination reason: Error, exit code: 2"},
+		},
+		{
+			name:           "no new restarts",
+			pod:            newPod(1),
+			expectedEvents: []string{},
+		},
+	}
+
+	for _, test := range cases {
+		fakeClients.pod = test.pod
+		m.checkRestarts(context.TODO())
+		events := drainEvents(recorder)
+		if !reflect.DeepEqual(events, test.expectedEvents) {
+			t.Errorf("test %q failed:\ngot events %v,\nexpected %v", test.name, events, test.expectedEvents)
+		}
+	}
+}
@@ -18,17 +18,33 @@ limitations under the License.
 package driver
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"testing"
 
+	gcs "cloud.google.com/go/storage"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	csimounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_mounter"
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	mount "k8s.io/mount-utils"
 )
 
@@ -41,6 +57,40 @@ var testVolumeCapability = &csi.VolumeCapability{
 	},
 }
 
+type fakeNodeClientset struct {
+	clientset.FakeClientset
+	labels map[string]string
+}
+
+func (c *fakeNodeClientset) GetNode(ctx context.Context, name string) (*v1.Node, error) {
+	node, err := c.FakeClientset.GetNode(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	node.Labels = c.labels
+
+	return node, nil
+}
+
+type fakeTerminatingPodClientset struct {
+	clientset.FakeClientset
+	deleted bool
+}
+
+func (c *fakeTerminatingPodClientset) GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error) {
+	if c.deleted {
+		return nil, apierrors.NewNotFound(v1.Resource("pods"), name)
+	}
+	pod, err := c.FakeClientset.GetPod(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+
+	return pod, nil
+}
+
 type nodeServerTestEnv struct {
 	ns csi.NodeServer
 	fm *mount.FakeMounter
@@ -50,7 +100,7 @@ func initTestNodeServer(t *testing.T) *nodeServerTestEnv {
 	t.Helper()
 	mounter := mount.NewFakeMounter([]mount.MountPoint{})
 	driver := initTestDriver(t, mounter)
-	s, _ := driver.config.StorageServiceManager.SetupService(context.TODO(), nil, "")
+	s, _ := driver.config.StorageServiceManager.SetupService(context.TODO(), nil, "", "")
 	if _, err := s.CreateBucket(context.Background(), &storage.ServiceBucket{Name: testVolumeID}); err != nil {
 		t.Fatalf("failed to create the fake bucket: %v", err)
 	}
@@ -81,11 +131,15 @@ func TestNodePublishVolume(t *testing.T) {
 	defer os.RemoveAll(base)
 
 	cases := []struct {
-		name          string
-		mounts        []mount.MountPoint // already existing mounts
-		req           *csi.NodePublishVolumeRequest
-		expectedMount *mount.MountPoint
-		expectErr     error
+		name                 string
+		mounts               []mount.MountPoint // already existing mounts
+		driverConfig         *driverconfig.Spec
+		instanceType         string // enables the machine type defaults if set
+		cacheDir             string // the node driver shared cache directory
+		sharedCacheMaxSizeMB int
+		req                  *csi.NodePublishVolumeRequest
+		expectedMount        *mount.MountPoint
+		expectErr            error
 	}{
 		{
 			name:      "empty request",
@@ -103,6 +157,26 @@ func TestNodePublishVolume(t *testing.T) {
 		},
 		{
 			name:   "valid request already mounted",
+			mounts: []mount.MountPoint{{Device: testVolumeID, Path: testTargetPath, Type: "fuse"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse"},
+		},
+		{
+			name:   "retry already mounted skipping the bucket access check",
+			mounts: []mount.MountPoint{{Device: "missing-bucket", Path: testTargetPath, Type: "fuse"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         "missing-bucket",
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+			},
+			expectedMount: &mount.MountPoint{Device: "missing-bucket", Path: testTargetPath, Type: "fuse"},
+		},
+		{
+			name:   "target path already mounted with another bucket",
 			mounts: []mount.MountPoint{{Device: "/test-device", Path: testTargetPath}},
 			req: &csi.NodePublishVolumeRequest{
 				VolumeId:         testVolumeID,
@@ -110,6 +184,7 @@ func TestNodePublishVolume(t *testing.T) {
 				VolumeCapability: testVolumeCapability,
 			},
 			expectedMount: &mount.MountPoint{Device: "/test-device", Path: testTargetPath},
+			expectErr:     status.Errorf(codes.AlreadyExists, "target path %q is already mounted with bucket %q", testTargetPath, "/test-device"),
 		},
 		{
 			name: "valid request with user mount options",
@@ -129,6 +204,297 @@ func TestNodePublishVolume(t *testing.T) {
 			},
 			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"foo", "bar"}},
 		},
+		{
+			name: "valid request with disallowed storage endpoint mount option",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "foo,storage-endpoint=https://example.com"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"foo"}},
+		},
+		{
+			name: "valid request with metrics export interval",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMetricsExportInterval: "60s"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"stackdriver-export-interval=1m0s"}},
+		},
+		{
+			name: "invalid metrics export interval",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMetricsExportInterval: "1s"},
+			},
+			expectErr: status.Error(codes.InvalidArgument, `NodePublishVolume VolumeContext "metricsExportInterval" must be a duration of at least 10s, got "1s"`),
+		},
+		{
+			name: "bucket not found",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         "missing-bucket",
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+			},
+			expectErr: newMountError(codes.NotFound, mountErrorBucketNotFound, "failed to get GCS bucket %q: %v", "missing-bucket", gcs.ErrBucketNotExist),
+		},
+		{
+			name: "valid request skipping the bucket access check",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         "missing-bucket",
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeySkipBucketAccessCheck: "true"},
+			},
+			expectedMount: &mount.MountPoint{Device: "missing-bucket", Path: testTargetPath, Type: "fuse"},
+		},
+		{
+			name: "invalid skip bucket access check",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeySkipBucketAccessCheck: "yes"},
+			},
+			expectErr: status.Error(codes.InvalidArgument, `NodePublishVolume VolumeContext "skipBucketAccessCheck" must be a boolean, got "yes"`),
+		},
+		{
+			name:         "valid request with bucket allowed by the driver config",
+			driverConfig: &driverconfig.Spec{BucketAllowlist: []string{"test-*"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse"},
+		},
+		{
+			name:         "bucket not allowed by the driver config",
+			driverConfig: &driverconfig.Spec{BucketAllowlist: []string{"other-bucket"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+			},
+			expectErr: newMountError(codes.PermissionDenied, mountErrorBucketNotAllowed, "bucket %q is not allowed by the driver config", testVolumeID),
+		},
+		{
+			name:         "mount option not allowed by the driver config",
+			driverConfig: &driverconfig.Spec{MountOptionAllowlist: []string{"implicit-dirs"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "implicit-dirs,uid=1001"},
+			},
+			expectErr: newMountError(codes.InvalidArgument, mountErrorMountOptionNotAllowed, "mount option %q is not allowed by the driver config", "uid=1001"),
+		},
+		{
+			name:         "valid request with an SELinux context of a multi-category level and a mount option allowlist",
+			driverConfig: &driverconfig.Spec{MountOptionAllowlist: []string{"implicit-dirs"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: `implicit-dirs,context="system_u:object_r:container_file_t:s0:c1,c2"`},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{`context="system_u:object_r:container_file_t:s0:c1,c2"`, "implicit-dirs"}},
+		},
+		{
+			name:         "valid request with default mount options of the driver config",
+			driverConfig: &driverconfig.Spec{DefaultMountOptions: []string{"stat-cache-ttl=1h", "implicit-dirs"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "stat-cache-ttl=10s"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"stat-cache-ttl=10s", "implicit-dirs"}},
+		},
+		{
+			name:         "valid request with machine type defaults",
+			instanceType: "a3-highgpu-8g",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "max-conns-per-host=10"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"max-conns-per-host=10", "sequential-read-size-mb=1024", "stat-cache-capacity=100000"}},
+		},
+		{
+			name: "valid request with deprecated mount options",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "max-retry-duration=30s,enable-storage-client-library,implicit-dirs"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"implicit-dirs", "max-retry-sleep=30s"}},
+		},
+		{
+			name:         "valid request with machine type defaults not in the mount option allowlist",
+			instanceType: "c3-standard-8",
+			driverConfig: &driverconfig.Spec{MountOptionAllowlist: []string{"implicit-dirs", "stat-cache-capacity"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "implicit-dirs"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"implicit-dirs", "stat-cache-capacity=20000"}},
+		},
+		{
+			name:         "valid request with machine type defaults of a family without recommendations",
+			instanceType: "e2-standard-4",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "implicit-dirs"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"implicit-dirs"}},
+		},
+		{
+			name: "valid request with request priority",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "max-conns-per-host=50", volumespec.VolumeContextKeyRequestPriority: "throughput-batch"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"max-conns-per-host=50", "max-retry-sleep=5m", "retry-multiplier=3"}},
+		},
+		{
+			name:         "valid request with request priority not in the mount option allowlist",
+			driverConfig: &driverconfig.Spec{MountOptionAllowlist: []string{"implicit-dirs"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "implicit-dirs", volumespec.VolumeContextKeyRequestPriority: "throughput-batch"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"implicit-dirs", "max-conns-per-host=10", "max-retry-sleep=5m", "retry-multiplier=3"}},
+		},
+		{
+			name: "invalid request with unknown request priority",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyRequestPriority: "high"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be one of %q and %q, got %q", volumespec.VolumeContextKeyRequestPriority, "latency-sensitive", "throughput-batch", "high"),
+		},
+		{
+			name: "valid request with parallel downloads",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "file-cache-max-size-mb=-1,file-cache-max-parallel-downloads=8", webhook.VolumeAttributeDownloadChunkSizeMb: "100"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"file-cache-download-chunk-size-mb=100", "file-cache-enable-parallel-downloads", "file-cache-max-parallel-downloads=8", "file-cache-max-size-mb=-1"}},
+		},
+		{
+			name:         "valid request with parallel downloads not in the mount option allowlist",
+			driverConfig: &driverconfig.Spec{MountOptionAllowlist: []string{"file-cache-max-size-mb"}},
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "file-cache-max-size-mb=-1", webhook.VolumeAttributeMaxParallelDownloads: "32"},
+			},
+			expectedMount: &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"file-cache-download-chunk-size-mb=50", "file-cache-enable-parallel-downloads", "file-cache-max-parallel-downloads=32", "file-cache-max-size-mb=-1"}},
+		},
+		{
+			name: "invalid request with parallel downloads without the file cache",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{webhook.VolumeAttributeMaxParallelDownloads: "32"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q and %q require the file cache, set the file-cache-max-size-mb mount option", webhook.VolumeAttributeDownloadChunkSizeMb, webhook.VolumeAttributeMaxParallelDownloads),
+		},
+		{
+			name: "invalid request with parallel downloads chunk size",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyMountOptions: "file-cache-max-size-mb=-1", webhook.VolumeAttributeDownloadChunkSizeMb: "0"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext is invalid: volume attribute %q must be an integer between 1 and %d, got %q", webhook.VolumeAttributeDownloadChunkSizeMb, 1024, "0"),
+		},
+		{
+			name:     "valid request with shared file cache",
+			cacheDir: "/var/lib/gcsfuse-csi/cache",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				Readonly:         true,
+				VolumeContext: map[string]string{
+					volumespec.VolumeContextKeyFileCacheShared:    "true",
+					volumespec.VolumeContextKeyMountOptions:       "file-cache-max-size-mb=-1",
+					volumespec.VolumeContextKeyPodNamespace:       "test-ns",
+					volumespec.VolumeContextKeyServiceAccountName: "test-sa",
+				},
+			},
+			sharedCacheMaxSizeMB: 1024,
+			expectedMount:        &mount.MountPoint{Device: testVolumeID, Path: testTargetPath, Type: "fuse", Opts: []string{"file-cache-max-size-mb=1024", "ro", "shared-cache-dir=/var/lib/gcsfuse-csi/cache/test-ns/test-sa/" + testVolumeID}},
+		},
+		{
+			name:     "invalid request with shared file cache without the Pod service account",
+			cacheDir: "/var/lib/gcsfuse-csi/cache",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				Readonly:         true,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyFileCacheShared: "true"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q requires the Pod namespace and service account", volumespec.VolumeContextKeyFileCacheShared),
+		},
+		{
+			name: "invalid request with shared file cache not configured",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				Readonly:         true,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyFileCacheShared: "true"},
+			},
+			expectErr: status.Errorf(codes.FailedPrecondition, "NodePublishVolume VolumeContext %q is set, but the node driver shared cache directory is not configured", volumespec.VolumeContextKeyFileCacheShared),
+		},
+		{
+			name:     "invalid request with shared file cache of a read-write volume",
+			cacheDir: "/var/lib/gcsfuse-csi/cache",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyFileCacheShared: "true"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q is only supported by read-only volumes", volumespec.VolumeContextKeyFileCacheShared),
+		},
+		{
+			name:     "invalid request with shared file cache attribute",
+			cacheDir: "/var/lib/gcsfuse-csi/cache",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:         testVolumeID,
+				TargetPath:       testTargetPath,
+				VolumeCapability: testVolumeCapability,
+				VolumeContext:    map[string]string{volumespec.VolumeContextKeyFileCacheShared: "yes"},
+			},
+			expectErr: status.Errorf(codes.InvalidArgument, "NodePublishVolume VolumeContext %q must be a boolean, got %q", volumespec.VolumeContextKeyFileCacheShared, "yes"),
+		},
 		{
 			name: "valid request read only",
 			req: &csi.NodePublishVolumeRequest{
@@ -162,6 +528,15 @@ func TestNodePublishVolume(t *testing.T) {
 		if test.mounts != nil {
 			testEnv.fm.MountPoints = test.mounts
 		}
+		if test.driverConfig != nil {
+			testEnv.ns.(*nodeServer).driver.config.DriverConfig = driverconfig.NewFakeWatcher(test.driverConfig)
+		}
+		testEnv.ns.(*nodeServer).driver.config.SharedCacheDir = test.cacheDir
+		testEnv.ns.(*nodeServer).driver.config.SharedCacheMaxSizeMB = test.sharedCacheMaxSizeMB
+		if test.instanceType != "" {
+			testEnv.ns.(*nodeServer).driver.config.EnableMachineTypeDefaults = true
+			testEnv.ns.(*nodeServer).k8sClients = &fakeNodeClientset{labels: map[string]string{v1.LabelInstanceTypeStable: test.instanceType}}
+		}
 
 		_, err := testEnv.ns.NodePublishVolume(context.TODO(), test.req)
 		if test.expectErr == nil && err != nil {
@@ -246,6 +621,194 @@ func TestNodeUnpublishVolume(t *testing.T) {
 	}
 }
 
+func TestNodeGetRegionalEndpoint(t *testing.T) {
+	t.Parallel()
+	mounter := mount.NewFakeMounter([]mount.MountPoint{})
+	driver := initTestDriver(t, mounter)
+	s, _ := driver.config.StorageServiceManager.SetupService(context.TODO(), nil, "", "")
+	buckets := []*storage.ServiceBucket{
+		{Name: "regional-bucket", Location: "US-CENTRAL1", LocationType: "region"},
+		{Name: "multi-regional-bucket", Location: "US", LocationType: "multi-region"},
+	}
+	for _, b := range buckets {
+		if _, err := s.CreateBucket(context.Background(), b); err != nil {
+			t.Fatalf("failed to create the fake bucket: %v", err)
+		}
+	}
+	ns, _ := newNodeServer(driver, mounter).(*nodeServer)
+
+	cases := []struct {
+		name             string
+		bucketName       string
+		expectedEndpoint string
+	}{
+		{
+			name:             "regional bucket",
+			bucketName:       "regional-bucket",
+			expectedEndpoint: "https://storage.us-central1.rep.googleapis.com",
+		},
+		{
+			name:       "multi-regional bucket",
+			bucketName: "multi-regional-bucket",
+		},
+		{
+			name:       "bucket location lookup failed",
+			bucketName: "non-existing-bucket",
+		},
+	}
+
+	for _, test := range cases {
+		endpoint := ns.getRegionalEndpoint(context.TODO(), s, test.bucketName)
+		if endpoint != test.expectedEndpoint {
+			t.Errorf("test %q failed:\ngot endpoint %q,\nexpected endpoint %q", test.name, endpoint, test.expectedEndpoint)
+		}
+	}
+}
+
+func TestNodeAuditIdentity(t *testing.T) {
+	t.Parallel()
+	mounter := mount.NewFakeMounter([]mount.MountPoint{})
+	driver := initTestDriver(t, mounter)
+	driver.config.EnableIdentityAuditEvents = true
+	recorder := record.NewFakeRecorder(1)
+	driver.recorder = recorder
+	ns, _ := newNodeServer(driver, mounter).(*nodeServer)
+
+	vc := map[string]string{
+		volumespec.VolumeContextKeyPodNamespace:       "test-ns",
+		volumespec.VolumeContextKeyPodName:            "test-pod",
+		volumespec.VolumeContextKeyServiceAccountName: "test-ksa",
+	}
+	pod, _ := driver.config.K8sClients.GetPod(context.TODO(), "test-ns", "test-pod")
+	ns.auditIdentity(context.TODO(), pod, vc, testVolumeID)
+
+	expectedEvent := `Normal GCPIdentityResolved Bucket "test-volume-id" is accessed with the GCP identity chain test-ns/test-ksa -> serviceAccount:test-project.svc.id.goog[test-ns/test-ksa]`
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("got event %q, expected %q", event, expectedEvent)
+		}
+	default:
+		t.Errorf("expected event %q, got none", expectedEvent)
+	}
+}
+
+func TestNodeEchoMountOptions(t *testing.T) {
+	t.Parallel()
+	mounter := mount.NewFakeMounter([]mount.MountPoint{})
+	driver := initTestDriver(t, mounter)
+	driver.config.EnableMountConfigEvents = true
+	recorder := record.NewFakeRecorder(1)
+	driver.recorder = recorder
+	ns, _ := newNodeServer(driver, mounter).(*nodeServer)
+
+	pod, _ := driver.config.K8sClients.GetPod(context.TODO(), "test-ns", "test-pod")
+	ns.echoMountOptions(context.TODO(), pod, testVolumeID, []string{"implicit-dirs", "key-file=/etc/sa.json", "ro"})
+
+	expectedEvent := `Normal MountOptionsResolved Bucket "test-volume-id" is mounted with the options "implicit-dirs,key-file=REDACTED,ro"`
+	select {
+	case event := <-recorder.Events:
+		if event != expectedEvent {
+			t.Errorf("got event %q, expected %q", event, expectedEvent)
+		}
+	default:
+		t.Errorf("expected event %q, got none", expectedEvent)
+	}
+}
+
+func TestNodeGetInfo(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name             string
+		labels           map[string]string
+		expectedTopology *csi.Topology
+	}{
+		{
+			name:   "node with zone and region labels",
+			labels: map[string]string{v1.LabelTopologyZone: "us-central1-c", v1.LabelTopologyRegion: "us-central1", v1.LabelHostname: "test-node"},
+			expectedTopology: &csi.Topology{Segments: map[string]string{
+				TopologyKeyZone:   "us-central1-c",
+				TopologyKeyRegion: "us-central1",
+			}},
+		},
+		{
+			name: "node without topology labels",
+		},
+	}
+
+	for _, tc := range cases {
+		testEnv := initTestNodeServer(t)
+		testEnv.ns.(*nodeServer).k8sClients = &fakeNodeClientset{labels: tc.labels}
+
+		resp, err := testEnv.ns.NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+		if err != nil {
+			t.Fatalf("test %q failed: NodeGetInfo failed: %v", tc.name, err)
+		}
+		if resp.GetNodeId() != testEnv.ns.(*nodeServer).driver.config.NodeID {
+			t.Errorf("test %q failed: got node ID %q", tc.name, resp.GetNodeId())
+		}
+		if !reflect.DeepEqual(resp.GetAccessibleTopology().GetSegments(), tc.expectedTopology.GetSegments()) {
+			t.Errorf("test %q failed: got topology %v, expected %v", tc.name, resp.GetAccessibleTopology(), tc.expectedTopology)
+		}
+	}
+}
+
+func TestNodeCheckStagingSpace(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name          string
+		stagingSize   string
+		sizeLimit     string
+		expectedEvent string
+	}{
+		{
+			name:        "staging space within the sidecar container ephemeral-storage limit",
+			stagingSize: "5Gi",
+		},
+		{
+			name:          "staging space above the sidecar container ephemeral-storage limit",
+			stagingSize:   "10Gi",
+			expectedEvent: `Warning StagingSpaceTooLow Bucket "test-volume-id" requires 10Gi staging space for the written files, but the gcsfuse sidecar container has 5Gi, the Pod may be evicted when writing large files. Set the Pod annotation "gke-gcsfuse/ephemeral-storage-limit" to at least the total staging space of the volumes`,
+		},
+		{
+			name:          "staging space above the emptyDir size limit",
+			stagingSize:   "2Gi",
+			sizeLimit:     "1Gi",
+			expectedEvent: `Warning StagingSpaceTooLow Bucket "test-volume-id" requires 2Gi staging space for the written files, but the gcsfuse sidecar container has 1Gi, the Pod may be evicted when writing large files. Set the Pod annotation "gke-gcsfuse/ephemeral-storage-limit" to at least the total staging space of the volumes`,
+		},
+	}
+
+	for _, tc := range cases {
+		mounter := mount.NewFakeMounter([]mount.MountPoint{})
+		driver := initTestDriver(t, mounter)
+		recorder := record.NewFakeRecorder(1)
+		driver.recorder = recorder
+		ns, _ := newNodeServer(driver, mounter).(*nodeServer)
+
+		pod, _ := driver.config.K8sClients.GetPod(context.TODO(), "test-ns", "test-pod")
+		if tc.sizeLimit != "" {
+			q := resource.MustParse(tc.sizeLimit)
+			for i := range pod.Spec.Volumes {
+				if pod.Spec.Volumes[i].EmptyDir != nil {
+					pod.Spec.Volumes[i].EmptyDir.SizeLimit = &q
+				}
+			}
+		}
+		ns.checkStagingSpace(pod, testVolumeID, resource.MustParse(tc.stagingSize))
+
+		select {
+		case event := <-recorder.Events:
+			if event != tc.expectedEvent {
+				t.Errorf("test %q failed: got event %q, expected %q", tc.name, event, tc.expectedEvent)
+			}
+		default:
+			if tc.expectedEvent != "" {
+				t.Errorf("test %q failed: expected event %q, got none", tc.name, tc.expectedEvent)
+			}
+		}
+	}
+}
+
 func validateMountPoint(t *testing.T, name string, fm *mount.FakeMounter, e *mount.MountPoint) {
 	t.Helper()
 	if e == nil {
@@ -294,3 +857,157 @@ func validateMountPoint(t *testing.T, name string, fm *mount.FakeMounter, e *mou
 		}
 	}
 }
+
+func TestNodePublishVolumeHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+	defaultPerm := os.FileMode(0o750) + os.ModeDir
+
+	cases := []struct {
+		name             string
+		handshakeTimeout *csimounter.HandshakeTimeout
+		gcsfuseReady     bool
+		expectErr        error
+		expectRemoved    bool
+	}{
+		{
+			name:             "sidecar container did not receive the file descriptor, the retry mounts again",
+			handshakeTimeout: &csimounter.HandshakeTimeout{Phase: metrics.MountPhaseFDHandoff, Timeout: "15m0s"},
+			expectErr: newMountError(codes.DeadlineExceeded, mountErrorHandshakeTimeout, "the mount handshake is stuck in phase %q: %v",
+				metrics.MountPhaseFDHandoff, "the sidecar container did not receive the FUSE file descriptor within 15m0s"),
+			expectRemoved: true,
+		},
+		{
+			name:             "gcsfuse not ready",
+			handshakeTimeout: &csimounter.HandshakeTimeout{Phase: metrics.MountPhaseGCSFuseReady, Timeout: "5m0s"},
+			expectErr: newMountError(codes.DeadlineExceeded, mountErrorHandshakeTimeout, "the mount handshake is stuck in phase %q: %v",
+				metrics.MountPhaseGCSFuseReady, "gcsfuse did not serve the file system within 5m0s"),
+		},
+		{
+			name:             "gcsfuse ready after the deadline",
+			handshakeTimeout: &csimounter.HandshakeTimeout{Phase: metrics.MountPhaseGCSFuseReady, Timeout: "5m0s"},
+			gcsfuseReady:     true,
+			expectRemoved:    true,
+		},
+	}
+
+	for _, test := range cases {
+		tmpDir := "/tmp/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/"
+		if err := os.MkdirAll(tmpDir, defaultPerm); err != nil {
+			t.Fatalf("failed to setup tmp dir path: %v", err)
+		}
+		base, err := os.MkdirTemp(tmpDir, "node-publish-")
+		if err != nil {
+			t.Fatalf("failed to setup testdir: %v", err)
+		}
+		defer os.RemoveAll(base)
+		targetPath := filepath.Join(base, "mount")
+
+		emptyDirBasePath, err := util.PrepareEmptyDir(targetPath, true)
+		if err != nil {
+			t.Fatalf("failed to prepare emptyDir path: %v", err)
+		}
+		defer os.RemoveAll(emptyDirBasePath)
+		b, err := json.Marshal(test.handshakeTimeout)
+		if err != nil {
+			t.Fatalf("failed to marshal the handshake timeout: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(emptyDirBasePath, csimounter.HandshakeTimeoutFileName), b, 0o644); err != nil {
+			t.Fatalf("failed to write the handshake timeout file: %v", err)
+		}
+		if test.gcsfuseReady {
+			if err := os.WriteFile(filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName), nil, 0o644); err != nil {
+				t.Fatalf("failed to write the ready file: %v", err)
+			}
+		}
+
+		testEnv := initTestNodeServer(t)
+		_, err = testEnv.ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeId:         testVolumeID,
+			TargetPath:       targetPath,
+			VolumeCapability: testVolumeCapability,
+		})
+		if test.expectErr == nil && err != nil {
+			t.Errorf("test %q failed:\ngot error %q,\nexpected error nil", test.name, err)
+		}
+		if test.expectErr != nil && !errors.Is(err, test.expectErr) {
+			t.Errorf("test %q failed:\ngot error %q,\nexpected error %q", test.name, err, test.expectErr)
+		}
+		if _, err := os.Stat(filepath.Join(emptyDirBasePath, csimounter.HandshakeTimeoutFileName)); test.expectRemoved != os.IsNotExist(err) {
+			t.Errorf("test %q failed: got handshake timeout file stat error %v", test.name, err)
+		}
+	}
+}
+
+func TestNodePublishVolumeTerminatingPod(t *testing.T) {
+	t.Parallel()
+	defaultPerm := os.FileMode(0o750) + os.ModeDir
+
+	cases := []struct {
+		name             string
+		deleted          bool
+		mounted          bool
+		expectErr        error
+		expectedExitFile bool
+	}{
+		{
+			name:    "republish of a deleted Pod",
+			deleted: true,
+			mounted: true,
+		},
+		{
+			name:             "republish of a terminating Pod ignores the sidecar container error",
+			mounted:          true,
+			expectedExitFile: true,
+		},
+		{
+			name:      "mount of a terminating Pod",
+			expectErr: status.Error(codes.FailedPrecondition, "the Pod is terminating, skipping the mount"),
+		},
+	}
+
+	for _, test := range cases {
+		tmpDir := "/tmp/var/lib/kubelet/pods/test-terminating-pod-id/volumes/kubernetes.io~csi/"
+		if err := os.MkdirAll(tmpDir, defaultPerm); err != nil {
+			t.Fatalf("failed to setup tmp dir path: %v", err)
+		}
+		base, err := os.MkdirTemp(tmpDir, "node-publish-")
+		if err != nil {
+			t.Fatalf("failed to setup testdir: %v", err)
+		}
+		defer os.RemoveAll(base)
+		targetPath := filepath.Join(base, "mount")
+
+		emptyDirBasePath, err := util.PrepareEmptyDir(targetPath, true)
+		if err != nil {
+			t.Fatalf("failed to prepare emptyDir path: %v", err)
+		}
+		defer os.RemoveAll(emptyDirBasePath)
+		exitFilePath := filepath.Dir(emptyDirBasePath) + "/exit"
+		if err := os.Remove(exitFilePath); err != nil && !os.IsNotExist(err) {
+			t.Fatalf("failed to remove the exit file: %v", err)
+		}
+		if err := os.WriteFile(emptyDirBasePath+"/error", []byte("gcsfuse exited with error: signal: terminated"), 0o644); err != nil {
+			t.Fatalf("failed to write the error file: %v", err)
+		}
+
+		testEnv := initTestNodeServer(t)
+		testEnv.ns.(*nodeServer).k8sClients = &fakeTerminatingPodClientset{deleted: test.deleted}
+		if test.mounted {
+			testEnv.fm.MountPoints = []mount.MountPoint{{Device: testVolumeID, Path: targetPath, Type: "fuse"}}
+		}
+		_, err = testEnv.ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeId:         testVolumeID,
+			TargetPath:       targetPath,
+			VolumeCapability: testVolumeCapability,
+		})
+		if test.expectErr == nil && err != nil {
+			t.Errorf("test %q failed:\ngot error %q,\nexpected error nil", test.name, err)
+		}
+		if test.expectErr != nil && !errors.Is(err, test.expectErr) {
+			t.Errorf("test %q failed:\ngot error %q,\nexpected error %q", test.name, err, test.expectErr)
+		}
+		if _, err := os.Stat(exitFilePath); test.expectedExitFile != (err == nil) {
+			t.Errorf("test %q failed: got exit file stat error %v, expected exit file %v", test.name, err, test.expectedExitFile)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	mount "k8s.io/mount-utils"
+)
+
+const (
+	// orphanedDirGracePeriod is the minimum age of a volume directory before it is cleaned up,
+	// so that the directories of new Pods not yet observed by the Pod informer are kept.
+	orphanedDirGracePeriod = 10 * time.Minute
+)
+
+// orphanedDirJanitor removes the volume directories in the sidecar container emptyDir of the Pods that no longer exist,
+// e.g. after a node crash or a forced Pod deletion, where the gcsfuse temp files and the shared cache mount
+// can keep the kubelet from removing the Pod directory and slowly exhaust the node ephemeral storage.
+type orphanedDirJanitor struct {
+	podsDir     string
+	mounter     mount.Interface
+	k8sClients  clientset.Interface
+	gracePeriod time.Duration
+}
+
+func newOrphanedDirJanitor(config *GCSDriverConfig) *orphanedDirJanitor {
+	return &orphanedDirJanitor{
+		podsDir:     filepath.Join(config.KubeletRootDir, "pods"),
+		mounter:     config.Mounter,
+		k8sClients:  config.K8sClients,
+		gracePeriod: orphanedDirGracePeriod,
+	}
+}
+
+// run cleans up the orphaned volume directories periodically until the context is cancelled.
+func (j *orphanedDirJanitor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.cleanup()
+		}
+	}
+}
+
+// cleanup removes the volume directories of the Pods that are not scheduled to the node.
+// The Pods with a mount point under the CSI volume directories or the volume directories are skipped,
+// because the kubelet is still tearing down their volumes.
+func (j *orphanedDirJanitor) cleanup() {
+	pods, err := j.k8sClients.ListNodePods()
+	if err != nil {
+		klog.Errorf("failed to list the Pods on the node, skipping the orphaned volume directory cleanup: %v", err)
+
+		return
+	}
+	podUIDs := sets.NewString()
+	for _, pod := range pods {
+		podUIDs.Insert(string(pod.UID))
+	}
+
+	volumesDirs, err := filepath.Glob(filepath.Join(j.podsDir, "*", "volumes", "kubernetes.io~empty-dir", webhook.SidecarContainerVolumeName, ".volumes"))
+	if err != nil {
+		klog.Errorf("failed to find the sidecar volume directories: %v", err)
+
+		return
+	}
+
+	for _, volumesDir := range volumesDirs {
+		podUID := strings.TrimPrefix(volumesDir, j.podsDir+string(os.PathSeparator))
+		podUID, _, _ = strings.Cut(podUID, string(os.PathSeparator))
+		if podUIDs.Has(podUID) {
+			continue
+		}
+
+		entries, err := os.ReadDir(volumesDir)
+		if err != nil {
+			klog.Errorf("failed to read the sidecar volume directory %q: %v", volumesDir, err)
+
+			continue
+		}
+		for _, e := range entries {
+			j.cleanupVolumeDir(podUID, filepath.Join(volumesDir, e.Name()))
+		}
+	}
+}
+
+// cleanupVolumeDir unmounts the shared cache directory from the volume directory of a Pod that no longer exists,
+// and removes the volume directory once nothing is mounted in it.
+func (j *orphanedDirJanitor) cleanupVolumeDir(podUID, volumeDir string) {
+	info, err := os.Stat(volumeDir)
+	if err != nil || !info.IsDir() || time.Since(info.ModTime()) < j.gracePeriod {
+		return
+	}
+
+	if err := mount.CleanupMountPoint(filepath.Join(volumeDir, sidecarmounter.SharedCacheDirName), j.mounter, false /* extensiveMountPointCheck */); err != nil {
+		klog.Errorf("failed to unmount the shared cache directory of the orphaned volume directory %q: %v", volumeDir, err)
+		metrics.OrphanedVolumeDirCleanupTotal.WithLabelValues(metrics.CleanupResultError).Inc()
+
+		return
+	}
+
+	// Removing a directory with a mount point in it would remove the files of the mounted file system.
+	mps, err := j.mounter.List()
+	if err != nil {
+		klog.Errorf("failed to list the mount points: %v", err)
+
+		return
+	}
+	csiVolumesDir := filepath.Join(j.podsDir, podUID, "volumes", "kubernetes.io~csi") + string(os.PathSeparator)
+	for _, mp := range mps {
+		if strings.HasPrefix(mp.Path, csiVolumesDir) || strings.HasPrefix(mp.Path, volumeDir+string(os.PathSeparator)) {
+			klog.V(4).Infof("skipping the orphaned volume directory %q of Pod %q, mount point %q exists", volumeDir, podUID, mp.Path)
+
+			return
+		}
+	}
+
+	if err := os.RemoveAll(volumeDir); err != nil {
+		klog.Errorf("failed to remove the orphaned volume directory %q: %v", volumeDir, err)
+		metrics.OrphanedVolumeDirCleanupTotal.WithLabelValues(metrics.CleanupResultError).Inc()
+
+		return
+	}
+	klog.Infof("removed the orphaned volume directory %q of Pod %q that no longer exists", volumeDir, podUID)
+	metrics.OrphanedVolumeDirCleanupTotal.WithLabelValues(metrics.CleanupResultRemoved).Inc()
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	mount "k8s.io/mount-utils"
+)
+
+type fakePodListClientset struct {
+	clientset.FakeClientset
+	podUIDs []string
+}
+
+func (c *fakePodListClientset) ListNodePods() ([]*v1.Pod, error) {
+	pods := []*v1.Pod{}
+	for _, uid := range c.podUIDs {
+		pod := &v1.Pod{}
+		pod.UID = types.UID(uid)
+		pods = append(pods, pod)
+	}
+
+	return pods, nil
+}
+
+func TestOrphanedDirJanitorCleanup(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		podExists     bool
+		recent        bool
+		sharedCache   bool
+		csiMounted    bool
+		expectRemoved bool
+	}{
+		{
+			name:          "volume directory of a deleted Pod",
+			expectRemoved: true,
+		},
+		{
+			name:          "volume directory of a deleted Pod with the shared cache mounted",
+			sharedCache:   true,
+			expectRemoved: true,
+		},
+		{
+			name:      "volume directory of an existing Pod",
+			podExists: true,
+		},
+		{
+			name:   "recent volume directory of a Pod not yet observed",
+			recent: true,
+		},
+		{
+			name:       "volume directory of a deleted Pod with the CSI volume mounted",
+			csiMounted: true,
+		},
+	}
+
+	for _, tc := range cases {
+		podsDir := t.TempDir()
+		podUID := "test-pod-uid"
+		volumeDir := filepath.Join(podsDir, podUID, "volumes", "kubernetes.io~empty-dir", webhook.SidecarContainerVolumeName, ".volumes", "test-volume")
+		if err := os.MkdirAll(filepath.Join(volumeDir, "temp-dir"), 0o750); err != nil {
+			t.Fatalf("failed to create the volume directory: %v", err)
+		}
+
+		mps := []mount.MountPoint{}
+		if tc.sharedCache {
+			sharedCacheDir := filepath.Join(volumeDir, sidecarmounter.SharedCacheDirName)
+			if err := os.MkdirAll(sharedCacheDir, 0o750); err != nil {
+				t.Fatalf("failed to create the shared cache directory: %v", err)
+			}
+			mps = append(mps, mount.MountPoint{Device: "/var/lib/gcsfuse-csi/cache/test-bucket", Path: sharedCacheDir, Type: "none", Opts: []string{"bind"}})
+		}
+		if tc.csiMounted {
+			mps = append(mps, mount.MountPoint{Device: "test-bucket", Path: filepath.Join(podsDir, podUID, "volumes", "kubernetes.io~csi", "test-volume", "mount"), Type: "fuse"})
+		}
+
+		if !tc.recent {
+			old := time.Now().Add(-2 * orphanedDirGracePeriod)
+			if err := os.Chtimes(volumeDir, old, old); err != nil {
+				t.Fatalf("failed to change the volume directory times: %v", err)
+			}
+		}
+
+		k8sClients := &fakePodListClientset{}
+		if tc.podExists {
+			k8sClients.podUIDs = []string{podUID}
+		}
+		j := &orphanedDirJanitor{
+			podsDir:     podsDir,
+			mounter:     mount.NewFakeMounter(mps),
+			k8sClients:  k8sClients,
+			gracePeriod: orphanedDirGracePeriod,
+		}
+		j.cleanup()
+
+		_, err := os.Stat(volumeDir)
+		if removed := os.IsNotExist(err); removed != tc.expectRemoved {
+			t.Errorf("test %q failed: got volume directory removed %v, expected %v", tc.name, removed, tc.expectRemoved)
+		}
+	}
+}
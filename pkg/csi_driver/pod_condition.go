@@ -0,0 +1,131 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// PodConditionVolumesReady is the Pod condition set by the node driver once all the gcsfuse volumes of the Pod are mounted,
+// so that the readiness gates and the controllers can wait for the volumes explicitly.
+const PodConditionVolumesReady v1.PodConditionType = "gke-gcsfuse/volumes-ready"
+
+// updateVolumesReadyCondition sets the volumes ready condition of the Pod if all the gcsfuse volumes of the Pod are mounted.
+// It is called after each volume of the Pod is mounted, so the last mounted volume sets the condition.
+func (s *nodeServer) updateVolumesReadyCondition(ctx context.Context, pod *v1.Pod) {
+	if !s.driver.config.EnableReadyCondition || hasVolumesReadyCondition(pod) {
+		return
+	}
+
+	logger := klog.FromContext(ctx)
+	volumes, err := s.gcsfuseVolumeDirs(ctx, pod)
+	if err != nil {
+		logger.Error(err, "failed to find the gcsfuse volumes of the Pod, skipping the volumes ready condition")
+
+		return
+	}
+
+	mounted, err := s.mountedVolumeDirs(pod)
+	if err != nil {
+		logger.Error(err, "failed to list the mounted volumes of the Pod, skipping the volumes ready condition")
+
+		return
+	}
+	for _, v := range volumes {
+		if !mounted[v] {
+			logger.V(4).Info("waiting for the other gcsfuse volumes of the Pod to set the volumes ready condition", "volume", v)
+
+			return
+		}
+	}
+
+	condition := v1.PodCondition{
+		Type:               PodConditionVolumesReady,
+		Status:             v1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "VolumesMounted",
+		Message:            "All the Cloud Storage FUSE volumes of the Pod are mounted",
+	}
+	if err := s.k8sClients.PatchPodCondition(ctx, pod.Namespace, pod.Name, condition); err != nil {
+		logger.Error(err, "failed to set the volumes ready condition of the Pod")
+
+		return
+	}
+	logger.V(4).Info("set the volumes ready condition of the Pod", "volumes", len(volumes))
+}
+
+// hasVolumesReadyCondition returns true if the volumes ready condition of the Pod is already true.
+func hasVolumesReadyCondition(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == PodConditionVolumesReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// gcsfuseVolumeDirs returns the names of the kubelet volume directories of the gcsfuse volumes of the Pod,
+// which are the volume names of the CSI ephemeral volumes, and the PersistentVolume names of the PersistentVolumeClaims.
+func (s *nodeServer) gcsfuseVolumeDirs(ctx context.Context, pod *v1.Pod) ([]string, error) {
+	dirs := []string{}
+	for _, v := range pod.Spec.Volumes {
+		switch {
+		case v.CSI != nil && v.CSI.Driver == s.driver.config.Name:
+			dirs = append(dirs, v.Name)
+		case v.PersistentVolumeClaim != nil:
+			pvc, err := s.k8sClients.GetPersistentVolumeClaim(ctx, pod.Namespace, v.PersistentVolumeClaim.ClaimName)
+			if err != nil {
+				return nil, err
+			}
+			if pvc.Spec.VolumeName == "" {
+				continue
+			}
+			pv, err := s.k8sClients.GetPersistentVolume(ctx, pvc.Spec.VolumeName)
+			if err != nil {
+				return nil, err
+			}
+			if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == s.driver.config.Name {
+				dirs = append(dirs, pv.Name)
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+// mountedVolumeDirs returns the names of the kubelet volume directories of the Pod that are mounted.
+func (s *nodeServer) mountedVolumeDirs(pod *v1.Pod) (map[string]bool, error) {
+	mps, err := s.mounter.List()
+	if err != nil {
+		return nil, err
+	}
+
+	mounted := map[string]bool{}
+	for _, mp := range mps {
+		podID, volume, err := util.ParsePodIDVolumeFromTargetpath(mp.Path)
+		if err == nil && podID == string(pod.UID) {
+			mounted[volume] = true
+		}
+	}
+
+	return mounted, nil
+}
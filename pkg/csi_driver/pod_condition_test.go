@@ -0,0 +1,126 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mount "k8s.io/mount-utils"
+)
+
+type fakeConditionClientset struct {
+	clientset.FakeClientset
+	patched []v1.PodCondition
+}
+
+func (c *fakeConditionClientset) GetPersistentVolumeClaim(_ context.Context, namespace, name string) (*v1.PersistentVolumeClaim, error) {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-" + name},
+	}, nil
+}
+
+func (c *fakeConditionClientset) GetPersistentVolume(_ context.Context, name string) (*v1.PersistentVolume, error) {
+	driver := "test-driver"
+	if name == "pv-other-claim" {
+		driver = "other-driver"
+	}
+
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: driver}},
+		},
+	}, nil
+}
+
+func (c *fakeConditionClientset) PatchPodCondition(_ context.Context, _, _ string, condition v1.PodCondition) error {
+	c.patched = append(c.patched, condition)
+
+	return nil
+}
+
+func TestUpdateVolumesReadyCondition(t *testing.T) {
+	t.Parallel()
+	targetPath := func(volume string) string {
+		return "/var/lib/kubelet/pods/test-pod-id/volumes/kubernetes.io~csi/" + volume + "/mount"
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-ns", UID: "test-pod-id"},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{
+				{Name: "inline", VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{Driver: "test-driver"}}},
+				{Name: "claim", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "claim"}}},
+				{Name: "other", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "other-claim"}}},
+				{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		mounts          []string
+		conditionIsTrue bool
+		expectPatch     bool
+	}{
+		{
+			name:        "all the gcsfuse volumes are mounted",
+			mounts:      []string{targetPath("inline"), targetPath("pv-claim")},
+			expectPatch: true,
+		},
+		{
+			name:   "a gcsfuse volume is not mounted",
+			mounts: []string{targetPath("inline"), "/var/lib/kubelet/pods/other-pod-id/volumes/kubernetes.io~csi/pv-claim/mount"},
+		},
+		{
+			name:            "the condition is already true",
+			mounts:          []string{targetPath("inline"), targetPath("pv-claim")},
+			conditionIsTrue: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		mountPoints := []mount.MountPoint{}
+		for _, m := range tc.mounts {
+			mountPoints = append(mountPoints, mount.MountPoint{Device: testVolumeID, Path: m, Type: "fuse"})
+		}
+		fm := mount.NewFakeMounter(mountPoints)
+		testEnv := initTestNodeServer(t)
+		ns := testEnv.ns.(*nodeServer)
+		ns.mounter = fm
+		ns.driver.config.EnableReadyCondition = true
+		k8sClients := &fakeConditionClientset{}
+		ns.k8sClients = k8sClients
+
+		p := pod.DeepCopy()
+		if tc.conditionIsTrue {
+			p.Status.Conditions = []v1.PodCondition{{Type: PodConditionVolumesReady, Status: v1.ConditionTrue}}
+		}
+		ns.updateVolumesReadyCondition(context.TODO(), p)
+
+		if got := len(k8sClients.patched) > 0; got != tc.expectPatch {
+			t.Errorf("test %q failed: got patched condition %v, expected %v", tc.name, got, tc.expectPatch)
+		}
+		if tc.expectPatch && (k8sClients.patched[0].Type != PodConditionVolumesReady || k8sClients.patched[0].Status != v1.ConditionTrue) {
+			t.Errorf("test %q failed: got condition %+v", tc.name, k8sClients.patched[0])
+		}
+	}
+}
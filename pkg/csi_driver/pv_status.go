@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	"k8s.io/klog/v2"
+)
+
+// Annotations of the PersistentVolumes of the driver, reporting the bucket attributes and the last bucket access check.
+const (
+	AnnotationBucketLocation     = "gcsfuse.csi.storage.gke.io/bucket-location"
+	AnnotationBucketLocationType = "gcsfuse.csi.storage.gke.io/bucket-location-type"
+	AnnotationBucketStorageClass = "gcsfuse.csi.storage.gke.io/bucket-storage-class"
+	AnnotationLastAccessCheck    = "gcsfuse.csi.storage.gke.io/last-access-check"
+	AnnotationAccessCheckError   = "gcsfuse.csi.storage.gke.io/access-check-error"
+)
+
+// pvStatusLeaseName is the Lease of the controller replica that updates the PersistentVolume annotations.
+const pvStatusLeaseName = "gcsfuse-csi-pv-status"
+
+// pvStatusUpdater annotates the PersistentVolumes of the driver with the attributes of their buckets,
+// so that the bucket location and storage class can be listed with kubectl.
+// The buckets are looked up with the credentials of the controller, not the credentials of the workloads.
+type pvStatusUpdater struct {
+	driverName            string
+	storageEndpoint       string
+	k8sClients            clientset.Interface
+	storageServiceManager storage.ServiceManager
+	interval              time.Duration
+	now                   func() time.Time
+}
+
+func newPVStatusUpdater(config *GCSDriverConfig) *pvStatusUpdater {
+	return &pvStatusUpdater{
+		driverName:            config.Name,
+		storageEndpoint:       config.StorageEndpoint,
+		k8sClients:            config.K8sClients,
+		storageServiceManager: config.StorageServiceManager,
+		interval:              config.PVStatusInterval,
+		now:                   time.Now,
+	}
+}
+
+// run updates the PersistentVolume annotations on every interval until the context is cancelled.
+func (u *pvStatusUpdater) run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		u.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update annotates each PersistentVolume of the driver with the attributes of its bucket.
+// If the bucket lookup fails, the error is recorded and the last known attributes are kept.
+// The PersistentVolumes are only patched if the bucket attributes or the access check result changed,
+// or the last access check time is older than the interval.
+func (u *pvStatusUpdater) update(ctx context.Context) {
+	pvs, err := u.k8sClients.ListPersistentVolumes(ctx)
+	if err != nil {
+		klog.Errorf("failed to list the PersistentVolumes, skipping the PersistentVolume status update: %v", err)
+
+		return
+	}
+
+	storageService, err := u.storageServiceManager.SetupServiceWithDefaultCredential(ctx, u.storageEndpoint)
+	if err != nil {
+		klog.Errorf("failed to set up the storage service, skipping the PersistentVolume status update: %v", err)
+
+		return
+	}
+
+	// The PersistentVolumes of the same bucket share the lookup.
+	annotations := map[string]map[string]*string{}
+	for i := range pvs {
+		pv := &pvs[i]
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != u.driverName || pv.DeletionTimestamp != nil {
+			continue
+		}
+
+		bucketName := pv.Spec.CSI.VolumeHandle
+		if _, ok := annotations[bucketName]; !ok {
+			annotations[bucketName] = u.bucketAnnotations(ctx, storageService, bucketName)
+		}
+
+		if !u.annotationsChanged(pv.Annotations, annotations[bucketName]) {
+			continue
+		}
+		if err := u.k8sClients.PatchPersistentVolumeAnnotations(ctx, pv.Name, annotations[bucketName]); err != nil {
+			klog.Errorf("failed to annotate the PersistentVolume %q: %v", pv.Name, err)
+		}
+	}
+}
+
+// annotationsChanged returns true if the annotations of the PersistentVolume differ from the desired annotations.
+// The last access check time changes on every lookup, so it is only refreshed once it is older than the interval.
+func (u *pvStatusUpdater) annotationsChanged(current map[string]string, desired map[string]*string) bool {
+	for k, v := range desired {
+		if k == AnnotationLastAccessCheck && v != nil {
+			checked, err := time.Parse(time.RFC3339, current[k])
+			if err != nil || u.now().Sub(checked) >= u.interval {
+				return true
+			}
+
+			continue
+		}
+		got, ok := current[k]
+		if v == nil && ok || v != nil && (!ok || got != *v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bucketAnnotations returns the PersistentVolume annotations of the bucket attributes,
+// or the access check error if the bucket cannot be looked up.
+func (u *pvStatusUpdater) bucketAnnotations(ctx context.Context, storageService storage.Service, bucketName string) map[string]*string {
+	bucket, err := storageService.GetBucket(ctx, &storage.ServiceBucket{Name: bucketName})
+	if err != nil {
+		klog.V(4).Infof("failed to get the bucket %q of the PersistentVolume status: %v", bucketName, err)
+		msg := storageErrorCode(err).String() + ": " + err.Error()
+
+		return map[string]*string{AnnotationAccessCheckError: &msg}
+	}
+
+	lastAccessCheck := u.now().UTC().Format(time.RFC3339)
+
+	return map[string]*string{
+		AnnotationBucketLocation:     &bucket.Location,
+		AnnotationBucketLocationType: &bucket.LocationType,
+		AnnotationBucketStorageClass: &bucket.StorageClass,
+		AnnotationLastAccessCheck:    &lastAccessCheck,
+		AnnotationAccessCheckError:   nil,
+	}
+}
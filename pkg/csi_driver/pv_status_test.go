@@ -0,0 +1,148 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakePVClientset struct {
+	clientset.FakeClientset
+	pvs     []v1.PersistentVolume
+	patches map[string]map[string]*string
+}
+
+func (c *fakePVClientset) ListPersistentVolumes(_ context.Context) ([]v1.PersistentVolume, error) {
+	return c.pvs, nil
+}
+
+func (c *fakePVClientset) PatchPersistentVolumeAnnotations(_ context.Context, name string, annotations map[string]*string) error {
+	c.patches[name] = annotations
+
+	return nil
+}
+
+func newTestPV(name, driverName, bucketName string) v1.PersistentVolume {
+	return v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: bucketName},
+			},
+		},
+	}
+}
+
+func TestPVStatusUpdate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	ssm := storage.NewFakeServiceManager()
+	storageService, err := ssm.SetupServiceWithDefaultCredential(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to set up the storage service: %v", err)
+	}
+	if _, err := storageService.CreateBucket(ctx, &storage.ServiceBucket{Name: "test-bucket", Location: "US-CENTRAL1", LocationType: "region", StorageClass: "STANDARD"}); err != nil {
+		t.Fatalf("failed to create the bucket: %v", err)
+	}
+
+	// The PersistentVolume with the current bucket attributes is not patched again.
+	unchangedPV := newTestPV("pv-5", DefaultName, "test-bucket")
+	unchangedPV.Annotations = map[string]string{
+		AnnotationBucketLocation:     "US-CENTRAL1",
+		AnnotationBucketLocationType: "region",
+		AnnotationBucketStorageClass: "STANDARD",
+		AnnotationLastAccessCheck:    "2023-08-01T11:55:00Z",
+	}
+	// The PersistentVolume whose last access check is older than the interval is patched with the new check time.
+	staleCheckPV := newTestPV("pv-6", DefaultName, "test-bucket")
+	staleCheckPV.Annotations = map[string]string{
+		AnnotationBucketLocation:     "US-CENTRAL1",
+		AnnotationBucketLocationType: "region",
+		AnnotationBucketStorageClass: "STANDARD",
+		AnnotationLastAccessCheck:    "2023-07-31T12:00:00Z",
+	}
+
+	k8sClients := &fakePVClientset{
+		pvs: []v1.PersistentVolume{
+			newTestPV("pv-1", DefaultName, "test-bucket"),
+			newTestPV("pv-2", DefaultName, "missing-bucket"),
+			newTestPV("pv-3", "pd.csi.storage.gke.io", "projects/test-project/zones/us-central1-c/disks/test-disk"),
+			{ObjectMeta: metav1.ObjectMeta{Name: "pv-4"}},
+			unchangedPV,
+			staleCheckPV,
+		},
+		patches: map[string]map[string]*string{},
+	}
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	u := &pvStatusUpdater{
+		driverName:            DefaultName,
+		k8sClients:            k8sClients,
+		storageServiceManager: ssm,
+		interval:              10 * time.Minute,
+		now:                   func() time.Time { return now },
+	}
+	u.update(ctx)
+
+	toString := func(annotations map[string]*string) map[string]string {
+		m := map[string]string{}
+		for k, v := range annotations {
+			if v == nil {
+				m[k] = "<removed>"
+			} else {
+				m[k] = *v
+			}
+		}
+
+		return m
+	}
+
+	expected := map[string]map[string]string{
+		"pv-1": {
+			AnnotationBucketLocation:     "US-CENTRAL1",
+			AnnotationBucketLocationType: "region",
+			AnnotationBucketStorageClass: "STANDARD",
+			AnnotationLastAccessCheck:    "2023-08-01T12:00:00Z",
+			AnnotationAccessCheckError:   "<removed>",
+		},
+		"pv-2": {
+			AnnotationAccessCheckError: "NotFound: storage: bucket doesn't exist",
+		},
+		"pv-6": {
+			AnnotationBucketLocation:     "US-CENTRAL1",
+			AnnotationBucketLocationType: "region",
+			AnnotationBucketStorageClass: "STANDARD",
+			AnnotationLastAccessCheck:    "2023-08-01T12:00:00Z",
+			AnnotationAccessCheckError:   "<removed>",
+		},
+	}
+	got := map[string]map[string]string{}
+	for name, annotations := range k8sClients.patches {
+		got[name] = toString(annotations)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got annotations %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	eventReasonSidecarThrottled = "SidecarCPUThrottled"
+
+	// throttlingEventInterval is the minimum interval between the CPU throttling events of a Pod,
+	// because the sidecar container reports the throttling on every check while it lasts.
+	throttlingEventInterval = 30 * time.Minute
+)
+
+// sidecarThrottlingReporter records an event on the Pods whose sidecar container reported heavy CPU throttling,
+// suggesting to raise the sidecar container CPU limit.
+type sidecarThrottlingReporter struct {
+	podsDir    string
+	k8sClients clientset.Interface
+	recorder   record.EventRecorder
+
+	// reported is the time of the throttling report of the last event of each Pod.
+	reported map[types.UID]time.Time
+}
+
+func newSidecarThrottlingReporter(config *GCSDriverConfig, recorder record.EventRecorder) *sidecarThrottlingReporter {
+	return &sidecarThrottlingReporter{
+		podsDir:    filepath.Join(config.KubeletRootDir, "pods"),
+		k8sClients: config.K8sClients,
+		recorder:   recorder,
+		reported:   map[types.UID]time.Time{},
+	}
+}
+
+// run checks the throttling reports periodically until the context is cancelled.
+func (r *sidecarThrottlingReporter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check records an event on each Pod on the node with a throttling report newer than its last event.
+func (r *sidecarThrottlingReporter) check() {
+	pods, err := r.k8sClients.ListNodePods()
+	if err != nil {
+		klog.Errorf("failed to list the Pods on the node, skipping the sidecar CPU throttling check: %v", err)
+
+		return
+	}
+
+	reported := map[types.UID]time.Time{}
+	for _, pod := range pods {
+		if t, ok := r.reported[pod.UID]; ok {
+			reported[pod.UID] = t
+		}
+
+		throttlingFile := filepath.Join(r.podsDir, string(pod.UID), "volumes", "kubernetes.io~empty-dir", webhook.SidecarContainerVolumeName, ".volumes", sidecarmounter.CPUThrottlingFileName)
+		info, err := os.Stat(throttlingFile)
+		if err != nil {
+			continue
+		}
+		if t, ok := reported[pod.UID]; ok && info.ModTime().Before(t.Add(throttlingEventInterval)) {
+			continue
+		}
+
+		msg, err := os.ReadFile(throttlingFile)
+		if err != nil {
+			klog.Errorf("failed to read the sidecar CPU throttling file %q: %v", throttlingFile, err)
+
+			continue
+		}
+		r.recorder.Eventf(pod, v1.EventTypeWarning, eventReasonSidecarThrottled,
+			"%s, which slows down the gcsfuse volumes. Raise the sidecar container CPU limit using the Pod annotation gke-gcsfuse/cpu-limit", msg)
+		reported[pod.UID] = info.ModTime()
+	}
+
+	// The Pods that no longer exist are forgotten.
+	r.reported = reported
+}
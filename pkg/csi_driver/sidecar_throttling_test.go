@@ -0,0 +1,81 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSidecarThrottlingReporterCheck(t *testing.T) {
+	t.Parallel()
+
+	podsDir := t.TempDir()
+	podUID := "test-pod-uid"
+	volumesDir := filepath.Join(podsDir, podUID, "volumes", "kubernetes.io~empty-dir", webhook.SidecarContainerVolumeName, ".volumes")
+	if err := os.MkdirAll(volumesDir, 0o750); err != nil {
+		t.Fatalf("failed to create the volumes directory: %v", err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &sidecarThrottlingReporter{
+		podsDir:    podsDir,
+		k8sClients: &fakePodListClientset{podUIDs: []string{podUID, "other-pod-uid"}},
+		recorder:   recorder,
+		reported:   map[types.UID]time.Time{"deleted-pod-uid": time.Now()},
+	}
+
+	// No throttling reported.
+	r.check()
+	if len(recorder.Events) != 0 {
+		t.Errorf("got event %q, expected no event", <-recorder.Events)
+	}
+	if _, ok := r.reported["deleted-pod-uid"]; ok {
+		t.Error("the deleted Pod was not forgotten")
+	}
+
+	throttlingFile := filepath.Join(volumesDir, sidecarmounter.CPUThrottlingFileName)
+	if err := os.WriteFile(throttlingFile, []byte("The gcsfuse sidecar container was CPU throttled in 60% of the CPU periods in the last 1m0s"), 0o644); err != nil {
+		t.Fatalf("failed to write the throttling file: %v", err)
+	}
+	r.check()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("got %v events, expected 1", len(recorder.Events))
+	}
+	expected := "Warning SidecarCPUThrottled The gcsfuse sidecar container was CPU throttled in 60% of the CPU periods in the last 1m0s, which slows down the gcsfuse volumes. Raise the sidecar container CPU limit using the Pod annotation gke-gcsfuse/cpu-limit"
+	if got := <-recorder.Events; got != expected {
+		t.Errorf("got event %q, expected %q", got, expected)
+	}
+
+	// The throttling reports within the event interval are not recorded again.
+	r.check()
+	later := time.Now().Add(throttlingEventInterval)
+	if err := os.Chtimes(throttlingFile, later, later); err != nil {
+		t.Fatalf("failed to change the throttling file times: %v", err)
+	}
+	r.check()
+	if len(recorder.Events) != 1 {
+		t.Errorf("got %v events, expected 1 event after the event interval", len(recorder.Events))
+	}
+}
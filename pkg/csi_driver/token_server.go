@@ -0,0 +1,125 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"k8s.io/klog/v2"
+)
+
+// tokenSocketListener is implemented by the mounters that create the token socket of a target path
+// in the sidecar container emptyDir, see csimounter.Mounter.
+type tokenSocketListener interface {
+	ListenTokenSocket(target string) (net.Listener, error)
+}
+
+// volumeTokenServers serve the downscoped tokens of the mounted volumes to gcsfuse in the sidecar containers,
+// so that the sidecar containers only get tokens limited to the bucket and the access of their volumes.
+type volumeTokenServers struct {
+	mu      sync.Mutex
+	servers map[string]*volumeTokenServer
+}
+
+// volumeTokenServer serves the tokens of the latest token source of a target path.
+type volumeTokenServer struct {
+	server *http.Server
+	mu     sync.Mutex
+	ts     oauth2.TokenSource
+}
+
+// Token returns a token of the latest token source.
+func (v *volumeTokenServer) Token() (*oauth2.Token, error) {
+	v.mu.Lock()
+	ts := v.ts
+	v.mu.Unlock()
+
+	return ts.Token()
+}
+
+func newVolumeTokenServers() *volumeTokenServers {
+	return &volumeTokenServers{servers: map[string]*volumeTokenServer{}}
+}
+
+// serve serves the tokens of ts for the target path on the listener returned by listen.
+// If the tokens of the target path are already served, only the token source is replaced,
+// because the service account token of the volume context is refreshed on every republish.
+// The server is started again on the republish after the node driver restarted.
+func (s *volumeTokenServers) serve(targetPath string, listen func() (net.Listener, error), ts oauth2.TokenSource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.servers[targetPath]; ok {
+		v.mu.Lock()
+		v.ts = ts
+		v.mu.Unlock()
+
+		return nil
+	}
+
+	l, err := listen()
+	if err != nil {
+		return err
+	}
+
+	v := &volumeTokenServer{ts: ts}
+	v.server = &http.Server{Handler: tokenHandler(v), ReadHeaderTimeout: time.Second * 10}
+	s.servers[targetPath] = v
+	go func() {
+		if err := v.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("the token server of the target path %q stopped: %v", targetPath, err)
+		}
+	}()
+
+	return nil
+}
+
+// stop stops serving the tokens of the target path.
+func (s *volumeTokenServers) stop(targetPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.servers[targetPath]; ok {
+		v.server.Close()
+		delete(s.servers, targetPath)
+	}
+}
+
+// tokenHandler responds with the tokens of ts in the JSON format of oauth2.Token,
+// which gcsfuse decodes from the responses of the token-url flag.
+func tokenHandler(ts oauth2.TokenSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		token, err := ts.Token()
+		if err != nil {
+			klog.Errorf("failed to get the downscoped token: %v", err)
+			http.Error(w, "failed to get the token", http.StatusBadGateway)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(token); err != nil {
+			klog.Errorf("failed to write the token: %v", err)
+		}
+	})
+}
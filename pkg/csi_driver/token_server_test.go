@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestVolumeTokenServers(t *testing.T) {
+	t.Parallel()
+	socketPath := filepath.Join(t.TempDir(), "token.sock")
+	listens := 0
+	listen := func() (net.Listener, error) {
+		listens++
+
+		return net.Listen("unix", socketPath)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	getToken := func() (*oauth2.Token, error) {
+		resp, err := client.Get("http://localhost/token") //nolint:noctx
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		token := &oauth2.Token{}
+		if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+			return nil, err
+		}
+
+		return token, nil
+	}
+
+	s := newVolumeTokenServers()
+	if err := s.serve("test-target", listen, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-1"})); err != nil {
+		t.Fatalf("failed to serve the tokens: %v", err)
+	}
+	if token, err := getToken(); err != nil || token.AccessToken != "token-1" {
+		t.Errorf("got token %+v and error %v, expected %q", token, err, "token-1")
+	}
+
+	// The republish replaces the token source without listening again.
+	if err := s.serve("test-target", listen, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-2"})); err != nil {
+		t.Fatalf("failed to serve the tokens: %v", err)
+	}
+	if token, err := getToken(); err != nil || token.AccessToken != "token-2" {
+		t.Errorf("got token %+v and error %v, expected %q", token, err, "token-2")
+	}
+	if listens != 1 {
+		t.Errorf("got %v listens, expected 1", listens)
+	}
+
+	s.stop("test-target")
+	if _, err := getToken(); err == nil {
+		t.Error("got a token after the server stopped, expected an error")
+	}
+}
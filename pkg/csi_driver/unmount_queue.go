@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"sync"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	mount "k8s.io/mount-utils"
+)
+
+// unmountQueue batches the unmounts of NodeUnpublishVolume and bounds their concurrency,
+// so that draining a node with hundreds of gcsfuse volumes does not exceed the eviction timeouts.
+// The mount table is listed once for each batch of the queued unmounts, instead of once for each unmount.
+type unmountQueue struct {
+	mounter mount.Interface
+	sem     chan struct{}
+
+	mu          sync.Mutex
+	pending     []*unmountTask
+	dispatching bool
+}
+
+type unmountTask struct {
+	ctx        context.Context
+	targetPath string
+	unmount    func(mounted bool) error
+	done       chan error
+}
+
+func newUnmountQueue(mounter mount.Interface, maxConcurrentUnmounts int) *unmountQueue {
+	if maxConcurrentUnmounts <= 0 {
+		maxConcurrentUnmounts = 1
+	}
+
+	return &unmountQueue{
+		mounter: mounter,
+		sem:     make(chan struct{}, maxConcurrentUnmounts),
+	}
+}
+
+// run queues the unmount of the target path and waits for it.
+// The unmount function is called with whether the target path is in the mount table listed for the batch.
+// The caller holds the volume lock of the target path, so the mount table entry of the target path cannot change while it is queued.
+func (q *unmountQueue) run(ctx context.Context, targetPath string, unmount func(mounted bool) error) error {
+	task := &unmountTask{ctx: ctx, targetPath: targetPath, unmount: unmount, done: make(chan error, 1)}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, task)
+	metrics.UnmountQueueDepth.Inc()
+	if !q.dispatching {
+		q.dispatching = true
+		go q.dispatch()
+	}
+	q.mu.Unlock()
+
+	// Wait for the queued task even if the context is canceled, so that the volume lock is not released while the task runs.
+	return <-task.done
+}
+
+// dispatch runs the pending unmounts in batches until the queue is empty.
+func (q *unmountQueue) dispatch() {
+	for {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		if len(batch) == 0 {
+			q.dispatching = false
+			q.mu.Unlock()
+
+			return
+		}
+		q.mu.Unlock()
+		metrics.UnmountBatchSize.Observe(float64(len(batch)))
+
+		mounted, err := q.mountedPaths()
+		if err != nil {
+			klog.ErrorS(err, "failed to list the mount points, unmounting the target paths of the batch", "batchSize", len(batch))
+		}
+
+		for _, task := range batch {
+			q.sem <- struct{}{}
+			metrics.UnmountQueueDepth.Dec()
+			go func(task *unmountTask) {
+				defer func() { <-q.sem }()
+				if err := task.ctx.Err(); err != nil {
+					task.done <- status.FromContextError(err).Err()
+
+					return
+				}
+				task.done <- task.unmount(err != nil || mounted[task.targetPath])
+			}(task)
+		}
+	}
+}
+
+// mountedPaths returns the set of the mounted paths.
+func (q *unmountQueue) mountedPaths() (map[string]bool, error) {
+	mps, err := q.mounter.List()
+	if err != nil {
+		return nil, err
+	}
+
+	mounted := make(map[string]bool, len(mps))
+	for _, mp := range mps {
+		mounted[mp.Path] = true
+	}
+
+	return mounted, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	mount "k8s.io/mount-utils"
+)
+
+type countingMounter struct {
+	*mount.FakeMounter
+	lists atomic.Int32
+}
+
+func (m *countingMounter) List() ([]mount.MountPoint, error) {
+	m.lists.Add(1)
+
+	return m.FakeMounter.List()
+}
+
+func TestUnmountQueue(t *testing.T) {
+	t.Parallel()
+	const tasks = 50
+	const maxConcurrentUnmounts = 4
+
+	mountPoints := []mount.MountPoint{}
+	for i := 0; i < tasks; i += 2 {
+		mountPoints = append(mountPoints, mount.MountPoint{Device: testVolumeID, Path: fmt.Sprintf("/target-%d", i), Type: "fuse"})
+	}
+	mounter := &countingMounter{FakeMounter: mount.NewFakeMounter(mountPoints)}
+	q := newUnmountQueue(mounter, maxConcurrentUnmounts)
+
+	var inflight, maxInflight atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := q.run(context.TODO(), fmt.Sprintf("/target-%d", i), func(mounted bool) error {
+				n := inflight.Add(1)
+				defer inflight.Add(-1)
+				for {
+					m := maxInflight.Load()
+					if n <= m || maxInflight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+
+				if expected := i%2 == 0; mounted != expected {
+					return fmt.Errorf("got mounted %v, expected %v", mounted, expected)
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Errorf("unmount of target %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := maxInflight.Load(); got > maxConcurrentUnmounts {
+		t.Errorf("got %v concurrent unmounts, expected at most %v", got, maxConcurrentUnmounts)
+	}
+	if got := mounter.lists.Load(); got >= tasks {
+		t.Errorf("got %v mount table listings for %v unmounts, expected the unmounts to be batched", got, tasks)
+	}
+}
+
+func TestUnmountQueueCanceledContext(t *testing.T) {
+	t.Parallel()
+	q := newUnmountQueue(mount.NewFakeMounter([]mount.MountPoint{}), 1)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	err := q.run(ctx, "/target", func(bool) error {
+		t.Errorf("the unmount of a canceled call should not run")
+
+		return nil
+	})
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("got error %v, expected code %v", err, codes.Canceled)
+	}
+}
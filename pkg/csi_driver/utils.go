@@ -21,6 +21,8 @@ import (
 	"fmt"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	pbSanitizer "github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -66,10 +68,10 @@ func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h
 		strippedReq = pbSanitizer.StripSecrets(req).String()
 	case NodePublishVolumeCSIFullMethod:
 		if nodePublishReq, ok := req.(*csi.NodePublishVolumeRequest); ok {
-			if token, ok := nodePublishReq.VolumeContext[VolumeContextKeyServiceAccountToken]; ok {
-				nodePublishReq.VolumeContext[VolumeContextKeyServiceAccountToken] = "***stripped***"
+			if token, ok := nodePublishReq.VolumeContext[volumespec.VolumeContextKeyServiceAccountToken]; ok {
+				nodePublishReq.VolumeContext[volumespec.VolumeContextKeyServiceAccountToken] = "***stripped***"
 				strippedReq = fmt.Sprintf("%+v", nodePublishReq)
-				nodePublishReq.VolumeContext[VolumeContextKeyServiceAccountToken] = token
+				nodePublishReq.VolumeContext[volumespec.VolumeContextKeyServiceAccountToken] = token
 			} else {
 				strippedReq = fmt.Sprintf("%+v", req)
 			}
@@ -80,17 +82,36 @@ func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h
 		strippedReq = fmt.Sprintf("%+v", req)
 	}
 
-	klog.V(4).Infof("%s called with request: %v", info.FullMethod, strippedReq)
+	// Attach the volume fields to the logger in the context,
+	// so that all the logs of this call can be filtered by the same fields.
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), requestLogFields(req)...)
+	ctx = klog.NewContext(ctx, logger)
+
+	logger.V(4).Info("gRPC call started", "method", info.FullMethod, "request", strippedReq)
 	resp, err := handler(ctx, req)
 	if err != nil {
-		klog.Errorf("%s failed with error: %v", info.FullMethod, err)
+		logger.Error(err, "gRPC call failed", "method", info.FullMethod)
 	} else {
 		if fmt.Sprintf("%v", resp) == "" {
-			klog.V(4).Infof("%s succeeded.", info.FullMethod)
+			logger.V(4).Info("gRPC call succeeded", "method", info.FullMethod)
 		} else {
-			klog.V(4).Infof("%s succeeded with response: %s", info.FullMethod, resp)
+			logger.V(4).Info("gRPC call succeeded", "method", info.FullMethod, "response", fmt.Sprintf("%v", resp))
 		}
 	}
 
 	return resp, err
 }
+
+// requestLogFields returns the structured logging key/value pairs of the volume ID,
+// Pod UID, and volume name if the request carries them.
+func requestLogFields(req interface{}) []interface{} {
+	fields := []interface{}{}
+	if r, ok := req.(interface{ GetVolumeId() string }); ok && r.GetVolumeId() != "" {
+		fields = append(fields, util.LogKeyVolumeID, r.GetVolumeId())
+	}
+	if r, ok := req.(interface{ GetTargetPath() string }); ok && r.GetTargetPath() != "" {
+		fields = append(fields, util.TargetPathLogFields(r.GetTargetPath())...)
+	}
+
+	return fields
+}
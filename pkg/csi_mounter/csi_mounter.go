@@ -18,7 +18,9 @@ limitations under the License.
 package csimounter
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -28,26 +30,125 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
 	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 	"k8s.io/mount-utils"
 )
 
+const gcsfuseReadyPollInterval = 500 * time.Millisecond
+
+// seLinuxContextOptions are the SELinux mount options passed to the kernel instead of the sidecar mounter.
+var seLinuxContextOptions = map[string]bool{
+	"context":     true,
+	"fscontext":   true,
+	"defcontext":  true,
+	"rootcontext": true,
+}
+
+// HandshakeTimeoutFileName is the file written to the volume directory in the sidecar container emptyDir
+// when a phase of the mount handshake between the node driver and the sidecar container timed out.
+const HandshakeTimeoutFileName = "handshake_timeout"
+
+// HandshakeTimeouts are the deadlines of the mount handshake phases after the fuse file system is mounted.
+type HandshakeTimeouts struct {
+	// FDHandoff is the deadline for the sidecar container to connect to the socket and receive the file descriptor.
+	FDHandoff time.Duration
+	// GCSFuseReady is the deadline for gcsfuse to serve the file system after the file descriptor is received.
+	GCSFuseReady time.Duration
+}
+
+// DefaultHandshakeTimeouts are the default deadlines of the mount handshake phases.
+var DefaultHandshakeTimeouts = HandshakeTimeouts{
+	FDHandoff:    15 * time.Minute,
+	GCSFuseReady: 5 * time.Minute,
+}
+
+// HandshakeTimeout is the content of the handshake timeout file.
+type HandshakeTimeout struct {
+	// Phase is the mount phase that timed out, one of metrics.MountPhaseFDHandoff and metrics.MountPhaseGCSFuseReady.
+	Phase   string `json:"phase"`
+	Timeout string `json:"timeout"`
+}
+
+// Description returns what did not happen in the phase that timed out.
+func (t *HandshakeTimeout) Description() string {
+	switch t.Phase {
+	case metrics.MountPhaseFDHandoff:
+		return fmt.Sprintf("the sidecar container did not receive the FUSE file descriptor within %v", t.Timeout)
+	case metrics.MountPhaseGCSFuseReady:
+		return fmt.Sprintf("gcsfuse did not serve the file system within %v", t.Timeout)
+	default:
+		return fmt.Sprintf("the mount phase %q did not finish within %v", t.Phase, t.Timeout)
+	}
+}
+
+// ReadHandshakeTimeout returns the handshake timeout written to the volume directory, or nil if no phase timed out.
+func ReadHandshakeTimeout(emptyDirBasePath string) (*HandshakeTimeout, error) {
+	b, err := os.ReadFile(filepath.Join(emptyDirBasePath, HandshakeTimeoutFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the handshake timeout file: %w", err)
+	}
+
+	t := &HandshakeTimeout{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("failed to parse the handshake timeout file: %w", err)
+	}
+
+	return t, nil
+}
+
+// writeHandshakeTimeout records the timed out phase, so that the following NodePublishVolume calls fail with an error naming the phase.
+func writeHandshakeTimeout(emptyDirBasePath, phase string, timeout time.Duration) error {
+	metrics.MountHandshakeTimeoutTotal.WithLabelValues(phase).Inc()
+
+	b, err := json.Marshal(&HandshakeTimeout{Phase: phase, Timeout: timeout.String()})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(emptyDirBasePath, HandshakeTimeoutFileName), b, 0o644)
+}
+
+// FUSEDevice opens the FUSE device, whose file descriptor is mounted by the node driver
+// and passed to gcsfuse in the sidecar container.
+type FUSEDevice interface {
+	Open() (int, error)
+}
+
+type linuxFUSEDevice struct{}
+
+func (linuxFUSEDevice) Open() (int, error) {
+	return syscall.Open("/dev/fuse", syscall.O_RDWR, 0o644)
+}
+
 // Mounter provides the Cloud Storage FUSE CSI implementation of mount.Interface
 // for the linux platform.
 type Mounter struct {
 	mount.MounterForceUnmounter
-	chdirMu sync.Mutex
+	chdirMu         sync.Mutex
 	storageEndpoint string
+	userAgent       string
+	timeouts        HandshakeTimeouts
+	device          FUSEDevice
+	// chown changes the ownership of the files shared with the sidecar container, which runs as nobody.
+	chown func(name string, uid, gid int) error
 }
 
 // New returns a mount.MounterForceUnmounter for the current system.
 // It provides options to override the default mounter behavior.
 // mounterPath allows using an alternative to `/bin/mount` for mounting.
-func New(mounterPath, storageEndpoint string) (mount.Interface, error) {
+// userAgent is passed to the sidecar mounter to attribute the gcsfuse GCS API calls.
+// timeouts are the deadlines of the mount handshake with the sidecar container.
+func New(mounterPath, storageEndpoint, userAgent string, timeouts HandshakeTimeouts) (mount.Interface, error) {
 	m, ok := mount.New(mounterPath).(mount.MounterForceUnmounter)
 	if !ok {
 		return nil, fmt.Errorf("failed to cast mounter to MounterForceUnmounter")
@@ -57,11 +158,24 @@ func New(mounterPath, storageEndpoint string) (mount.Interface, error) {
 		m,
 		sync.Mutex{},
 		storageEndpoint,
+		userAgent,
+		timeouts,
+		linuxFUSEDevice{},
+		os.Chown,
 	}, nil
 }
 
 func (m *Mounter) Mount(source string, target string, fstype string, options []string) error {
+	storageEndpoint, options := extractStorageEndpoint(options)
+	if storageEndpoint == "" {
+		storageEndpoint = m.storageEndpoint
+	}
+	sharedCacheDir, options := extractMountOption(options, volumespec.SharedCacheDirMountOptionKey)
+	traceID, options := extractMountOption(options, volumespec.TraceIDMountOptionKey)
+	tokenServer, options := extractMountOption(options, volumespec.TokenServerMountOptionKey)
 	csiMountOptions, sidecarMountOptions := prepareMountOptions(options)
+	podID, _, _ := util.ParsePodIDVolumeFromTargetpath(target)
+	logger := klog.Background().WithValues(append([]interface{}{util.LogKeyBucket, source}, util.TargetPathLogFields(target)...)...)
 
 	// Prepare the temp emptyDir path
 	emptyDirBasePath, err := util.PrepareEmptyDir(target, false)
@@ -69,101 +183,274 @@ func (m *Mounter) Mount(source string, target string, fstype string, options []s
 		return fmt.Errorf("failed to prepare emptyDir path: %w", err)
 	}
 
-	klog.V(4).Info("opening the device /dev/fuse")
-	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR, 0o644)
+	// Roll back if the mount fails, so that the retry does not find a mounted target path without a gcsfuse process serving it,
+	// and the shared cache directory bind mounts do not pile up on every retry.
+	var l net.Listener
+	fd := -1
+	sharedCacheMounted, mounted, handedOff := false, false, false
+	defer func() {
+		if handedOff {
+			return
+		}
+		if l != nil {
+			l.Close()
+		}
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+		if mounted {
+			if err := m.Unmount(target); err != nil {
+				logger.Error(err, "failed to unmount the target path after the mount failed")
+			}
+		}
+		if sharedCacheMounted {
+			if err := m.Unmount(filepath.Join(emptyDirBasePath, sidecarmounter.SharedCacheDirName)); err != nil {
+				logger.Error(err, "failed to unmount the shared cache directory after the mount failed")
+			}
+		}
+	}()
+
+	if sharedCacheDir != "" {
+		logger.V(4).Info("mounting the shared cache directory", "sharedCacheDir", sharedCacheDir)
+		if err := m.mountSharedCacheDir(sharedCacheDir, emptyDirBasePath); err != nil {
+			return fmt.Errorf("failed to mount the shared cache directory %q: %w", sharedCacheDir, err)
+		}
+		sharedCacheMounted = true
+	}
+
+	logger.V(4).Info("opening the device /dev/fuse")
+	fd, err = m.device.Open()
 	if err != nil {
 		return fmt.Errorf("failed to open the device /dev/fuse: %w", err)
 	}
 	csiMountOptions = append(csiMountOptions, fmt.Sprintf("fd=%v", fd))
 
-	klog.V(4).Info("mounting the fuse filesystem")
+	logger.V(4).Info("mounting the fuse filesystem")
 	err = m.MountSensitiveWithoutSystemdWithMountFlags(source, target, fstype, csiMountOptions, nil, []string{"--internal-only"})
 	if err != nil {
 		return fmt.Errorf("failed to mount the fuse filesystem: %w", err)
 	}
+	mounted = true
 
-	klog.V(4).Info("passing the descriptor")
+	logger.V(4).Info("passing the descriptor")
+	l, err = m.createSocket(emptyDirBasePath)
+	if err != nil {
+		return err
+	}
+
+	// Prepare sidecar mounter MountConfig
+	mc := sidecarmounter.MountConfig{
+		BucketName:      source,
+		Options:         sidecarMountOptions,
+		StorageEndpoint: storageEndpoint,
+		UserAgent:       m.userAgent,
+		PodUID:          podID,
+		SharedCache:     sharedCacheDir != "",
+		TokenServer:     tokenServer == "true",
+	}
+	mcb, err := json.Marshal(mc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sidecar mounter MountConfig %v: %w", mc, err)
+	}
+
+	// Asynchronously waiting for the sidecar container to connect to the listener
+	timer := metrics.NewMountPhaseTimer()
+	timer.SetTraceID(traceID)
+	handedOff = true
+	go func(l net.Listener, msg []byte, fd int) {
+		if !sendFD(logger, l, msg, fd, emptyDirBasePath, m.timeouts.FDHandoff) {
+			// Nothing serves the fuse connection, so unmount the target path for the kubelet retry to mount it again.
+			if err := m.Unmount(target); err != nil {
+				logger.Error(err, "failed to unmount the target path after the file descriptor handoff failed")
+			}
+
+			return
+		}
+		timer.ObservePhase(metrics.MountPhaseFDHandoff)
+
+		readyFile := filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName)
+		if err := wait.PollUntilContextTimeout(context.Background(), gcsfuseReadyPollInterval, m.timeouts.GCSFuseReady, false, func(context.Context) (bool, error) {
+			_, err := os.Stat(readyFile)
+
+			return err == nil, nil
+		}); err != nil {
+			logger.Error(err, "gcsfuse did not become ready")
+			if err := writeHandshakeTimeout(emptyDirBasePath, metrics.MountPhaseGCSFuseReady, m.timeouts.GCSFuseReady); err != nil {
+				logger.Error(err, "failed to write the handshake timeout file")
+			}
+
+			return
+		}
+		timer.ObservePhase(metrics.MountPhaseGCSFuseReady)
+
+		logger.V(4).Info("exiting the goroutine")
+	}(l, mcb, fd)
+
+	return nil
+}
+
+// sendFD waits for the sidecar container to connect to the listener, and sends the /dev/fuse file descriptor and the mount config.
+// The file descriptor and the listener are closed before it returns, because the FUSE connection is not aborted
+// when gcsfuse exits while the driver holds the file descriptor, which hangs the workload I/O and the unmount.
+func sendFD(logger klog.Logger, l net.Listener, msg []byte, fd int, emptyDirBasePath string, timeout time.Duration) bool {
+	defer syscall.Close(fd)
+	defer l.Close()
+
+	logger.V(4).Info("start to accept connections to the listener")
+	a, err := l.Accept()
+	if err != nil {
+		logger.Error(err, "failed to accept connections to the listener")
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if err := writeHandshakeTimeout(emptyDirBasePath, metrics.MountPhaseFDHandoff, timeout); err != nil {
+				logger.Error(err, "failed to write the handshake timeout file")
+			}
+		}
+
+		return false
+	}
+	defer a.Close()
+
+	logger.V(4).Info("start to send file descriptor and mount options")
+	if err = util.SendMsg(a, fd, msg); err != nil {
+		logger.Error(err, "failed to send file descriptor and mount options")
+
+		return false
+	}
+
+	return true
+}
+
+// createSocket creates the socket the sidecar container connects to in the emptyDir volume base path.
+func (m *Mounter) createSocket(emptyDirBasePath string) (net.Listener, error) {
+	l, err := m.listenSocket(emptyDirBasePath, "socket")
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop accepting connections if the sidecar container does not connect before the deadline.
+	if ul, ok := l.(*net.UnixListener); ok {
+		if err := ul.SetDeadline(time.Now().Add(m.timeouts.FDHandoff)); err != nil {
+			l.Close()
+
+			return nil, fmt.Errorf("failed to set the deadline of the listener: %w", err)
+		}
+	}
+
+	return l, nil
+}
+
+// ListenTokenSocket creates the socket where the node server serves the downscoped tokens of the volume of the target path
+// to the sidecar container. The socket of a previous node server run is replaced.
+func (m *Mounter) ListenTokenSocket(target string) (net.Listener, error) {
+	emptyDirBasePath, err := util.PrepareEmptyDir(target, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare emptyDir path: %w", err)
+	}
+
+	return m.listenSocket(emptyDirBasePath, sidecarmounter.TokenSocketName)
+}
+
+// listenSocket creates a socket owned by the sidecar container user in the emptyDir volume base path.
+func (m *Mounter) listenSocket(emptyDirBasePath, name string) (net.Listener, error) {
 	// Need to change the current working directory to the temp volume base path,
 	// because the socket absolute path is longer than 104 characters,
 	// which will cause "bind: invalid argument" errors.
 	m.chdirMu.Lock()
+	defer m.chdirMu.Unlock()
 	exPwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("failed to get the current directory to %w", err)
+		return nil, fmt.Errorf("failed to get the current directory to %w", err)
 	}
 	if err = os.Chdir(emptyDirBasePath); err != nil {
-		return fmt.Errorf("failed to change directory to %q: %w", emptyDirBasePath, err)
+		return nil, fmt.Errorf("failed to change directory to %q: %w", emptyDirBasePath, err)
 	}
+	defer func() {
+		if err := os.Chdir(exPwd); err != nil {
+			klog.Errorf("failed to change directory to %q: %v", exPwd, err)
+		}
+	}()
 
-	klog.V(4).Info("creating a listener for the socket")
-	l, err := net.Listen("unix", "./socket")
-	if err != nil {
-		return fmt.Errorf("failed to create the listener for the socket: %w", err)
+	// The socket of a previous failed mount of the target path would fail the listener creation.
+	socketPath := "./" + name
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove the stale socket: %w", err)
 	}
 
-	// Change the socket ownership
-	err = os.Chown(filepath.Dir(emptyDirBasePath), webhook.NobodyUID, webhook.NobodyGID)
-	if err != nil {
-		return fmt.Errorf("failed to change ownership on base of emptyDirBasePath: %w", err)
-	}
-	err = os.Chown(emptyDirBasePath, webhook.NobodyUID, webhook.NobodyGID)
-	if err != nil {
-		return fmt.Errorf("failed to change ownership on emptyDirBasePath: %w", err)
-	}
-	err = os.Chown("./socket", webhook.NobodyUID, webhook.NobodyGID)
+	klog.V(4).Infof("creating a listener for the socket %q", name)
+	l, err := net.Listen("unix", socketPath)
 	if err != nil {
-		return fmt.Errorf("failed to change ownership on socket: %w", err)
+		return nil, fmt.Errorf("failed to create the listener for the socket: %w", err)
 	}
 
-	// Close the listener after 15 minutes
-	// TODO: properly handle the socket listener timed out
-	go func(l net.Listener) {
-		time.Sleep(15 * time.Minute)
-		l.Close()
-	}(l)
+	// Change the socket ownership
+	for _, p := range []string{filepath.Dir(emptyDirBasePath), emptyDirBasePath, socketPath} {
+		if err := m.chown(p, webhook.NobodyUID, webhook.NobodyGID); err != nil {
+			l.Close()
 
-	if err = os.Chdir(exPwd); err != nil {
-		return fmt.Errorf("failed to change directory to %q: %w", exPwd, err)
+			return nil, fmt.Errorf("failed to change ownership on %q: %w", p, err)
+		}
 	}
-	m.chdirMu.Unlock()
 
-	// Prepare sidecar mounter MountConfig
-	mc := sidecarmounter.MountConfig{
-		BucketName: source,
-		Options:    sidecarMountOptions,
-		StorageEndpoint: m.storageEndpoint,
+	return l, nil
+}
+
+// mountSharedCacheDir bind mounts the shared cache directory on the node
+// to the volume directory in the sidecar container emptyDir, where gcsfuse uses it as the cache directory.
+func (m *Mounter) mountSharedCacheDir(sharedCacheDir, emptyDirBasePath string) error {
+	target := filepath.Join(emptyDirBasePath, sidecarmounter.SharedCacheDirName)
+	for _, dir := range []string{sharedCacheDir, target} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+		if err := m.chown(dir, webhook.NobodyUID, webhook.NobodyGID); err != nil {
+			return err
+		}
 	}
-	mcb, err := json.Marshal(mc)
+
+	// The sidecar container may restart and the volume may be republished, the directory is only mounted once.
+	notMnt, err := m.IsLikelyNotMountPoint(target)
 	if err != nil {
-		return fmt.Errorf("failed to marshal sidecar mounter MountConfig %v: %w", mc, err)
+		return err
+	}
+	if !notMnt {
+		return nil
 	}
 
-	// Asynchronously waiting for the sidecar container to connect to the listener
-	go func(l net.Listener, bucketName, target string, msg []byte, fd int) {
-		defer syscall.Close(fd)
-		defer l.Close()
+	return m.MountSensitiveWithoutSystemd(sharedCacheDir, target, "", []string{"bind"}, nil)
+}
+
+// UnmountSharedCacheDir unmounts the shared cache directory from the sidecar container emptyDir of the target path,
+// so that the emptyDir can be removed when the Pod is deleted. It is a no-op if the directory is not mounted.
+func UnmountSharedCacheDir(mounter mount.Interface, target string) error {
+	emptyDirBasePath, err := util.PrepareEmptyDir(target, false)
+	if err != nil {
+		return nil //nolint:nilerr // the target path is not a Pod volume, so there is no emptyDir.
+	}
 
-		podID, volumeName, _ := util.ParsePodIDVolumeFromTargetpath(target)
-		logPrefix := fmt.Sprintf("[Pod %v, Volume %v, Bucket %v]", podID, volumeName, bucketName)
+	return mount.CleanupMountPoint(filepath.Join(emptyDirBasePath, sidecarmounter.SharedCacheDirName), mounter, false /* extensiveMountPointCheck */)
+}
 
-		klog.V(4).Infof("%v start to accept connections to the listener.", logPrefix)
-		a, err := l.Accept()
-		if err != nil {
-			klog.Errorf("%v failed to accept connections to the listener: %v", logPrefix, err)
+// extractStorageEndpoint returns the storage endpoint set by the node server,
+// and the mount options without the storage endpoint option.
+func extractStorageEndpoint(options []string) (string, []string) {
+	return extractMountOption(options, volumespec.StorageEndpointMountOptionKey)
+}
 
-			return
-		}
-		defer a.Close()
+// extractMountOption returns the value of a mount option set by the node server,
+// and the mount options without the option.
+func extractMountOption(options []string, key string) (string, []string) {
+	value := ""
+	filteredOptions := []string{}
+	for _, o := range options {
+		if v, ok := strings.CutPrefix(o, key+"="); ok {
+			value = v
 
-		klog.V(4).Infof("%v start to send file descriptor and mount options", logPrefix)
-		if err = util.SendMsg(a, fd, msg); err != nil {
-			klog.Errorf("%v failed to send file descriptor and mount options: %v", logPrefix, err)
+			continue
 		}
+		filteredOptions = append(filteredOptions, o)
+	}
 
-		klog.V(4).Infof("%v exiting the goroutine.", logPrefix)
-	}(l, source, target, mcb, fd)
-
-	return nil
+	return value, filteredOptions
 }
 
 func prepareMountOptions(options []string) ([]string, []string) {
@@ -198,6 +485,15 @@ func prepareMountOptions(options []string) ([]string, []string) {
 		}
 	}
 
+	// SELinux context options label the files of the fuse filesystem,
+	// e.g. the context option passed by the kubelet when seLinuxMount is enabled on the CSIDriver.
+	for _, o := range optionSet.List() {
+		if k, v, found := strings.Cut(o, "="); found && seLinuxContextOptions[k] {
+			csiMountOptions = append(csiMountOptions, k+"="+quoteMountOptionValue(v))
+			optionSet.Delete(o)
+		}
+	}
+
 	for _, o := range optionSet.List() {
 		if strings.HasPrefix(o, "o=") {
 			v := o[2:]
@@ -212,3 +508,13 @@ func prepareMountOptions(options []string) ([]string, []string) {
 
 	return csiMountOptions, optionSet.List()
 }
+
+// quoteMountOptionValue quotes a mount option value containing commas, e.g. the SELinux level s0:c1,c2,
+// so that mount(8) does not split it into separate options.
+func quoteMountOptionValue(v string) string {
+	if !strings.Contains(v, ",") || strings.HasPrefix(v, `"`) {
+		return v
+	}
+
+	return `"` + v + `"`
+}
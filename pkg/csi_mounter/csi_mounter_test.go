@@ -18,10 +18,22 @@ limitations under the License.
 package csimounter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/mount-utils"
 )
 
 var defaultCsiMountOptions = []string{
@@ -67,6 +79,18 @@ func TestPrepareMountArgs(t *testing.T) {
 			expecteCsiMountOptions:     append(defaultCsiMountOptions, "ro", "noexec", "noatime"),
 			expecteSidecarMountOptions: []string{"implicit-dirs", "max-conns-per-host=10"},
 		},
+		{
+			name:                       "should pass SELinux context options to the kernel",
+			inputMountOptions:          []string{`context="system_u:object_r:container_file_t:s0:c1,c2"`, "rootcontext=system_u:object_r:container_file_t:s0", "implicit-dirs"},
+			expecteCsiMountOptions:     append(defaultCsiMountOptions, `context="system_u:object_r:container_file_t:s0:c1,c2"`, "rootcontext=system_u:object_r:container_file_t:s0"),
+			expecteSidecarMountOptions: []string{"implicit-dirs"},
+		},
+		{
+			name:                       "should quote SELinux context options with a category set",
+			inputMountOptions:          []string{"context=system_u:object_r:container_file_t:s0:c1,c2"},
+			expecteCsiMountOptions:     append(defaultCsiMountOptions, `context="system_u:object_r:container_file_t:s0:c1,c2"`),
+			expecteSidecarMountOptions: []string{},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -83,6 +107,258 @@ func TestPrepareMountArgs(t *testing.T) {
 	}
 }
 
+func TestExtractStorageEndpoint(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                    string
+		inputMountOptions       []string
+		expectedStorageEndpoint string
+		expectedMountOptions    []string
+	}{
+		{
+			name:                 "should return empty endpoint when not set",
+			inputMountOptions:    []string{"ro", "implicit-dirs"},
+			expectedMountOptions: []string{"ro", "implicit-dirs"},
+		},
+		{
+			name:                    "should extract the storage endpoint",
+			inputMountOptions:       []string{"ro", "storage-endpoint=https://storage.us-central1.rep.googleapis.com", "implicit-dirs"},
+			expectedStorageEndpoint: "https://storage.us-central1.rep.googleapis.com",
+			expectedMountOptions:    []string{"ro", "implicit-dirs"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+
+		e, o := extractStorageEndpoint(tc.inputMountOptions)
+		if e != tc.expectedStorageEndpoint {
+			t.Errorf("Got storage endpoint %q, but expected %q", e, tc.expectedStorageEndpoint)
+		}
+
+		if !reflect.DeepEqual(o, tc.expectedMountOptions) {
+			t.Errorf("Got options %v, but expected %v", o, tc.expectedMountOptions)
+		}
+	}
+}
+
+// The mount tests are not parallel, because Mount changes the working directory of the process to create the socket.
+
+func TestMountHandshake(t *testing.T) {
+	target, emptyDirBasePath, sidecarVolumesDir := prepareTestVolume(t)
+	fm := &FakeFUSEMounter{FakeMounter: mount.NewFakeMounter(nil)}
+	device := &FakeFUSEDevice{}
+	m := NewFakeMounter(fm, device, DefaultHandshakeTimeouts)
+
+	options := []string{"ro", "implicit-dirs", volumespec.StorageEndpointMountOptionKey + "=https://storage.us-central1.rep.googleapis.com", volumespec.TokenServerMountOptionKey + "=true"}
+	if err := m.Mount("test-bucket", target, "fuse", options); err != nil {
+		t.Fatalf("failed to mount: %v", err)
+	}
+
+	mps, _ := fm.List()
+	if len(mps) != 1 || mps[0].Device != "test-bucket" || mps[0].Path != target || mps[0].Type != "fuse" {
+		t.Errorf("got mount points %+v, expected the fuse mount of bucket %q to %q", mps, "test-bucket", target)
+	}
+
+	mc, err := sidecarmounter.ReceiveMountConfig(filepath.Join(sidecarVolumesDir, "test-volume", "socket"), "")
+	if err != nil {
+		t.Fatalf("failed to receive the mount config: %v", err)
+	}
+	defer syscall.Close(mc.FileDescriptor)
+
+	if mc.BucketName != "test-bucket" || mc.VolumeName != "test-volume" || mc.PodUID != "test-pod-uid" {
+		t.Errorf("got mount config %+v, expected bucket %q, volume %q, and Pod UID %q", mc, "test-bucket", "test-volume", "test-pod-uid")
+	}
+	if !reflect.DeepEqual(mc.Options, []string{"implicit-dirs"}) {
+		t.Errorf("got sidecar mount options %v, expected %v", mc.Options, []string{"implicit-dirs"})
+	}
+	if mc.StorageEndpoint != "https://storage.us-central1.rep.googleapis.com" {
+		t.Errorf("got storage endpoint %q, expected %q", mc.StorageEndpoint, "https://storage.us-central1.rep.googleapis.com")
+	}
+	if expected := filepath.Join(sidecarVolumesDir, "test-volume", sidecarmounter.TokenSocketName); mc.TokenSocketPath != expected {
+		t.Errorf("got token socket path %q, expected %q", mc.TokenSocketPath, expected)
+	}
+	if _, err := os.Stat(filepath.Join(emptyDirBasePath, "socket")); !os.IsNotExist(err) {
+		t.Errorf("got socket stat error %v, expected the socket to be removed", err)
+	}
+
+	// The node driver closes its file descriptor once gcsfuse is ready.
+	syscall.Close(mc.FileDescriptor)
+	if err := os.WriteFile(filepath.Join(emptyDirBasePath, sidecarmounter.ReadyFileName), nil, 0o644); err != nil {
+		t.Fatalf("failed to write the ready file: %v", err)
+	}
+	waitForClosedFileDescriptors(t, device)
+}
+
+func TestListenTokenSocket(t *testing.T) {
+	target, emptyDirBasePath, _ := prepareTestVolume(t)
+	m := NewFakeMounter(&FakeFUSEMounter{FakeMounter: mount.NewFakeMounter(nil)}, &FakeFUSEDevice{}, DefaultHandshakeTimeouts)
+
+	// The socket left by a previous node driver run is replaced.
+	socketPath := filepath.Join(emptyDirBasePath, sidecarmounter.TokenSocketName)
+	if err := os.WriteFile(socketPath, nil, 0o644); err != nil {
+		t.Fatalf("failed to write the stale socket: %v", err)
+	}
+
+	l, err := m.ListenTokenSocket(target)
+	if err != nil {
+		t.Fatalf("failed to listen on the token socket: %v", err)
+	}
+	defer l.Close()
+
+	if fi, err := os.Stat(socketPath); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		t.Errorf("got token socket stat %v and error %v, expected a socket", fi, err)
+	}
+}
+
+func TestMountHandshakeTimeout(t *testing.T) {
+	target, emptyDirBasePath, _ := prepareTestVolume(t)
+	fm := &FakeFUSEMounter{FakeMounter: mount.NewFakeMounter(nil)}
+	device := &FakeFUSEDevice{}
+	m := NewFakeMounter(fm, device, HandshakeTimeouts{FDHandoff: 100 * time.Millisecond, GCSFuseReady: time.Minute})
+
+	if err := m.Mount("test-bucket", target, "fuse", nil); err != nil {
+		t.Fatalf("failed to mount: %v", err)
+	}
+
+	var timeout *HandshakeTimeout
+	if err := wait.PollUntilContextTimeout(context.Background(), 50*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		var err error
+		timeout, err = ReadHandshakeTimeout(emptyDirBasePath)
+
+		return timeout != nil, err
+	}); err != nil {
+		t.Fatalf("failed to read the handshake timeout: %v", err)
+	}
+	if timeout.Phase != metrics.MountPhaseFDHandoff {
+		t.Errorf("got handshake timeout phase %q, expected %q", timeout.Phase, metrics.MountPhaseFDHandoff)
+	}
+	waitForClosedFileDescriptors(t, device)
+
+	// The target path is unmounted, so that the retry mounts it again.
+	if err := wait.PollUntilContextTimeout(context.Background(), 50*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		mps, err := fm.List()
+
+		return len(mps) == 0, err
+	}); err != nil {
+		t.Errorf("the target path is still mounted after the handoff timed out: %v", err)
+	}
+}
+
+func TestMountFailure(t *testing.T) {
+	testCases := []struct {
+		name            string
+		openErr         error
+		mountErr        error
+		chownErr        error
+		staleSocket     bool
+		sharedCache     bool
+		expectErr       bool
+		expectedMounts  int
+		expectedOpenFDs int
+	}{
+		{
+			name:      "FUSE device cannot be opened",
+			openErr:   errors.New("no such device"),
+			expectErr: true,
+		},
+		{
+			name:      "fuse mount fails",
+			mountErr:  errors.New("permission denied"),
+			expectErr: true,
+		},
+		{
+			name:        "shared cache directory is unmounted if the fuse mount fails",
+			mountErr:    errors.New("permission denied"),
+			sharedCache: true,
+			expectErr:   true,
+		},
+		{
+			name:      "mount is rolled back if the socket cannot be created",
+			chownErr:  errors.New("operation not permitted"),
+			expectErr: true,
+		},
+		{
+			name:            "stale socket of a previous mount is replaced",
+			staleSocket:     true,
+			expectedMounts:  1,
+			expectedOpenFDs: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+
+		target, emptyDirBasePath, _ := prepareTestVolume(t)
+		fm := &FakeFUSEMounter{FakeMounter: mount.NewFakeMounter(nil), MountErr: tc.mountErr}
+		device := &FakeFUSEDevice{OpenErr: tc.openErr}
+		m := NewFakeMounter(fm, device, HandshakeTimeouts{FDHandoff: time.Minute, GCSFuseReady: time.Minute})
+		if tc.chownErr != nil {
+			m.chown = func(string, int, int) error {
+				return tc.chownErr
+			}
+		}
+		if tc.staleSocket {
+			if err := os.WriteFile(filepath.Join(emptyDirBasePath, "socket"), nil, 0o644); err != nil {
+				t.Fatalf("failed to write the stale socket: %v", err)
+			}
+		}
+
+		var options []string
+		if tc.sharedCache {
+			options = []string{volumespec.SharedCacheDirMountOptionKey + "=" + t.TempDir()}
+		}
+		err := m.Mount("test-bucket", target, "fuse", options)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("Got error %v, but expected error %v", err, tc.expectErr)
+		}
+
+		if mps, _ := fm.List(); len(mps) != tc.expectedMounts {
+			t.Errorf("Got mount points %+v, but expected %v mount points", mps, tc.expectedMounts)
+		}
+
+		if n := device.OpenFileDescriptors(); n != tc.expectedOpenFDs {
+			t.Errorf("Got %v open file descriptors, but expected %v", n, tc.expectedOpenFDs)
+		}
+	}
+}
+
+// prepareTestVolume returns a target path following the kubelet Pod volume path pattern and its volume directory in the sidecar container emptyDir.
+// It also returns a short path to the emptyDir volumes directory as seen by the sidecar container,
+// because the socket path under the test directory is longer than the 108 characters a Unix socket path can have.
+func prepareTestVolume(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	target := filepath.Join(t.TempDir(), "var/lib/kubelet/pods/test-pod-uid/volumes/kubernetes.io~csi/test-volume/mount")
+	emptyDirBasePath, err := util.PrepareEmptyDir(target, true)
+	if err != nil {
+		t.Fatalf("failed to prepare the emptyDir: %v", err)
+	}
+
+	sidecarDir, err := os.MkdirTemp("", "sidecar")
+	if err != nil {
+		t.Fatalf("failed to create the sidecar directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sidecarDir) })
+	sidecarVolumesDir := filepath.Join(sidecarDir, ".volumes")
+	if err := os.Symlink(filepath.Dir(emptyDirBasePath), sidecarVolumesDir); err != nil {
+		t.Fatalf("failed to link the sidecar volumes directory: %v", err)
+	}
+
+	return target, emptyDirBasePath, sidecarVolumesDir
+}
+
+func waitForClosedFileDescriptors(t *testing.T, device *FakeFUSEDevice) {
+	t.Helper()
+
+	if err := wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return device.OpenFileDescriptors() == 0, nil
+	}); err != nil {
+		t.Errorf("Got %v open file descriptors, but expected all the file descriptors to be closed", device.OpenFileDescriptors())
+	}
+}
+
 func countOptionOccurrence(options []string) map[string]int {
 	dict := make(map[string]int)
 	for _, o := range options {
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csimounter
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/mount-utils"
+)
+
+// FakeFUSEDevice is an in-memory FUSE device for the tests without access to /dev/fuse.
+// Open returns the read end of a pipe, which can be passed over the socket like the FUSE file descriptor.
+type FakeFUSEDevice struct {
+	// OpenErr is returned by Open if set.
+	OpenErr error
+
+	mu      sync.Mutex
+	writers []*os.File
+}
+
+func (d *FakeFUSEDevice) Open() (int, error) {
+	if d.OpenErr != nil {
+		return -1, d.OpenErr
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return -1, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writers = append(d.writers, w)
+
+	// The caller owns the file descriptor, so the file must not close it when garbage collected.
+	fd, err := syscall.Dup(int(r.Fd()))
+	r.Close()
+
+	return fd, err
+}
+
+// OpenFileDescriptors returns the number of file descriptors returned by Open that are not closed yet,
+// including the copies received by the sidecar container.
+func (d *FakeFUSEDevice) OpenFileDescriptors() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for _, w := range d.writers {
+		// Writing to a pipe fails once all the file descriptors of the read end are closed.
+		if _, err := w.Write([]byte{0}); err == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// FakeFUSEMounter is an in-memory mount.MounterForceUnmounter recording the fuse mounts.
+type FakeFUSEMounter struct {
+	*mount.FakeMounter
+	// MountErr is returned by the fuse mount if set.
+	MountErr error
+}
+
+func (m *FakeFUSEMounter) MountSensitiveWithoutSystemdWithMountFlags(source string, target string, fstype string, options []string, sensitiveOptions []string, mountFlags []string) error {
+	if m.MountErr != nil {
+		return m.MountErr
+	}
+
+	return m.FakeMounter.MountSensitiveWithoutSystemdWithMountFlags(source, target, fstype, options, sensitiveOptions, mountFlags)
+}
+
+func (m *FakeFUSEMounter) UnmountWithForce(target string, _ time.Duration) error {
+	return m.Unmount(target)
+}
+
+// NewFakeMounter returns a Mounter mounting the fuse file system of the FakeFUSEDevice with the FakeFUSEMounter.
+// The ownership of the files shared with the sidecar container is not changed, so the tests do not need to run as root.
+func NewFakeMounter(fm *FakeFUSEMounter, device *FakeFUSEDevice, timeouts HandshakeTimeouts) *Mounter {
+	return &Mounter{
+		MounterForceUnmounter: fm,
+		timeouts:              timeouts,
+		device:                device,
+		chown: func(string, int, int) error {
+			return nil
+		},
+	}
+}
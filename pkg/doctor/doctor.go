@@ -0,0 +1,540 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/auth"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	driver "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_driver"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	gcpServiceAccountAnnotationKey = "iam.gke.io/gcp-service-account"
+	workloadIdentityUserRole       = "roles/iam.workloadIdentityUser"
+	gceProviderIDPrefix            = "gce://"
+)
+
+// storageRoles are the predefined roles that grant the access to list the objects in a bucket.
+var storageRoles = map[string]bool{
+	"roles/storage.admin":              true,
+	"roles/storage.objectAdmin":        true,
+	"roles/storage.objectUser":         true,
+	"roles/storage.objectViewer":       true,
+	"roles/storage.legacyBucketOwner":  true,
+	"roles/storage.legacyBucketReader": true,
+	"roles/storage.legacyBucketWriter": true,
+}
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+	StatusSkip Status = "SKIP"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check   string
+	Status  Status
+	Message string
+}
+
+// Report is the list of the check results of a Pod.
+type Report struct {
+	Pod     string
+	Results []Result
+}
+
+func (r *Report) add(check string, status Status, format string, args ...interface{}) {
+	r.Results = append(r.Results, Result{Check: check, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// Failed returns true if any check failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Print writes the report as a table.
+func (r *Report) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Diagnosing Pod %s\n\n", r.Pod)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tMESSAGE")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Status, result.Check, result.Message)
+	}
+
+	return tw.Flush()
+}
+
+// IAMService gets the IAM policies of GCP service accounts.
+type IAMService interface {
+	// GetServiceAccountIAMPolicy returns the members of each role in the IAM policy of the service account.
+	GetServiceAccountIAMPolicy(ctx context.Context, email string) (map[string][]string, error)
+}
+
+// Doctor automates the troubleshooting guide for Pods consuming Cloud Storage FUSE CSI volumes.
+// The Kubernetes API and GCP API calls are made with the credentials of the user running the checks.
+type Doctor struct {
+	Client                kubernetes.Interface
+	StorageServiceManager storage.ServiceManager
+	IAMService            IAMService
+	StorageEndpoint       string
+	// IdentityPool is the Workload Identity pool of the cluster, e.g. <project-id>.svc.id.goog.
+	// If empty, the pool is derived from the project of the node the Pod is scheduled to.
+	IdentityPool string
+	// NodeVolumeLister lists the volumes mounted on the node of the Pod. If nil, the node mounts are not checked.
+	NodeVolumeLister NodeVolumeLister
+}
+
+// gcsfuseVolume is a volume of the Pod served by the CSI driver.
+type gcsfuseVolume struct {
+	name   string
+	bucket string
+}
+
+// Diagnose runs the checks on the Pod, and returns the report.
+// An error is only returned if the Pod cannot be read.
+func (d *Doctor) Diagnose(ctx context.Context, namespace, name string) (*Report, error) {
+	pod, err := d.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Pod %s/%s: %w", namespace, name, err)
+	}
+
+	report := &Report{Pod: namespace + "/" + name}
+	d.checkAnnotation(report, pod)
+	d.checkSidecarInjection(report, pod)
+	volumes := d.checkVolumes(ctx, report, pod)
+	principal := d.checkWorkloadIdentity(ctx, report, pod)
+	d.checkBuckets(ctx, report, volumes, principal)
+	d.checkSidecarStatus(report, pod)
+	d.checkNodeMounts(ctx, report, pod, volumes)
+	d.checkMountEvents(ctx, report, pod)
+
+	return report, nil
+}
+
+func (d *Doctor) checkAnnotation(report *Report, pod *v1.Pod) {
+	const check = "Annotation"
+	v, ok := pod.Annotations[webhook.AnnotationGcsfuseVolumeEnableKey]
+	switch {
+	case !ok:
+		report.add(check, StatusFail, "the annotation %q is not set, add the annotation %s: \"true\" to the Pod template", webhook.AnnotationGcsfuseVolumeEnableKey, webhook.AnnotationGcsfuseVolumeEnableKey)
+	case strings.ToLower(v) != "true":
+		report.add(check, StatusFail, "the annotation %q is %q, set it to \"true\"", webhook.AnnotationGcsfuseVolumeEnableKey, v)
+	default:
+		report.add(check, StatusPass, "the annotation %q is set", webhook.AnnotationGcsfuseVolumeEnableKey)
+	}
+}
+
+func (d *Doctor) checkSidecarInjection(report *Report, pod *v1.Pod) {
+	const check = "Sidecar injection"
+	containerInjected := false
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if c.Name == webhook.SidecarContainerName {
+			containerInjected = true
+
+			break
+		}
+	}
+
+	volumeInjected := false
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == webhook.SidecarContainerVolumeName {
+			volumeInjected = true
+
+			break
+		}
+	}
+
+	switch {
+	case !containerInjected:
+		report.add(check, StatusFail, "the sidecar container %q is not injected, the Pod was created without the annotation or before the webhook was running, recreate the Pod", webhook.SidecarContainerName)
+	case !volumeInjected:
+		report.add(check, StatusFail, "the sidecar container volume %q is not injected, recreate the Pod", webhook.SidecarContainerVolumeName)
+	default:
+		report.add(check, StatusPass, "the sidecar container %q is injected", webhook.SidecarContainerName)
+	}
+}
+
+// checkVolumes validates the CSI ephemeral volumes and the PersistentVolumeClaims of the Pod, and returns the gcsfuse volumes.
+func (d *Doctor) checkVolumes(ctx context.Context, report *Report, pod *v1.Pod) []gcsfuseVolume {
+	volumes := []gcsfuseVolume{}
+	for _, v := range pod.Spec.Volumes {
+		check := "Volume " + v.Name
+		switch {
+		case v.CSI != nil:
+			if v.CSI.Driver != volumespec.DriverName {
+				continue
+			}
+
+			bucket := v.CSI.VolumeAttributes[volumespec.VolumeContextKeyBucketName]
+			if bucket == "" {
+				report.add(check, StatusFail, "the volume attribute %q is not set", volumespec.VolumeContextKeyBucketName)
+
+				continue
+			}
+			report.add(check, StatusPass, "CSI ephemeral volume of bucket %q", bucket)
+			volumes = append(volumes, gcsfuseVolume{name: v.Name, bucket: bucket})
+
+		case v.PersistentVolumeClaim != nil:
+			claimName := v.PersistentVolumeClaim.ClaimName
+			pvc, err := d.Client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, claimName, metav1.GetOptions{})
+			if err != nil {
+				report.add(check, StatusFail, "failed to get PersistentVolumeClaim %q: %v", claimName, err)
+
+				continue
+			}
+			if pvc.Spec.VolumeName == "" {
+				report.add(check, StatusFail, "PersistentVolumeClaim %q is not bound, make sure the PersistentVolume sets the claimRef or the PersistentVolumeClaim sets the volumeName", claimName)
+
+				continue
+			}
+
+			pv, err := d.Client.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+			if err != nil {
+				report.add(check, StatusFail, "failed to get PersistentVolume %q: %v", pvc.Spec.VolumeName, err)
+
+				continue
+			}
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != volumespec.DriverName {
+				continue
+			}
+			if pv.Spec.CSI.VolumeHandle == "" {
+				report.add(check, StatusFail, "the volumeHandle of PersistentVolume %q is not set to the bucket name", pv.Name)
+
+				continue
+			}
+			report.add(check, StatusPass, "PersistentVolume %q of bucket %q", pv.Name, pv.Spec.CSI.VolumeHandle)
+			volumes = append(volumes, gcsfuseVolume{name: v.Name, bucket: pv.Spec.CSI.VolumeHandle})
+		}
+	}
+
+	if len(volumes) == 0 {
+		report.add("Volumes", StatusFail, "the Pod does not have any volume using the driver %q", volumespec.DriverName)
+	}
+
+	return volumes
+}
+
+// checkWorkloadIdentity validates the Workload Identity setup of the Kubernetes service account of the Pod,
+// and returns the GCP principal that accesses the buckets. The principal is empty if it cannot be determined.
+func (d *Doctor) checkWorkloadIdentity(ctx context.Context, report *Report, pod *v1.Pod) string {
+	const check = "Workload Identity"
+	saName := pod.Spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+
+	sa, err := d.Client.CoreV1().ServiceAccounts(pod.Namespace).Get(ctx, saName, metav1.GetOptions{})
+	if err != nil {
+		report.add(check, StatusFail, "failed to get the Kubernetes service account %s/%s: %v", pod.Namespace, saName, err)
+
+		return ""
+	}
+
+	identityPool, err := d.getIdentityPool(ctx, pod)
+	if err != nil {
+		report.add(check, StatusWarn, "failed to determine the Workload Identity pool, set the identity pool explicitly: %v", err)
+		if gcpSA := sa.Annotations[gcpServiceAccountAnnotationKey]; gcpSA != "" {
+			return "serviceAccount:" + gcpSA
+		}
+
+		return ""
+	}
+
+	identity := &auth.Identity{
+		KubernetesServiceAccount:   pod.Namespace + "/" + saName,
+		FederatedPrincipal:         fmt.Sprintf("serviceAccount:%s[%s/%s]", identityPool, pod.Namespace, saName),
+		ImpersonatedServiceAccount: sa.Annotations[gcpServiceAccountAnnotationKey],
+	}
+
+	if identity.ImpersonatedServiceAccount == "" {
+		report.add(check, StatusPass, "the buckets are accessed as the federated principal: %s", identity.Chain())
+
+		return identity.Principal()
+	}
+
+	if d.IAMService == nil {
+		report.add(check, StatusSkip, "the IAM service is not configured")
+
+		return identity.Principal()
+	}
+
+	policy, err := d.IAMService.GetServiceAccountIAMPolicy(ctx, identity.ImpersonatedServiceAccount)
+	if err != nil {
+		report.add(check, StatusWarn, "failed to get the IAM policy of the GCP service account %q: %v", identity.ImpersonatedServiceAccount, err)
+
+		return identity.Principal()
+	}
+
+	if !containsString(policy[workloadIdentityUserRole], identity.FederatedPrincipal) {
+		report.add(check, StatusFail, "%q is not granted the role %q on the GCP service account %q, run: gcloud iam service-accounts add-iam-policy-binding %s --role %s --member %q",
+			identity.FederatedPrincipal, workloadIdentityUserRole, identity.ImpersonatedServiceAccount,
+			identity.ImpersonatedServiceAccount, workloadIdentityUserRole, identity.FederatedPrincipal)
+
+		return identity.Principal()
+	}
+
+	report.add(check, StatusPass, "the buckets are accessed as the GCP service account: %s", identity.Chain())
+
+	return identity.Principal()
+}
+
+// getIdentityPool returns the configured identity pool, or the default identity pool of the project of the Pod node.
+func (d *Doctor) getIdentityPool(ctx context.Context, pod *v1.Pod) (string, error) {
+	if d.IdentityPool != "" {
+		return d.IdentityPool, nil
+	}
+
+	if pod.Spec.NodeName == "" {
+		return "", fmt.Errorf("the Pod is not scheduled to a node")
+	}
+
+	node, err := d.Client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %q: %w", pod.Spec.NodeName, err)
+	}
+
+	// The provider ID of GCE nodes is in the format of gce://<project-id>/<zone>/<instance-name>.
+	projectID, _, _ := strings.Cut(strings.TrimPrefix(node.Spec.ProviderID, gceProviderIDPrefix), "/")
+	if !strings.HasPrefix(node.Spec.ProviderID, gceProviderIDPrefix) || projectID == "" {
+		return "", fmt.Errorf("unexpected provider ID %q of node %q", node.Spec.ProviderID, node.Name)
+	}
+
+	return projectID + ".svc.id.goog", nil
+}
+
+// checkBuckets checks the existence of each bucket, and whether the principal is granted a storage role on the bucket.
+func (d *Doctor) checkBuckets(ctx context.Context, report *Report, volumes []gcsfuseVolume, principal string) {
+	if len(volumes) == 0 {
+		return
+	}
+
+	storageService, err := d.StorageServiceManager.SetupServiceWithDefaultCredential(ctx, d.StorageEndpoint)
+	if err != nil {
+		report.add("Buckets", StatusWarn, "failed to set up the storage service with your credentials: %v", err)
+
+		return
+	}
+
+	checked := map[string]bool{}
+	for _, v := range volumes {
+		if checked[v.bucket] {
+			continue
+		}
+		checked[v.bucket] = true
+
+		check := "Bucket " + v.bucket
+		if v.bucket == "_" {
+			report.add(check, StatusSkip, "volume %q mounts all the buckets the principal has access to", v.name)
+
+			continue
+		}
+
+		bucket := &storage.ServiceBucket{Name: v.bucket}
+		if _, err := storageService.GetBucket(ctx, bucket); err != nil {
+			if storage.IsNotExistErr(err) {
+				report.add(check, StatusFail, "the bucket does not exist, make sure the bucket name is specified correctly")
+			} else {
+				report.add(check, StatusWarn, "failed to get the bucket with your credentials: %v", err)
+			}
+
+			continue
+		}
+		report.add(check, StatusPass, "the bucket exists")
+
+		check = "Bucket " + v.bucket + " IAM"
+		if principal == "" {
+			report.add(check, StatusSkip, "the principal accessing the bucket is unknown")
+
+			continue
+		}
+
+		policy, err := storageService.GetIAMPolicy(ctx, bucket)
+		if err != nil {
+			report.add(check, StatusWarn, "failed to get the bucket IAM policy with your credentials: %v", err)
+
+			continue
+		}
+
+		roles := []string{}
+		for role, members := range policy {
+			if storageRoles[role] && (containsString(members, principal) || containsString(members, "allUsers") || containsString(members, "allAuthenticatedUsers")) {
+				roles = append(roles, role)
+			}
+		}
+		sort.Strings(roles)
+
+		if len(roles) == 0 {
+			report.add(check, StatusWarn, "%q is not granted a storage role on the bucket, grant the role roles/storage.objectUser or roles/storage.objectViewer unless the access is granted at the project level", principal)
+
+			continue
+		}
+		report.add(check, StatusPass, "%q is granted %s", principal, strings.Join(roles, ", "))
+	}
+}
+
+func (d *Doctor) checkSidecarStatus(report *Report, pod *v1.Pod) {
+	const check = "Sidecar status"
+	var status *v1.ContainerStatus
+	for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if cs.Name == webhook.SidecarContainerName {
+			cs := cs
+			status = &cs
+
+			break
+		}
+	}
+
+	if status == nil {
+		report.add(check, StatusSkip, "the sidecar container has not been created, the Pod phase is %q", pod.Status.Phase)
+
+		return
+	}
+
+	switch {
+	case status.State.Running != nil:
+		if status.RestartCount > 0 && status.LastTerminationState.Terminated != nil {
+			report.add(check, StatusWarn, "running, restarted %d times, last terminated with reason %q", status.RestartCount, status.LastTerminationState.Terminated.Reason)
+
+			return
+		}
+		report.add(check, StatusPass, "running")
+	case status.State.Terminated != nil:
+		terminated := status.State.Terminated
+		switch {
+		case terminated.Reason == "OOMKilled":
+			report.add(check, StatusFail, "terminated because of OOM, increase the sidecar container memory limit using the annotation gke-gcsfuse/memory-limit")
+		case terminated.ExitCode != 0:
+			report.add(check, StatusFail, "terminated with exit code %d, reason %q, check the sidecar container logs", terminated.ExitCode, terminated.Reason)
+		default:
+			report.add(check, StatusPass, "terminated after the workload containers exited")
+		}
+	case status.State.Waiting != nil:
+		report.add(check, StatusWarn, "waiting with reason %q: %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+	}
+}
+
+// checkNodeMounts reports whether the buckets of the gcsfuse volumes are mounted on the node of the Pod, and with which options.
+func (d *Doctor) checkNodeMounts(ctx context.Context, report *Report, pod *v1.Pod, volumes []gcsfuseVolume) {
+	const check = "Node mounts"
+	if d.NodeVolumeLister == nil || len(volumes) == 0 {
+		return
+	}
+	if pod.Spec.NodeName == "" {
+		report.add(check, StatusSkip, "the Pod is not scheduled to a node")
+
+		return
+	}
+
+	mounted, err := d.NodeVolumeLister.ListVolumes(ctx, pod.Spec.NodeName)
+	if err != nil {
+		report.add(check, StatusSkip, "failed to list the volumes mounted on node %q: %v", pod.Spec.NodeName, err)
+
+		return
+	}
+
+	for _, v := range volumes {
+		check := "Node mount " + v.name
+		var mv *driver.MountedVolume
+		for i := range mounted {
+			if mounted[i].PodUID == string(pod.UID) && mounted[i].Bucket == v.bucket {
+				mv = &mounted[i]
+
+				break
+			}
+		}
+
+		switch {
+		case mv == nil:
+			report.add(check, StatusFail, "bucket %q is not mounted on node %q", v.bucket, pod.Spec.NodeName)
+		case len(mv.MountOptions) == 0:
+			report.add(check, StatusPass, "bucket %q is mounted at %s", v.bucket, mv.TargetPath)
+		default:
+			report.add(check, StatusPass, "bucket %q is mounted at %s with options %s", v.bucket, mv.TargetPath, strings.Join(mv.MountOptions, ","))
+		}
+	}
+}
+
+// checkMountEvents reports the most recent FailedMount event of the Pod.
+func (d *Doctor) checkMountEvents(ctx context.Context, report *Report, pod *v1.Pod) {
+	const check = "Mount events"
+	events, err := d.Client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.name=%s,reason=FailedMount", pod.Name),
+	})
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			report.add(check, StatusSkip, "not allowed to list the events: %v", err)
+		} else {
+			report.add(check, StatusWarn, "failed to list the events: %v", err)
+		}
+
+		return
+	}
+
+	var latest *v1.Event
+	for i := range events.Items {
+		e := &events.Items[i]
+		if e.InvolvedObject.UID != pod.UID || e.Reason != "FailedMount" {
+			continue
+		}
+		if latest == nil || e.LastTimestamp.After(latest.LastTimestamp.Time) {
+			latest = e
+		}
+	}
+
+	if latest == nil {
+		report.add(check, StatusPass, "no FailedMount events")
+
+		return
+	}
+	report.add(check, StatusFail, "%s (x%d)", latest.Message, latest.Count)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
+	driver "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_driver"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace    = "test-ns"
+	testPodName      = "test-pod"
+	testBucket       = "test-bucket"
+	testGCPSA        = "test-sa@test-project.iam.gserviceaccount.com"
+	testFederatedKSA = "serviceAccount:test-project.svc.id.goog[test-ns/test-ksa]"
+)
+
+type fakeIAMService struct {
+	policy map[string][]string
+}
+
+func (s *fakeIAMService) GetServiceAccountIAMPolicy(_ context.Context, _ string) (map[string][]string, error) {
+	return s.policy, nil
+}
+
+type fakeNodeVolumeLister struct {
+	volumes []driver.MountedVolume
+}
+
+func (l *fakeNodeVolumeLister) ListVolumes(_ context.Context, _ string) ([]driver.MountedVolume, error) {
+	return l.volumes, nil
+}
+
+func newTestPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        testPodName,
+			Namespace:   testNamespace,
+			UID:         "test-pod-uid",
+			Annotations: map[string]string{webhook.AnnotationGcsfuseVolumeEnableKey: "true"},
+		},
+		Spec: v1.PodSpec{
+			NodeName:           "test-node",
+			ServiceAccountName: "test-ksa",
+			Containers: []v1.Container{
+				{Name: webhook.SidecarContainerName},
+				{Name: "workload"},
+			},
+			Volumes: []v1.Volume{
+				webhook.GetSidecarContainerVolumeSpec(),
+				{
+					Name: "gcs-fuse-csi-ephemeral",
+					VolumeSource: v1.VolumeSource{
+						CSI: &v1.CSIVolumeSource{
+							Driver:           volumespec.DriverName,
+							VolumeAttributes: map[string]string{volumespec.VolumeContextKeyBucketName: testBucket},
+						},
+					},
+				},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: webhook.SidecarContainerName, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			},
+		},
+	}
+}
+
+func newTestObjects(pod *v1.Pod) []runtime.Object {
+	return []runtime.Object{
+		pod,
+		&v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-ksa",
+				Namespace:   testNamespace,
+				Annotations: map[string]string{gcpServiceAccountAnnotationKey: testGCPSA},
+			},
+		},
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+			Spec:       v1.NodeSpec{ProviderID: "gce://test-project/us-central1-c/test-node"},
+		},
+	}
+}
+
+func newTestDoctor(t *testing.T, createBucket bool, objects ...runtime.Object) *Doctor {
+	t.Helper()
+	ssm := storage.NewFakeServiceManager()
+	if createBucket {
+		ss, err := ssm.SetupServiceWithDefaultCredential(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("failed to set up the storage service: %v", err)
+		}
+		if _, err := ss.CreateBucket(context.TODO(), &storage.ServiceBucket{Name: testBucket}); err != nil {
+			t.Fatalf("failed to create the bucket: %v", err)
+		}
+		if err := ss.SetIAMPolicy(context.TODO(), &storage.ServiceBucket{Name: testBucket}, "serviceAccount:"+testGCPSA, "roles/storage.objectUser"); err != nil {
+			t.Fatalf("failed to set the bucket IAM policy: %v", err)
+		}
+	}
+
+	return &Doctor{
+		Client:                fake.NewSimpleClientset(objects...),
+		StorageServiceManager: ssm,
+		IAMService:            &fakeIAMService{policy: map[string][]string{workloadIdentityUserRole: {testFederatedKSA}}},
+		NodeVolumeLister: &fakeNodeVolumeLister{volumes: []driver.MountedVolume{
+			{PodUID: "test-pod-uid", Bucket: testBucket, TargetPath: "/var/lib/kubelet/pods/test-pod-uid/volumes/kubernetes.io~csi/gcs-fuse-csi-ephemeral/mount", MountOptions: []string{"implicit-dirs"}},
+		}},
+	}
+}
+
+func resultStatuses(report *Report) map[string]Status {
+	statuses := map[string]Status{}
+	for _, r := range report.Results {
+		statuses[r.Check] = r.Status
+	}
+
+	return statuses
+}
+
+func TestDiagnoseHealthyPod(t *testing.T) {
+	t.Parallel()
+	d := newTestDoctor(t, true, newTestObjects(newTestPod())...)
+
+	report, err := d.Diagnose(context.TODO(), testNamespace, testPodName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, r := range report.Results {
+		if r.Status != StatusPass {
+			t.Errorf("check %q got status %v, expected %v: %s", r.Check, r.Status, StatusPass, r.Message)
+		}
+	}
+	if report.Failed() {
+		t.Error("expected the report not to fail")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.Print(buf); err != nil {
+		t.Fatalf("failed to print the report: %v", err)
+	}
+	if !strings.Contains(buf.String(), "PASS    Bucket test-bucket IAM") {
+		t.Errorf("unexpected report output:\n%s", buf.String())
+	}
+}
+
+func TestDiagnoseFailures(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name           string
+		modifyPod      func(pod *v1.Pod)
+		noBucket       bool
+		wiPolicy       map[string][]string
+		notMounted     bool
+		extraObjects   []runtime.Object
+		expectedCheck  string
+		expectedStatus Status
+	}{
+		{
+			name:           "annotation not set",
+			modifyPod:      func(pod *v1.Pod) { pod.Annotations = nil },
+			expectedCheck:  "Annotation",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "sidecar container not injected",
+			modifyPod:      func(pod *v1.Pod) { pod.Spec.Containers = pod.Spec.Containers[1:] },
+			expectedCheck:  "Sidecar injection",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "bucket name not set",
+			modifyPod:      func(pod *v1.Pod) { pod.Spec.Volumes[1].CSI.VolumeAttributes = nil },
+			expectedCheck:  "Volume gcs-fuse-csi-ephemeral",
+			expectedStatus: StatusFail,
+		},
+		{
+			name: "PersistentVolumeClaim not bound",
+			modifyPod: func(pod *v1.Pod) {
+				pod.Spec.Volumes[1].VolumeSource = v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "test-pvc"}}
+			},
+			extraObjects: []runtime.Object{
+				&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "test-pvc", Namespace: testNamespace}},
+			},
+			expectedCheck:  "Volume gcs-fuse-csi-ephemeral",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "Workload Identity not bound",
+			wiPolicy:       map[string][]string{},
+			expectedCheck:  "Workload Identity",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "bucket not found",
+			noBucket:       true,
+			expectedCheck:  "Bucket test-bucket",
+			expectedStatus: StatusFail,
+		},
+		{
+			name: "sidecar container OOM",
+			modifyPod: func(pod *v1.Pod) {
+				pod.Status.ContainerStatuses[0].State = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}
+			},
+			expectedCheck:  "Sidecar status",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "bucket not mounted on the node",
+			notMounted:     true,
+			expectedCheck:  "Node mount gcs-fuse-csi-ephemeral",
+			expectedStatus: StatusFail,
+		},
+		{
+			name: "failed mount event",
+			extraObjects: []runtime.Object{
+				&v1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Name: "test-event", Namespace: testNamespace},
+					InvolvedObject: v1.ObjectReference{Name: testPodName, Namespace: testNamespace, UID: "test-pod-uid"},
+					Reason:         "FailedMount",
+					Message:        "MountVolume.SetUp failed",
+					Count:          3,
+				},
+			},
+			expectedCheck:  "Mount events",
+			expectedStatus: StatusFail,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			pod := newTestPod()
+			if tc.modifyPod != nil {
+				tc.modifyPod(pod)
+			}
+			d := newTestDoctor(t, !tc.noBucket, append(newTestObjects(pod), tc.extraObjects...)...)
+			if tc.wiPolicy != nil {
+				d.IAMService = &fakeIAMService{policy: tc.wiPolicy}
+			}
+			if tc.notMounted {
+				d.NodeVolumeLister = &fakeNodeVolumeLister{}
+			}
+
+			report, err := d.Diagnose(context.TODO(), testNamespace, testPodName)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if status := resultStatuses(report)[tc.expectedCheck]; status != tc.expectedStatus {
+				t.Errorf("check %q got status %q, expected %q, results: %+v", tc.expectedCheck, status, tc.expectedStatus, report.Results)
+			}
+			if !report.Failed() {
+				t.Error("expected the report to fail")
+			}
+		})
+	}
+}
+
+func TestDiagnosePodNotFound(t *testing.T) {
+	t.Parallel()
+	d := newTestDoctor(t, true)
+
+	if _, err := d.Diagnose(context.TODO(), testNamespace, testPodName); err == nil {
+		t.Error("expected error when the Pod does not exist")
+	}
+}
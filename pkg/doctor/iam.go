@@ -0,0 +1,53 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+
+	iam "google.golang.org/api/iam/v1"
+)
+
+type gcpIAMService struct {
+	service *iam.Service
+}
+
+// NewIAMService returns an IAMService using the application default credentials.
+func NewIAMService(ctx context.Context) (IAMService, error) {
+	service, err := iam.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the IAM service: %w", err)
+	}
+
+	return &gcpIAMService{service: service}, nil
+}
+
+func (s *gcpIAMService) GetServiceAccountIAMPolicy(ctx context.Context, email string) (map[string][]string, error) {
+	policy, err := s.service.Projects.ServiceAccounts.GetIamPolicy("projects/-/serviceAccounts/" + email).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := map[string][]string{}
+	for _, b := range policy.Bindings {
+		bindings[b.Role] = append(bindings[b.Role], b.Members...)
+	}
+
+	return bindings, nil
+}
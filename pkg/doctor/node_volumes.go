@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	driver "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_driver"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	nodeDriverLabelSelector = "k8s-app=gcs-fuse-csi-driver"
+	nodeDriverContainerName = "gcs-fuse-csi-driver"
+	nodeDriverBinary        = "/gcs-fuse-csi-driver"
+)
+
+// NodeVolumeLister lists the gcsfuse volumes mounted on a node.
+type NodeVolumeLister interface {
+	ListVolumes(ctx context.Context, nodeName string) ([]driver.MountedVolume, error)
+}
+
+// ExecNodeVolumeLister lists the gcsfuse volumes mounted on a node by running the node driver in the --list-volumes mode
+// in the node driver Pod of the node, which requires the permission to create pods/exec in the driver namespace.
+type ExecNodeVolumeLister struct {
+	Client     kubernetes.Interface
+	RestConfig *rest.Config
+	// Namespace is the namespace of the node driver Pods.
+	Namespace string
+}
+
+// ListVolumes returns the gcsfuse volumes mounted on the node.
+func (l *ExecNodeVolumeLister) ListVolumes(ctx context.Context, nodeName string) ([]driver.MountedVolume, error) {
+	pods, err := l.Client.CoreV1().Pods(l.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: nodeDriverLabelSelector,
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the node driver Pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no node driver Pod found on node %q in namespace %q", nodeName, l.Namespace)
+	}
+	pod := pods.Items[0]
+
+	req := l.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: nodeDriverContainerName,
+			Command:   []string{nodeDriverBinary, "--list-volumes"},
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(l.RestConfig, "POST", req.URL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec into the node driver Pod %s: %w", pod.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return nil, fmt.Errorf("failed to list the volumes in the node driver Pod %s: %w: %s", pod.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	volumes := []driver.MountedVolume{}
+	if err := json.Unmarshal(stdout.Bytes(), &volumes); err != nil {
+		return nil, fmt.Errorf("failed to parse the volumes listed by the node driver Pod %s: %w", pod.Name, err)
+	}
+
+	return volumes, nil
+}
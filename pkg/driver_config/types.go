@@ -0,0 +1,213 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driverconfig
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group    = "gcsfuse.csi.storage.gke.io"
+	Version  = "v1alpha1"
+	Kind     = "GCSFuseCSIDriverConfig"
+	Resource = "gcsfusecsidriverconfigs"
+
+	// DefaultName is the name of the cluster-scoped GCSFuseCSIDriverConfig object watched by the driver components.
+	DefaultName = "default"
+)
+
+// GroupVersionResource is the resource of the GCSFuseCSIDriverConfig CRD.
+var GroupVersionResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: Resource}
+
+// GCSFuseCSIDriverConfig expresses the cluster-wide defaults and policies of the CSI driver.
+// The fields set in the object take precedence over the flags of the node driver and the webhook.
+type GCSFuseCSIDriverConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Spec `json:"spec,omitempty"`
+}
+
+// Spec is the cluster-wide driver configuration.
+type Spec struct {
+	// Sidecar overrides the default sidecar container settings of the webhook.
+	Sidecar SidecarSpec `json:"sidecar,omitempty"`
+	// MountOptionAllowlist is the list of the mount options allowed in the volumes, e.g. implicit-dirs or uid.
+	// The options are matched by the name before the "=". The ro and rw options are always allowed.
+	// If empty, all the mount options are allowed.
+	MountOptionAllowlist []string `json:"mountOptionAllowlist,omitempty"`
+	// BucketAllowlist is the list of the bucket names allowed to be mounted. A name ending with "*" matches the buckets with the prefix.
+	// If empty, all the buckets are allowed.
+	BucketAllowlist []string `json:"bucketAllowlist,omitempty"`
+	// DefaultMountOptions are added to the mount options of every volume that does not set the same option,
+	// e.g. the cache settings stat-cache-ttl=1h or type-cache-ttl=1h.
+	DefaultMountOptions []string `json:"defaultMountOptions,omitempty"`
+	// NamespaceDefaults are the defaults of the Pods and volumes in some namespaces, which take precedence over the cluster-wide defaults.
+	// The first entry matching the namespace is used.
+	NamespaceDefaults []NamespaceDefaults `json:"namespaceDefaults,omitempty"`
+}
+
+// NamespaceDefaults are the defaults of the Pods and volumes in the namespaces, so that the application teams do not need to learn the tuning knobs.
+type NamespaceDefaults struct {
+	// Namespaces are the names of the namespaces. A name ending with "*" matches the namespaces with the prefix.
+	Namespaces []string `json:"namespaces"`
+	// Annotations are the sidecar container annotations added by the webhook to the Pods that do not set them,
+	// e.g. gke-gcsfuse/memory-limit: 1Gi.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// MountOptions are added by the node driver to every volume of the Pods that does not set the same option.
+	MountOptions []string `json:"mountOptions,omitempty"`
+}
+
+// SidecarSpec is the default sidecar container settings. The empty fields fall back to the webhook flags.
+type SidecarSpec struct {
+	Image                 string `json:"image,omitempty"`
+	ImagePullPolicy       string `json:"imagePullPolicy,omitempty"`
+	CPULimit              string `json:"cpuLimit,omitempty"`
+	MemoryLimit           string `json:"memoryLimit,omitempty"`
+	EphemeralStorageLimit string `json:"ephemeralStorageLimit,omitempty"`
+	// CanaryImage is injected instead of the sidecar image into CanaryPercentage percent of the new Pods.
+	CanaryImage      string `json:"canaryImage,omitempty"`
+	CanaryPercentage *int32 `json:"canaryPercentage,omitempty"`
+}
+
+// IsBucketAllowed returns true if the bucket is allowed by the bucket allowlist.
+func (s *Spec) IsBucketAllowed(bucket string) bool {
+	if s == nil || len(s.BucketAllowlist) == 0 {
+		return true
+	}
+
+	for _, b := range s.BucketAllowlist {
+		if matchName(b, bucket) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NamespaceDefaultsOf returns the defaults of the namespace, or nil if no entry matches the namespace.
+func (s *Spec) NamespaceDefaultsOf(namespace string) *NamespaceDefaults {
+	if s == nil {
+		return nil
+	}
+
+	for i := range s.NamespaceDefaults {
+		for _, n := range s.NamespaceDefaults[i].Namespaces {
+			if matchName(n, namespace) {
+				return &s.NamespaceDefaults[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchName returns true if the name is the pattern, or has the prefix of a pattern ending with "*".
+func matchName(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+
+	return pattern == name
+}
+
+// IsMountOptionAllowed returns true if the mount option is allowed by the mount option allowlist.
+func (s *Spec) IsMountOptionAllowed(option string) bool {
+	if s == nil || len(s.MountOptionAllowlist) == 0 {
+		return true
+	}
+
+	// The context option is passed by the kubelet with the Pod SELinux label when seLinuxMount is enabled on the CSIDriver.
+	name := mountOptionName(option)
+	if name == "ro" || name == "rw" || name == "context" {
+		return true
+	}
+
+	for _, o := range s.MountOptionAllowlist {
+		if mountOptionName(o) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApplyDefaultMountOptions returns the mount options with the default mount options that are not set in the options.
+// The default mount options of the namespace take precedence over the cluster-wide default mount options.
+func (s *Spec) ApplyDefaultMountOptions(options []string, namespace string) []string {
+	if s == nil {
+		return options
+	}
+
+	if d := s.NamespaceDefaultsOf(namespace); d != nil {
+		options = MergeMountOptions(options, d.MountOptions)
+	}
+
+	return MergeMountOptions(options, s.DefaultMountOptions)
+}
+
+// MergeMountOptions returns the mount options with the default mount options whose names are not set in the options.
+func MergeMountOptions(options, defaults []string) []string {
+	if len(defaults) == 0 {
+		return options
+	}
+
+	set := map[string]bool{}
+	for _, o := range options {
+		set[mountOptionName(o)] = true
+	}
+
+	result := append([]string{}, options...)
+	for _, o := range defaults {
+		if !set[mountOptionName(o)] {
+			result = append(result, o)
+		}
+	}
+
+	return result
+}
+
+// SplitMountOptions splits the comma-separated mount options of the mountOptions volume attribute,
+// keeping the commas of the double-quoted values, e.g. the SELinux level of context="system_u:object_r:container_file_t:s0:c1,c2".
+func SplitMountOptions(options string) []string {
+	result := []string{}
+	start, quoted := 0, false
+	for i, c := range options {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				result = append(result, options[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(result, options[start:])
+}
+
+// mountOptionName returns the name of a mount option, e.g. uid for uid=1001, or implicit-dirs for --implicit-dirs.
+func mountOptionName(option string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(option), "=")
+
+	return strings.TrimLeft(name, "-")
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driverconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIsBucketAllowed(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name     string
+		spec     *Spec
+		bucket   string
+		expected bool
+	}{
+		{name: "nil spec", bucket: "test-bucket", expected: true},
+		{name: "empty allowlist", spec: &Spec{}, bucket: "test-bucket", expected: true},
+		{name: "exact match", spec: &Spec{BucketAllowlist: []string{"test-bucket"}}, bucket: "test-bucket", expected: true},
+		{name: "prefix match", spec: &Spec{BucketAllowlist: []string{"team-a-*"}}, bucket: "team-a-data", expected: true},
+		{name: "prefix not match", spec: &Spec{BucketAllowlist: []string{"team-a-*"}}, bucket: "team-b-data", expected: false},
+		{name: "not in allowlist", spec: &Spec{BucketAllowlist: []string{"test-bucket"}}, bucket: "test-bucket-2", expected: false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.spec.IsBucketAllowed(tc.bucket); got != tc.expected {
+			t.Errorf("%v: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestIsMountOptionAllowed(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name     string
+		spec     *Spec
+		option   string
+		expected bool
+	}{
+		{name: "nil spec", option: "uid=1001", expected: true},
+		{name: "empty allowlist", spec: &Spec{}, option: "uid=1001", expected: true},
+		{name: "option with value", spec: &Spec{MountOptionAllowlist: []string{"uid"}}, option: "uid=1001", expected: true},
+		{name: "option with flag prefix", spec: &Spec{MountOptionAllowlist: []string{"implicit-dirs"}}, option: "--implicit-dirs", expected: true},
+		{name: "read only option", spec: &Spec{MountOptionAllowlist: []string{"implicit-dirs"}}, option: "ro", expected: true},
+		{name: "SELinux context option", spec: &Spec{MountOptionAllowlist: []string{"implicit-dirs"}}, option: `context="system_u:object_r:container_file_t:s0:c1,c2"`, expected: true},
+		{name: "option not in allowlist", spec: &Spec{MountOptionAllowlist: []string{"implicit-dirs"}}, option: "gid=1001", expected: false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.spec.IsMountOptionAllowed(tc.option); got != tc.expected {
+			t.Errorf("%v: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestApplyDefaultMountOptions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		spec      *Spec
+		options   []string
+		namespace string
+		expected  []string
+	}{
+		{name: "nil spec", options: []string{"uid=1001"}, expected: []string{"uid=1001"}},
+		{
+			name:     "default options added",
+			spec:     &Spec{DefaultMountOptions: []string{"implicit-dirs", "stat-cache-ttl=1h"}},
+			options:  []string{"uid=1001"},
+			expected: []string{"uid=1001", "implicit-dirs", "stat-cache-ttl=1h"},
+		},
+		{
+			name:     "volume options take precedence",
+			spec:     &Spec{DefaultMountOptions: []string{"stat-cache-ttl=1h"}},
+			options:  []string{"stat-cache-ttl=10s"},
+			expected: []string{"stat-cache-ttl=10s"},
+		},
+		{
+			name: "namespace options take precedence over cluster options",
+			spec: &Spec{
+				DefaultMountOptions: []string{"stat-cache-ttl=1h", "implicit-dirs"},
+				NamespaceDefaults: []NamespaceDefaults{
+					{Namespaces: []string{"other"}, MountOptions: []string{"type-cache-ttl=1m"}},
+					{Namespaces: []string{"team-*"}, MountOptions: []string{"stat-cache-ttl=5m"}},
+				},
+			},
+			options:   []string{"uid=1001"},
+			namespace: "team-a",
+			expected:  []string{"uid=1001", "stat-cache-ttl=5m", "implicit-dirs"},
+		},
+		{
+			name:      "namespace without defaults",
+			spec:      &Spec{NamespaceDefaults: []NamespaceDefaults{{Namespaces: []string{"team-*"}, MountOptions: []string{"stat-cache-ttl=5m"}}}},
+			options:   []string{"uid=1001"},
+			namespace: "default",
+			expected:  []string{"uid=1001"},
+		},
+	}
+
+	for _, tc := range cases {
+		if got := tc.spec.ApplyDefaultMountOptions(tc.options, tc.namespace); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestSplitMountOptions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name     string
+		options  string
+		expected []string
+	}{
+		{name: "options", options: "implicit-dirs,uid=1001", expected: []string{"implicit-dirs", "uid=1001"}},
+		{
+			name:     "SELinux context option with a multi-category level",
+			options:  `implicit-dirs,context="system_u:object_r:container_file_t:s0:c1,c2",ro`,
+			expected: []string{"implicit-dirs", `context="system_u:object_r:container_file_t:s0:c1,c2"`, "ro"},
+		},
+		{name: "empty options", options: "", expected: []string{""}},
+	}
+
+	for _, tc := range cases {
+		if got := SplitMountOptions(tc.options); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v: got %q, expected %q", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	t.Parallel()
+	w := NewWatcher(nil, DefaultName)
+	if w.Get() != nil {
+		t.Fatal("expected nil spec before the first update")
+	}
+
+	w.update(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Group + "/" + Version,
+		"kind":       Kind,
+		"metadata":   map[string]interface{}{"name": DefaultName},
+		"spec": map[string]interface{}{
+			"bucketAllowlist": []interface{}{"test-bucket"},
+			"sidecar":         map[string]interface{}{"image": "test-image"},
+		},
+	}})
+	expected := &Spec{BucketAllowlist: []string{"test-bucket"}, Sidecar: SidecarSpec{Image: "test-image"}}
+	if got := w.Get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got spec %+v, expected %+v", got, expected)
+	}
+
+	// An invalid object keeps the previous spec.
+	w.update(&unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": DefaultName},
+		"spec":     map[string]interface{}{"bucketAllowlist": "not-a-list"},
+	}})
+	if got := w.Get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got spec %+v after an invalid update, expected %+v", got, expected)
+	}
+
+	w.set(nil)
+	if w.Get() != nil {
+		t.Error("expected nil spec after the object is deleted")
+	}
+}
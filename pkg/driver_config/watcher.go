@@ -0,0 +1,120 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driverconfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// informerResyncPeriod is the resync period of the driver config informer.
+	informerResyncPeriod = 10 * time.Minute
+	// syncTimeout is how long Start waits for the initial list of the driver config.
+	syncTimeout = time.Minute
+)
+
+// Watcher keeps the latest spec of the GCSFuseCSIDriverConfig object.
+// A nil Watcher returns a nil spec, so that the callers fall back to the flags.
+type Watcher struct {
+	client dynamic.Interface
+	name   string
+
+	mu   sync.RWMutex
+	spec *Spec
+}
+
+// NewWatcher returns a Watcher of the GCSFuseCSIDriverConfig object with the name.
+func NewWatcher(client dynamic.Interface, name string) *Watcher {
+	return &Watcher{client: client, name: name}
+}
+
+// Start watches the GCSFuseCSIDriverConfig object until the context is done, and waits for the initial sync.
+// If the initial sync times out, e.g. the CRD is not installed, an error is returned and the watch continues in the background.
+func (w *Watcher) Start(ctx context.Context) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(w.client, informerResyncPeriod, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+		o.FieldSelector = fields.OneTermEqualSelector("metadata.name", w.name).String()
+	})
+	informer := factory.ForResource(GroupVersionResource).Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.update,
+		UpdateFunc: func(_, obj interface{}) { w.update(obj) },
+		DeleteFunc: func(interface{}) { w.set(nil) },
+	}); err != nil {
+		return fmt.Errorf("failed to add the driver config event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, syncTimeout, true, func(context.Context) (bool, error) {
+		return informer.HasSynced(), nil
+	}); err != nil {
+		return fmt.Errorf("failed to sync the informer of %v, make sure the CRD is installed: %w", GroupVersionResource, err)
+	}
+
+	return nil
+}
+
+// Get returns the spec of the GCSFuseCSIDriverConfig object, or nil if the object does not exist.
+func (w *Watcher) Get() *Spec {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.spec
+}
+
+func (w *Watcher) update(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		klog.Errorf("unexpected driver config object type %T", obj)
+
+		return
+	}
+
+	config := &GCSFuseCSIDriverConfig{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, config); err != nil {
+		// Keep the previous spec, so that an invalid update does not drop the cluster policies.
+		klog.Errorf("failed to parse the driver config %q, keeping the previous config: %v", u.GetName(), err)
+
+		return
+	}
+
+	klog.Infof("driver config %q updated to resource version %v: %+v", u.GetName(), u.GetResourceVersion(), config.Spec)
+	w.set(&config.Spec)
+}
+
+func (w *Watcher) set(spec *Spec) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.spec = spec
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/component-base/metrics"
+)
+
+// KubeAPIRequestTotal counts the Kubernetes API requests sent by the driver components,
+// so that the API server load of the Pod and service account lookups can be attributed during mass scheduling.
+var KubeAPIRequestTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+	Subsystem:      subsystem,
+	Name:           "kube_api_requests_total",
+	Help:           "Total number of Kubernetes API requests by verb, resource, and HTTP status code.",
+	StabilityLevel: metrics.ALPHA,
+}, []string{"verb", "resource", "code"})
+
+type kubeAPIRoundTripper struct {
+	rt      http.RoundTripper
+	counter *metrics.CounterVec
+}
+
+// NewKubeAPIRoundTripper returns a RoundTripper that counts the Kubernetes API requests sent by rt.
+func NewKubeAPIRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return &kubeAPIRoundTripper{rt: rt, counter: KubeAPIRequestTotal}
+}
+
+func (t *kubeAPIRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	verb, resource := parseKubeAPIRequest(req)
+	t.counter.WithLabelValues(verb, resource, code).Inc()
+
+	return resp, err
+}
+
+// parseKubeAPIRequest returns the Kubernetes API verb and resource of the request,
+// e.g. get and pods for GET /api/v1/namespaces/default/pods/test-pod,
+// or create and serviceaccounts/token for POST /api/v1/namespaces/default/serviceaccounts/test-sa/token.
+func parseKubeAPIRequest(req *http.Request) (string, string) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		// Discovery and other non-resource requests, e.g. /version.
+		return strings.ToLower(req.Method), "nonresource"
+	}
+
+	// Drop the namespace of namespaced resources, except for the namespaces resource itself.
+	if len(segments) > 2 && segments[0] == "namespaces" {
+		segments = segments[2:]
+	}
+	if len(segments) == 0 {
+		return strings.ToLower(req.Method), "nonresource"
+	}
+
+	resource := segments[0]
+	if len(segments) >= 3 {
+		resource += "/" + segments[2]
+	}
+	named := len(segments) >= 2
+
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" {
+			return "watch", resource
+		}
+		if named {
+			return "get", resource
+		}
+
+		return "list", resource
+	case http.MethodPost:
+		return "create", resource
+	case http.MethodPut:
+		return "update", resource
+	case http.MethodPatch:
+		return "patch", resource
+	case http.MethodDelete:
+		if named {
+			return "delete", resource
+		}
+
+		return "deletecollection", resource
+	default:
+		return strings.ToLower(req.Method), resource
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+type fakeRoundTripper struct {
+	statusCode int
+	err        error
+}
+
+func (rt *fakeRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	if rt.err != nil {
+		return nil, rt.err
+	}
+
+	return &http.Response{StatusCode: rt.statusCode, Body: http.NoBody}, nil
+}
+
+func TestParseKubeAPIRequest(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		method           string
+		url              string
+		expectedVerb     string
+		expectedResource string
+	}{
+		{method: http.MethodGet, url: "https://kube/api/v1/namespaces/default/pods/test-pod", expectedVerb: "get", expectedResource: "pods"},
+		{method: http.MethodGet, url: "https://kube/api/v1/pods?fieldSelector=spec.nodeName%3Dtest-node", expectedVerb: "list", expectedResource: "pods"},
+		{method: http.MethodGet, url: "https://kube/api/v1/pods?watch=true", expectedVerb: "watch", expectedResource: "pods"},
+		{method: http.MethodPost, url: "https://kube/api/v1/namespaces/default/serviceaccounts/test-sa/token", expectedVerb: "create", expectedResource: "serviceaccounts/token"},
+		{method: http.MethodGet, url: "https://kube/api/v1/namespaces/default", expectedVerb: "get", expectedResource: "namespaces"},
+		{method: http.MethodGet, url: "https://kube/apis/storage.k8s.io/v1/csinodes/test-node", expectedVerb: "get", expectedResource: "csinodes"},
+		{method: http.MethodPatch, url: "https://kube/api/v1/namespaces/default/events/test-event", expectedVerb: "patch", expectedResource: "events"},
+		{method: http.MethodGet, url: "https://kube/version", expectedVerb: "get", expectedResource: "nonresource"},
+	}
+
+	for _, tc := range cases {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		verb, resource := parseKubeAPIRequest(req)
+		if verb != tc.expectedVerb || resource != tc.expectedResource {
+			t.Errorf("%v %v: got %v %v, expected %v %v", tc.method, tc.url, verb, resource, tc.expectedVerb, tc.expectedResource)
+		}
+	}
+}
+
+func TestKubeAPIRoundTripper(t *testing.T) {
+	t.Parallel()
+	counter := metrics.NewCounterVec(&metrics.CounterOpts{
+		Name: "test_kube_api_requests_total",
+		Help: "Test Kubernetes API requests.",
+	}, []string{"verb", "resource", "code"})
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(counter)
+
+	for _, rt := range []*fakeRoundTripper{{statusCode: http.StatusOK}, {statusCode: http.StatusOK}, {statusCode: http.StatusNotFound}, {err: errors.New("connection refused")}} {
+		req, err := http.NewRequest(http.MethodGet, "https://kube/api/v1/namespaces/default/pods/test-pod", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := (&kubeAPIRoundTripper{rt: rt, counter: counter}).RoundTrip(req)
+		if !errors.Is(err, rt.err) {
+			t.Errorf("got error %v, expected %v", err, rt.err)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+
+	expected := `
+		# HELP test_kube_api_requests_total [ALPHA] Test Kubernetes API requests.
+		# TYPE test_kube_api_requests_total counter
+		test_kube_api_requests_total{code="200",resource="pods",verb="get"} 2
+		test_kube_api_requests_total{code="404",resource="pods",verb="get"} 1
+		test_kube_api_requests_total{code="error",resource="pods",verb="get"} 1
+	`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "test_kube_api_requests_total"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
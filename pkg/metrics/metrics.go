@@ -0,0 +1,373 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// subsystem is the prefix of all the metric names exported by the driver.
+	subsystem = "gcsfusecsi"
+)
+
+var (
+	// TokenCacheHitTotal counts the token requests served from the token broker cache.
+	TokenCacheHitTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "token_cache_hit_total",
+		Help:           "Total number of GCP token requests served from the token cache.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// TokenCacheMissTotal counts the token requests that required a token exchange.
+	TokenCacheMissTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "token_cache_miss_total",
+		Help:           "Total number of GCP token requests that required a token exchange.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// TokenExchangeErrorTotal counts the failed token exchanges.
+	TokenExchangeErrorTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "token_exchange_error_total",
+		Help:           "Total number of failed GCP token exchanges.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// TokenExchangeDedupedTotal counts the token requests that shared an in-flight token exchange.
+	TokenExchangeDedupedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "token_exchange_deduped_total",
+		Help:           "Total number of GCP token requests that shared an in-flight token exchange for the same Kubernetes service account.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// MountRetrySuppressedTotal counts the NodePublishVolume retries that returned the previous error without a new mount attempt.
+	MountRetrySuppressedTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "mount_retry_suppressed_total",
+		Help:           "Total number of NodePublishVolume retries of repeatedly failing mounts that returned the previous error during the backoff.",
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+// Node driver health metrics, so that nodes where the plugin silently deregistered can be alerted on.
+var (
+	// NodePluginRegistered reports whether the kubelet has the driver registered on the node.
+	NodePluginRegistered = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      subsystem,
+		Name:           "node_plugin_registered",
+		Help:           "Whether the CSI driver is registered with the kubelet on the node, 1 if registered, 0 otherwise.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// NodePluginRegistrationCheckErrorTotal counts the failed registration checks.
+	NodePluginRegistrationCheckErrorTotal = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "node_plugin_registration_check_error_total",
+		Help:           "Total number of failed checks of the CSI driver registration with the kubelet.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// NodeContainerRestarts reports the restart count of each container in the node driver Pod,
+	// including the restarts caused by liveness probe failures.
+	NodeContainerRestarts = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      subsystem,
+		Name:           "node_container_restarts",
+		Help:           "Number of restarts of the containers in the CSI driver node Pod.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"container"})
+
+	// NodeDriverStartTime reports the start time of the node driver process.
+	NodeDriverStartTime = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      subsystem,
+		Name:           "node_driver_start_time_seconds",
+		Help:           "Start time of the CSI driver node process since unix epoch in seconds.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// OrphanedVolumeDirCleanupTotal counts the sidecar volume directories of deleted Pods cleaned up by the node driver.
+	OrphanedVolumeDirCleanupTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "node_orphaned_volume_dir_cleanup_total",
+		Help:           "Total number of sidecar volume directories of Pods that no longer exist cleaned up by the node driver, by result.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"result"})
+)
+
+// Unmount queue metrics, so that slow node drains can be attributed to the unmounts of the gcsfuse volumes.
+var (
+	// UnmountQueueDepth reports the NodeUnpublishVolume calls waiting for an unmount worker.
+	UnmountQueueDepth = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      subsystem,
+		Name:           "node_unmount_queue_depth",
+		Help:           "Number of NodeUnpublishVolume calls waiting for an unmount worker.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	// UnmountBatchSize reports the number of the unmounts that share a listing of the mount table.
+	UnmountBatchSize = metrics.NewHistogram(&metrics.HistogramOpts{
+		Subsystem:      subsystem,
+		Name:           "node_unmount_batch_size",
+		Help:           "Number of the NodeUnpublishVolume calls batched together with one listing of the mount table.",
+		Buckets:        []float64{1, 2, 5, 10, 20, 50, 100, 200},
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+// Results of the orphaned volume directory cleanup.
+const (
+	CleanupResultRemoved = "removed"
+	CleanupResultError   = "error"
+)
+
+// Mount phases of NodePublishVolume and the following sidecar handshake.
+const (
+	MountPhaseValidation   = "validation"
+	MountPhaseToken        = "token"
+	MountPhaseBucketCheck  = "bucket_check"
+	MountPhasePodCheck     = "pod_check"
+	MountPhaseMount        = "mount"
+	MountPhaseFDHandoff    = "fd_handoff"
+	MountPhaseGCSFuseReady = "gcsfuse_ready"
+)
+
+// MountPhaseLatency reports the latency of each mount phase, so that mount time regressions can be localized.
+var MountPhaseLatency = metrics.NewHistogramVec(&metrics.HistogramOpts{
+	Subsystem:      subsystem,
+	Name:           "mount_phase_duration_seconds",
+	Help:           "Duration of each phase of mounting a volume, from the NodePublishVolume call to gcsfuse serving the file system.",
+	Buckets:        []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	StabilityLevel: metrics.ALPHA,
+}, []string{"phase"})
+
+// MountHandshakeTimeoutTotal counts the mount handshakes with the sidecar container that timed out, by the stuck phase.
+var MountHandshakeTimeoutTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+	Subsystem:      subsystem,
+	Name:           "mount_handshake_timeout_total",
+	Help:           "Total number of mount handshakes with the sidecar container that timed out, by the phase that did not finish.",
+	StabilityLevel: metrics.ALPHA,
+}, []string{"phase"})
+
+// PhaseTimer observes the latency of consecutive phases of an operation.
+type PhaseTimer struct {
+	histogram *metrics.HistogramVec
+	start     time.Time
+	traceID   string
+}
+
+// NewMountPhaseTimer returns a PhaseTimer that starts the first mount phase now.
+func NewMountPhaseTimer() *PhaseTimer {
+	return &PhaseTimer{histogram: MountPhaseLatency, start: time.Now()}
+}
+
+// SetTraceID sets the trace of the operation, which is attached to the observed latencies as an exemplar.
+func (t *PhaseTimer) SetTraceID(traceID string) {
+	t.traceID = traceID
+}
+
+// ObservePhase records the time since the previous phase ended, and starts the next phase.
+func (t *PhaseTimer) ObservePhase(phase string) {
+	now := time.Now()
+	observe(t.histogram.WithLabelValues(phase), now.Sub(t.start).Seconds(), t.traceID)
+	t.start = now
+}
+
+// TraceID returns the ID of the sampled trace of the context, or an empty string if the context is not traced.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
+
+// observe records the value with an exemplar linking to the trace, if any,
+// so that a latency spike in the dashboards can be followed to the traces of the slow operations.
+// The exemplars are only exposed in the OpenMetrics format.
+func observe(o metrics.ObserverMetric, value float64, traceID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+
+		return
+	}
+
+	o.Observe(value)
+}
+
+// Sidecar injection tracks of the webhook.
+const (
+	SidecarTrackStable = "stable"
+	SidecarTrackCanary = "canary"
+)
+
+// SidecarInjectionTotal counts the sidecar containers injected by the webhook, so that canary sidecar images can be compared with the stable image.
+var SidecarInjectionTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+	Subsystem:      subsystem,
+	Name:           "webhook_sidecar_injection_total",
+	Help:           "Total number of sidecar containers injected by the webhook, by sidecar image and rollout track.",
+	StabilityLevel: metrics.ALPHA,
+}, []string{"image", "track"})
+
+// Webhook annotation adoption metrics, so that platform teams can track the adoption of the annotations
+// and find the workloads with gcsfuse volumes that the sidecar container is not injected into.
+var (
+	// WebhookGcsfusePodTotal counts the created Pods with gcsfuse volumes, by the value of the gke-gcsfuse/volumes annotation.
+	WebhookGcsfusePodTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "webhook_gcsfuse_pod_total",
+		Help:           "Total number of created Pods with gcsfuse CSI ephemeral volumes or the gke-gcsfuse/volumes annotation, by the annotation value, which is missing if the annotation is not set.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"annotation"})
+
+	// WebhookAnnotationTotal counts the created Pods setting each gke-gcsfuse annotation.
+	WebhookAnnotationTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      subsystem,
+		Name:           "webhook_annotation_total",
+		Help:           "Total number of created Pods setting each gke-gcsfuse annotation key.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"key"})
+)
+
+// Values of the annotation label of WebhookGcsfusePodTotal besides true and false.
+const (
+	AnnotationValueMissing = "missing"
+	AnnotationValueInvalid = "invalid"
+)
+
+// CSI operation metrics, following the csi-lib-utils metrics conventions.
+var (
+	operationsLatency = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Subsystem:      "csi",
+		Name:           "operations_seconds",
+		Help:           "Container Storage Interface operation duration with gRPC error code status total.",
+		Buckets:        []float64{.1, .25, .5, 1, 2.5, 5, 10, 15, 25, 50, 120, 300, 600},
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"driver_name", "method_name", "grpc_status_code"})
+
+	operationsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:      "csi",
+		Name:           "operations_total",
+		Help:           "Total number of Container Storage Interface operations by gRPC status code.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"driver_name", "method_name", "grpc_status_code"})
+
+	operationsInflight = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Subsystem:      "csi",
+		Name:           "operations_inflight",
+		Help:           "Number of in-flight Container Storage Interface operations.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"driver_name", "method_name"})
+)
+
+// Manager registers the driver metrics and serves them over HTTP.
+type Manager struct {
+	registry metrics.KubeRegistry
+	mux      *http.ServeMux
+}
+
+func NewMetricsManager() *Manager {
+	mm := &Manager{
+		registry: metrics.NewKubeRegistry(),
+		mux:      http.NewServeMux(),
+	}
+	mm.registry.MustRegister(
+		TokenCacheHitTotal,
+		TokenCacheMissTotal,
+		TokenExchangeErrorTotal,
+		TokenExchangeDedupedTotal,
+		MountRetrySuppressedTotal,
+		NodePluginRegistered,
+		NodePluginRegistrationCheckErrorTotal,
+		NodeContainerRestarts,
+		NodeDriverStartTime,
+		OrphanedVolumeDirCleanupTotal,
+		UnmountQueueDepth,
+		UnmountBatchSize,
+		MountPhaseLatency,
+		MountHandshakeTimeoutTotal,
+		KubeAPIRequestTotal,
+		operationsLatency,
+		operationsTotal,
+		operationsInflight,
+	)
+
+	return mm
+}
+
+// NewWebhookMetricsManager returns a Manager of the webhook metrics.
+func NewWebhookMetricsManager() *Manager {
+	mm := &Manager{
+		registry: metrics.NewKubeRegistry(),
+		mux:      http.NewServeMux(),
+	}
+	mm.registry.MustRegister(SidecarInjectionTotal, WebhookGcsfusePodTotal, WebhookAnnotationTotal, KubeAPIRequestTotal)
+
+	return mm
+}
+
+func (mm *Manager) GetRegistry() metrics.KubeRegistry {
+	return mm.registry
+}
+
+// InitializeHTTPHandler sets up a server and creates a handler for metrics.
+func (mm *Manager) InitializeHTTPHandler(address, path string) {
+	mm.mux.Handle(path, metrics.HandlerFor(mm.registry, metrics.HandlerOpts{ErrorHandling: metrics.ContinueOnError, EnableOpenMetrics: true}))
+
+	go func() {
+		klog.Infof("Metric server listening at %q", address)
+		//nolint:gosec
+		if err := http.ListenAndServe(address, mm.mux); err != nil {
+			klog.Fatalf("failed to start metric server at specified endpoint %q and path %q: %v", address, path, err)
+		}
+	}()
+}
+
+// RegisterHandler registers an additional handler on the metrics server.
+func (mm *Manager) RegisterHandler(path string, handler http.Handler) {
+	mm.mux.Handle(path, handler)
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that records the CSI operation metrics.
+func (mm *Manager) UnaryServerInterceptor(driverName string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		operationsInflight.WithLabelValues(driverName, info.FullMethod).Inc()
+		defer operationsInflight.WithLabelValues(driverName, info.FullMethod).Dec()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		code := status.Code(err).String()
+
+		observe(operationsLatency.WithLabelValues(driverName, info.FullMethod, code), time.Since(start).Seconds(), TraceID(ctx))
+		operationsTotal.WithLabelValues(driverName, info.FullMethod, code).Inc()
+
+		return resp, err
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	t.Parallel()
+	mm := NewMetricsManager()
+	interceptor := mm.UnaryServerInterceptor("test-driver")
+
+	cases := []struct {
+		name   string
+		req    interface{}
+		method string
+		err    error
+	}{
+		{
+			name:   "successful NodePublishVolume",
+			req:    &csi.NodePublishVolumeRequest{VolumeId: "test-bucket"},
+			method: "/csi.v1.Node/NodePublishVolume",
+		},
+		{
+			name:   "failed NodePublishVolume",
+			req:    &csi.NodePublishVolumeRequest{VolumeId: "test-bucket"},
+			method: "/csi.v1.Node/NodePublishVolume",
+			err:    status.Error(codes.NotFound, "bucket not found"),
+		},
+		{
+			name:   "successful CreateVolume",
+			req:    &csi.CreateVolumeRequest{Name: "test-volume"},
+			method: "/csi.v1.Controller/CreateVolume",
+		},
+	}
+
+	for _, test := range cases {
+		handler := func(context.Context, interface{}) (interface{}, error) {
+			return nil, test.err
+		}
+		_, err := interceptor(context.TODO(), test.req, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %q failed: got error %v, expected %v", test.name, err, test.err)
+		}
+	}
+
+	expected := `
+		# HELP csi_operations_total [ALPHA] Total number of Container Storage Interface operations by gRPC status code.
+		# TYPE csi_operations_total counter
+		csi_operations_total{driver_name="test-driver",grpc_status_code="NotFound",method_name="/csi.v1.Node/NodePublishVolume"} 1
+		csi_operations_total{driver_name="test-driver",grpc_status_code="OK",method_name="/csi.v1.Controller/CreateVolume"} 1
+		csi_operations_total{driver_name="test-driver",grpc_status_code="OK",method_name="/csi.v1.Node/NodePublishVolume"} 1
+		# HELP csi_operations_inflight [ALPHA] Number of in-flight Container Storage Interface operations.
+		# TYPE csi_operations_inflight gauge
+		csi_operations_inflight{driver_name="test-driver",method_name="/csi.v1.Controller/CreateVolume"} 0
+		csi_operations_inflight{driver_name="test-driver",method_name="/csi.v1.Node/NodePublishVolume"} 0
+	`
+	if err := testutil.GatherAndCompare(mm.GetRegistry(), strings.NewReader(expected), "csi_operations_total", "csi_operations_inflight"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestPhaseTimer(t *testing.T) {
+	t.Parallel()
+	histogram := metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Name: "test_phase_duration_seconds",
+		Help: "Test phase duration.",
+	}, []string{"phase"})
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(histogram)
+
+	timer := &PhaseTimer{histogram: histogram, start: time.Now()}
+	timer.ObservePhase(MountPhaseValidation)
+	timer.ObservePhase(MountPhaseMount)
+	timer.ObservePhase(MountPhaseMount)
+
+	cases := []struct {
+		phase         string
+		expectedCount uint64
+	}{
+		{phase: MountPhaseValidation, expectedCount: 1},
+		{phase: MountPhaseMount, expectedCount: 2},
+		{phase: MountPhaseToken, expectedCount: 0},
+	}
+
+	for _, test := range cases {
+		count, err := testutil.GetHistogramMetricCount(histogram.WithLabelValues(test.phase))
+		if err != nil {
+			t.Errorf("test %q failed: got error %v", test.phase, err)
+
+			continue
+		}
+		if count != test.expectedCount {
+			t.Errorf("test %q failed: got count %v, expected %v", test.phase, count, test.expectedCount)
+		}
+	}
+}
+
+func TestPhaseTimerExemplar(t *testing.T) {
+	t.Parallel()
+	histogram := metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Name: "test_phase_exemplar_duration_seconds",
+		Help: "Test phase duration.",
+	}, []string{"phase"})
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(histogram)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	timer := &PhaseTimer{histogram: histogram, start: time.Now()}
+	timer.ObservePhase(MountPhaseValidation)
+	timer.SetTraceID(traceID)
+	timer.ObservePhase(MountPhaseMount)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather the metrics: %v", err)
+	}
+
+	exemplars := map[string]string{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			phase := m.GetLabel()[0].GetValue()
+			for _, b := range m.GetHistogram().GetBucket() {
+				for _, l := range b.GetExemplar().GetLabel() {
+					exemplars[phase] = l.GetName() + "=" + l.GetValue()
+				}
+			}
+		}
+	}
+
+	expected := map[string]string{MountPhaseMount: "trace_id=" + traceID}
+	if len(exemplars) != len(expected) || exemplars[MountPhaseMount] != expected[MountPhaseMount] {
+		t.Errorf("got exemplars %v, expected %v", exemplars, expected)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	t.Parallel()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	cases := []struct {
+		name     string
+		flags    trace.TraceFlags
+		expected string
+	}{
+		{name: "sampled trace", flags: trace.FlagsSampled, expected: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "trace not sampled", expected: ""},
+	}
+
+	for _, test := range cases {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: test.flags,
+		}))
+		if got := TraceID(ctx); got != test.expected {
+			t.Errorf("test %q failed: got trace ID %q, expected %q", test.name, got, test.expected)
+		}
+	}
+
+	if got := TraceID(context.Background()); got != "" {
+		t.Errorf("got trace ID %q for a context without a trace, expected an empty string", got)
+	}
+}
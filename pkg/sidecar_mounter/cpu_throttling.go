@@ -0,0 +1,137 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecarmounter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CPUThrottlingFileName is the file created in the volume base directory when the sidecar container is heavily CPU throttled,
+	// so that the node server can report it on the Pod.
+	CPUThrottlingFileName = "cpu-throttling"
+
+	// cpuThrottlingThreshold is the fraction of the CPU periods with throttling above which the throttling is reported.
+	cpuThrottlingThreshold = 0.25
+	// minCPUPeriods is the minimum number of CPU periods in a check, so that short bursts of an idle container are not reported.
+	minCPUPeriods = 100
+)
+
+// cpuStatPaths are the cpu.stat files of the container cgroup, for cgroup v2 and cgroup v1.
+var cpuStatPaths = []string{"/sys/fs/cgroup/cpu.stat", "/sys/fs/cgroup/cpu,cpuacct/cpu.stat", "/sys/fs/cgroup/cpu/cpu.stat"}
+
+// cpuStat is the CPU bandwidth statistics of a cgroup.
+type cpuStat struct {
+	periods          uint64
+	throttledPeriods uint64
+}
+
+// CPUThrottlingMonitor writes the CPU throttling file when the sidecar container is throttled in a large fraction of the CPU periods,
+// which is the most common cause of slow gcsfuse volumes that is not visible in the gcsfuse logs.
+type CPUThrottlingMonitor struct {
+	statPath       string
+	throttlingFile string
+	last           *cpuStat
+}
+
+// NewCPUThrottlingMonitor returns a CPUThrottlingMonitor writing the throttling file in the volume base directory,
+// or nil if the container cgroup has no CPU bandwidth statistics.
+func NewCPUThrottlingMonitor(volumeBasePath string) *CPUThrottlingMonitor {
+	for _, p := range cpuStatPaths {
+		if _, err := os.Stat(p); err == nil {
+			return &CPUThrottlingMonitor{statPath: p, throttlingFile: volumeBasePath + "/" + CPUThrottlingFileName}
+		}
+	}
+
+	return nil
+}
+
+// Run checks the CPU throttling periodically.
+func (m *CPUThrottlingMonitor) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.check(interval)
+	}
+}
+
+// check writes the throttling file if the container was throttled in more than cpuThrottlingThreshold of the CPU periods since the last check.
+func (m *CPUThrottlingMonitor) check(interval time.Duration) {
+	stat, err := readCPUStat(m.statPath)
+	if err != nil {
+		klog.Errorf("failed to read the CPU statistics: %v", err)
+
+		return
+	}
+
+	last := m.last
+	m.last = stat
+	if last == nil || stat.periods < last.periods+minCPUPeriods || stat.throttledPeriods < last.throttledPeriods {
+		return
+	}
+
+	ratio := float64(stat.throttledPeriods-last.throttledPeriods) / float64(stat.periods-last.periods)
+	if ratio < cpuThrottlingThreshold {
+		return
+	}
+
+	msg := fmt.Sprintf("The gcsfuse sidecar container was CPU throttled in %.0f%% of the CPU periods in the last %v", ratio*100, interval)
+	klog.Warning(msg)
+	if err := os.WriteFile(m.throttlingFile, []byte(msg), 0o644); err != nil {
+		klog.Errorf("failed to write the CPU throttling file %q: %v", m.throttlingFile, err)
+	}
+}
+
+// readCPUStat reads the nr_periods and nr_throttled fields of a cgroup cpu.stat file.
+func readCPUStat(path string) (*cpuStat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat := &cpuStat{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+
+		var field *uint64
+		switch key {
+		case "nr_periods":
+			field = &stat.periods
+		case "nr_throttled":
+			field = &stat.throttledPeriods
+		default:
+			continue
+		}
+		if *field, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid %v in %q: %w", key, path, err)
+		}
+	}
+
+	return stat, scanner.Err()
+}
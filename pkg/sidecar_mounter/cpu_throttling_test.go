@@ -0,0 +1,119 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecarmounter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadCPUStat(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		content   string
+		expected  cpuStat
+		expectErr bool
+	}{
+		{
+			name:     "cgroup v2",
+			content:  "usage_usec 1000\nuser_usec 600\nsystem_usec 400\nnr_periods 200\nnr_throttled 50\nthrottled_usec 30000\n",
+			expected: cpuStat{periods: 200, throttledPeriods: 50},
+		},
+		{
+			name:     "cgroup v1",
+			content:  "nr_periods 300\nnr_throttled 10\nthrottled_time 5000000\n",
+			expected: cpuStat{periods: 300, throttledPeriods: 10},
+		},
+		{
+			name:     "no CPU limit",
+			content:  "usage_usec 1000\nuser_usec 600\nsystem_usec 400\n",
+			expected: cpuStat{},
+		},
+		{
+			name:      "invalid value",
+			content:   "nr_periods many\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		path := filepath.Join(t.TempDir(), "cpu.stat")
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatalf("failed to write the cpu.stat file: %v", err)
+		}
+
+		got, err := readCPUStat(path)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("test %q failed: got error %v, expected error %v", tc.name, err, tc.expectErr)
+		}
+		if err == nil && *got != tc.expected {
+			t.Errorf("test %q failed: got %+v, expected %+v", tc.name, *got, tc.expected)
+		}
+	}
+}
+
+func TestCPUThrottlingMonitorCheck(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		last         *cpuStat
+		current      string
+		expectReport bool
+	}{
+		{
+			name:    "first check",
+			current: "nr_periods 1000\nnr_throttled 900\n",
+		},
+		{
+			name:         "heavy throttling",
+			last:         &cpuStat{periods: 1000, throttledPeriods: 100},
+			current:      "nr_periods 1600\nnr_throttled 400\n",
+			expectReport: true,
+		},
+		{
+			name:    "light throttling",
+			last:    &cpuStat{periods: 1000, throttledPeriods: 100},
+			current: "nr_periods 1600\nnr_throttled 200\n",
+		},
+		{
+			name:    "too few CPU periods",
+			last:    &cpuStat{periods: 1000, throttledPeriods: 100},
+			current: "nr_periods 1050\nnr_throttled 150\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		dir := t.TempDir()
+		statPath := filepath.Join(dir, "cpu.stat")
+		if err := os.WriteFile(statPath, []byte(tc.current), 0o644); err != nil {
+			t.Fatalf("failed to write the cpu.stat file: %v", err)
+		}
+
+		m := &CPUThrottlingMonitor{statPath: statPath, throttlingFile: filepath.Join(dir, CPUThrottlingFileName), last: tc.last}
+		m.check(time.Minute)
+
+		_, err := os.Stat(m.throttlingFile)
+		if gotReport := err == nil; gotReport != tc.expectReport {
+			t.Errorf("test %q failed: got throttling file %v, expected %v", tc.name, gotReport, tc.expectReport)
+		}
+	}
+}
@@ -18,9 +18,21 @@ limitations under the License.
 package sidecarmounter
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ReadyFileName is the file created in the volume directory once gcsfuse is ready to serve requests.
+	ReadyFileName = "ready"
+
+	// gcsfuseMountedLog is logged by gcsfuse once the file system is mounted.
+	gcsfuseMountedLog = "File system has been successfully mounted"
 )
 
 type stderrWriter struct {
@@ -47,3 +59,27 @@ func (f *stderrWriter) Write(msg []byte) (int, error) {
 
 	return len(msg), nil
 }
+
+type readyWriter struct {
+	readyFile string
+	once      sync.Once
+}
+
+// NewReadyWriter returns a writer that creates the ready file
+// once the gcsfuse output shows that the file system is mounted.
+func NewReadyWriter(readyFile string) io.Writer {
+	return &readyWriter{readyFile: readyFile}
+}
+
+// Write scans the gcsfuse output for the mounted log.
+func (f *readyWriter) Write(msg []byte) (int, error) {
+	if bytes.Contains(msg, []byte(gcsfuseMountedLog)) {
+		f.once.Do(func() {
+			if err := os.WriteFile(f.readyFile, nil, 0o644); err != nil {
+				klog.Errorf("failed to create the ready file %q: %v", f.readyFile, err)
+			}
+		})
+	}
+
+	return len(msg), nil
+}
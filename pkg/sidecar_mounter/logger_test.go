@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecarmounter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadyWriter(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		output        []string
+		expectedReady bool
+	}{
+		{
+			name:          "should not create the ready file before gcsfuse is mounted",
+			output:        []string{"time=\"17/10/2026 05:30:00.000000\" severity=INFO msg=\"Start gcsfuse/1.0.0 (Go version go1.20.5) for app \\\"gke-gcs-fuse-csi\\\" using mount point: /dev/fd/3\"\n"},
+			expectedReady: false,
+		},
+		{
+			name: "should create the ready file once gcsfuse is mounted",
+			output: []string{
+				"time=\"17/10/2026 05:30:00.000000\" severity=INFO msg=\"Mounting file system \\\"test-bucket\\\"...\"\n",
+				"time=\"17/10/2026 05:30:01.000000\" severity=INFO msg=\"File system has been successfully mounted.\"\n",
+			},
+			expectedReady: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		readyFile := filepath.Join(t.TempDir(), ReadyFileName)
+		w := NewReadyWriter(readyFile)
+		for _, o := range tc.output {
+			if _, err := w.Write([]byte(o)); err != nil {
+				t.Errorf("Did not expect error but got: %v", err)
+			}
+		}
+
+		_, err := os.Stat(readyFile)
+		if ready := err == nil; ready != tc.expectedReady {
+			t.Errorf("Got ready %v, but expected %v", ready, tc.expectedReady)
+		}
+	}
+}
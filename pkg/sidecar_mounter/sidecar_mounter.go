@@ -18,12 +18,17 @@ limitations under the License.
 package sidecarmounter
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
 
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
 	"k8s.io/klog/v2"
 )
 
@@ -44,6 +49,9 @@ func New(mounterPath string) *Mounter {
 	}
 }
 
+// SharedCacheDirName is the directory in the volume directory where the node server mounts the shared cache directory.
+const SharedCacheDirName = "shared-cache"
+
 // MountConfig contains the information gcsfuse needs.
 type MountConfig struct {
 	FileDescriptor  int       `json:"-"`
@@ -52,23 +60,103 @@ type MountConfig struct {
 	TempDir         string    `json:"-"`
 	Options         []string  `json:"options,omitempty"`
 	ErrWriter       io.Writer `json:"-"`
+	ReadyWriter     io.Writer `json:"-"`
 	StorageEndpoint string
+	UserAgent       string `json:"userAgent,omitempty"`
+	PodUID          string `json:"podUID,omitempty"`
+	// SharedCache is set by the node server if the node-level shared cache directory is mounted to SharedCacheDirName
+	// in the volume directory, and CacheDir is set by the sidecar mounter to the path of the directory.
+	SharedCache bool   `json:"sharedCache,omitempty"`
+	CacheDir    string `json:"-"`
+	// TokenServer is set by the node server if it serves the downscoped tokens of the volume on TokenSocketName
+	// in the volume directory, and TokenURL is set by the sidecar mounter to the URL gcsfuse fetches the tokens from.
+	TokenServer     bool   `json:"tokenServer,omitempty"`
+	TokenSocketPath string `json:"-"`
+	TokenURL        string `json:"-"`
+}
+
+// LogFields returns the structured logging key/value pairs identifying the volume,
+// using the same keys as the node server.
+func (mc *MountConfig) LogFields() []interface{} {
+	return []interface{}{util.LogKeyPodUID, mc.PodUID, util.LogKeyVolumeName, mc.VolumeName, util.LogKeyBucket, mc.BucketName}
+}
+
+// ReceiveMountConfig connects to the socket created by the node driver in the volume directory,
+// and receives the FUSE file descriptor, the bucket name, and the mount options passed to gcsfuse.
+// The socket is removed once the mount config is received.
+func ReceiveMountConfig(socketPath, storageEndpoint string) (*MountConfig, error) {
+	// socket path pattern: /tmp/.volumes/<volume-name>/socket
+	dir := filepath.Dir(socketPath)
+	mc := MountConfig{
+		VolumeName:      filepath.Base(dir),
+		TempDir:         filepath.Join(dir, "temp-dir"),
+		StorageEndpoint: storageEndpoint,
+	}
+
+	klog.Infof("connecting to socket %q", socketPath)
+	c, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the socket %q: %w", socketPath, err)
+	}
+
+	fd, msg, err := util.RecvMsg(c)
+	if err != nil {
+		c.Close()
+
+		return nil, fmt.Errorf("failed to receive mount options from the socket %q: %w", socketPath, err)
+	}
+	// as we got all the information from the socket, closing the connection and deleting the socket
+	c.Close()
+	if err = syscall.Unlink(socketPath); err != nil {
+		klog.Errorf("failed to close socket %q: %v", socketPath, err)
+	}
+
+	mc.FileDescriptor = fd
+
+	if err := json.Unmarshal(msg, &mc); err != nil {
+		return nil, fmt.Errorf("failed to unmarchal the mount config: %w", err)
+	}
+
+	if mc.SharedCache {
+		mc.CacheDir = filepath.Join(dir, SharedCacheDirName)
+	}
+
+	if mc.TokenServer {
+		mc.TokenSocketPath = filepath.Join(dir, TokenSocketName)
+	}
+
+	if mc.BucketName == "" {
+		return nil, fmt.Errorf("failed to fetch bucket name from CSI driver")
+	}
+
+	return &mc, nil
 }
 
 func (m *Mounter) Mount(mc *MountConfig) (*exec.Cmd, error) {
-	klog.Infof("start to mount bucket %q for volume %q", mc.BucketName, mc.VolumeName)
+	klog.InfoS("start to mount bucket", mc.LogFields()...)
 
 	if err := os.MkdirAll(mc.TempDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create temp dir %q: %w", mc.TempDir, err)
 	}
 
+	if mc.TokenSocketPath != "" {
+		tokenURL, err := serveTokenProxy(mc.TokenSocketPath)
+		if err != nil {
+			return nil, err
+		}
+		mc.TokenURL = tokenURL
+	}
+
 	flagMap := mc.PrepareMountArgs()
 	args := []string{"gcsfuse"}
+	redactedArgs := []string{"gcsfuse"}
 
 	for k, v := range flagMap {
 		args = append(args, "--"+k)
+		redactedArgs = append(redactedArgs, "--"+k)
 		if v != "" {
 			args = append(args, v)
+			redactedArgs = append(redactedArgs, util.RedactFlagValue(k, v))
 		}
 	}
 
@@ -77,12 +165,16 @@ func (m *Mounter) Mount(mc *MountConfig) (*exec.Cmd, error) {
 	// the /dev/fuse is passed as ExtraFiles below, and will always be FD 3
 	args = append(args, "/dev/fd/3")
 
-	klog.Infof("gcsfuse mounting with args %v...", args)
+	klog.InfoS("gcsfuse mounting", append(mc.LogFields(), "args", redactedArgs)...)
+	var stdout io.Writer = os.Stdout
+	if mc.ReadyWriter != nil {
+		stdout = io.MultiWriter(os.Stdout, mc.ReadyWriter)
+	}
 	cmd := exec.Cmd{
 		Path:       m.mounterPath,
 		Args:       args,
 		ExtraFiles: []*os.File{os.NewFile(uintptr(mc.FileDescriptor), "/dev/fuse")},
-		Stdout:     os.Stdout,
+		Stdout:     stdout,
 		Stderr:     io.MultiWriter(os.Stderr, mc.ErrWriter),
 	}
 
@@ -105,21 +197,28 @@ var disallowedFlags = map[string]bool{
 	"token-url":            true,
 	"reuse-token-from-url": true,
 	"o":                    true,
-	"endpoint": 						true,
+	"endpoint":             true,
+	"cache-dir":            true,
+}
+
+// IsDisallowedFlag returns true if the gcsfuse flag is set by the sidecar mounter, so that the mount option of the flag is discarded.
+func IsDisallowedFlag(flag string) bool {
+	return disallowedFlags[flag]
 }
 
 var boolFlags = map[string]bool{
-	"implicit-dirs":                 true,
-	"experimental-local-file-cache": true,
-	"enable-nonexistent-type-cache": true,
-	"debug_fuse_errors":             true,
-	"debug_fuse":                    true,
-	"debug_fs":                      true,
-	"debug_gcs":                     true,
-	"debug_http":                    true,
-	"debug_invariants":              true,
-	"debug_mutex":                   true,
-	"enable-storage-client-library": true,
+	"implicit-dirs":                        true,
+	"experimental-local-file-cache":        true,
+	"enable-nonexistent-type-cache":        true,
+	"debug_fuse_errors":                    true,
+	"debug_fuse":                           true,
+	"debug_fs":                             true,
+	"debug_gcs":                            true,
+	"debug_http":                           true,
+	"debug_invariants":                     true,
+	"debug_mutex":                          true,
+	"enable-storage-client-library":        true,
+	"file-cache-enable-parallel-downloads": true,
 }
 
 func (mc *MountConfig) PrepareMountArgs() map[string]string {
@@ -131,7 +230,23 @@ func (mc *MountConfig) PrepareMountArgs() map[string]string {
 		"log-format": "text",
 		"uid":        "0",
 		"gid":        "0",
-		"endpoint": 	mc.StorageEndpoint,
+	}
+
+	// gcsfuse appends the app name to the user agent of the GCS API calls.
+	if mc.UserAgent != "" {
+		flagMap["app-name"] = GCSFuseAppName + " " + mc.UserAgent
+	}
+
+	if mc.StorageEndpoint != "" {
+		flagMap["endpoint"] = mc.StorageEndpoint
+	}
+
+	if mc.CacheDir != "" {
+		flagMap["cache-dir"] = mc.CacheDir
+	}
+
+	if mc.TokenURL != "" {
+		flagMap["token-url"] = mc.TokenURL
 	}
 
 	invalidArgs := []string{}
@@ -161,8 +276,7 @@ func (mc *MountConfig) PrepareMountArgs() map[string]string {
 	}
 
 	if len(invalidArgs) > 0 {
-		klog.Warningf("got invalid arguments for volume %q: %v. Will discard invalid args and continue to mount.",
-			invalidArgs, mc.VolumeName)
+		klog.InfoS("got invalid arguments, will discard invalid args and continue to mount", append(mc.LogFields(), "invalidArgs", invalidArgs)...)
 	}
 
 	return flagMap
@@ -67,7 +67,7 @@ func TestPrepareMountArgs(t *testing.T) {
 			mc: &MountConfig{
 				BucketName: "test-bucket",
 				TempDir:    "test-temp-dir",
-				Options:    []string{
+				Options: []string{
 					"uid=100",
 					"gid=200",
 					"debug_gcs",
@@ -94,17 +94,21 @@ func TestPrepareMountArgs(t *testing.T) {
 			mc: &MountConfig{
 				BucketName: "test-bucket",
 				TempDir:    "test-temp-dir",
-				Options:    []string{
+				Options: []string{
 					"max-conns-per-host=10",
 					"implicit-dirs",
 				},
 			},
 			expectedArgs: map[string]string{
+				"implicit-dirs":      "",
 				"app-name":           GCSFuseAppName,
 				"temp-dir":           "test-temp-dir",
 				"foreground":         "",
 				"log-file":           "/dev/fd/1",
 				"log-format":         "text",
+				"uid":                "0",
+				"gid":                "0",
+				"max-conns-per-host": "10",
 			},
 		},
 		{
@@ -112,19 +116,23 @@ func TestPrepareMountArgs(t *testing.T) {
 			mc: &MountConfig{
 				BucketName: "test-bucket",
 				TempDir:    "test-temp-dir",
-				Options:    []string{
+				Options: []string{
 					"max-conns-per-host=10",
 					"implicit-dirs",
 				},
 				StorageEndpoint: "https://storage.googleapis.com",
 			},
 			expectedArgs: map[string]string{
+				"implicit-dirs":      "",
 				"app-name":           GCSFuseAppName,
 				"temp-dir":           "test-temp-dir",
 				"foreground":         "",
 				"log-file":           "/dev/fd/1",
 				"log-format":         "text",
-				"endpoint": 					"https://storage.googleapis.com",
+				"uid":                "0",
+				"gid":                "0",
+				"max-conns-per-host": "10",
+				"endpoint":           "https://storage.googleapis.com",
 			},
 		},
 		{
@@ -132,18 +140,22 @@ func TestPrepareMountArgs(t *testing.T) {
 			mc: &MountConfig{
 				BucketName: "test-bucket",
 				TempDir:    "test-temp-dir",
-				Options:    []string{
+				Options: []string{
 					"max-conns-per-host=10",
 					"implicit-dirs",
 					"endpoint=blah",
 				},
 			},
 			expectedArgs: map[string]string{
+				"implicit-dirs":      "",
 				"app-name":           GCSFuseAppName,
 				"temp-dir":           "test-temp-dir",
 				"foreground":         "",
 				"log-file":           "/dev/fd/1",
 				"log-format":         "text",
+				"uid":                "0",
+				"gid":                "0",
+				"max-conns-per-host": "10",
 			},
 		},
 		{
@@ -151,7 +163,7 @@ func TestPrepareMountArgs(t *testing.T) {
 			mc: &MountConfig{
 				BucketName: "test-bucket",
 				TempDir:    "test-temp-dir",
-				Options:    []string{
+				Options: []string{
 					"max-conns-per-host=10",
 					"implicit-dirs",
 					"endpoint=blah",
@@ -159,12 +171,33 @@ func TestPrepareMountArgs(t *testing.T) {
 				StorageEndpoint: "https://storage.googleapis.com",
 			},
 			expectedArgs: map[string]string{
+				"implicit-dirs":      "",
 				"app-name":           GCSFuseAppName,
 				"temp-dir":           "test-temp-dir",
 				"foreground":         "",
 				"log-file":           "/dev/fd/1",
 				"log-format":         "text",
-				"endpoint": 					"https://storage.googleapis.com",
+				"uid":                "0",
+				"gid":                "0",
+				"max-conns-per-host": "10",
+				"endpoint":           "https://storage.googleapis.com",
+			},
+		},
+		{
+			name: "should return app name with user agent correctly",
+			mc: &MountConfig{
+				BucketName: "test-bucket",
+				TempDir:    "test-temp-dir",
+				UserAgent:  "gcs-fuse-csi-driver/v0.1.4 (gke/v1.27.3-gke.100; sidecar/v0.1.4)",
+			},
+			expectedArgs: map[string]string{
+				"app-name":   GCSFuseAppName + " gcs-fuse-csi-driver/v0.1.4 (gke/v1.27.3-gke.100; sidecar/v0.1.4)",
+				"temp-dir":   "test-temp-dir",
+				"foreground": "",
+				"log-file":   "/dev/fd/1",
+				"log-format": "text",
+				"uid":        "0",
+				"gid":        "0",
 			},
 		},
 		{
@@ -188,6 +221,44 @@ func TestPrepareMountArgs(t *testing.T) {
 				"max-conns-per-host":                  "10",
 			},
 		},
+		{
+			name: "should return valid args with the shared cache directory correctly",
+			mc: &MountConfig{
+				BucketName: "test-bucket",
+				TempDir:    "test-temp-dir",
+				CacheDir:   "test-cache-dir",
+				Options:    []string{"cache-dir=/tmp"},
+			},
+			expectedArgs: map[string]string{
+				"app-name":   GCSFuseAppName,
+				"temp-dir":   "test-temp-dir",
+				"cache-dir":  "test-cache-dir",
+				"foreground": "",
+				"log-file":   "/dev/fd/1",
+				"log-format": "text",
+				"uid":        "0",
+				"gid":        "0",
+			},
+		},
+		{
+			name: "should return valid args with the token URL of the node driver correctly",
+			mc: &MountConfig{
+				BucketName: "test-bucket",
+				TempDir:    "test-temp-dir",
+				TokenURL:   "http://127.0.0.1:8080/token",
+				Options:    []string{"token-url=https://example.com/token"},
+			},
+			expectedArgs: map[string]string{
+				"app-name":   GCSFuseAppName,
+				"temp-dir":   "test-temp-dir",
+				"token-url":  "http://127.0.0.1:8080/token",
+				"foreground": "",
+				"log-file":   "/dev/fd/1",
+				"log-format": "text",
+				"uid":        "0",
+				"gid":        "0",
+			},
+		},
 		{
 			name: "should return valid args with error correctly",
 			mc: &MountConfig{
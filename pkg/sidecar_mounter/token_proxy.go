@@ -0,0 +1,62 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecarmounter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+
+	"k8s.io/klog/v2"
+)
+
+// TokenSocketName is the socket in the volume directory where the node driver serves the downscoped tokens of the volume.
+const TokenSocketName = "token.sock"
+
+// serveTokenProxy serves the tokens of the node driver socket on a localhost port, and returns the URL of the tokens,
+// because gcsfuse only fetches the tokens of the token-url flag over TCP.
+func serveTokenProxy(socketPath string) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the listener of the token proxy: %w", err)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "localhost"
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	go func() {
+		//nolint:gosec // the proxy only listens on localhost
+		if err := http.Serve(l, proxy); err != nil {
+			klog.Errorf("the token proxy of the socket %q stopped: %v", socketPath, err)
+		}
+	}()
+
+	return "http://" + l.Addr().String() + "/token", nil
+}
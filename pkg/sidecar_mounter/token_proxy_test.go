@@ -0,0 +1,58 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sidecarmounter
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeTokenProxy(t *testing.T) {
+	t.Parallel()
+	socketPath := filepath.Join(t.TempDir(), TokenSocketName)
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to create the token socket: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"access_token":"downscoped-token"}`))
+		}))
+	}()
+
+	tokenURL, err := serveTokenProxy(socketPath)
+	if err != nil {
+		t.Fatalf("failed to serve the token proxy: %v", err)
+	}
+
+	resp, err := http.Get(tokenURL) //nolint:noctx
+	if err != nil {
+		t.Fatalf("failed to get the token from %q: %v", tokenURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the token response: %v", err)
+	}
+	if string(body) != `{"access_token":"downscoped-token"}` {
+		t.Errorf("got token response %q, expected the token of the socket", body)
+	}
+}
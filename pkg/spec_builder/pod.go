@@ -0,0 +1,86 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specbuilder
+
+import (
+	"fmt"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// SidecarLimits are the sidecar container resource limits set by the Pod annotations.
+// The zero limits are not set, so that the webhook uses its defaults.
+type SidecarLimits struct {
+	CPU              resource.Quantity
+	Memory           resource.Quantity
+	EphemeralStorage resource.Quantity
+}
+
+// SidecarAnnotations returns the Pod annotations injecting the sidecar container with the limits.
+func SidecarAnnotations(limits SidecarLimits) map[string]string {
+	annotations := map[string]string{
+		webhook.AnnotationGcsfuseVolumeEnableKey: "true",
+	}
+	for key, q := range map[string]resource.Quantity{
+		webhook.AnnotationGcsfuseSidecarCPULimitKey:              limits.CPU,
+		webhook.AnnotationGcsfuseSidecarMemoryLimitKey:           limits.Memory,
+		webhook.AnnotationGcsfuseSidecarEphemeralStorageLimitKey: limits.EphemeralStorage,
+	} {
+		if !q.IsZero() {
+			annotations[key] = q.String()
+		}
+	}
+
+	return annotations
+}
+
+// EnableSidecar adds the sidecar annotations to the Pod template, keeping the other annotations.
+func EnableSidecar(template *corev1.PodTemplateSpec, limits SidecarLimits) {
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	for k, v := range SidecarAnnotations(limits) {
+		template.Annotations[k] = v
+	}
+}
+
+// MountVolume adds the volume to the Pod spec, and mounts it at the path in the containers.
+// The Pod spec is not changed if a container is not found.
+func MountVolume(spec *corev1.PodSpec, volume corev1.Volume, mountPath string, containerNames ...string) error {
+	indexes := map[string]int{}
+	for i, c := range spec.Containers {
+		indexes[c.Name] = i
+	}
+	for _, name := range containerNames {
+		if _, ok := indexes[name]; !ok {
+			return fmt.Errorf("container %q not found in the Pod spec", name)
+		}
+	}
+
+	for _, name := range containerNames {
+		c := &spec.Containers[indexes[name]]
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: mountPath,
+		})
+	}
+	spec.Volumes = append(spec.Volumes, volume)
+
+	return nil
+}
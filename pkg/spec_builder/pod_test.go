@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specbuilder
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSidecarAnnotations(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name     string
+		limits   SidecarLimits
+		expected map[string]string
+	}{
+		{
+			name:     "default limits",
+			expected: map[string]string{"gke-gcsfuse/volumes": "true"},
+		},
+		{
+			name:   "all limits",
+			limits: SidecarLimits{CPU: resource.MustParse("500m"), Memory: resource.MustParse("1Gi"), EphemeralStorage: resource.MustParse("10Gi")},
+			expected: map[string]string{
+				"gke-gcsfuse/volumes":                 "true",
+				"gke-gcsfuse/cpu-limit":               "500m",
+				"gke-gcsfuse/memory-limit":            "1Gi",
+				"gke-gcsfuse/ephemeral-storage-limit": "10Gi",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		if got := SidecarAnnotations(tc.limits); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("test %q failed: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestMountVolume(t *testing.T) {
+	t.Parallel()
+	volume, err := NewVolume("test-bucket").InlineVolume("test-volume")
+	if err != nil {
+		t.Fatalf("failed to build the volume: %v", err)
+	}
+
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "reader"}, {Name: "writer"}}}
+	if err := MountVolume(spec, volume, "/data", "reader", "not-found"); err == nil {
+		t.Errorf("expected an error for a container not found")
+	}
+	if len(spec.Volumes) != 0 || len(spec.Containers[0].VolumeMounts) != 0 {
+		t.Errorf("the Pod spec is changed after the error: %+v", spec)
+	}
+
+	if err := MountVolume(spec, volume, "/data", "reader", "writer"); err != nil {
+		t.Fatalf("failed to mount the volume: %v", err)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].Name != "test-volume" {
+		t.Errorf("got volumes %+v", spec.Volumes)
+	}
+	for _, c := range spec.Containers {
+		if !reflect.DeepEqual(c.VolumeMounts, []corev1.VolumeMount{{Name: "test-volume", MountPath: "/data"}}) {
+			t.Errorf("got volume mounts %+v of container %q", c.VolumeMounts, c.Name)
+		}
+	}
+}
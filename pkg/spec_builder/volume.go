@@ -0,0 +1,248 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package specbuilder builds the Kubernetes specs of gcsfuse volumes, so that the manifests generated by Go tooling
+// are validated with the same rules as the node driver and the webhook.
+package specbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultCapacity is the nominal capacity of the PersistentVolumes, which is required by Kubernetes but not enforced on the buckets.
+var defaultCapacity = resource.MustParse("5Gi")
+
+// Volume builds a gcsfuse volume, either as a CSI ephemeral volume of a Pod, or as a PersistentVolume bound to a PersistentVolumeClaim.
+type Volume struct {
+	bucketName   string
+	readOnly     bool
+	capacity     resource.Quantity
+	mountOptions []string
+	attributes   map[string]string
+}
+
+// NewVolume returns a read-write volume of the bucket without mount options and volume attributes.
+func NewVolume(bucketName string) *Volume {
+	return &Volume{
+		bucketName: bucketName,
+		capacity:   defaultCapacity,
+		attributes: map[string]string{},
+	}
+}
+
+// ReadOnly mounts the volume read-only.
+func (v *Volume) ReadOnly() *Volume {
+	v.readOnly = true
+
+	return v
+}
+
+// Capacity sets the nominal capacity of the PersistentVolume and the PersistentVolumeClaim.
+func (v *Volume) Capacity(q resource.Quantity) *Volume {
+	v.capacity = q
+
+	return v
+}
+
+// MountOptions appends gcsfuse mount options, e.g. implicit-dirs or uid=1001.
+func (v *Volume) MountOptions(options ...string) *Volume {
+	v.mountOptions = append(v.mountOptions, options...)
+
+	return v
+}
+
+// Attribute sets a volume attribute, for the attributes without a dedicated method.
+func (v *Volume) Attribute(key, value string) *Volume {
+	v.attributes[key] = value
+
+	return v
+}
+
+// SkipBucketAccessCheck skips the bucket access check of the node driver before mounting.
+func (v *Volume) SkipBucketAccessCheck() *Volume {
+	return v.Attribute(volumespec.VolumeContextKeySkipBucketAccessCheck, "true")
+}
+
+// FileCacheShared makes the read-only volume use the shared cache directory of the node.
+func (v *Volume) FileCacheShared() *Volume {
+	return v.Attribute(volumespec.VolumeContextKeyFileCacheShared, "true")
+}
+
+// QuotaProject attributes the Cloud Storage API quota of the volume to the project.
+func (v *Volume) QuotaProject(projectID string) *Volume {
+	return v.Attribute(volumespec.VolumeContextKeyQuotaProject, projectID)
+}
+
+// MetricsExportInterval exports the gcsfuse metrics to Cloud Monitoring at the interval.
+func (v *Volume) MetricsExportInterval(d time.Duration) *Volume {
+	return v.Attribute(volumespec.VolumeContextKeyMetricsExportInterval, d.String())
+}
+
+// RequestPriority tunes the gcsfuse retries and concurrency, the priority is latency-sensitive or throughput-batch.
+func (v *Volume) RequestPriority(priority string) *Volume {
+	return v.Attribute(volumespec.VolumeContextKeyRequestPriority, priority)
+}
+
+// ExpectedMaxWriteSize sizes the staging space of the volume to the largest file the workload writes.
+func (v *Volume) ExpectedMaxWriteSize(q resource.Quantity) *Volume {
+	return v.Attribute(webhook.VolumeAttributeExpectedMaxWriteSize, q.String())
+}
+
+// TmpVolumeSize sets the staging space of the volume, which takes precedence over ExpectedMaxWriteSize.
+func (v *Volume) TmpVolumeSize(q resource.Quantity) *Volume {
+	return v.Attribute(webhook.VolumeAttributeTmpVolumeSize, q.String())
+}
+
+// ParallelDownloads enables the parallel downloads of large objects into the file cache.
+func (v *Volume) ParallelDownloads(chunkSizeMb, maxParallelDownloads int) *Volume {
+	v.Attribute(webhook.VolumeAttributeDownloadChunkSizeMb, strconv.Itoa(chunkSizeMb))
+
+	return v.Attribute(webhook.VolumeAttributeMaxParallelDownloads, strconv.Itoa(maxParallelDownloads))
+}
+
+// Validate returns an error if the bucket name is empty, or a volume attribute is unknown or invalid.
+func (v *Volume) Validate() error {
+	if v.bucketName == "" {
+		return fmt.Errorf("the bucket name must be provided")
+	}
+
+	return volumespec.VolumeSpecValidator{}.ValidateVolumeAttributes(v.attributes)
+}
+
+// Warnings returns the warnings of the mount options that the node driver translates or ignores.
+func (v *Volume) Warnings() []string {
+	return volumespec.VolumeSpecValidator{}.MountOptionWarnings(v.mountOptions)
+}
+
+// InlineVolume returns the volume as a CSI ephemeral volume of a Pod.
+func (v *Volume) InlineVolume(name string) (corev1.Volume, error) {
+	if err := v.Validate(); err != nil {
+		return corev1.Volume{}, err
+	}
+
+	attributes := v.copyAttributes()
+	attributes[volumespec.VolumeContextKeyBucketName] = v.bucketName
+	if len(v.mountOptions) > 0 {
+		attributes[volumespec.VolumeContextKeyMountOptions] = strings.Join(v.mountOptions, ",")
+	}
+	readOnly := v.readOnly
+
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver:           volumespec.DriverName,
+				ReadOnly:         &readOnly,
+				VolumeAttributes: attributes,
+			},
+		},
+	}, nil
+}
+
+// PersistentVolumeSource returns the CSI source of a PersistentVolume whose spec is built by another tool, e.g. a test framework.
+// The mount options are passed in the mountOptions volume attribute, because the PersistentVolume spec is not part of the source.
+func (v *Volume) PersistentVolumeSource() (*corev1.PersistentVolumeSource, error) {
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+
+	attributes := v.copyAttributes()
+	if len(v.mountOptions) > 0 {
+		attributes[volumespec.VolumeContextKeyMountOptions] = strings.Join(v.mountOptions, ",")
+	}
+
+	return &corev1.PersistentVolumeSource{
+		CSI: &corev1.CSIPersistentVolumeSource{
+			Driver:           volumespec.DriverName,
+			VolumeHandle:     v.bucketName,
+			ReadOnly:         v.readOnly,
+			VolumeAttributes: attributes,
+		},
+	}, nil
+}
+
+// PersistentVolumeAndClaim returns the volume as a PersistentVolume statically bound to a PersistentVolumeClaim.
+// The StorageClass of both is empty, so that the claim is not dynamically provisioned.
+func (v *Volume) PersistentVolumeAndClaim(pvName, pvcNamespace, pvcName string) (*corev1.PersistentVolume, *corev1.PersistentVolumeClaim, error) {
+	if err := v.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	accessMode := corev1.ReadWriteMany
+	if v.readOnly {
+		accessMode = corev1.ReadOnlyMany
+	}
+
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: pvName,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{accessMode},
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: v.capacity},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			MountOptions:                  v.mountOptions,
+			ClaimRef: &corev1.ObjectReference{
+				Namespace: pvcNamespace,
+				Name:      pvcName,
+			},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:           volumespec.DriverName,
+					VolumeHandle:     v.bucketName,
+					ReadOnly:         v.readOnly,
+					VolumeAttributes: v.copyAttributes(),
+				},
+			},
+		},
+	}
+
+	storageClassName := ""
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: pvcNamespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{accessMode},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: v.capacity},
+			},
+			VolumeName:       pvName,
+			StorageClassName: &storageClassName,
+		},
+	}
+
+	return pv, pvc, nil
+}
+
+func (v *Volume) copyAttributes() map[string]string {
+	attributes := make(map[string]string, len(v.attributes))
+	for k, a := range v.attributes {
+		attributes[k] = a
+	}
+
+	return attributes
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specbuilder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestInlineVolume(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name               string
+		volume             *Volume
+		expectedAttributes map[string]string
+		expectedReadOnly   bool
+		expectErr          bool
+	}{
+		{
+			name:               "bucket only",
+			volume:             NewVolume("test-bucket"),
+			expectedAttributes: map[string]string{"bucketName": "test-bucket"},
+		},
+		{
+			name:   "mount options and attributes",
+			volume: NewVolume("test-bucket").ReadOnly().MountOptions("implicit-dirs", "uid=1001").SkipBucketAccessCheck().MetricsExportInterval(time.Minute).TmpVolumeSize(resource.MustParse("10Gi")),
+			expectedAttributes: map[string]string{
+				"bucketName":            "test-bucket",
+				"mountOptions":          "implicit-dirs,uid=1001",
+				"skipBucketAccessCheck": "true",
+				"metricsExportInterval": "1m0s",
+				"tmpVolumeSize":         "10Gi",
+			},
+			expectedReadOnly: true,
+		},
+		{
+			name:      "empty bucket name",
+			volume:    NewVolume(""),
+			expectErr: true,
+		},
+		{
+			name:      "invalid request priority",
+			volume:    NewVolume("test-bucket").RequestPriority("high"),
+			expectErr: true,
+		},
+		{
+			name:      "unknown attribute",
+			volume:    NewVolume("test-bucket").Attribute("bucket", "test-bucket"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		v, err := tc.volume.InlineVolume("test-volume")
+		if tc.expectErr != (err != nil) {
+			t.Errorf("test %q failed: got error %v, expected error %v", tc.name, err, tc.expectErr)
+		}
+		if err != nil {
+			continue
+		}
+		if v.Name != "test-volume" || v.CSI.Driver != "gcsfuse.csi.storage.gke.io" || *v.CSI.ReadOnly != tc.expectedReadOnly {
+			t.Errorf("test %q failed: got volume %+v", tc.name, v)
+		}
+		if !reflect.DeepEqual(v.CSI.VolumeAttributes, tc.expectedAttributes) {
+			t.Errorf("test %q failed: got attributes %v, expected %v", tc.name, v.CSI.VolumeAttributes, tc.expectedAttributes)
+		}
+	}
+}
+
+func TestPersistentVolumeAndClaim(t *testing.T) {
+	t.Parallel()
+	pv, pvc, err := NewVolume("test-bucket").ReadOnly().MountOptions("implicit-dirs").QuotaProject("test-project").PersistentVolumeAndClaim("test-pv", "test-ns", "test-pvc")
+	if err != nil {
+		t.Fatalf("failed to build the PersistentVolume: %v", err)
+	}
+
+	if pv.Spec.CSI.VolumeHandle != "test-bucket" || !pv.Spec.CSI.ReadOnly {
+		t.Errorf("got PersistentVolume CSI source %+v", pv.Spec.CSI)
+	}
+	if !reflect.DeepEqual(pv.Spec.MountOptions, []string{"implicit-dirs"}) {
+		t.Errorf("got mount options %v, expected [implicit-dirs]", pv.Spec.MountOptions)
+	}
+	if !reflect.DeepEqual(pv.Spec.CSI.VolumeAttributes, map[string]string{"quotaProject": "test-project"}) {
+		t.Errorf("got volume attributes %v, expected the quota project only", pv.Spec.CSI.VolumeAttributes)
+	}
+	if pv.Spec.ClaimRef.Namespace != "test-ns" || pv.Spec.ClaimRef.Name != "test-pvc" || pvc.Spec.VolumeName != "test-pv" {
+		t.Errorf("the PersistentVolume %+v and the PersistentVolumeClaim %+v are not bound to each other", pv.Spec.ClaimRef, pvc.Spec)
+	}
+	if *pvc.Spec.StorageClassName != "" || pvc.Spec.AccessModes[0] != corev1.ReadOnlyMany || pv.Spec.AccessModes[0] != corev1.ReadOnlyMany {
+		t.Errorf("got PersistentVolumeClaim spec %+v", pvc.Spec)
+	}
+}
+
+func TestPersistentVolumeSource(t *testing.T) {
+	t.Parallel()
+	source, err := NewVolume("test-bucket").ReadOnly().MountOptions("implicit-dirs", "uid=1001").QuotaProject("test-project").PersistentVolumeSource()
+	if err != nil {
+		t.Fatalf("failed to build the PersistentVolume source: %v", err)
+	}
+
+	if source.CSI.VolumeHandle != "test-bucket" || !source.CSI.ReadOnly {
+		t.Errorf("got PersistentVolume CSI source %+v", source.CSI)
+	}
+	expectedAttributes := map[string]string{"mountOptions": "implicit-dirs,uid=1001", "quotaProject": "test-project"}
+	if !reflect.DeepEqual(source.CSI.VolumeAttributes, expectedAttributes) {
+		t.Errorf("got volume attributes %v, expected %v", source.CSI.VolumeAttributes, expectedAttributes)
+	}
+
+	if _, err := NewVolume("").PersistentVolumeSource(); err == nil {
+		t.Error("expected an error for the empty bucket name")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build boringcrypto
+
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+// Importing fipsonly restricts the TLS configurations of all the Google API and Kubernetes API clients
+// to the FIPS 140-2 approved settings of the BoringCrypto module.
+import _ "crypto/tls/fipsonly"
+
+// FIPSMode is true if the binary is built with GOEXPERIMENT=boringcrypto, using the FIPS build mode of the Makefile.
+const FIPSMode = true
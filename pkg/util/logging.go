@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Structured logging keys shared by the node server and the sidecar mounter,
+// so that the lifecycle of a single mount can be reconstructed using one log filter.
+const (
+	LogKeyVolumeID   = "volumeID"
+	LogKeyPod        = "pod"
+	LogKeyPodUID     = "podUID"
+	LogKeyBucket     = "bucket"
+	LogKeyVolumeName = "volumeName"
+	LogKeyTargetPath = "targetPath"
+)
+
+// TargetPathLogFields returns the structured logging key/value pairs
+// of the Pod UID and volume name parsed from the target path.
+func TargetPathLogFields(targetPath string) []interface{} {
+	podUID, volumeName, _ := ParsePodIDVolumeFromTargetpath(targetPath)
+
+	return []interface{}{LogKeyPodUID, podUID, LogKeyVolumeName, volumeName, LogKeyTargetPath, targetPath}
+}
+
+// redactedValue replaces the sensitive values of the logged gcsfuse flags.
+const redactedValue = "REDACTED"
+
+// sensitiveFlagKeywords identify the gcsfuse flags whose values can carry credentials, e.g. key-file and token-url.
+var sensitiveFlagKeywords = []string{"key", "token", "secret", "password", "credential"}
+
+// RedactFlagValue returns the value of a gcsfuse flag that is safe to be logged.
+// The values of the flags that can carry credentials are replaced, and so is the user info of URL values.
+func RedactFlagValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+
+	name = strings.ToLower(name)
+	for _, k := range sensitiveFlagKeywords {
+		if strings.Contains(name, k) {
+			return redactedValue
+		}
+	}
+
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+
+	return value
+}
+
+// RedactMountOptions returns the mount options in the key=value format with the values redacted by RedactFlagValue.
+func RedactMountOptions(options []string) []string {
+	redacted := make([]string, 0, len(options))
+	for _, o := range options {
+		k, v, found := strings.Cut(o, "=")
+		if found {
+			o = k + "=" + RedactFlagValue(k, v)
+		}
+		redacted = append(redacted, o)
+	}
+
+	return redacted
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net/http"
+)
+
+type headerTransport struct {
+	base   http.RoundTripper
+	header string
+	value  string
+}
+
+// NewUserAgentTransport returns a http.RoundTripper that sets the User-Agent header
+// on every request before delegating to the base RoundTripper.
+func NewUserAgentTransport(base http.RoundTripper, userAgent string) http.RoundTripper {
+	return newHeaderTransport(base, "User-Agent", userAgent)
+}
+
+// NewQuotaProjectTransport returns a http.RoundTripper that sets the X-Goog-User-Project header
+// on every request, so that the API quota and billing are attributed to the quota project.
+func NewQuotaProjectTransport(base http.RoundTripper, quotaProject string) http.RoundTripper {
+	return newHeaderTransport(base, "X-Goog-User-Project", quotaProject)
+}
+
+func newHeaderTransport(base http.RoundTripper, header, value string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &headerTransport{base: base, header: header, value: value}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.value == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrip should not modify the original request.
+	r := req.Clone(req.Context())
+	r.Header.Set(t.header, t.value)
+
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderTransport(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		transport      http.RoundTripper
+		header         string
+		expectedOutput string
+	}{
+		{
+			name:           "should set user agent",
+			transport:      NewUserAgentTransport(nil, "test-user-agent"),
+			header:         "User-Agent",
+			expectedOutput: "test-user-agent",
+		},
+		{
+			name:           "should set quota project",
+			transport:      NewQuotaProjectTransport(nil, "test-quota-project"),
+			header:         "X-Goog-User-Project",
+			expectedOutput: "test-quota-project",
+		},
+		{
+			name:           "should not set quota project when empty",
+			transport:      NewQuotaProjectTransport(nil, ""),
+			header:         "X-Goog-User-Project",
+			expectedOutput: "",
+		},
+		{
+			name:           "should set both headers when chained",
+			transport:      NewQuotaProjectTransport(NewUserAgentTransport(nil, "test-user-agent"), "test-quota-project"),
+			header:         "X-Goog-User-Project",
+			expectedOutput: "test-quota-project",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		var output string
+		server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			output = r.Header.Get(tc.header)
+		}))
+
+		client := &http.Client{Transport: tc.transport}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Errorf("Did not expect error but got: %v", err)
+		} else {
+			resp.Body.Close()
+		}
+		server.Close()
+
+		if output != tc.expectedOutput {
+			t.Errorf("Got header %q value %q, but expected %q", tc.header, output, tc.expectedOutput)
+		}
+	}
+}
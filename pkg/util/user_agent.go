@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	userAgentProductName = "gcs-fuse-csi-driver"
+	unknownVersion       = "unknown"
+)
+
+// UserAgentInfo contains the information used to attribute the GCS and IAM API calls
+// made by the driver and gcsfuse.
+type UserAgentInfo struct {
+	DriverVersion  string
+	GKEVersion     string
+	SidecarVersion string
+	Features       []string
+}
+
+// String returns the user agent string, for example:
+// gcs-fuse-csi-driver/v0.1.4 (gke/v1.27.3-gke.100; sidecar/v0.1.4; features/node,storage-endpoint).
+func (u *UserAgentInfo) String() string {
+	features := append([]string{}, u.Features...)
+	sort.Strings(features)
+
+	details := []string{
+		"gke/" + versionOrUnknown(u.GKEVersion),
+		"sidecar/" + versionOrUnknown(u.SidecarVersion),
+	}
+	if len(features) > 0 {
+		details = append(details, "features/"+strings.Join(features, ","))
+	}
+
+	return fmt.Sprintf("%v/%v (%v)", userAgentProductName, versionOrUnknown(u.DriverVersion), strings.Join(details, "; "))
+}
+
+// GetImageVersion returns the tag of a container image, or "unknown" if the image is not tagged.
+// The digest of a digest-pinned image is not a version, so it is ignored.
+func GetImageVersion(image string) string {
+	// ignore the digest, e.g. image:tag@sha256:...
+	image, _, _ = strings.Cut(image, "@")
+	// ignore the registry port, e.g. localhost:5000/image
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 && i < len(name)-1 {
+		return name[i+1:]
+	}
+
+	return unknownVersion
+}
+
+func versionOrUnknown(v string) string {
+	if v == "" {
+		return unknownVersion
+	}
+
+	return v
+}
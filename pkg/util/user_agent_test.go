@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+func TestUserAgentInfoString(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		info           *UserAgentInfo
+		expectedOutput string
+	}{
+		{
+			name:           "should return unknown versions when info is empty",
+			info:           &UserAgentInfo{},
+			expectedOutput: "gcs-fuse-csi-driver/unknown (gke/unknown; sidecar/unknown)",
+		},
+		{
+			name: "should return full user agent with sorted features",
+			info: &UserAgentInfo{
+				DriverVersion:  "v0.1.4",
+				GKEVersion:     "v1.27.3-gke.100",
+				SidecarVersion: "v0.1.4",
+				Features:       []string{"storage-endpoint", "node"},
+			},
+			expectedOutput: "gcs-fuse-csi-driver/v0.1.4 (gke/v1.27.3-gke.100; sidecar/v0.1.4; features/node,storage-endpoint)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		output := tc.info.String()
+		if output != tc.expectedOutput {
+			t.Errorf("Got user agent %q, but expected %q", output, tc.expectedOutput)
+		}
+	}
+}
+
+func TestGetImageVersion(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		image          string
+		expectedOutput string
+	}{
+		{
+			name:           "should return image tag",
+			image:          "gcr.io/gke-release/gcs-fuse-csi-driver-sidecar-mounter:v0.1.4",
+			expectedOutput: "v0.1.4",
+		},
+		{
+			name:           "should return unknown when image is not tagged",
+			image:          "gcr.io/gke-release/gcs-fuse-csi-driver-sidecar-mounter",
+			expectedOutput: "unknown",
+		},
+		{
+			name:           "should ignore registry port",
+			image:          "localhost:5000/gcs-fuse-csi-driver-sidecar-mounter",
+			expectedOutput: "unknown",
+		},
+		{
+			name:           "should return image tag of a digest-pinned image",
+			image:          "gcr.io/gke-release/gcs-fuse-csi-driver-sidecar-mounter:v0.1.4@sha256:0d3f5a2b4c6e8f1a3b5c7d9e0f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a",
+			expectedOutput: "v0.1.4",
+		},
+		{
+			name:           "should return unknown when image is only pinned by digest",
+			image:          "gcr.io/gke-release/gcs-fuse-csi-driver-sidecar-mounter@sha256:0d3f5a2b4c6e8f1a3b5c7d9e0f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a",
+			expectedOutput: "unknown",
+		},
+		{
+			name:           "should ignore registry port of a digest-pinned image",
+			image:          "localhost:5000/gcs-fuse-csi-driver-sidecar-mounter@sha256:0d3f5a2b4c6e8f1a3b5c7d9e0f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a",
+			expectedOutput: "unknown",
+		},
+		{
+			name:           "should return unknown when image is empty",
+			image:          "",
+			expectedOutput: "unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case: %s", tc.name)
+		output := GetImageVersion(tc.image)
+		if output != tc.expectedOutput {
+			t.Errorf("Got image version %q, but expected %q", output, tc.expectedOutput)
+		}
+	}
+}
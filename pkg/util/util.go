@@ -119,8 +119,10 @@ func ParseEndpoint(endpoint string, cleanupSocket bool) (string, string, error)
 	return u.Scheme, addr, nil
 }
 
+// ParsePodIDVolumeFromTargetpath returns the Pod UID and the volume name of a target path under the pods directory
+// of the kubelet root directory, which is not always /var/lib/kubelet, e.g. the kubelet --root-dir flag or microk8s.
 func ParsePodIDVolumeFromTargetpath(targetPath string) (string, string, error) {
-	r := regexp.MustCompile("/var/lib/kubelet/pods/(.*)/volumes/kubernetes.io~csi/(.*)/mount")
+	r := regexp.MustCompile("/pods/([^/]+)/volumes/kubernetes.io~csi/([^/]+)/mount")
 	matched := r.FindStringSubmatch(targetPath)
 	if len(matched) < 3 {
 		return "", "", fmt.Errorf("targetPath %v does not contain Pod ID or volume information", targetPath)
@@ -275,6 +275,13 @@ func TestParsePodIDVolumeFromTargetpath(t *testing.T) {
 			expectedVolume: "test-volume",
 			expectedError:  false,
 		},
+		{
+			name:           "should parse Pod ID of a custom kubelet root directory correctly",
+			targetPath:     "/var/snap/microk8s/common/var/lib/kubelet/pods/d2013878-3d56-45f9-89ec-0826612c89b6/volumes/kubernetes.io~csi/test-volume/mount",
+			expectedPodID:  "d2013878-3d56-45f9-89ec-0826612c89b6",
+			expectedVolume: "test-volume",
+			expectedError:  false,
+		},
 		{
 			name:           "should return error",
 			targetPath:     "/foo/bar/volumes",
@@ -321,6 +328,12 @@ func TestPrepareEmptyDir(t *testing.T) {
 			expectedEmptyDirBasePath: fmt.Sprintf("/var/lib/kubelet/pods/d2013878-3d56-45f9-89ec-0826612c89b6/volumes/kubernetes.io~empty-dir/%v/.volumes/test-volume", webhook.SidecarContainerVolumeName),
 			expectedError:            false,
 		},
+		{
+			name:                     "should return emptyDir path of a custom kubelet root directory correctly",
+			targetPath:               "/data/kubelet/pods/d2013878-3d56-45f9-89ec-0826612c89b6/volumes/kubernetes.io~csi/test-volume/mount",
+			expectedEmptyDirBasePath: fmt.Sprintf("/data/kubelet/pods/d2013878-3d56-45f9-89ec-0826612c89b6/volumes/kubernetes.io~empty-dir/%v/.volumes/test-volume", webhook.SidecarContainerVolumeName),
+			expectedError:            false,
+		},
 		{
 			name:                     "should return error",
 			targetPath:               "/foo/bar/volumes",
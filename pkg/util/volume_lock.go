@@ -58,3 +58,11 @@ func (vl *VolumeLocks) Release(volumeID string) {
 	defer vl.mux.Unlock()
 	vl.locks.Delete(volumeID)
 }
+
+// List returns the sorted volume IDs with an ongoing operation.
+func (vl *VolumeLocks) List() []string {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+
+	return sets.List(vl.locks)
+}
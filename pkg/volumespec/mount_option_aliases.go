@@ -0,0 +1,72 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumespec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mountOptionAliases map the deprecated and renamed gcsfuse flags to the flags of the gcsfuse version in the sidecar image,
+// so that the mountOptions of the existing volumes keep working when the sidecar image bumps the gcsfuse major version.
+// An empty replacement means the flag was removed and its behavior is the default, so the option is dropped.
+var mountOptionAliases = map[string]string{
+	// The retries are bounded by the maximum backoff instead of the total duration, see mountOptionMeaningChanges.
+	"max-retry-duration": "max-retry-sleep",
+	// The metrics export graduated from experimental.
+	"experimental-stackdriver-export-interval": "stackdriver-export-interval",
+	// The Go storage client library is always used.
+	"enable-storage-client-library": "",
+	// The fuse errors are always logged.
+	"debug_fuse_errors": "",
+}
+
+// mountOptionMeaningChanges describe the renamed flags whose value has a different meaning than the deprecated flag,
+// so that the warning tells the user to review the value instead of only renaming the option.
+var mountOptionMeaningChanges = map[string]string{
+	"max-retry-duration": "the value was the total duration of the retries, and is now the maximum backoff between two retries",
+}
+
+// TranslateMountOptions replaces the deprecated gcsfuse flags in the mount options with the current flags,
+// and drops the removed flags. A warning is returned for each translated option, to be surfaced to the user.
+func TranslateMountOptions(options []string) ([]string, []string) {
+	translated := make([]string, 0, len(options))
+	warnings := []string{}
+	for _, o := range options {
+		k, v, found := strings.Cut(o, "=")
+		replacement, ok := mountOptionAliases[k]
+		switch {
+		case !ok:
+			translated = append(translated, o)
+		case replacement == "":
+			warnings = append(warnings, fmt.Sprintf("mount option %q was removed from gcsfuse and is ignored", k))
+		default:
+			if found {
+				translated = append(translated, replacement+"="+v)
+			} else {
+				translated = append(translated, replacement)
+			}
+			warning := fmt.Sprintf("mount option %q is deprecated, %q is used instead", k, replacement)
+			if change, ok := mountOptionMeaningChanges[k]; ok {
+				warning += fmt.Sprintf(", the meaning changed: %v", change)
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+
+	return translated, warnings
+}
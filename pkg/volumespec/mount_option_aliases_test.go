@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumespec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateMountOptions(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name             string
+		options          []string
+		expectedOptions  []string
+		expectedWarnings []string
+	}{
+		{
+			name:             "current options",
+			options:          []string{"implicit-dirs", "max-retry-sleep=30s"},
+			expectedOptions:  []string{"implicit-dirs", "max-retry-sleep=30s"},
+			expectedWarnings: []string{},
+		},
+		{
+			name:             "renamed option with a value",
+			options:          []string{"max-retry-duration=30s", "ro"},
+			expectedOptions:  []string{"max-retry-sleep=30s", "ro"},
+			expectedWarnings: []string{`mount option "max-retry-duration" is deprecated, "max-retry-sleep" is used instead, the meaning changed: the value was the total duration of the retries, and is now the maximum backoff between two retries`},
+		},
+		{
+			name:             "removed option",
+			options:          []string{"debug_fuse_errors=true", "ro"},
+			expectedOptions:  []string{"ro"},
+			expectedWarnings: []string{`mount option "debug_fuse_errors" was removed from gcsfuse and is ignored`},
+		},
+	}
+
+	for _, test := range cases {
+		options, warnings := TranslateMountOptions(test.options)
+		if !reflect.DeepEqual(options, test.expectedOptions) {
+			t.Errorf("test %q failed: got options %v, expected %v", test.name, options, test.expectedOptions)
+		}
+		if !reflect.DeepEqual(warnings, test.expectedWarnings) {
+			t.Errorf("test %q failed: got warnings %v, expected %v", test.name, warnings, test.expectedWarnings)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumespec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sidecarmounter "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/sidecar_mounter"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/util"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+)
+
+// csiParameterPrefix is the prefix of the volume attributes set by the kubelet,
+// and of the StorageClass parameters reserved for the external-provisioner, e.g. the provisioner secret.
+const csiParameterPrefix = "csi.storage.k8s.io/"
+
+// provisionerAttributePrefix is the prefix of the volume attributes set by the external-provisioner
+// on the PersistentVolumes it provisions, e.g. storage.kubernetes.io/csiProvisionerIdentity.
+const provisionerAttributePrefix = "storage.kubernetes.io/"
+
+// knownVolumeAttributes are the volume attributes used by the node driver and the webhook.
+var knownVolumeAttributes = map[string]bool{
+	VolumeContextKeyBucketName:                  true,
+	VolumeContextKeyMountOptions:                true,
+	VolumeContextKeyQuotaProject:                true,
+	VolumeContextKeyMetricsExportInterval:       true,
+	VolumeContextKeySkipBucketAccessCheck:       true,
+	VolumeContextKeyFileCacheShared:             true,
+	VolumeContextKeyRequestPriority:             true,
+	webhook.VolumeAttributeExpectedMaxWriteSize: true,
+	webhook.VolumeAttributeTmpVolumeSize:        true,
+	webhook.VolumeAttributeDownloadChunkSizeMb:  true,
+	webhook.VolumeAttributeMaxParallelDownloads: true,
+}
+
+// VolumeSpecValidator validates the volume attributes, StorageClass parameters, and mount options of the driver
+// at the creation of the PersistentVolumes and StorageClasses, with the same rules as the node driver and the controller.
+type VolumeSpecValidator struct{}
+
+// ValidateVolumeAttributes returns an error if a volume attribute is unknown or has an invalid value.
+func (VolumeSpecValidator) ValidateVolumeAttributes(attributes map[string]string) error {
+	for k, v := range attributes {
+		if !knownVolumeAttributes[k] && !strings.HasPrefix(k, csiParameterPrefix) && !strings.HasPrefix(k, provisionerAttributePrefix) {
+			return fmt.Errorf("unknown volume attribute %q", k)
+		}
+
+		switch k {
+		case VolumeContextKeySkipBucketAccessCheck, VolumeContextKeyFileCacheShared:
+			if _, err := strconv.ParseBool(v); err != nil {
+				return fmt.Errorf("volume attribute %q must be a boolean, got %q", k, v)
+			}
+		case VolumeContextKeyMetricsExportInterval:
+			if d, err := time.ParseDuration(v); err != nil || d < MinMetricsExportInterval {
+				return fmt.Errorf("volume attribute %q must be a duration of at least %v, got %q", k, MinMetricsExportInterval, v)
+			}
+		case VolumeContextKeyRequestPriority:
+			if _, ok := RequestPriorityMountOptions[v]; !ok {
+				return fmt.Errorf("volume attribute %q must be one of %q and %q, got %q", k, RequestPriorityLatencySensitive, RequestPriorityThroughputBatch, v)
+			}
+		}
+	}
+
+	if _, err := webhook.VolumeStagingSize(attributes); err != nil {
+		return err
+	}
+	if _, err := webhook.ParallelDownloadMountOptions(attributes); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateStorageClassParameters returns an error if a StorageClass parameter is unknown or has an invalid value.
+func (VolumeSpecValidator) ValidateStorageClassParameters(parameters map[string]string) error {
+	for k, v := range parameters {
+		switch {
+		case strings.HasPrefix(k, csiParameterPrefix):
+		case strings.ToLower(k) == ParameterKeyLabels:
+			if _, err := util.ConvertLabelsStringToMap(v); err != nil {
+				return fmt.Errorf("parameter %q is invalid: %w", k, err)
+			}
+		default:
+			return fmt.Errorf("unknown parameter %q, only %q and the %q parameters are supported", k, ParameterKeyLabels, csiParameterPrefix)
+		}
+	}
+
+	return nil
+}
+
+// MountOptionWarnings returns the warnings of the mount options that the node driver translates or ignores.
+// The other gcsfuse flags are not checked, so that the options of newer gcsfuse versions are not rejected.
+func (VolumeSpecValidator) MountOptionWarnings(options []string) []string {
+	_, warnings := TranslateMountOptions(options)
+	for _, o := range options {
+		name, _, _ := strings.Cut(o, "=")
+		switch {
+		case name == StorageEndpointMountOptionKey || name == SharedCacheDirMountOptionKey || name == TraceIDMountOptionKey || name == TokenServerMountOptionKey:
+			warnings = append(warnings, fmt.Sprintf("mount option %q is only set by the node driver and is ignored", name))
+		case sidecarmounter.IsDisallowedFlag(strings.TrimLeft(name, "-")):
+			warnings = append(warnings, fmt.Sprintf("mount option %q is set by the sidecar mounter and is ignored", name))
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumespec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateVolumeAttributes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		attributes  map[string]string
+		expectedErr bool
+	}{
+		{
+			name: "valid attributes",
+			attributes: map[string]string{
+				VolumeContextKeyBucketName:            "test-bucket",
+				VolumeContextKeyMountOptions:          "implicit-dirs,uid=1001",
+				VolumeContextKeySkipBucketAccessCheck: "true",
+				VolumeContextKeyMetricsExportInterval: "1m",
+				VolumeContextKeyRequestPriority:       RequestPriorityThroughputBatch,
+				"tmpVolumeSize":                       "10Gi",
+				VolumeContextKeyEphemeral:             "true",
+			},
+		},
+		{
+			name: "attributes of a PersistentVolume provisioned by the external-provisioner",
+			attributes: map[string]string{
+				VolumeContextKeyMountOptions:                   "implicit-dirs",
+				"storage.kubernetes.io/csiProvisionerIdentity": "1700000000000-8081-gcsfuse.csi.storage.gke.io",
+			},
+		},
+		{
+			name:        "unknown attribute",
+			attributes:  map[string]string{"bucketname": "test-bucket"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid boolean",
+			attributes:  map[string]string{VolumeContextKeyFileCacheShared: "yes please"},
+			expectedErr: true,
+		},
+		{
+			name:        "metrics export interval too short",
+			attributes:  map[string]string{VolumeContextKeyMetricsExportInterval: "1s"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid request priority",
+			attributes:  map[string]string{VolumeContextKeyRequestPriority: "urgent"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid staging size",
+			attributes:  map[string]string{"expectedMaxWriteSize": "big"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid parallel downloads",
+			attributes:  map[string]string{"maxParallelDownloads": "-1"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := VolumeSpecValidator{}.ValidateVolumeAttributes(tc.attributes)
+		if gotErr := err != nil; gotErr != tc.expectedErr {
+			t.Errorf("test %q failed: got error %v, expected an error %v", tc.name, err, tc.expectedErr)
+		}
+	}
+}
+
+func TestValidateStorageClassParameters(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		parameters  map[string]string
+		expectedErr bool
+	}{
+		{
+			name: "valid parameters",
+			parameters: map[string]string{
+				"csi.storage.k8s.io/provisioner-secret-name":      "gcs-csi-secret",
+				"csi.storage.k8s.io/provisioner-secret-namespace": "${pvc.namespace}",
+				ParameterKeyLabels: "team=storage,env=dev",
+			},
+		},
+		{
+			name:        "unknown parameter",
+			parameters:  map[string]string{"lables": "team=storage"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid labels",
+			parameters:  map[string]string{ParameterKeyLabels: "team"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := VolumeSpecValidator{}.ValidateStorageClassParameters(tc.parameters)
+		if gotErr := err != nil; gotErr != tc.expectedErr {
+			t.Errorf("test %q failed: got error %v, expected an error %v", tc.name, err, tc.expectedErr)
+		}
+	}
+}
+
+func TestMountOptionWarnings(t *testing.T) {
+	t.Parallel()
+
+	got := VolumeSpecValidator{}.MountOptionWarnings([]string{"implicit-dirs", "max-retry-duration=30s", "temp-dir=/tmp", "shared-cache-dir=/cache"})
+	expected := []string{
+		`mount option "max-retry-duration" is deprecated, "max-retry-sleep" is used instead, the meaning changed: the value was the total duration of the retries, and is now the maximum backoff between two retries`,
+		`mount option "temp-dir" is set by the sidecar mounter and is ignored`,
+		`mount option "shared-cache-dir" is only set by the node driver and is ignored`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got warnings %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package volumespec holds the volume attributes, StorageClass parameters, and mount options of the driver,
+// and their validation, shared by the node driver, the webhook, and the spec builder
+// without importing the driver itself.
+package volumespec
+
+import "time"
+
+// DriverName is the default name of the CSI driver.
+const DriverName = "gcsfuse.csi.storage.gke.io"
+
+// NodePublishVolume VolumeContext parameters.
+const (
+	VolumeContextKeyServiceAccountName = "csi.storage.k8s.io/serviceAccount.name"
+	//nolint:gosec
+	VolumeContextKeyServiceAccountToken = "csi.storage.k8s.io/serviceAccount.tokens"
+	VolumeContextKeyPodName             = "csi.storage.k8s.io/pod.name"
+	VolumeContextKeyPodNamespace        = "csi.storage.k8s.io/pod.namespace"
+	VolumeContextKeyEphemeral           = "csi.storage.k8s.io/ephemeral"
+	VolumeContextKeyBucketName          = "bucketName"
+	VolumeContextKeyMountOptions        = "mountOptions"
+	VolumeContextKeyQuotaProject        = "quotaProject"
+	// VolumeContextKeyMetricsExportInterval opts in to exporting gcsfuse metrics to Cloud Monitoring at the given interval.
+	VolumeContextKeyMetricsExportInterval = "metricsExportInterval"
+	// VolumeContextKeySkipBucketAccessCheck skips the bucket existence and access check before mounting,
+	// for identities that can access the objects but cannot list the bucket. gcsfuse then surfaces the access errors.
+	VolumeContextKeySkipBucketAccessCheck = "skipBucketAccessCheck"
+	// VolumeContextKeyFileCacheShared makes a read-only volume use the shared cache directory of the node,
+	// so that the mounts of the same bucket on a node share one copy of the cached objects.
+	VolumeContextKeyFileCacheShared = "fileCacheShared"
+	// VolumeContextKeyRequestPriority tunes the gcsfuse retries and concurrency of the volume, see RequestPriorityMountOptions.
+	VolumeContextKeyRequestPriority = "requestPriority"
+)
+
+// ParameterKeyLabels is the StorageClass parameter of the user provided labels of the provisioned buckets.
+const ParameterKeyLabels = "labels"
+
+// MinMetricsExportInterval is the minimum gcsfuse metrics export interval,
+// to stay within the Cloud Monitoring custom metrics write rate limit.
+const MinMetricsExportInterval = time.Second * 10
+
+// requestPriority volume attribute values.
+const (
+	RequestPriorityLatencySensitive = "latency-sensitive"
+	RequestPriorityThroughputBatch  = "throughput-batch"
+)
+
+// RequestPriorityMountOptions are the gcsfuse mount options of each requestPriority volume attribute value.
+var RequestPriorityMountOptions = map[string][]string{
+	// Retry throttled and failed requests quickly with a short backoff, and allow many parallel requests,
+	// so that the file operations of interactive and serving workloads do not stall.
+	RequestPriorityLatencySensitive: {"max-retry-sleep=10s", "retry-multiplier=1.5", "max-conns-per-host=100"},
+	// Back off longer on throttled requests and limit the parallel requests, so that batch workloads
+	// leave the GCS quota to the latency-sensitive volumes on the same node and finish eventually.
+	RequestPriorityThroughputBatch: {"max-retry-sleep=5m", "retry-multiplier=3", "max-conns-per-host=10"},
+}
+
+// StorageEndpointMountOptionKey is the mount option used by the node server
+// to override the storage endpoint of a single volume, e.g. using a regional endpoint.
+const StorageEndpointMountOptionKey = "storage-endpoint"
+
+// SharedCacheDirMountOptionKey is the mount option used by the node server
+// to share a node-level gcsfuse cache directory between the read-only mounts of the same bucket.
+const SharedCacheDirMountOptionKey = "shared-cache-dir"
+
+// TraceIDMountOptionKey is the mount option used by the node server
+// to pass the trace of NodePublishVolume to the mount phases that finish after NodePublishVolume returns.
+const TraceIDMountOptionKey = "trace-id"
+
+// TokenServerMountOptionKey is the mount option used by the node server
+// to tell the sidecar mounter that the node server serves the downscoped tokens of the volume.
+const TokenServerMountOptionKey = "token-server"
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"strings"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// annotationKeys are the Pod annotations of the webhook counted by the adoption metrics.
+// The other annotations are not counted, so that the cardinality of the metrics is bounded.
+var annotationKeys = []string{
+	AnnotationGcsfuseVolumeEnableKey,
+	AnnotationGcsfuseSidecarCPULimitKey,
+	AnnotationGcsfuseSidecarMemoryLimitKey,
+	AnnotationGcsfuseSidecarEphemeralStorageLimitKey,
+}
+
+// recordAdoption counts the Pod in the annotation adoption metrics.
+func recordAdoption(req admission.Request, pod *corev1.Pod) {
+	if !countsAdoption(req, pod) {
+		return
+	}
+
+	annotation, counted, keys := podAdoption(pod)
+	if counted {
+		metrics.WebhookGcsfusePodTotal.WithLabelValues(annotation).Inc()
+	}
+	for _, k := range keys {
+		metrics.WebhookAnnotationTotal.WithLabelValues(k).Inc()
+	}
+}
+
+// countsAdoption returns false for the admission requests that do not create a new Pod, so that each Pod is counted once:
+// the dry-run requests, and the reinvocations of the webhook after the sidecar container was injected.
+func countsAdoption(req admission.Request, pod *corev1.Pod) bool {
+	if req.DryRun != nil && *req.DryRun {
+		return false
+	}
+
+	for _, c := range pod.Spec.Containers {
+		if c.Name == SidecarContainerName {
+			return false
+		}
+	}
+
+	return true
+}
+
+// podAdoption returns the value of the gke-gcsfuse/volumes annotation of the Pod, whether the Pod uses gcsfuse volumes,
+// and the webhook annotation keys set on the Pod.
+// A Pod uses gcsfuse volumes if it has gcsfuse CSI ephemeral volumes or sets the annotation. The PersistentVolumes
+// of the Pod are not visible at the Pod admission, so a Pod only mounting gcsfuse PersistentVolumes without the annotation is not counted.
+func podAdoption(pod *corev1.Pod) (string, bool, []string) {
+	annotation := metrics.AnnotationValueMissing
+	if v, ok := pod.Annotations[AnnotationGcsfuseVolumeEnableKey]; ok {
+		switch v = strings.ToLower(v); v {
+		case "true", "false":
+			annotation = v
+		default:
+			annotation = metrics.AnnotationValueInvalid
+		}
+	}
+
+	counted := annotation != metrics.AnnotationValueMissing
+	for _, v := range pod.Spec.Volumes {
+		if v.CSI != nil && v.CSI.Driver == gcsfuseCSIDriverName {
+			counted = true
+
+			break
+		}
+	}
+
+	keys := []string{}
+	for _, k := range annotationKeys {
+		if _, ok := pod.Annotations[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+
+	return annotation, counted, keys
+}
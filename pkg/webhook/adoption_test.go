@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestPodAdoption(t *testing.T) {
+	t.Parallel()
+
+	gcsfuseVolume := corev1.Volume{
+		Name: "test-volume",
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{Driver: gcsfuseCSIDriverName},
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		annotations        map[string]string
+		volumes            []corev1.Volume
+		expectedAnnotation string
+		expectedCounted    bool
+		expectedKeys       []string
+	}{
+		{
+			name:               "no gcsfuse volumes",
+			volumes:            []corev1.Volume{{Name: "test-volume", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+			expectedAnnotation: "missing",
+			expectedKeys:       []string{},
+		},
+		{
+			name:               "gcsfuse volume without the annotation",
+			annotations:        map[string]string{AnnotationGcsfuseSidecarMemoryLimitKey: "1Gi", "other/annotation": "true"},
+			volumes:            []corev1.Volume{gcsfuseVolume},
+			expectedAnnotation: "missing",
+			expectedCounted:    true,
+			expectedKeys:       []string{AnnotationGcsfuseSidecarMemoryLimitKey},
+		},
+		{
+			name:               "gcsfuse volume with the annotation and limits",
+			annotations:        map[string]string{AnnotationGcsfuseVolumeEnableKey: "True", AnnotationGcsfuseSidecarCPULimitKey: "1", AnnotationGcsfuseSidecarEphemeralStorageLimitKey: "10Gi"},
+			volumes:            []corev1.Volume{gcsfuseVolume},
+			expectedAnnotation: "true",
+			expectedCounted:    true,
+			expectedKeys:       []string{AnnotationGcsfuseVolumeEnableKey, AnnotationGcsfuseSidecarCPULimitKey, AnnotationGcsfuseSidecarEphemeralStorageLimitKey},
+		},
+		{
+			name:               "annotation without CSI ephemeral volumes",
+			annotations:        map[string]string{AnnotationGcsfuseVolumeEnableKey: "false"},
+			expectedAnnotation: "false",
+			expectedCounted:    true,
+			expectedKeys:       []string{AnnotationGcsfuseVolumeEnableKey},
+		},
+		{
+			name:               "invalid annotation value",
+			annotations:        map[string]string{AnnotationGcsfuseVolumeEnableKey: "yes"},
+			expectedAnnotation: "invalid",
+			expectedCounted:    true,
+			expectedKeys:       []string{AnnotationGcsfuseVolumeEnableKey},
+		},
+	}
+
+	for _, tc := range testCases {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+			Spec:       corev1.PodSpec{Volumes: tc.volumes},
+		}
+		annotation, counted, keys := podAdoption(pod)
+		if annotation != tc.expectedAnnotation || counted != tc.expectedCounted {
+			t.Errorf("test %q failed: got annotation %q and counted %v, expected %q and %v", tc.name, annotation, counted, tc.expectedAnnotation, tc.expectedCounted)
+		}
+		if !reflect.DeepEqual(keys, tc.expectedKeys) {
+			t.Errorf("test %q failed: got keys %v, expected %v", tc.name, keys, tc.expectedKeys)
+		}
+	}
+}
+
+func TestCountsAdoption(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		dryRun          *bool
+		containers      []corev1.Container
+		expectedCounted bool
+	}{
+		{
+			name:            "new Pod",
+			containers:      []corev1.Container{{Name: "workload"}},
+			expectedCounted: true,
+		},
+		{
+			name:            "new Pod of a request that is not a dry run",
+			dryRun:          pointer.Bool(false),
+			containers:      []corev1.Container{{Name: "workload"}},
+			expectedCounted: true,
+		},
+		{
+			name:       "dry-run request",
+			dryRun:     pointer.Bool(true),
+			containers: []corev1.Container{{Name: "workload"}},
+		},
+		{
+			name:       "reinvocation after the sidecar container was injected",
+			containers: []corev1.Container{{Name: SidecarContainerName}, {Name: "workload"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{DryRun: tc.dryRun}}
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: tc.containers}}
+		if counted := countsAdoption(req, pod); counted != tc.expectedCounted {
+			t.Errorf("test %q failed: got counted %v, expected %v", tc.name, counted, tc.expectedCounted)
+		}
+	}
+}
@@ -19,7 +19,10 @@ package webhook
 
 import (
 	"fmt"
+	"hash/fnv"
 
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
@@ -29,6 +32,14 @@ type Config struct {
 	CPULimit              resource.Quantity
 	MemoryLimit           resource.Quantity
 	EphemeralStorageLimit resource.Quantity
+	// CanaryContainerImage is injected instead of ContainerImage into CanaryPercentage percent of the new Pods.
+	CanaryContainerImage string
+	CanaryPercentage     int
+	// The limit percents scale the sidecar container limits to a percentage of the workload containers limits.
+	// The fixed limits above are the minimum. Zero disables the scaling of the resource.
+	CPULimitPercent              int
+	MemoryLimitPercent           int
+	EphemeralStorageLimitPercent int
 }
 
 func LoadConfig(containerImage, imagePullPolicy, cpuLimit, memoryLimit, ephemeralStorageLimit string) (*Config, error) {
@@ -55,6 +66,159 @@ func LoadConfig(containerImage, imagePullPolicy, cpuLimit, memoryLimit, ephemera
 	return cfg, nil
 }
 
+// SetCanary sets the canary sidecar image and the percentage of the new Pods it is injected into.
+func (c *Config) SetCanary(image string, percentage int) error {
+	if percentage < 0 || percentage > 100 {
+		return fmt.Errorf("canary percentage %d is not between 0 and 100", percentage)
+	}
+	if image == "" && percentage > 0 {
+		return fmt.Errorf("canary percentage %d is set without a canary image", percentage)
+	}
+	c.CanaryContainerImage = image
+	c.CanaryPercentage = percentage
+
+	return nil
+}
+
+// SetLimitPercents sets the percentages of the workload containers limits used as the sidecar container limits.
+func (c *Config) SetLimitPercents(cpu, memory, ephemeralStorage int) error {
+	for _, p := range []struct {
+		name    string
+		percent int
+	}{
+		{"CPU", cpu},
+		{"memory", memory},
+		{"ephemeral storage", ephemeralStorage},
+	} {
+		if p.percent < 0 || p.percent > 100 {
+			return fmt.Errorf("%s limit percent %d is not between 0 and 100", p.name, p.percent)
+		}
+	}
+	c.CPULimitPercent = cpu
+	c.MemoryLimitPercent = memory
+	c.EphemeralStorageLimitPercent = ephemeralStorage
+
+	return nil
+}
+
+// ScaleToPod raises the sidecar container limits to the limit percents of the total limits of the Pod containers,
+// so that large workloads get a sidecar container sized for their I/O. The fixed limits are kept as the minimum.
+func (c *Config) ScaleToPod(pod *corev1.Pod) {
+	for _, s := range []struct {
+		name    corev1.ResourceName
+		percent int
+		q       *resource.Quantity
+	}{
+		{corev1.ResourceCPU, c.CPULimitPercent, &c.CPULimit},
+		{corev1.ResourceMemory, c.MemoryLimitPercent, &c.MemoryLimit},
+		{corev1.ResourceEphemeralStorage, c.EphemeralStorageLimitPercent, &c.EphemeralStorageLimit},
+	} {
+		if s.percent <= 0 {
+			continue
+		}
+
+		total := podContainersLimit(pod, s.name)
+		var scaled *resource.Quantity
+		if s.name == corev1.ResourceCPU {
+			scaled = resource.NewMilliQuantity(total.MilliValue()*int64(s.percent)/100, resource.DecimalSI)
+		} else {
+			scaled = resource.NewQuantity(total.Value()*int64(s.percent)/100, resource.BinarySI)
+		}
+
+		if scaled.Cmp(*s.q) > 0 {
+			*s.q = *scaled
+		}
+	}
+}
+
+// podContainersLimit returns the sum of the resource limits of the Pod containers.
+// The request is used for the containers without a limit.
+func podContainersLimit(pod *corev1.Pod, name corev1.ResourceName) resource.Quantity {
+	total := resource.Quantity{}
+	for _, c := range pod.Spec.Containers {
+		if q, ok := c.Resources.Limits[name]; ok {
+			total.Add(q)
+		} else if q, ok := c.Resources.Requests[name]; ok {
+			total.Add(q)
+		}
+	}
+
+	return total
+}
+
+// IsCanary returns true if the Pod with the key, e.g. the Pod UID, gets the canary sidecar image.
+// The same key always gets the same image for the same percentage.
+func (c *Config) IsCanary(key string) bool {
+	if c.CanaryContainerImage == "" || c.CanaryPercentage <= 0 {
+		return false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return h.Sum32()%100 < uint32(c.CanaryPercentage)
+}
+
+// WithSidecarSpec returns a copy of the config overridden by the non-empty fields of the cluster driver config.
+func (c *Config) WithSidecarSpec(s *driverconfig.SidecarSpec) (*Config, error) {
+	cfg := &Config{
+		ContainerImage:        c.ContainerImage,
+		ImagePullPolicy:       c.ImagePullPolicy,
+		CPULimit:              c.CPULimit.DeepCopy(),
+		MemoryLimit:           c.MemoryLimit.DeepCopy(),
+		EphemeralStorageLimit: c.EphemeralStorageLimit.DeepCopy(),
+		CanaryContainerImage:  c.CanaryContainerImage,
+		CanaryPercentage:      c.CanaryPercentage,
+
+		CPULimitPercent:              c.CPULimitPercent,
+		MemoryLimitPercent:           c.MemoryLimitPercent,
+		EphemeralStorageLimitPercent: c.EphemeralStorageLimitPercent,
+	}
+	if s == nil {
+		return cfg, nil
+	}
+
+	if s.Image != "" {
+		cfg.ContainerImage = s.Image
+	}
+	if s.ImagePullPolicy != "" {
+		cfg.ImagePullPolicy = s.ImagePullPolicy
+	}
+	if s.CanaryImage != "" || s.CanaryPercentage != nil {
+		image, percentage := cfg.CanaryContainerImage, cfg.CanaryPercentage
+		if s.CanaryImage != "" {
+			image = s.CanaryImage
+		}
+		if s.CanaryPercentage != nil {
+			percentage = int(*s.CanaryPercentage)
+		}
+		if err := cfg.SetCanary(image, percentage); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, l := range []struct {
+		name  string
+		value string
+		q     *resource.Quantity
+	}{
+		{"CPU limit", s.CPULimit, &cfg.CPULimit},
+		{"memory limit", s.MemoryLimit, &cfg.MemoryLimit},
+		{"ephemeral storage limit", s.EphemeralStorageLimit, &cfg.EphemeralStorageLimit},
+	} {
+		if l.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(l.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %q: %w", l.name, l.value, err)
+		}
+		*l.q = q
+	}
+
+	return cfg, nil
+}
+
 func FakeConfig() *Config {
 	c, _ := LoadConfig("fake-sidecar-image", "Always", "100m", "30Mi", "5Gi")
 
@@ -0,0 +1,175 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"testing"
+
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSetCanary(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name       string
+		image      string
+		percentage int
+		expectErr  bool
+	}{
+		{name: "no canary"},
+		{name: "valid canary", image: "canary-image", percentage: 10},
+		{name: "percentage above 100", image: "canary-image", percentage: 101, expectErr: true},
+		{name: "negative percentage", image: "canary-image", percentage: -1, expectErr: true},
+		{name: "percentage without image", percentage: 10, expectErr: true},
+	}
+
+	for _, tc := range cases {
+		err := FakeConfig().SetCanary(tc.image, tc.percentage)
+		if tc.expectErr != (err != nil) {
+			t.Errorf("%v: got error %v, expected error %v", tc.name, err, tc.expectErr)
+		}
+	}
+}
+
+func TestIsCanary(t *testing.T) {
+	t.Parallel()
+	for _, percentage := range []int{0, 10, 50, 100} {
+		c := FakeConfig()
+		if err := c.SetCanary("canary-image", percentage); err != nil {
+			t.Fatalf("failed to set canary: %v", err)
+		}
+
+		canaries := 0
+		for i := 0; i < 10000; i++ {
+			key := fmt.Sprintf("pod-uid-%d", i)
+			canary := c.IsCanary(key)
+			if canary != c.IsCanary(key) {
+				t.Fatalf("got different canary decisions for the same key %q", key)
+			}
+			if canary {
+				canaries++
+			}
+		}
+
+		// Allow 2% deviation from the expected percentage.
+		if diff := canaries/100 - percentage; diff < -2 || diff > 2 {
+			t.Errorf("got %d canaries out of 10000 for percentage %d", canaries, percentage)
+		}
+	}
+}
+
+func TestWithSidecarSpecCanary(t *testing.T) {
+	t.Parallel()
+	c := FakeConfig()
+	if err := c.SetCanary("canary-image", 10); err != nil {
+		t.Fatalf("failed to set canary: %v", err)
+	}
+
+	zero := int32(0)
+	cfg, err := c.WithSidecarSpec(&driverconfig.SidecarSpec{CanaryPercentage: &zero})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CanaryContainerImage != "canary-image" || cfg.CanaryPercentage != 0 {
+		t.Errorf("got canary %q %d, expected the driver config percentage to stop the canary", cfg.CanaryContainerImage, cfg.CanaryPercentage)
+	}
+
+	invalid := int32(200)
+	if _, err := c.WithSidecarSpec(&driverconfig.SidecarSpec{CanaryPercentage: &invalid}); err == nil {
+		t.Error("expected error for an invalid canary percentage")
+	}
+}
+
+func TestScaleToPod(t *testing.T) {
+	t.Parallel()
+	container := func(limits, requests corev1.ResourceList) corev1.Container {
+		return corev1.Container{Resources: corev1.ResourceRequirements{Limits: limits, Requests: requests}}
+	}
+	largePod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				container(corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("8"), corev1.ResourceMemory: resource.MustParse("32Gi")}, nil),
+				container(nil, corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("8Gi")}),
+			},
+		},
+	}
+
+	cases := []struct {
+		name              string
+		pod               *corev1.Pod
+		cpuPercent        int
+		memoryPercent     int
+		expectedCPU       string
+		expectedMemory    string
+		expectedEphemeral string
+	}{
+		{
+			name:              "scaling disabled",
+			pod:               largePod,
+			expectedCPU:       "100m",
+			expectedMemory:    "30Mi",
+			expectedEphemeral: "5Gi",
+		},
+		{
+			name:              "limits scaled to the pod",
+			pod:               largePod,
+			cpuPercent:        10,
+			memoryPercent:     5,
+			expectedCPU:       "1",
+			expectedMemory:    "2Gi",
+			expectedEphemeral: "5Gi",
+		},
+		{
+			name:              "fixed limits kept as the minimum",
+			pod:               &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{container(corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}, nil)}}},
+			cpuPercent:        10,
+			memoryPercent:     10,
+			expectedCPU:       "100m",
+			expectedMemory:    "30Mi",
+			expectedEphemeral: "5Gi",
+		},
+	}
+
+	for _, tc := range cases {
+		c := FakeConfig()
+		if err := c.SetLimitPercents(tc.cpuPercent, tc.memoryPercent, 0); err != nil {
+			t.Fatalf("%v: failed to set the limit percents: %v", tc.name, err)
+		}
+		c.ScaleToPod(tc.pod)
+
+		for _, r := range []struct {
+			got      resource.Quantity
+			expected string
+		}{
+			{c.CPULimit, tc.expectedCPU},
+			{c.MemoryLimit, tc.expectedMemory},
+			{c.EphemeralStorageLimit, tc.expectedEphemeral},
+		} {
+			if r.got.Cmp(resource.MustParse(r.expected)) != 0 {
+				t.Errorf("%v: got limit %v, expected %v", tc.name, r.got.String(), r.expected)
+			}
+		}
+	}
+
+	if err := FakeConfig().SetLimitPercents(101, 0, 0); err == nil {
+		t.Error("expected error for a limit percent above 100")
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"net/http"
 	"strings"
 
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/metrics"
 	v1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -33,16 +35,18 @@ import (
 )
 
 const (
-	AnnotationGcsfuseVolumeEnableKey                  = "gke-gcsfuse/volumes"
-	annotationGcsfuseSidecarCPULimitKey               = "gke-gcsfuse/cpu-limit"
-	annotationGcsfuseSidecarMemoryLimitKey            = "gke-gcsfuse/memory-limit"
-	annotationGcsfuseSidecarEphermeralStorageLimitKey = "gke-gcsfuse/ephemeral-storage-limit"
+	AnnotationGcsfuseVolumeEnableKey                 = "gke-gcsfuse/volumes"
+	AnnotationGcsfuseSidecarCPULimitKey              = "gke-gcsfuse/cpu-limit"
+	AnnotationGcsfuseSidecarMemoryLimitKey           = "gke-gcsfuse/memory-limit"
+	AnnotationGcsfuseSidecarEphemeralStorageLimitKey = "gke-gcsfuse/ephemeral-storage-limit"
 )
 
 type SidecarInjector struct {
 	Client  client.Client
 	Config  *Config
 	Decoder *admission.Decoder
+	// DriverConfig overrides the sidecar container settings of Config if the cluster driver config is set.
+	DriverConfig *driverconfig.Watcher
 }
 
 // Handle injects a gcsfuse sidecar container and a emptyDir to incoming qualified pods.
@@ -50,7 +54,7 @@ func (si *SidecarInjector) Handle(_ context.Context, req admission.Request) admi
 	pod := &corev1.Pod{}
 
 	if err := si.Decoder.Decode(req, pod); err != nil {
-		klog.Error("Could not decode request: name %q, namespace %q, error: ", req.Name, req.Namespace, err)
+		klog.ErrorS(err, "could not decode request", "pod", klog.KRef(req.Namespace, req.Name))
 
 		return admission.Errored(http.StatusBadRequest, err)
 	}
@@ -59,6 +63,9 @@ func (si *SidecarInjector) Handle(_ context.Context, req admission.Request) admi
 		return admission.Allowed(fmt.Sprintf("No injection required for operation %v.", req.Operation))
 	}
 
+	// The annotations are counted before the namespace defaults are applied, so that only the annotations set by the users are counted.
+	recordAdoption(req, pod)
+
 	if v, ok := pod.Annotations[AnnotationGcsfuseVolumeEnableKey]; !ok || strings.ToLower(v) != "true" {
 		return admission.Allowed(fmt.Sprintf("The annotation key %q is not found, no injection required.", AnnotationGcsfuseVolumeEnableKey))
 	}
@@ -72,49 +79,128 @@ func (si *SidecarInjector) Handle(_ context.Context, req admission.Request) admi
 		return admission.Errored(http.StatusBadRequest, fmt.Errorf("the acceptable values for %q are 'True', 'true', 'false' or 'False'", AnnotationGcsfuseVolumeEnableKey))
 	}
 
-	if ValidatePodHasSidecarContainerInjected(si.Config.ContainerImage, pod) {
-		return admission.Allowed("The sidecar container was injected, no injection required.")
+	if os := getPodOS(pod); os != "" && os != string(corev1.Linux) {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("unsupported operating system %q: the Cloud Storage FUSE CSI driver and the sidecar container only support Linux nodes", os))
+	}
+
+	var sidecarSpec *driverconfig.SidecarSpec
+	if spec := si.DriverConfig.Get(); spec != nil {
+		sidecarSpec = &spec.Sidecar
+		applyNamespaceDefaults(pod, spec.NamespaceDefaultsOf(req.Namespace))
+	}
+	configCopy, err := si.Config.WithSidecarSpec(sidecarSpec)
+	if err != nil {
+		klog.ErrorS(err, "invalid sidecar container settings in the driver config, using the webhook flags")
+		configCopy, _ = si.Config.WithSidecarSpec(nil)
+	}
+
+	if ValidatePodHasSidecarContainerInjected(configCopy.ContainerImage, pod) ||
+		(configCopy.CanaryContainerImage != "" && ValidatePodHasSidecarContainerInjected(configCopy.CanaryContainerImage, pod)) {
+		return handleReinvocation(req, pod, configCopy)
+	}
+
+	// The Pod UID is usually not assigned yet during the admission, so the admission request UID is used instead.
+	track := metrics.SidecarTrackStable
+	canaryKey := string(pod.UID)
+	if canaryKey == "" {
+		canaryKey = string(req.UID)
+	}
+	if configCopy.IsCanary(canaryKey) {
+		configCopy.ContainerImage = configCopy.CanaryContainerImage
+		track = metrics.SidecarTrackCanary
+	}
+
+	stagingSize, warnings, err := sizeSidecarContainer(pod, configCopy)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	configCopy := &Config{
-		ContainerImage:        si.Config.ContainerImage,
-		ImagePullPolicy:       si.Config.ImagePullPolicy,
-		CPULimit:              si.Config.CPULimit.DeepCopy(),
-		MemoryLimit:           si.Config.MemoryLimit.DeepCopy(),
-		EphemeralStorageLimit: si.Config.EphemeralStorageLimit.DeepCopy(),
+	klog.InfoS("mutating Pod", "pod", klog.KRef(req.Namespace, pod.Name), "generateName", pod.GenerateName,
+		"image", configCopy.ContainerImage, "track", track, "cpuLimit", configCopy.CPULimit.String(), "memoryLimit", configCopy.MemoryLimit.String(), "ephemeralStorageLimit", configCopy.EphemeralStorageLimit.String())
+	// the gcsfuse sidecar container has to before the containers that consume the gcsfuse volume
+	sidecar := GetSidecarContainerSpec(configCopy)
+	sidecar.SecurityContext.SELinuxOptions = sidecarSELinuxOptions(pod)
+	pod.Spec.Containers = append([]corev1.Container{sidecar}, pod.Spec.Containers...)
+	sidecarVolume := GetSidecarContainerVolumeSpec()
+	sidecarVolume.EmptyDir.SizeLimit = stagingVolumeSizeLimit(stagingSize, configCopy)
+	pod.Spec.Volumes = append([]corev1.Volume{sidecarVolume}, pod.Spec.Volumes...)
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to marshal pod: %w", err))
 	}
-	if v, ok := pod.Annotations[annotationGcsfuseSidecarCPULimitKey]; ok {
+	metrics.SidecarInjectionTotal.WithLabelValues(configCopy.ContainerImage, track).Inc()
+
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	resp.Warnings = warnings
+
+	return resp
+}
+
+// sizeSidecarContainer sets the sidecar container limits of the config for the Pod,
+// and returns the staging space of the gcsfuse volumes and the warnings of the limits set by the Pod annotations.
+func sizeSidecarContainer(pod *corev1.Pod, c *Config) (resource.Quantity, []string, error) {
+	// Scale the default limits to the workload before the Pod annotations override them.
+	c.ScaleToPod(pod)
+
+	// The emptyDir usage counts towards the sidecar container ephemeral-storage limit, so the limit must fit the staged files.
+	stagingSize, err := podStagingSize(pod)
+	if err != nil {
+		return resource.Quantity{}, nil, err
+	}
+	if stagingSize.Cmp(c.EphemeralStorageLimit) > 0 {
+		c.EphemeralStorageLimit = stagingSize
+	}
+
+	// The parallel downloads hold the downloaded chunks in memory on top of the gcsfuse baseline usage.
+	downloadMemory, err := podDownloadMemory(pod)
+	if err != nil {
+		return resource.Quantity{}, nil, err
+	}
+	c.MemoryLimit.Add(downloadMemory)
+
+	if v, ok := pod.Annotations[AnnotationGcsfuseSidecarCPULimitKey]; ok {
 		if q, err := resource.ParseQuantity(v); err == nil {
-			configCopy.CPULimit = q
+			c.CPULimit = q
 		} else {
-			return admission.Errored(http.StatusBadRequest, fmt.Errorf("bad value %q for %q: %w", v, annotationGcsfuseSidecarCPULimitKey, err))
+			return resource.Quantity{}, nil, fmt.Errorf("bad value %q for %q: %w", v, AnnotationGcsfuseSidecarCPULimitKey, err)
 		}
 	}
 
-	if v, ok := pod.Annotations[annotationGcsfuseSidecarMemoryLimitKey]; ok {
+	if v, ok := pod.Annotations[AnnotationGcsfuseSidecarMemoryLimitKey]; ok {
 		if q, err := resource.ParseQuantity(v); err == nil {
-			configCopy.MemoryLimit = q
+			c.MemoryLimit = q
 		} else {
-			return admission.Errored(http.StatusBadRequest, fmt.Errorf("bad value %q for %q: %w", v, annotationGcsfuseSidecarMemoryLimitKey, err))
+			return resource.Quantity{}, nil, fmt.Errorf("bad value %q for %q: %w", v, AnnotationGcsfuseSidecarMemoryLimitKey, err)
 		}
 	}
 
-	if v, ok := pod.Annotations[annotationGcsfuseSidecarEphermeralStorageLimitKey]; ok {
+	if v, ok := pod.Annotations[AnnotationGcsfuseSidecarEphemeralStorageLimitKey]; ok {
 		if q, err := resource.ParseQuantity(v); err == nil {
-			configCopy.EphemeralStorageLimit = q
+			c.EphemeralStorageLimit = q
 		} else {
-			return admission.Errored(http.StatusBadRequest, fmt.Errorf("bad value %q for %q: %w", v, annotationGcsfuseSidecarEphermeralStorageLimitKey, err))
+			return resource.Quantity{}, nil, fmt.Errorf("bad value %q for %q: %w", v, AnnotationGcsfuseSidecarEphemeralStorageLimitKey, err)
 		}
 	}
 
-	klog.Infof("mutating Pod: Name %q, GenerateName %q, Namespace %q, CPU limit %q, memory limit %q, ephemeral storage limit %q", pod.Name, pod.GenerateName, pod.Namespace, configCopy.CPULimit.String(), configCopy.MemoryLimit.String(), configCopy.EphemeralStorageLimit.String())
-	// the gcsfuse sidecar container has to before the containers that consume the gcsfuse volume
-	pod.Spec.Containers = append([]corev1.Container{GetSidecarContainerSpec(configCopy)}, pod.Spec.Containers...)
-	pod.Spec.Volumes = append([]corev1.Volume{GetSidecarContainerVolumeSpec()}, pod.Spec.Volumes...)
-	marshaledPod, err := json.Marshal(pod)
-	if err != nil {
-		return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to marshal pod: %w", err))
+	warnings := []string{}
+	if stagingSize.Cmp(c.EphemeralStorageLimit) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the gcsfuse sidecar container ephemeral-storage limit %v set by the annotation %q is lower than the %v staging space required by the volume attributes %q and %q, the Pod may be evicted when writing large files",
+			c.EphemeralStorageLimit.String(), AnnotationGcsfuseSidecarEphemeralStorageLimitKey, stagingSize.String(), VolumeAttributeTmpVolumeSize, VolumeAttributeExpectedMaxWriteSize))
+	}
+	if downloadMemory.Cmp(c.MemoryLimit) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the gcsfuse sidecar container memory limit %v set by the annotation %q is lower than the %v used by the parallel downloads of the volume attributes %q and %q, the sidecar container may be OOM killed",
+			c.MemoryLimit.String(), AnnotationGcsfuseSidecarMemoryLimitKey, downloadMemory.String(), VolumeAttributeDownloadChunkSizeMb, VolumeAttributeMaxParallelDownloads))
+	}
+
+	return stagingSize, warnings, nil
+}
+
+// getPodOS returns the operating system the Pod is restricted to by the spec.os field or the node selector,
+// or an empty string if the Pod is not restricted to any operating system.
+func getPodOS(pod *corev1.Pod) string {
+	if pod.Spec.OS != nil {
+		return string(pod.Spec.OS.Name)
 	}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	return pod.Spec.NodeSelector[corev1.LabelOSStable]
 }
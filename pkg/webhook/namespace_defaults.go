@@ -0,0 +1,53 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// namespaceDefaultAnnotations are the Pod annotations that the namespace defaults of the driver config can set.
+var namespaceDefaultAnnotations = map[string]bool{
+	AnnotationGcsfuseSidecarCPULimitKey:              true,
+	AnnotationGcsfuseSidecarMemoryLimitKey:           true,
+	AnnotationGcsfuseSidecarEphemeralStorageLimitKey: true,
+}
+
+// applyNamespaceDefaults adds the default annotations of the namespace that the Pod does not set.
+// The annotations are added to the Pod, so that the applied defaults are visible on the created Pod.
+func applyNamespaceDefaults(pod *corev1.Pod, defaults *driverconfig.NamespaceDefaults) {
+	if defaults == nil {
+		return
+	}
+
+	for k, v := range defaults.Annotations {
+		if !namespaceDefaultAnnotations[k] {
+			klog.Warningf("ignoring the namespace default annotation %q, only the sidecar container resource annotations are supported", k)
+
+			continue
+		}
+		if _, ok := pod.Annotations[k]; ok {
+			continue
+		}
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[k] = v
+	}
+}
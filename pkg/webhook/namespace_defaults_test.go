@@ -0,0 +1,80 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyNamespaceDefaults(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		annotations         map[string]string
+		defaults            *driverconfig.NamespaceDefaults
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "no namespace defaults",
+			annotations:         map[string]string{AnnotationGcsfuseVolumeEnableKey: "true"},
+			expectedAnnotations: map[string]string{AnnotationGcsfuseVolumeEnableKey: "true"},
+		},
+		{
+			name:        "namespace defaults are added",
+			annotations: map[string]string{AnnotationGcsfuseVolumeEnableKey: "true"},
+			defaults: &driverconfig.NamespaceDefaults{Annotations: map[string]string{
+				AnnotationGcsfuseSidecarMemoryLimitKey: "1Gi",
+				AnnotationGcsfuseSidecarCPULimitKey:    "500m",
+			}},
+			expectedAnnotations: map[string]string{
+				AnnotationGcsfuseVolumeEnableKey:       "true",
+				AnnotationGcsfuseSidecarMemoryLimitKey: "1Gi",
+				AnnotationGcsfuseSidecarCPULimitKey:    "500m",
+			},
+		},
+		{
+			name:        "Pod annotations take precedence",
+			annotations: map[string]string{AnnotationGcsfuseVolumeEnableKey: "true", AnnotationGcsfuseSidecarMemoryLimitKey: "2Gi"},
+			defaults:    &driverconfig.NamespaceDefaults{Annotations: map[string]string{AnnotationGcsfuseSidecarMemoryLimitKey: "1Gi"}},
+			expectedAnnotations: map[string]string{
+				AnnotationGcsfuseVolumeEnableKey:       "true",
+				AnnotationGcsfuseSidecarMemoryLimitKey: "2Gi",
+			},
+		},
+		{
+			name:                "unsupported annotations are ignored",
+			annotations:         map[string]string{AnnotationGcsfuseVolumeEnableKey: "true"},
+			defaults:            &driverconfig.NamespaceDefaults{Annotations: map[string]string{AnnotationGcsfuseVolumeEnableKey: "false", "foo": "bar"}},
+			expectedAnnotations: map[string]string{AnnotationGcsfuseVolumeEnableKey: "true"},
+		},
+	}
+
+	for _, tc := range testCases {
+		pod := &corev1.Pod{}
+		pod.Annotations = tc.annotations
+		applyNamespaceDefaults(pod, tc.defaults)
+
+		if !reflect.DeepEqual(pod.Annotations, tc.expectedAnnotations) {
+			t.Errorf("test %q failed: got annotations %v, expected %v", tc.name, pod.Annotations, tc.expectedAnnotations)
+		}
+	}
+}
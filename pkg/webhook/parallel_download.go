@@ -0,0 +1,125 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Volume attributes enabling the gcsfuse parallel downloads of large objects into the file cache,
+// e.g. to reduce the model loading latency of LLM serving workloads.
+const (
+	// VolumeAttributeDownloadChunkSizeMb is the size in MiB of the object range fetched by each download request.
+	VolumeAttributeDownloadChunkSizeMb = "downloadChunkSizeMb"
+	// VolumeAttributeMaxParallelDownloads is the maximum number of download requests in flight across the volume.
+	VolumeAttributeMaxParallelDownloads = "maxParallelDownloads"
+
+	// The gcsfuse defaults used when only one of the attributes is set.
+	defaultDownloadChunkSizeMb  = 50
+	defaultMaxParallelDownloads = 16
+
+	maxDownloadChunkSizeMb  = 1024
+	maxMaxParallelDownloads = 256
+)
+
+// ParallelDownloadMountOptions returns the gcsfuse mount options of the parallel download volume attributes,
+// or nil if neither attribute is set.
+func ParallelDownloadMountOptions(attributes map[string]string) ([]string, error) {
+	chunkSizeMb, parallelDownloads, err := parallelDownloadSettings(attributes)
+	if err != nil || chunkSizeMb == 0 {
+		return nil, err
+	}
+
+	return []string{
+		"file-cache-enable-parallel-downloads",
+		fmt.Sprintf("file-cache-download-chunk-size-mb=%d", chunkSizeMb),
+		fmt.Sprintf("file-cache-max-parallel-downloads=%d", parallelDownloads),
+	}, nil
+}
+
+// volumeDownloadMemory returns the memory used by the chunks of the parallel downloads of a volume with the given attributes,
+// or zero if the parallel downloads are not enabled.
+func volumeDownloadMemory(attributes map[string]string) (resource.Quantity, error) {
+	chunkSizeMb, parallelDownloads, err := parallelDownloadSettings(attributes)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+
+	return *resource.NewQuantity(int64(chunkSizeMb)*int64(parallelDownloads)*1024*1024, resource.BinarySI), nil
+}
+
+// podDownloadMemory returns the sum of the memory used by the parallel downloads of the gcsfuse CSI ephemeral volumes of the Pod.
+// The attributes of the PersistentVolumes are not visible at the Pod admission.
+func podDownloadMemory(pod *corev1.Pod) (resource.Quantity, error) {
+	total := resource.Quantity{}
+	for _, v := range pod.Spec.Volumes {
+		if v.CSI == nil || v.CSI.Driver != gcsfuseCSIDriverName {
+			continue
+		}
+
+		q, err := volumeDownloadMemory(v.CSI.VolumeAttributes)
+		if err != nil {
+			return resource.Quantity{}, fmt.Errorf("volume %q: %w", v.Name, err)
+		}
+		total.Add(q)
+	}
+
+	return total, nil
+}
+
+// parallelDownloadSettings returns the validated chunk size and number of parallel downloads,
+// or zeros if neither attribute is set.
+func parallelDownloadSettings(attributes map[string]string) (int, int, error) {
+	chunkSizeMb, chunkSizeSet, err := intAttribute(attributes, VolumeAttributeDownloadChunkSizeMb, maxDownloadChunkSizeMb)
+	if err != nil {
+		return 0, 0, err
+	}
+	parallelDownloads, parallelDownloadsSet, err := intAttribute(attributes, VolumeAttributeMaxParallelDownloads, maxMaxParallelDownloads)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !chunkSizeSet && !parallelDownloadsSet {
+		return 0, 0, nil
+	}
+	if !chunkSizeSet {
+		chunkSizeMb = defaultDownloadChunkSizeMb
+	}
+	if !parallelDownloadsSet {
+		parallelDownloads = defaultMaxParallelDownloads
+	}
+
+	return chunkSizeMb, parallelDownloads, nil
+}
+
+func intAttribute(attributes map[string]string, key string, maxValue int) (int, bool, error) {
+	v, ok := attributes[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 || i > maxValue {
+		return 0, false, fmt.Errorf("volume attribute %q must be an integer between 1 and %d, got %q", key, maxValue, v)
+	}
+
+	return i, true, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParallelDownloadMountOptions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		attributes      map[string]string
+		expectedOptions []string
+		expectErr       bool
+	}{
+		{
+			name:       "no parallel download attributes",
+			attributes: map[string]string{"bucketName": "test-bucket"},
+		},
+		{
+			name:       "both attributes",
+			attributes: map[string]string{VolumeAttributeDownloadChunkSizeMb: "200", VolumeAttributeMaxParallelDownloads: "32"},
+			expectedOptions: []string{
+				"file-cache-enable-parallel-downloads",
+				"file-cache-download-chunk-size-mb=200",
+				"file-cache-max-parallel-downloads=32",
+			},
+		},
+		{
+			name:       "default chunk size",
+			attributes: map[string]string{VolumeAttributeMaxParallelDownloads: "32"},
+			expectedOptions: []string{
+				"file-cache-enable-parallel-downloads",
+				"file-cache-download-chunk-size-mb=50",
+				"file-cache-max-parallel-downloads=32",
+			},
+		},
+		{
+			name:       "invalid chunk size",
+			attributes: map[string]string{VolumeAttributeDownloadChunkSizeMb: "200Mi"},
+			expectErr:  true,
+		},
+		{
+			name:       "too many parallel downloads",
+			attributes: map[string]string{VolumeAttributeMaxParallelDownloads: "1000"},
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		options, err := ParallelDownloadMountOptions(tc.attributes)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("test %q failed: got error %v, expected error %v", tc.name, err, tc.expectErr)
+		}
+		if !reflect.DeepEqual(options, tc.expectedOptions) {
+			t.Errorf("test %q failed: got options %v, expected %v", tc.name, options, tc.expectedOptions)
+		}
+	}
+}
+
+func TestPodDownloadMemory(t *testing.T) {
+	t.Parallel()
+
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+		{
+			Name: "model",
+			VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+				Driver:           gcsfuseCSIDriverName,
+				VolumeAttributes: map[string]string{VolumeAttributeDownloadChunkSizeMb: "100", VolumeAttributeMaxParallelDownloads: "8"},
+			}},
+		},
+		{
+			Name: "dataset",
+			VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{
+				Driver:           gcsfuseCSIDriverName,
+				VolumeAttributes: map[string]string{"bucketName": "test-bucket"},
+			}},
+		},
+	}}}
+
+	got, err := podDownloadMemory(pod)
+	if err != nil {
+		t.Fatalf("failed to get the download memory: %v", err)
+	}
+	if expected := resource.MustParse("800Mi"); got.Cmp(expected) != 0 {
+		t.Errorf("got %v, expected %v", got.String(), expected.String())
+	}
+}
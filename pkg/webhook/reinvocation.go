@@ -0,0 +1,103 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// handleReinvocation raises the resources of the injected sidecar container to fit the gcsfuse volumes of the Pod.
+// With the reinvocationPolicy IfNeeded, the webhook is called again when the webhooks ordered after it change the Pod,
+// e.g. the admission-time generators of pipeline Pods that add the volumes after the sidecar container is injected.
+func handleReinvocation(req admission.Request, pod *corev1.Pod, c *Config) admission.Response {
+	workload := pod.DeepCopy()
+	workload.Spec.Containers = []corev1.Container{}
+	for _, container := range pod.Spec.Containers {
+		if container.Name != SidecarContainerName {
+			workload.Spec.Containers = append(workload.Spec.Containers, container)
+		}
+	}
+
+	stagingSize, warnings, err := sizeSidecarContainer(workload, c)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if !raiseSidecarResources(pod, c, stagingSize) {
+		return admission.Allowed("The sidecar container was injected, no injection required.")
+	}
+
+	klog.InfoS("resizing the sidecar container of Pod", "pod", klog.KRef(req.Namespace, pod.Name), "generateName", pod.GenerateName,
+		"cpuLimit", c.CPULimit.String(), "memoryLimit", c.MemoryLimit.String(), "ephemeralStorageLimit", c.EphemeralStorageLimit.String())
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to marshal pod: %w", err))
+	}
+
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	resp.Warnings = warnings
+
+	return resp
+}
+
+// raiseSidecarResources raises the resources of the sidecar container, and the size limit of its emptyDir,
+// to the limits of the config and the staging space of the volumes. The resources are never lowered, and the unlimited resources are kept.
+// It returns true if the Pod was changed.
+func raiseSidecarResources(pod *corev1.Pod, c *Config, stagingSize resource.Quantity) bool {
+	changed := false
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if container.Name != SidecarContainerName {
+			continue
+		}
+
+		for name, q := range map[corev1.ResourceName]resource.Quantity{
+			corev1.ResourceCPU:              c.CPULimit,
+			corev1.ResourceMemory:           c.MemoryLimit,
+			corev1.ResourceEphemeralStorage: c.EphemeralStorageLimit,
+		} {
+			if limit, ok := container.Resources.Limits[name]; ok && q.Cmp(limit) > 0 {
+				if container.Resources.Requests == nil {
+					container.Resources.Requests = corev1.ResourceList{}
+				}
+				container.Resources.Limits[name] = q
+				container.Resources.Requests[name] = q
+				changed = true
+			}
+		}
+	}
+
+	for i := range pod.Spec.Volumes {
+		v := &pod.Spec.Volumes[i]
+		if v.Name != SidecarContainerVolumeName || v.EmptyDir == nil || v.EmptyDir.SizeLimit == nil {
+			continue
+		}
+		if limit := stagingVolumeSizeLimit(stagingSize, c); limit != nil && limit.Cmp(*v.EmptyDir.SizeLimit) > 0 {
+			v.EmptyDir.SizeLimit = limit
+			changed = true
+		}
+	}
+
+	return changed
+}
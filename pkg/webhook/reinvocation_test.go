@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestHandleReinvocation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                   string
+		attributes             map[string]string
+		annotations            map[string]string
+		unlimitedMemory        bool
+		expectPatch            bool
+		expectWarning          bool
+		expectedMemory         string
+		expectedEphemeralLimit string
+		expectedSizeLimit      string
+	}{
+		{
+			name:                   "sidecar container fits the volumes",
+			attributes:             map[string]string{"bucketName": "test-bucket"},
+			expectedMemory:         "30Mi",
+			expectedEphemeralLimit: "5Gi",
+			expectedSizeLimit:      "1Gi",
+		},
+		{
+			name:                   "volume with staging space added",
+			attributes:             map[string]string{VolumeAttributeTmpVolumeSize: "10Gi"},
+			expectPatch:            true,
+			expectedMemory:         "30Mi",
+			expectedEphemeralLimit: "10Gi",
+			expectedSizeLimit:      "10Gi",
+		},
+		{
+			name:                   "volume with parallel downloads added",
+			attributes:             map[string]string{VolumeAttributeMaxParallelDownloads: "16"},
+			expectPatch:            true,
+			expectedMemory:         "830Mi",
+			expectedEphemeralLimit: "5Gi",
+			expectedSizeLimit:      "1Gi",
+		},
+		{
+			name:                   "annotation lower than the staging space",
+			attributes:             map[string]string{VolumeAttributeTmpVolumeSize: "10Gi"},
+			annotations:            map[string]string{AnnotationGcsfuseSidecarEphemeralStorageLimitKey: "2Gi"},
+			expectPatch:            true,
+			expectWarning:          true,
+			expectedMemory:         "30Mi",
+			expectedEphemeralLimit: "5Gi",
+			expectedSizeLimit:      "10Gi",
+		},
+		{
+			name:                   "unlimited sidecar container memory is kept",
+			attributes:             map[string]string{VolumeAttributeMaxParallelDownloads: "16"},
+			unlimitedMemory:        true,
+			expectedEphemeralLimit: "5Gi",
+			expectedSizeLimit:      "1Gi",
+		},
+	}
+
+	for _, tc := range testCases {
+		sidecar := GetSidecarContainerSpec(FakeConfig())
+		if tc.unlimitedMemory {
+			delete(sidecar.Resources.Limits, corev1.ResourceMemory)
+			delete(sidecar.Resources.Requests, corev1.ResourceMemory)
+		}
+		sidecarVolume := GetSidecarContainerVolumeSpec()
+		sizeLimit := resource.MustParse("1Gi")
+		sidecarVolume.EmptyDir.SizeLimit = &sizeLimit
+
+		pod := &corev1.Pod{}
+		pod.Annotations = tc.annotations
+		pod.Spec.Containers = []corev1.Container{sidecar, {Name: "workload"}}
+		pod.Spec.Volumes = []corev1.Volume{
+			sidecarVolume,
+			{
+				Name: "test-volume",
+				VolumeSource: corev1.VolumeSource{
+					CSI: &corev1.CSIVolumeSource{Driver: gcsfuseCSIDriverName, VolumeAttributes: tc.attributes},
+				},
+			},
+		}
+		raw, err := json.Marshal(pod)
+		if err != nil {
+			t.Fatalf("test %q failed: failed to marshal the Pod: %v", tc.name, err)
+		}
+		req := admission.Request{AdmissionRequest: v1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+
+		resp := handleReinvocation(req, pod, FakeConfig())
+		if !resp.Allowed {
+			t.Errorf("test %q failed: the Pod was not allowed: %v", tc.name, resp.Result)
+		}
+		if gotPatch := len(resp.Patches) > 0; gotPatch != tc.expectPatch {
+			t.Errorf("test %q failed: got patches %v, expected a patch %v", tc.name, resp.Patches, tc.expectPatch)
+		}
+		if gotWarning := len(resp.Warnings) > 0; gotWarning != tc.expectWarning {
+			t.Errorf("test %q failed: got warnings %v, expected a warning %v", tc.name, resp.Warnings, tc.expectWarning)
+		}
+
+		limits := pod.Spec.Containers[0].Resources.Limits
+		if q, ok := limits[corev1.ResourceMemory]; ok != (tc.expectedMemory != "") || (ok && q.Cmp(resource.MustParse(tc.expectedMemory)) != 0) {
+			t.Errorf("test %q failed: got memory limit %v, expected %q", tc.name, q.String(), tc.expectedMemory)
+		}
+		if q := limits[corev1.ResourceEphemeralStorage]; q.Cmp(resource.MustParse(tc.expectedEphemeralLimit)) != 0 {
+			t.Errorf("test %q failed: got ephemeral-storage limit %v, expected %v", tc.name, q.String(), tc.expectedEphemeralLimit)
+		}
+		if q := pod.Spec.Volumes[0].EmptyDir.SizeLimit; q.Cmp(resource.MustParse(tc.expectedSizeLimit)) != 0 {
+			t.Errorf("test %q failed: got emptyDir size limit %v, expected %v", tc.name, q.String(), tc.expectedSizeLimit)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sidecarSELinuxOptions returns the SELinux options of the containers of the Pod if they all set the same container-level options,
+// so that the sidecar container gets the same SELinux label as the workload containers.
+// The kubelet only mounts the volumes with the SELinux context mount option if all the containers of the Pod have the same label.
+// It returns nil if the Pod sets Pod-level SELinux options, which the sidecar container inherits.
+func sidecarSELinuxOptions(pod *corev1.Pod) *corev1.SELinuxOptions {
+	if pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.SELinuxOptions != nil {
+		return nil
+	}
+
+	var options *corev1.SELinuxOptions
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.SecurityContext == nil || container.SecurityContext.SELinuxOptions == nil {
+			return nil
+		}
+		if options != nil && !reflect.DeepEqual(options, container.SecurityContext.SELinuxOptions) {
+			return nil
+		}
+		options = container.SecurityContext.SELinuxOptions
+	}
+
+	if options == nil {
+		return nil
+	}
+
+	return options.DeepCopy()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSidecarSELinuxOptions(t *testing.T) {
+	t.Parallel()
+
+	level := &corev1.SELinuxOptions{Level: "s0:c1,c2"}
+	withOptions := func(name string, options *corev1.SELinuxOptions) corev1.Container {
+		return corev1.Container{Name: name, SecurityContext: &corev1.SecurityContext{SELinuxOptions: options}}
+	}
+
+	testCases := []struct {
+		name            string
+		podOptions      *corev1.SELinuxOptions
+		initContainers  []corev1.Container
+		containers      []corev1.Container
+		expectedOptions *corev1.SELinuxOptions
+	}{
+		{
+			name:       "no SELinux options",
+			containers: []corev1.Container{{Name: "workload"}},
+		},
+		{
+			name:       "Pod-level SELinux options are inherited",
+			podOptions: level,
+			containers: []corev1.Container{withOptions("workload", &corev1.SELinuxOptions{Level: "s0:c3,c4"})},
+		},
+		{
+			name:            "same container-level SELinux options",
+			initContainers:  []corev1.Container{withOptions("init", level)},
+			containers:      []corev1.Container{withOptions("workload-1", level), withOptions("workload-2", level)},
+			expectedOptions: level,
+		},
+		{
+			name:       "different container-level SELinux options",
+			containers: []corev1.Container{withOptions("workload-1", level), withOptions("workload-2", &corev1.SELinuxOptions{Level: "s0:c3,c4"})},
+		},
+		{
+			name:           "init container without SELinux options",
+			initContainers: []corev1.Container{{Name: "init"}},
+			containers:     []corev1.Container{withOptions("workload", level)},
+		},
+	}
+
+	for _, tc := range testCases {
+		pod := &corev1.Pod{}
+		if tc.podOptions != nil {
+			pod.Spec.SecurityContext = &corev1.PodSecurityContext{SELinuxOptions: tc.podOptions}
+		}
+		pod.Spec.InitContainers = tc.initContainers
+		pod.Spec.Containers = tc.containers
+
+		if got := sidecarSELinuxOptions(pod); !reflect.DeepEqual(got, tc.expectedOptions) {
+			t.Errorf("test %q failed: got SELinux options %v, expected %v", tc.name, got, tc.expectedOptions)
+		}
+	}
+}
@@ -53,6 +53,20 @@ func GetSidecarContainerSpec(c *Config) v1.Container {
 			RunAsGroup:     pointer.Int64(NobodyGID),
 		},
 		Args: []string{"--v=5"},
+		// The gcsfuse Cloud Monitoring exporter detects the k8s_container monitored resource
+		// labels from these environment variables, and the Pod name from the hostname.
+		Env: []v1.EnvVar{
+			{
+				Name: "NAMESPACE",
+				ValueFrom: &v1.EnvVarSource{
+					FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+				},
+			},
+			{
+				Name:  "CONTAINER_NAME",
+				Value: SidecarContainerName,
+			},
+		},
 		Resources: v1.ResourceRequirements{
 			Limits: v1.ResourceList{
 				v1.ResourceCPU:              c.CPULimit,
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Volume attributes sizing the staging space of a volume in the sidecar container emptyDir,
+// where gcsfuse keeps a written file until it is uploaded to the bucket.
+const (
+	// VolumeAttributeExpectedMaxWriteSize is the size of the largest file the workload writes to the volume.
+	VolumeAttributeExpectedMaxWriteSize = "expectedMaxWriteSize"
+	// VolumeAttributeTmpVolumeSize is the staging space of the volume, which takes precedence over expectedMaxWriteSize,
+	// e.g. for workloads writing several large files concurrently.
+	VolumeAttributeTmpVolumeSize = "tmpVolumeSize"
+
+	gcsfuseCSIDriverName = "gcsfuse.csi.storage.gke.io"
+)
+
+// VolumeStagingSize returns the staging space required by a volume with the given attributes,
+// or zero if neither staging attribute is set.
+func VolumeStagingSize(attributes map[string]string) (resource.Quantity, error) {
+	for _, key := range []string{VolumeAttributeTmpVolumeSize, VolumeAttributeExpectedMaxWriteSize} {
+		v, ok := attributes[key]
+		if !ok {
+			continue
+		}
+
+		q, err := resource.ParseQuantity(v)
+		if err != nil || q.Sign() <= 0 {
+			return resource.Quantity{}, fmt.Errorf("volume attribute %q must be a positive quantity, got %q", key, v)
+		}
+
+		return q, nil
+	}
+
+	return resource.Quantity{}, nil
+}
+
+// podStagingSize returns the sum of the staging space required by the gcsfuse CSI ephemeral volumes of the Pod.
+// The attributes of the PersistentVolumes are not visible at the Pod admission, and are checked by the node driver.
+func podStagingSize(pod *corev1.Pod) (resource.Quantity, error) {
+	total := resource.Quantity{}
+	for _, v := range pod.Spec.Volumes {
+		if v.CSI == nil || v.CSI.Driver != gcsfuseCSIDriverName {
+			continue
+		}
+
+		q, err := VolumeStagingSize(v.CSI.VolumeAttributes)
+		if err != nil {
+			return resource.Quantity{}, fmt.Errorf("volume %q: %w", v.Name, err)
+		}
+		total.Add(q)
+	}
+
+	return total, nil
+}
+
+// stagingVolumeSizeLimit returns the size limit of the sidecar container emptyDir, or nil if the emptyDir is not limited.
+// The gcsfuse PersistentVolumes of the Pod also stage their files in the emptyDir, but their attributes are not visible
+// at the Pod admission, so the limit is not lower than the sidecar container ephemeral-storage limit.
+// The emptyDir is not limited if the staging space is not set or the ephemeral-storage limit is unlimited.
+func stagingVolumeSizeLimit(stagingSize resource.Quantity, c *Config) *resource.Quantity {
+	if stagingSize.IsZero() || c.EphemeralStorageLimit.IsZero() {
+		return nil
+	}
+
+	limit := c.EphemeralStorageLimit.DeepCopy()
+	if stagingSize.Cmp(limit) > 0 {
+		limit = stagingSize.DeepCopy()
+	}
+
+	return &limit
+}
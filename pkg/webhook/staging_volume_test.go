@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodStagingSize(t *testing.T) {
+	t.Parallel()
+
+	csiVolume := func(driver string, attributes map[string]string) corev1.Volume {
+		return corev1.Volume{
+			Name: "test-volume",
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{Driver: driver, VolumeAttributes: attributes},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		volumes   []corev1.Volume
+		expected  resource.Quantity
+		expectErr bool
+	}{
+		{
+			name:     "no staging attributes",
+			volumes:  []corev1.Volume{csiVolume(gcsfuseCSIDriverName, map[string]string{"bucketName": "test-bucket"})},
+			expected: resource.Quantity{},
+		},
+		{
+			name: "sum of the volumes, tmpVolumeSize takes precedence",
+			volumes: []corev1.Volume{
+				csiVolume(gcsfuseCSIDriverName, map[string]string{VolumeAttributeExpectedMaxWriteSize: "2Gi"}),
+				csiVolume(gcsfuseCSIDriverName, map[string]string{VolumeAttributeExpectedMaxWriteSize: "1Gi", VolumeAttributeTmpVolumeSize: "8Gi"}),
+				csiVolume("other.csi.driver", map[string]string{VolumeAttributeTmpVolumeSize: "100Gi"}),
+			},
+			expected: resource.MustParse("10Gi"),
+		},
+		{
+			name:      "invalid quantity",
+			volumes:   []corev1.Volume{csiVolume(gcsfuseCSIDriverName, map[string]string{VolumeAttributeExpectedMaxWriteSize: "large"})},
+			expectErr: true,
+		},
+		{
+			name:      "zero quantity",
+			volumes:   []corev1.Volume{csiVolume(gcsfuseCSIDriverName, map[string]string{VolumeAttributeTmpVolumeSize: "0"})},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: tc.volumes}}
+		got, err := podStagingSize(pod)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("test %q failed: got error %v, expected error %v", tc.name, err, tc.expectErr)
+		}
+		if err == nil && got.Cmp(tc.expected) != 0 {
+			t.Errorf("test %q failed: got %v, expected %v", tc.name, got.String(), tc.expected.String())
+		}
+	}
+}
+
+func TestStagingVolumeSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                  string
+		stagingSize           string
+		ephemeralStorageLimit string
+		expected              string
+	}{
+		{
+			name:                  "no staging space",
+			stagingSize:           "0",
+			ephemeralStorageLimit: "5Gi",
+		},
+		{
+			name:                  "staging space lower than the ephemeral-storage limit",
+			stagingSize:           "1Gi",
+			ephemeralStorageLimit: "5Gi",
+			expected:              "5Gi",
+		},
+		{
+			name:                  "ephemeral-storage limit lowered by the annotation",
+			stagingSize:           "10Gi",
+			ephemeralStorageLimit: "5Gi",
+			expected:              "10Gi",
+		},
+		{
+			name:                  "unlimited ephemeral storage",
+			stagingSize:           "10Gi",
+			ephemeralStorageLimit: "0",
+		},
+	}
+
+	for _, tc := range testCases {
+		c := &Config{EphemeralStorageLimit: resource.MustParse(tc.ephemeralStorageLimit)}
+		got := stagingVolumeSizeLimit(resource.MustParse(tc.stagingSize), c)
+		if tc.expected == "" {
+			if got != nil {
+				t.Errorf("test %q failed: got size limit %v, expected no size limit", tc.name, got.String())
+			}
+
+			continue
+		}
+		if got == nil || got.Cmp(resource.MustParse(tc.expected)) != 0 {
+			t.Errorf("test %q failed: got size limit %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
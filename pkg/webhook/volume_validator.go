@@ -0,0 +1,95 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	driverconfig "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/driver_config"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// VolumeSpecChecker checks the volume attributes, StorageClass parameters, and mount options of the driver.
+// It is implemented by the CSI driver package, which the webhook package cannot import.
+type VolumeSpecChecker interface {
+	ValidateVolumeAttributes(attributes map[string]string) error
+	ValidateStorageClassParameters(parameters map[string]string) error
+	MountOptionWarnings(options []string) []string
+}
+
+// VolumeValidator rejects the PersistentVolumes and StorageClasses of the driver with unknown or invalid volume attributes and parameters,
+// so that the typos are caught at the creation of the objects instead of when a Pod mounts the volume.
+// The mount options are not rejected, the options that the driver ignores are returned as warnings.
+type VolumeValidator struct {
+	Decoder *admission.Decoder
+	Checker VolumeSpecChecker
+}
+
+// Handle validates the incoming PersistentVolumes and StorageClasses.
+func (v *VolumeValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	var attributes, parameters map[string]string
+	var mountOptions []string
+	var name string
+	switch req.Kind.Kind {
+	case "PersistentVolume":
+		pv := &corev1.PersistentVolume{}
+		if err := v.Decoder.Decode(req, pv); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != gcsfuseCSIDriverName {
+			return admission.Allowed("The PersistentVolume does not use the driver.")
+		}
+		attributes = pv.Spec.CSI.VolumeAttributes
+		mountOptions = pv.Spec.MountOptions
+		name = pv.Name
+	case "StorageClass":
+		sc := &storagev1.StorageClass{}
+		if err := v.Decoder.Decode(req, sc); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if sc.Provisioner != gcsfuseCSIDriverName {
+			return admission.Allowed("The StorageClass does not use the driver.")
+		}
+		parameters = sc.Parameters
+		mountOptions = sc.MountOptions
+		name = sc.Name
+	default:
+		return admission.Allowed(fmt.Sprintf("No validation required for kind %v.", req.Kind.Kind))
+	}
+
+	if err := v.Checker.ValidateVolumeAttributes(attributes); err != nil {
+		klog.InfoS("rejecting volume attributes", "kind", req.Kind.Kind, "name", name, "err", err)
+
+		return admission.Denied(fmt.Sprintf("%v %q: %v", req.Kind.Kind, name, err))
+	}
+	if err := v.Checker.ValidateStorageClassParameters(parameters); err != nil {
+		klog.InfoS("rejecting StorageClass parameters", "name", name, "err", err)
+
+		return admission.Denied(fmt.Sprintf("%v %q: %v", req.Kind.Kind, name, err))
+	}
+
+	if o, ok := attributes["mountOptions"]; ok {
+		mountOptions = append(append([]string{}, mountOptions...), driverconfig.SplitMountOptions(o)...)
+	}
+
+	return admission.Allowed("The volume attributes are valid.").WithWarnings(v.Checker.MountOptionWarnings(mountOptions)...)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type fakeVolumeSpecChecker struct{}
+
+func (fakeVolumeSpecChecker) ValidateVolumeAttributes(attributes map[string]string) error {
+	if _, ok := attributes["invalid"]; ok {
+		return errors.New("unknown volume attribute")
+	}
+
+	return nil
+}
+
+func (fakeVolumeSpecChecker) ValidateStorageClassParameters(parameters map[string]string) error {
+	if _, ok := parameters["invalid"]; ok {
+		return errors.New("unknown parameter")
+	}
+
+	return nil
+}
+
+func (fakeVolumeSpecChecker) MountOptionWarnings(options []string) []string {
+	warnings := []string{}
+	for _, o := range options {
+		if o == "ignored" {
+			warnings = append(warnings, "ignored")
+		}
+	}
+
+	return warnings
+}
+
+func TestVolumeValidator(t *testing.T) {
+	t.Parallel()
+
+	newPV := func(driver string, attributes map[string]string, mountOptions ...string) runtime.Object {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-pv"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: "test-bucket", VolumeAttributes: attributes},
+				},
+				MountOptions: mountOptions,
+			},
+		}
+	}
+	newStorageClass := func(provisioner string, parameters map[string]string) runtime.Object {
+		return &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "test-sc"}, Provisioner: provisioner, Parameters: parameters}
+	}
+
+	testCases := []struct {
+		name             string
+		kind             string
+		object           runtime.Object
+		expectAllowed    bool
+		expectedWarnings int
+	}{
+		{
+			name:          "valid PersistentVolume",
+			kind:          "PersistentVolume",
+			object:        newPV(gcsfuseCSIDriverName, map[string]string{"bucketName": "test-bucket"}),
+			expectAllowed: true,
+		},
+		{
+			name:          "invalid PersistentVolume",
+			kind:          "PersistentVolume",
+			object:        newPV(gcsfuseCSIDriverName, map[string]string{"invalid": "true"}),
+			expectAllowed: false,
+		},
+		{
+			name:          "PersistentVolume of another driver",
+			kind:          "PersistentVolume",
+			object:        newPV("pd.csi.storage.gke.io", map[string]string{"invalid": "true"}),
+			expectAllowed: true,
+		},
+		{
+			name:             "PersistentVolume with ignored mount options",
+			kind:             "PersistentVolume",
+			object:           newPV(gcsfuseCSIDriverName, map[string]string{"mountOptions": "implicit-dirs,ignored"}, "ignored"),
+			expectAllowed:    true,
+			expectedWarnings: 2,
+		},
+		{
+			name:          "invalid StorageClass",
+			kind:          "StorageClass",
+			object:        newStorageClass(gcsfuseCSIDriverName, map[string]string{"invalid": "true"}),
+			expectAllowed: false,
+		},
+		{
+			name:          "StorageClass of another provisioner",
+			kind:          "StorageClass",
+			object:        newStorageClass("pd.csi.storage.gke.io", map[string]string{"invalid": "true"}),
+			expectAllowed: true,
+		},
+	}
+
+	v := &VolumeValidator{Decoder: admission.NewDecoder(runtime.NewScheme()), Checker: fakeVolumeSpecChecker{}}
+	for _, tc := range testCases {
+		raw, err := json.Marshal(tc.object)
+		if err != nil {
+			t.Fatalf("test %q failed: failed to marshal the object: %v", tc.name, err)
+		}
+		req := admission.Request{AdmissionRequest: v1.AdmissionRequest{
+			Kind:   metav1.GroupVersionKind{Kind: tc.kind},
+			Object: runtime.RawExtension{Raw: raw},
+		}}
+
+		resp := v.Handle(context.Background(), req)
+		if resp.Allowed != tc.expectAllowed {
+			t.Errorf("test %q failed: got allowed %v, expected %v: %v", tc.name, resp.Allowed, tc.expectAllowed, resp.Result)
+		}
+		if len(resp.Warnings) != tc.expectedWarnings {
+			t.Errorf("test %q failed: got warnings %v, expected %d warnings", tc.name, resp.Warnings, tc.expectedWarnings)
+		}
+	}
+}
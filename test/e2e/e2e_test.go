@@ -18,6 +18,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"path/filepath"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/metadata"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/testsuites"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
@@ -36,12 +38,17 @@ import (
 )
 
 var (
-	err            error
-	c              clientset.Interface
-	m              metadata.Service
-	bucketLocation = flag.String("test-bucket-location", "us-central1", "the test bucket location")
-	skipGcpSaTest  = flag.Bool("skip-gcp-sa-test", true, "skip GCP SA test")
-	apiEnv         = flag.String("api-env", "prod", "cluster API env")
+	err                     error
+	c                       clientset.Interface
+	m                       metadata.Service
+	bucketLocation          = flag.String("test-bucket-location", "us-central1", "the test bucket location")
+	skipGcpSaTest           = flag.Bool("skip-gcp-sa-test", true, "skip GCP SA test")
+	apiEnv                  = flag.String("api-env", "prod", "cluster API env")
+	storageEmulatorEndpoint = flag.String("storage-emulator-endpoint", "", "if set, the tests create buckets in the GCS emulator at the endpoint instead of GCS, and the cluster is not required to be a GKE cluster")
+	nodeArch                = flag.String("node-arch", "", "the CPU architecture of the nodes the test Pods run on, e.g. arm64; empty means any architecture")
+	nodePool                = flag.String("node-pool", "", "the GKE node pool the test Pods run on; empty means any node pool")
+
+	testDriver *GCSFuseCSITestDriver
 )
 
 var _ = func() bool {
@@ -55,8 +62,10 @@ var _ = func() bool {
 	framework.RegisterClusterFlags(flag.CommandLine)
 	flag.Parse()
 	framework.AfterReadingAllFlags(&framework.TestContext)
+	specs.SetNodeArchitecture(*nodeArch)
+	specs.SetNodePool(*nodePool)
 
-	c, err = clientset.New(framework.TestContext.KubeConfig)
+	c, err = clientset.New(framework.TestContext.KubeConfig, 0, 0)
 	if err != nil {
 		klog.Fatalf("Failed to configure k8s client: %v", err)
 	}
@@ -68,6 +77,16 @@ var _ = func() bool {
 
 	currentCluster := kubeConfig.CurrentContext
 	framework.Logf("Running test on cluster %s", currentCluster)
+	// The emulator mode runs on any cluster, e.g. kind, without a GCP project.
+	if *storageEmulatorEndpoint != "" {
+		m, err = metadata.NewFakeService("test-project", "us-central1", currentCluster, *apiEnv)
+		if err != nil {
+			klog.Fatalf("Failed to create fake meta data service: %v", err)
+		}
+
+		return true
+	}
+
 	l := strings.Split(currentCluster, "_")
 	if len(l) < 4 || l[0] != "gke" {
 		klog.Fatalf("Got invalid cluster name %v, please make sure the cluster is created on GKE", currentCluster)
@@ -100,13 +119,32 @@ var _ = ginkgo.Describe("E2E Test Suite", func() {
 		testsuites.InitGcsFuseCSIFailedMountTestSuite,
 		testsuites.InitGcsFuseCSIWorkloadsTestSuite,
 		testsuites.InitGcsFuseCSIMultiVolumeTestSuite,
-		testsuites.InitGcsFuseCSIGCSFuseIntegrationTestSuite,
-		testsuites.InitGcsFuseCSIPerformanceTestSuite,
+		testsuites.InitGcsFuseCSIGCSFuseIntegrationTestSuite(*gcsfuseIntegrationTestRef, *gcsfuseIntegrationTestGoVersion, *gcsfuseIntegrationTestImage),
+		testsuites.InitGcsFuseCSIPerformanceTestSuite(*performanceFioJobFiles, *performanceFioParams, *performanceResultsGCSPath),
+		testsuites.InitGcsFuseCSIMetricsTestSuite,
+		testsuites.InitGcsFuseCSIDataIntegrityTestSuite,
+		testsuites.InitGcsFuseCSIConsistencyTestSuite,
+		testsuites.InitGcsFuseCSIHostNetworkTestSuite,
+		testsuites.InitGcsFuseCSICrossProjectTestSuite,
+		testsuites.InitGcsFuseCSIAutopilotTestSuite(*useGKEAutopilot),
+		testsuites.InitGcsFuseCSIIstioTestSuite,
+		testsuites.InitGcsFuseCSIMLWorkloadTestSuite,
+		testsuites.InitGcsFuseCSIChaosTestSuite,
+		testsuites.InitGcsFuseCSIScalabilityTestSuite(*scalabilityPodsPerNode, *scalabilityVolumesPerPod),
 	}
 
-	testDriver := InitGCSFuseCSITestDriver(c, m, *bucketLocation, *skipGcpSaTest)
+	var buckets []string
+	if *existingBuckets != "" {
+		buckets = strings.Split(*existingBuckets, ",")
+	}
+	testDriver = InitGCSFuseCSITestDriver(c, m, *bucketLocation, *skipGcpSaTest, buckets, *storageEmulatorEndpoint, *crossProjectID, *bucketKMSKeyName, *bucketPoolSize)
 
 	ginkgo.Context(storageframework.GetDriverNameWithFeatureTags(testDriver), func() {
 		storageframework.DefineTestSuites(testDriver, GCSFuseCSITestSuites)
 	})
 })
+
+// Each Ginkgo process creates its own bucket pool, so the bucket pool is deleted on every process.
+var _ = ginkgo.AfterSuite(func(ctx context.Context) {
+	testDriver.DeleteBucketPool(ctx)
+})
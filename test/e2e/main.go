@@ -21,6 +21,7 @@ import (
 	"flag"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/utils"
 	"k8s.io/klog/v2"
@@ -30,6 +31,8 @@ var (
 	pkgDir = flag.String("pkg-dir", "", "the package directory")
 
 	// Kubernetes cluster flags.
+	clusterType         = flag.String("cluster-type", utils.ClusterTypeGKE, "type of the test cluster, gke or kind; kind runs the hermetic test subset against the GCS emulator on a local kind cluster")
+	kindClusterName     = flag.String("kind-cluster-name", "gcsfuse-csi-e2e", "name of the kind cluster, which is created if it does not exist and kept after the test")
 	gkeClusterRegion    = flag.String("gke-cluster-region", "", "region that gke regional cluster should be created in")
 	gkeClusterVersion   = flag.String("gke-cluster-version", "", "GKE cluster worker master and node version")
 	gkeNodeVersion      = flag.String("gke-node-version", "", "GKE cluster worker node version")
@@ -38,10 +41,26 @@ var (
 	useGKEAutopilot     = flag.Bool("use-gke-autopilot", false, "use GKE Autopilot cluster for the tests")
 	apiEndpointOverride = flag.String("api-endpoint-override", "https://container.googleapis.com/", "CloudSDK API endpoint override to use for the cluster environment")
 	nodeImageType       = flag.String("node-image-type", "cos_containerd", "image type to use for the cluster")
+	addARMNodePool      = flag.Bool("add-arm-node-pool", false, "add an ARM node pool to the cluster and run the volumes and workloads tests on the ARM nodes")
+	armNodeMachineType  = flag.String("arm-node-machine-type", "t2a-standard-4", "GKE cluster ARM node pool machine type")
+	nodePools           = flag.String("node-pools", "", "semicolon-separated node pools added to the cluster, and the tests run once per node pool, e.g. 'ubuntu:image-type=ubuntu_containerd;arm:machine-type=t2a-standard-4,focus=volumes;spot:spot=true'; the keys are image-type, machine-type, num-nodes, spot, and focus. The node pools are created when running in prow, and must exist otherwise")
+
+	// Network flags.
+	gkeClusterNetwork        = flag.String("gke-cluster-network", "", "VPC network the GKE cluster is created in, defaults to the default network")
+	gkeClusterSubnetwork     = flag.String("gke-cluster-subnetwork", "", "subnetwork the GKE cluster is created in")
+	privateCluster           = flag.Bool("private-cluster", false, "create a private GKE cluster with private nodes and no public control plane endpoint; the test must run from a host in the cluster VPC network")
+	privateClusterMasterCIDR = flag.String("private-cluster-master-cidr", "172.16.0.32/28", "the /28 IP range of the private cluster control plane")
+	useRestrictedVIP         = flag.Bool("use-restricted-vip", false, "resolve the Google API and container registry domains to restricted.googleapis.com on the cluster network, to validate VPC Service Controls")
 
 	// Test infrastructure flags.
-	inProw             = flag.Bool("run-in-prow", false, "whether or not to run the test in PROW")
-	boskosResourceType = flag.String("boskos-resource-type", "gke-internal-project", "name of the boskos resource type to reserve")
+	inProw              = flag.Bool("run-in-prow", false, "whether or not to run the test in PROW")
+	boskosResourceType  = flag.String("boskos-resource-type", "gke-internal-project", "name of the boskos resource type to reserve")
+	acquireCrossProject = flag.Bool("acquire-cross-project", false, "acquire a second boskos project when running in prow, and run the cross-project tests against it")
+	crossProjectID      = flag.String("cross-project-id", "", "project the cross-project tests create buckets in, which must be different from the cluster project; the cross-project tests are skipped if empty")
+	runJanitor          = flag.Bool("run-janitor", false, "before running the tests, delete the buckets, GCP service accounts, and IAM policy bindings older than 'janitor-ttl' leaked by the interrupted test runs in the test projects")
+	janitorOnly         = flag.Bool("janitor-only", false, "only run the janitor on 'janitor-projects' and exit, without creating a cluster or running the tests")
+	janitorProjects     = flag.String("janitor-projects", "", "comma-separated projects the janitor cleans up in 'janitor-only' mode, defaults to the gcloud project")
+	janitorTTL          = flag.Duration("janitor-ttl", 24*time.Hour, "the janitor only deletes the test resources older than the TTL, which must be longer than the longest test run sharing the projects")
 
 	// Driver flags.
 	imageRegistry          = flag.String("image-registry", "", "name of image to stage to")
@@ -50,6 +69,15 @@ var (
 	deployOverlayName      = flag.String("deploy-overlay-name", "stable", "which kustomize overlay to deploy the driver with")
 	useGKEManagedDriver    = flag.Bool("use-gke-managed-driver", false, "use GKE managed GCS FUSE CSI driver for the tests")
 
+	// Existing resource flags.
+	useStorageEmulator = flag.Bool("use-storage-emulator", false, "run the functional tests against the fake-gcs-server deployed by the emulator overlay, which does not require a GCP project")
+	existingBuckets    = flag.String("existing-buckets", "", "comma-separated names of pre-created buckets the tests use instead of creating buckets and granting IAM roles")
+	bucketPoolSize     = flag.Int("bucket-pool-size", 0, "number of buckets each ginkgo process creates once and shares across the tests, each test using a new directory in a bucket; 0 creates a new bucket per test")
+	bucketKMSKeyName   = flag.String("bucket-kms-key-name", "", "Cloud KMS key the CMEK test buckets are encrypted with, which the Cloud Storage service agent must be able to use; the CMEK bucket tests are skipped if empty")
+
+	// Service mesh flags.
+	installIstio = flag.Bool("install-istio", false, "whether or not to install Istio on the cluster before running the Istio interoperability tests")
+
 	// Ginkgo flags.
 	ginkgoFocus         = flag.String("ginkgo-focus", "", "pass to ginkgo run --focus flag")
 	ginkgoSkip          = flag.String("ginkgo-skip", "", "pass to ginkgo run --skip flag")
@@ -57,6 +85,24 @@ var (
 	ginkgoTimeout       = flag.String("ginkgo-timeout", "2h", "pass to ginkgo run --timeout flag")
 	ginkgoFlakeAttempts = flag.String("ginkgo-flake-attempts", "2", "pass to ginkgo run --flake-attempts flag")
 	ginkgoSkipGcpSaTest = flag.Bool("ginkgo-skip-gcp-sa-test", true, "skip GCP SA test")
+
+	// Flake tracking flags.
+	quarantineFile     = flag.String("quarantine-file", "", "the file of the quarantined specs the tests skip, one ginkgo skip regular expression per line")
+	flakeReportGCSPath = flag.String("flake-report-gcs-path", "", "the GCS path the flake report is uploaded to, e.g. gs://my-bucket/flakes")
+
+	// GCS FUSE integration test flags.
+	gcsfuseIntegrationTestRef       = flag.String("gcsfuse-integration-test-ref", "v1.0.0", "the gcsfuse git tag, branch, or commit the gcsfuse integration tests are checked out at")
+	gcsfuseIntegrationTestGoVersion = flag.String("gcsfuse-integration-test-go-version", "1.20.5", "the Go version the gcsfuse integration tests are run with")
+	gcsfuseIntegrationTestImage     = flag.String("gcsfuse-integration-test-image", "", "a prebuilt image containing the gcsfuse source at /gcsfuse and Go at /usr/local/go; if set, the gcsfuse ref and Go version flags are ignored")
+
+	// Performance test flags.
+	performanceFioJobFiles    = flag.String("performance-fio-job-files", "", "comma-separated absolute paths of fio job files the performance test runs; empty means the default profiles")
+	performanceFioParams      = flag.String("performance-fio-params", "", "comma-separated KEY=VALUE environment variables the fio job files reference, e.g. NUMJOBS=8,FILESIZE=1G")
+	performanceResultsGCSPath = flag.String("performance-results-gcs-path", "", "the GCS path the structured performance results are uploaded to, e.g. gs://my-bucket/perf")
+
+	// Scalability test flags.
+	scalabilityPodsPerNode   = flag.Int("scalability-pods-per-node", 10, "number of Pods the scalability test launches on a single node")
+	scalabilityVolumesPerPod = flag.Int("scalability-volumes-per-pod", 5, "number of gcsfuse volumes each Pod mounts in the scalability test")
 )
 
 func main() {
@@ -66,6 +112,37 @@ func main() {
 	}
 	flag.Parse()
 
+	if *janitorOnly {
+		projects := []string{}
+		if *janitorProjects != "" {
+			projects = strings.Split(*janitorProjects, ",")
+		}
+		if err := utils.Janitor(projects, *janitorTTL); err != nil {
+			klog.Fatalf("Failed to delete the leaked e2e test resources: %v", err)
+		}
+
+		return
+	}
+
+	switch *clusterType {
+	case utils.ClusterTypeGKE:
+	case utils.ClusterTypeKind:
+		if *inProw {
+			klog.Fatal("'cluster-type' kind is not supported when running in prow")
+		}
+		// kind clusters have no GCP project, so always build and load the driver images,
+		// and run the functional tests against the GCS emulator.
+		klog.Info("Using the emulator overlay and the GCS emulator on the kind cluster")
+		*deployOverlayName = "emulator"
+		*useGKEManagedDriver = false
+		*useStorageEmulator = true
+		if *imageRegistry == "" {
+			*imageRegistry = "kind.local"
+		}
+	default:
+		klog.Fatalf("'cluster-type' must be %q or %q, got %q", utils.ClusterTypeGKE, utils.ClusterTypeKind, *clusterType)
+	}
+
 	if *inProw {
 		utils.EnsureVariable(boskosResourceType, true, "'boskos-resource-type' must be set when running in prow")
 		utils.EnsureVariable(gkeClusterRegion, true, "'gke-cluster-region' must be set when running in prow")
@@ -76,10 +153,70 @@ func main() {
 		}
 	}
 
+	if *acquireCrossProject && !*inProw {
+		klog.Fatal("'acquire-cross-project' requires 'run-in-prow', set 'cross-project-id' instead when running outside prow")
+	}
+
+	if (*privateCluster || *useRestrictedVIP) && !*inProw {
+		klog.Fatal("'private-cluster' and 'use-restricted-vip' are only supported when the test creates the cluster with 'run-in-prow'")
+	}
+
+	if *useRestrictedVIP && !*privateCluster {
+		klog.Fatal("'use-restricted-vip' requires 'private-cluster', because nodes with external IPs do not use Private Google Access")
+	}
+
+	pools, err := utils.ParseNodePools(*nodePools, *nodeImageType, *nodeMachineType)
+	if err != nil {
+		klog.Fatalf("Failed to parse 'node-pools': %v", err)
+	}
+	if len(pools) > 0 && (*useGKEAutopilot || *clusterType != utils.ClusterTypeGKE) {
+		klog.Fatal("'node-pools' is only supported on GKE Standard clusters")
+	}
+	if len(pools) > 0 && *addARMNodePool {
+		klog.Fatal("'add-arm-node-pool' cannot be used with 'node-pools', add an ARM node pool to 'node-pools' instead")
+	}
+
+	if *runJanitor && (*useStorageEmulator || *clusterType == utils.ClusterTypeKind) {
+		klog.Fatal("'run-janitor' is not supported with the GCS emulator, because the test does not create resources in a GCP project")
+	}
+
+	quarantinedSpecs := []string{}
+	if *quarantineFile != "" {
+		var err error
+		if quarantinedSpecs, err = utils.ReadQuarantinedSpecs(*quarantineFile); err != nil {
+			klog.Fatalf("Failed to read 'quarantine-file': %v", err)
+		}
+	}
+
+	// Creating GCP service accounts mutates the IAM policies, which the existing buckets mode must not do.
+	if *existingBuckets != "" && !*ginkgoSkipGcpSaTest {
+		klog.Fatal("'ginkgo-skip-gcp-sa-test' must be true when 'existing-buckets' is set")
+	}
+
+	if *bucketPoolSize < 0 || (*bucketPoolSize > 0 && *existingBuckets != "") {
+		klog.Fatal("'bucket-pool-size' must not be negative, and cannot be used with 'existing-buckets'")
+	}
+
+	if *useStorageEmulator {
+		if *deployOverlayName != "emulator" || *useGKEManagedDriver {
+			klog.Fatal("'deploy-overlay-name' must be emulator and 'use-gke-managed-driver' must be false when 'use-storage-emulator' is set")
+		}
+		if !*ginkgoSkipGcpSaTest {
+			klog.Fatal("'ginkgo-skip-gcp-sa-test' must be true when 'use-storage-emulator' is set")
+		}
+	}
+
 	testParams := &utils.TestParameters{
 		PkgDir:                 *pkgDir,
+		ClusterType:            *clusterType,
+		KindClusterName:        *kindClusterName,
 		InProw:                 *inProw,
 		BoskosResourceType:     *boskosResourceType,
+		AcquireCrossProject:    *acquireCrossProject,
+		CrossProjectID:         *crossProjectID,
+		BucketKMSKeyName:       *bucketKMSKeyName,
+		RunJanitor:             *runJanitor,
+		JanitorTTL:             *janitorTTL,
 		UseGKEManagedDriver:    *useGKEManagedDriver,
 		NodeImageType:          *nodeImageType,
 		UseGKEAutopilot:        *useGKEAutopilot,
@@ -89,6 +226,9 @@ func main() {
 		GkeNodeVersion:         *gkeNodeVersion,
 		NodeMachineType:        *nodeMachineType,
 		NumNodes:               *numNodes,
+		AddARMNodePool:         *addARMNodePool,
+		ARMNodeMachineType:     *armNodeMachineType,
+		NodePools:              pools,
 		ImageRegistry:          *imageRegistry,
 		DeployOverlayName:      *deployOverlayName,
 		BuildGcsFuseCsiDriver:  *buildGcsFuseCsiDriver,
@@ -99,6 +239,29 @@ func main() {
 		GinkgoTimeout:          *ginkgoTimeout,
 		GinkgoFlakeAttempts:    *ginkgoFlakeAttempts,
 		GinkgoSkipGcpSaTest:    *ginkgoSkipGcpSaTest,
+		QuarantinedSpecs:       quarantinedSpecs,
+		FlakeReportGCSPath:     *flakeReportGCSPath,
+		InstallIstio:           *installIstio,
+		ExistingBuckets:        *existingBuckets,
+		BucketPoolSize:         *bucketPoolSize,
+		UseStorageEmulator:     *useStorageEmulator,
+
+		GkeClusterNetwork:        *gkeClusterNetwork,
+		GkeClusterSubnetwork:     *gkeClusterSubnetwork,
+		PrivateCluster:           *privateCluster,
+		PrivateClusterMasterCIDR: *privateClusterMasterCIDR,
+		UseRestrictedVIP:         *useRestrictedVIP,
+
+		GcsfuseIntegrationTestRef:       *gcsfuseIntegrationTestRef,
+		GcsfuseIntegrationTestGoVersion: *gcsfuseIntegrationTestGoVersion,
+		GcsfuseIntegrationTestImage:     *gcsfuseIntegrationTestImage,
+
+		PerformanceFioJobFiles:    *performanceFioJobFiles,
+		PerformanceFioParams:      *performanceFioParams,
+		PerformanceResultsGCSPath: *performanceResultsGCSPath,
+
+		ScalabilityPodsPerNode:   *scalabilityPodsPerNode,
+		ScalabilityVolumesPerPod: *scalabilityVolumesPerPod,
 	}
 
 	if strings.Contains(testParams.GinkgoFocus, "performance") {
@@ -108,6 +271,16 @@ func main() {
 		testParams.NodeMachineType = "n2-standard-32"
 	}
 
+	// Only the functional tests of the volumes suite run against the GCS emulator by default.
+	if testParams.UseStorageEmulator && testParams.GinkgoFocus == "" {
+		testParams.GinkgoFocus = "volumes"
+	}
+
+	// The ARM node pool validates the multi-arch images, so only run the volumes and workloads tests there by default.
+	if testParams.AddARMNodePool && testParams.GinkgoFocus == "" {
+		testParams.GinkgoFocus = "volumes|workloads"
+	}
+
 	if err := utils.Handle(testParams); err != nil {
 		klog.Fatalf("Failed to run e2e test: %v", err)
 	}
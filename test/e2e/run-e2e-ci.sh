@@ -33,6 +33,16 @@ readonly boskos_resource_type="${GCE_PD_BOSKOS_RESOURCE_TYPE:-gke-internal-proje
 readonly gke_cluster_version=${GKE_CLUSTER_VERSION:-latest}
 readonly gke_node_version=${GKE_NODE_VERSION:-}
 readonly node_machine_type=${MACHINE_TYPE:-n1-standard-2}
+readonly node_pools=${NODE_POOLS:-}
+readonly bucket_pool_size=${BUCKET_POOL_SIZE:-0}
+readonly acquire_cross_project=${ACQUIRE_CROSS_PROJECT:-false}
+readonly run_janitor=${RUN_JANITOR:-true}
+readonly janitor_ttl=${JANITOR_TTL:-24h}
+readonly flake_report_gcs_path=${FLAKE_REPORT_GCS_PATH:-}
+readonly gke_cluster_network=${GKE_CLUSTER_NETWORK:-}
+readonly gke_cluster_subnetwork=${GKE_CLUSTER_SUBNETWORK:-}
+readonly private_cluster=${PRIVATE_CLUSTER:-false}
+readonly use_restricted_vip=${USE_RESTRICTED_VIP:-false}
 
 # Initialize ginkgo.
 export PATH=${PATH}:$(go env GOPATH)/bin
@@ -55,8 +65,19 @@ base_cmd="${PKGDIR}/bin/e2e-test-ci \
             --ginkgo-focus=${ginkgo_focus} \
             --ginkgo-skip=${ginkgo_skip} \
             --boskos-resource-type=${boskos_resource_type} \
+            --acquire-cross-project=${acquire_cross_project} \
+            --bucket-pool-size=${bucket_pool_size} \
+            --run-janitor=${run_janitor} \
+            --janitor-ttl=${janitor_ttl} \
+            --quarantine-file=${PKGDIR}/test/e2e/quarantined-specs.txt \
+            --flake-report-gcs-path=${flake_report_gcs_path} \
+            --gke-cluster-network=${gke_cluster_network} \
+            --gke-cluster-subnetwork=${gke_cluster_subnetwork} \
+            --private-cluster=${private_cluster} \
+            --use-restricted-vip=${use_restricted_vip} \
             --gke-cluster-version=${gke_cluster_version} \
             --gke-node-version=${gke_node_version} \
-            --node-machine-type=${node_machine_type}"
+            --node-machine-type=${node_machine_type} \
+            --node-pools='${node_pools}'"
 
 eval "$base_cmd"
\ No newline at end of file
@@ -20,18 +20,39 @@ set -o nounset
 set -o errexit
 
 readonly PKGDIR="$( dirname -- "$0"; )/../.."
+readonly cluster_type=${E2E_TEST_CLUSTER_TYPE:-gke}
+readonly kind_cluster_name=${KIND_CLUSTER_NAME:-gcsfuse-csi-e2e}
 readonly gke_cluster_region=${GKE_CLUSTER_REGION:-us-central1}
 readonly use_gke_autopilot=${E2E_TEST_USE_GKE_AUTOPILOT:-false}
+readonly add_arm_node_pool=${E2E_TEST_ADD_ARM_NODE_POOL:-false}
+readonly node_pools=${E2E_TEST_NODE_POOLS:-}
 readonly cloudsdk_api_endpoint_overrides_container=${CLOUDSDK_API_ENDPOINT_OVERRIDES_CONTAINER:-https://container.googleapis.com/}
 
 readonly use_gke_managed_driver="${E2E_TEST_USE_GKE_MANAGED_DRIVER:-true}"
 readonly build_gcs_fuse_csi_driver="${E2E_TEST_BUILD_DRIVER:-false}"
+readonly install_istio="${E2E_TEST_INSTALL_ISTIO:-false}"
+readonly existing_buckets="${E2E_TEST_EXISTING_BUCKETS:-}"
+readonly bucket_pool_size="${E2E_TEST_BUCKET_POOL_SIZE:-0}"
+readonly use_storage_emulator="${E2E_TEST_USE_STORAGE_EMULATOR:-false}"
+readonly cross_project_id="${E2E_TEST_CROSS_PROJECT_ID:-}"
+readonly run_janitor="${E2E_TEST_RUN_JANITOR:-false}"
+readonly janitor_only="${E2E_TEST_JANITOR_ONLY:-false}"
+readonly janitor_projects="${E2E_TEST_JANITOR_PROJECTS:-}"
+readonly janitor_ttl="${E2E_TEST_JANITOR_TTL:-24h}"
+readonly gcsfuse_integration_test_ref="${E2E_TEST_GCSFUSE_INTEGRATION_TEST_REF:-v1.0.0}"
+readonly gcsfuse_integration_test_go_version="${E2E_TEST_GCSFUSE_INTEGRATION_TEST_GO_VERSION:-1.20.5}"
+readonly gcsfuse_integration_test_image="${E2E_TEST_GCSFUSE_INTEGRATION_TEST_IMAGE:-}"
+readonly performance_fio_job_files="${E2E_TEST_PERFORMANCE_FIO_JOB_FILES:-}"
+readonly performance_fio_params="${E2E_TEST_PERFORMANCE_FIO_PARAMS:-}"
+readonly performance_results_gcs_path="${E2E_TEST_PERFORMANCE_RESULTS_GCS_PATH:-}"
 
 readonly ginkgo_focus="${E2E_TEST_FOCUS:-}"
 readonly ginkgo_skip="${E2E_TEST_SKIP:-should.succeed.in.performance.test}"
 readonly ginkgo_procs="${E2E_TEST_GINKGO_PROCS:-5}"
 readonly ginkgo_timeout="${E2E_TEST_GINKGO_TIMEOUT:-2h}"
 readonly ginkgo_flake_attempts="${E2E_TEST_GINKGO_FLAKE_ATTEMPTS:-2}"
+readonly quarantine_file="${E2E_TEST_QUARANTINE_FILE:-${PKGDIR}/test/e2e/quarantined-specs.txt}"
+readonly flake_report_gcs_path="${E2E_TEST_FLAKE_REPORT_GCS_PATH:-}"
 
 # Initialize ginkgo.
 export PATH=${PATH}:$(go env GOPATH)/bin
@@ -45,18 +66,39 @@ chmod +x ${PKGDIR}/bin/e2e-test-ci
 base_cmd="${PKGDIR}/bin/e2e-test-ci \
             --pkg-dir=${PKGDIR} \
             --run-in-prow=false \
+            --cluster-type=${cluster_type} \
+            --kind-cluster-name=${kind_cluster_name} \
             --gke-cluster-region=${gke_cluster_region} \
             --use-gke-autopilot=${use_gke_autopilot} \
+            --add-arm-node-pool=${add_arm_node_pool} \
+            --node-pools='${node_pools}' \
             --api-endpoint-override=${cloudsdk_api_endpoint_overrides_container} \
-            --image-registry=${REGISTRY} \
+            --image-registry=${REGISTRY:-} \
             --build-gcs-fuse-csi-driver=${build_gcs_fuse_csi_driver} \
             --build-gcs-fuse-from-source=${BUILD_GCSFUSE_FROM_SOURCE} \
             --deploy-overlay-name=${OVERLAY} \
             --use-gke-managed-driver=${use_gke_managed_driver} \
+            --install-istio=${install_istio} \
+            --existing-buckets=${existing_buckets} \
+            --bucket-pool-size=${bucket_pool_size} \
+            --use-storage-emulator=${use_storage_emulator} \
+            --cross-project-id=${cross_project_id} \
+            --run-janitor=${run_janitor} \
+            --janitor-only=${janitor_only} \
+            --janitor-projects=${janitor_projects} \
+            --janitor-ttl=${janitor_ttl} \
+            --gcsfuse-integration-test-ref=${gcsfuse_integration_test_ref} \
+            --gcsfuse-integration-test-go-version=${gcsfuse_integration_test_go_version} \
+            --gcsfuse-integration-test-image=${gcsfuse_integration_test_image} \
+            --performance-fio-job-files=${performance_fio_job_files} \
+            --performance-fio-params=${performance_fio_params} \
+            --performance-results-gcs-path=${performance_results_gcs_path} \
             --ginkgo-focus=${ginkgo_focus} \
             --ginkgo-skip=${ginkgo_skip} \
             --ginkgo-procs=${ginkgo_procs} \
             --ginkgo-timeout=${ginkgo_timeout} \
-            --ginkgo-flake-attempts=${ginkgo_flake_attempts}"
+            --ginkgo-flake-attempts=${ginkgo_flake_attempts} \
+            --quarantine-file=${quarantine_file} \
+            --flake-report-gcs-path=${flake_report_gcs_path}"
 
 eval "$base_cmd"
\ No newline at end of file
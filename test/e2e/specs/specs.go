@@ -19,21 +19,39 @@ package specs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	specbuilder "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/spec_builder"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
 	iam "google.golang.org/api/iam/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/kubernetes/pkg/kubelet/events"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2edeployment "k8s.io/kubernetes/test/e2e/framework/deployment"
@@ -49,17 +67,41 @@ const (
 	TesterContainerName   = "volume-tester"
 	K8sServiceAccountName = "gcsfuse-csi-sa"
 	//nolint:gosec
-	K8sSecretName                   = "gcsfuse-csi-test-secret"
-	FakeVolumePrefix                = "gcsfuse-csi-fake-volume"
-	InvalidVolumePrefix             = "gcsfuse-csi-invalid-volume"
-	NonRootVolumePrefix             = "gcsfuse-csi-non-root-volume"
-	InvalidMountOptionsVolumePrefix = "gcsfuse-csi-invalid-mount-options-volume"
-	ImplicitDirsVolumePrefix        = "gcsfuse-csi-implicit-dirs-volume"
-	ForceNewBucketPrefix            = "gcsfuse-csi-force-new-bucket"
-	SubfolderInBucketPrefix         = "gcsfuse-csi-subfolder-in-bucket"
-	MultipleBucketsPrefix           = "gcsfuse-csi-multiple-buckets"
-	ImplicitDirsPath                = "implicit-dir"
-	InvalidVolume                   = "<invalid-name>"
+	K8sSecretName                      = "gcsfuse-csi-test-secret"
+	FakeVolumePrefix                   = "gcsfuse-csi-fake-volume"
+	InvalidVolumePrefix                = "gcsfuse-csi-invalid-volume"
+	NonRootVolumePrefix                = "gcsfuse-csi-non-root-volume"
+	InvalidMountOptionsVolumePrefix    = "gcsfuse-csi-invalid-mount-options-volume"
+	ImplicitDirsVolumePrefix           = "gcsfuse-csi-implicit-dirs-volume"
+	FileCacheVolumePrefix              = "gcsfuse-csi-file-cache-volume"
+	ReadOnlyVolumePrefix               = "gcsfuse-csi-read-only-volume"
+	RWFileModeMountOptionsVolumePrefix = "gcsfuse-csi-rw-file-mode-mount-options-volume"
+	ForceNewBucketPrefix               = "gcsfuse-csi-force-new-bucket"
+	SubfolderInBucketPrefix            = "gcsfuse-csi-subfolder-in-bucket"
+	MultipleBucketsPrefix              = "gcsfuse-csi-multiple-buckets"
+	CrossProjectBucketPrefix           = "gcsfuse-csi-cross-project-bucket"
+	CrossProjectQuotaBucketPrefix      = "gcsfuse-csi-cross-project-quota-bucket"
+	RetainVolumePrefix                 = "gcsfuse-csi-retain-volume"
+	HNSBucketPrefix                    = "gcsfuse-csi-hns-bucket"
+	AutoclassBucketPrefix              = "gcsfuse-csi-autoclass-bucket"
+	CMEKBucketPrefix                   = "gcsfuse-csi-cmek-bucket"
+	ImplicitDirsPath                   = "implicit-dir"
+	InvalidVolume                      = "<invalid-name>"
+
+	// TestBucketNamePrefix and GCPServiceAccountDisplayName identify the GCP resources created by the tests,
+	// so that the janitor can delete the resources leaked by interrupted test runs.
+	TestBucketNamePrefix         = "gcsfuse-csi-e2e-"
+	GCPServiceAccountDisplayName = "Cloud Storage FUSE CSI Driver E2E Test SA"
+	// GCPServiceAccountCreatedAtPrefix precedes the RFC 3339 creation time in the GCP service account description,
+	// because the IAM API does not return the creation time of service accounts.
+	GCPServiceAccountCreatedAtPrefix = "created at "
+
+	// DriverNamespace is the namespace the CSI driver is deployed to by the kustomize overlays.
+	DriverNamespace   = "gcs-fuse-csi-driver"
+	driverMetricsPort = 9920
+
+	IstioNamespace          = "istio-system"
+	IstioProxyContainerName = "istio-proxy"
 
 	GoogleCloudCliImage = "gcr.io/google.com/cloudsdktool/google-cloud-cli:slim"
 	UbuntuImage         = "ubuntu:20.04"
@@ -75,6 +117,35 @@ type TestPod struct {
 	namespace *v1.Namespace
 }
 
+// nodeArchitecture is the CPU architecture of the nodes the test Pods run on, e.g. arm64. Empty means any architecture.
+var nodeArchitecture string
+
+// SetNodeArchitecture makes the test Pods run on the nodes with the CPU architecture, e.g. arm64.
+func SetNodeArchitecture(arch string) {
+	nodeArchitecture = arch
+}
+
+// nodePool is the GKE node pool the test Pods run on. Empty means any node pool.
+var nodePool string
+
+// SetNodePool makes the test Pods run on the nodes of the GKE node pool.
+func SetNodePool(pool string) {
+	nodePool = pool
+}
+
+// GetNodeSelector returns the node selector of the test Pods.
+func GetNodeSelector() map[string]string {
+	nodeSelector := map[string]string{"kubernetes.io/os": "linux"}
+	if nodeArchitecture != "" {
+		nodeSelector["kubernetes.io/arch"] = nodeArchitecture
+	}
+	if nodePool != "" {
+		nodeSelector["cloud.google.com/gke-nodepool"] = nodePool
+	}
+
+	return nodeSelector
+}
+
 func NewTestPod(c clientset.Interface, ns *v1.Namespace) *TestPod {
 	cpu, _ := resource.ParseQuantity("100m")
 	mem, _ := resource.ParseQuantity("20Mi")
@@ -85,16 +156,15 @@ func NewTestPod(c clientset.Interface, ns *v1.Namespace) *TestPod {
 		pod: &v1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				GenerateName: "gcsfuse-volume-tester-",
-				Annotations: map[string]string{
-					"gke-gcsfuse/volumes":                 "true",
-					"gke-gcsfuse/cpu-limit":               "50m",
-					"gke-gcsfuse/memory-limit":            "50Mi",
-					"gke-gcsfuse/ephemeral-storage-limit": "50Mi",
-				},
+				Annotations: specbuilder.SidecarAnnotations(specbuilder.SidecarLimits{
+					CPU:              resource.MustParse("50m"),
+					Memory:           resource.MustParse("50Mi"),
+					EphemeralStorage: resource.MustParse("50Mi"),
+				}),
 			},
 			Spec: v1.PodSpec{
 				TerminationGracePeriodSeconds: pointer.Int64(5),
-				NodeSelector:                  map[string]string{"kubernetes.io/os": "linux"},
+				NodeSelector:                  GetNodeSelector(),
 				ServiceAccountName:            K8sServiceAccountName,
 				Containers: []v1.Container{
 					{
@@ -151,6 +221,16 @@ func (t *TestPod) VerifyExecInPodSucceedWithFullOutput(f *framework.Framework, c
 	framework.Logf("Output of %q: \n%s", shExec, stdout)
 }
 
+// VerifyExecInPodSucceedWithOutput verifies shell cmd in target pod succeed and returns the stdout.
+func (t *TestPod) VerifyExecInPodSucceedWithOutput(f *framework.Framework, containerName, shExec string) string {
+	stdout, stderr, err := e2epod.ExecCommandInContainerWithFullOutput(f, t.pod.Name, containerName, "/bin/sh", "-c", shExec)
+	framework.ExpectNoError(err,
+		"%q should succeed, but failed with error message %q\nstdout: %s\nstderr: %s",
+		shExec, err, stdout, stderr)
+
+	return stdout
+}
+
 // VerifyExecInPodFail verifies shell cmd in target pod fail with certain exit code.
 func (t *TestPod) VerifyExecInPodFail(f *framework.Framework, containerName, shExec string, exitCode int) {
 	stdout, stderr, err := e2epod.ExecCommandInContainerWithFullOutput(f, t.pod.Name, containerName, "/bin/sh", "-c", shExec)
@@ -158,6 +238,15 @@ func (t *TestPod) VerifyExecInPodFail(f *framework.Framework, containerName, shE
 		fmt.Sprintf("%q should fail with exit code %d, but exit without error\nstdout: %s\nstderr: %s", shExec, exitCode, stdout, stderr))
 }
 
+// VerifyExecInPodFailWithError verifies shell cmd in target pod fail with the error message in the output.
+func (t *TestPod) VerifyExecInPodFailWithError(f *framework.Framework, containerName, shExec, errMsg string) {
+	stdout, stderr, err := e2epod.ExecCommandInContainerWithFullOutput(f, t.pod.Name, containerName, "/bin/sh", "-c", shExec)
+	gomega.Expect(err).Should(gomega.HaveOccurred(),
+		fmt.Sprintf("%q should fail with error %q, but exit without error\nstdout: %s\nstderr: %s", shExec, errMsg, stdout, stderr))
+	gomega.Expect(stdout+stderr).To(gomega.ContainSubstring(errMsg),
+		"%q should fail with error %q\nstdout: %s\nstderr: %s", shExec, errMsg, stdout, stderr)
+}
+
 func (t *TestPod) WaitForRunning(ctx context.Context) {
 	err := e2epod.WaitForPodRunningInNamespaceSlow(ctx, t.client, t.pod.Name, t.pod.Namespace)
 	framework.ExpectNoError(err)
@@ -171,19 +260,119 @@ func (t *TestPod) WaitFoSuccess(ctx context.Context) {
 	framework.ExpectNoError(err)
 }
 
+// WaitForSidecarTerminated waits for the sidecar container to be terminated with the reason, e.g. OOMKilled.
+func (t *TestPod) WaitForSidecarTerminated(ctx context.Context, reason string) {
+	framework.Logf("Waiting the sidecar container of Pod %s to be terminated with reason %s", t.pod.Name, reason)
+	err := e2epod.WaitForPodCondition(ctx, t.client, t.namespace.Name, t.pod.Name, "sidecar container terminated", pollTimeoutSlow, func(pod *v1.Pod) (bool, error) {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != webhook.SidecarContainerName {
+				continue
+			}
+			for _, state := range []v1.ContainerState{cs.State, cs.LastTerminationState} {
+				if state.Terminated != nil && state.Terminated.Reason == reason {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	})
+	framework.ExpectNoError(err)
+}
+
+// WaitForSidecarRestarted waits for the kubelet to restart the sidecar container according to the Pod restart policy.
+func (t *TestPod) WaitForSidecarRestarted(ctx context.Context) {
+	framework.Logf("Waiting the sidecar container of Pod %s to be restarted", t.pod.Name)
+	err := e2epod.WaitForPodCondition(ctx, t.client, t.namespace.Name, t.pod.Name, "sidecar container restarted", pollTimeoutSlow, func(pod *v1.Pod) (bool, error) {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == webhook.SidecarContainerName && cs.RestartCount > 0 {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+	framework.ExpectNoError(err)
+}
+
+// WaitForEvicted waits for the kubelet to evict the Pod, e.g. when the Pod exceeds its ephemeral storage limit, and returns the eviction message.
+func (t *TestPod) WaitForEvicted(ctx context.Context) string {
+	framework.Logf("Waiting Pod %s to be evicted", t.pod.Name)
+	var message string
+	err := e2epod.WaitForPodCondition(ctx, t.client, t.namespace.Name, t.pod.Name, "evicted", pollTimeoutSlow, func(pod *v1.Pod) (bool, error) {
+		if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+			message = pod.Status.Message
+
+			return true, nil
+		}
+
+		return false, nil
+	})
+	framework.ExpectNoError(err)
+
+	return message
+}
+
+// WaitForTerminatedOrDeleted waits for the Pod to stop running after its node shuts down.
+// It returns the terminated Pod, or nil if the Pod was garbage collected with the node.
+func (t *TestPod) WaitForTerminatedOrDeleted(ctx context.Context) *v1.Pod {
+	framework.Logf("Waiting Pod %s to be terminated or deleted", t.pod.Name)
+	var terminatedPod *v1.Pod
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, pollTimeoutSlow, true, func(ctx context.Context) (bool, error) {
+		pod, err := t.client.CoreV1().Pods(t.namespace.Name).Get(ctx, t.pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded {
+			terminatedPod = pod
+
+			return true, nil
+		}
+
+		return false, nil
+	})
+	framework.ExpectNoError(err)
+
+	return terminatedPod
+}
+
+// Evict evicts the Pod using the eviction API, which respects PodDisruptionBudgets the same way as node drains.
+func (t *TestPod) Evict(ctx context.Context) {
+	framework.Logf("Evicting Pod %s", t.pod.Name)
+	err := t.client.CoreV1().Pods(t.namespace.Name).EvictV1(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      t.pod.Name,
+			Namespace: t.namespace.Name,
+		},
+	})
+	framework.ExpectNoError(err)
+
+	err = e2epod.WaitForPodNotFoundInNamespace(ctx, t.client, t.pod.Name, t.namespace.Name, pollTimeoutSlow)
+	framework.ExpectNoError(err)
+}
+
 func (t *TestPod) WaitForUnschedulable(ctx context.Context) {
 	err := e2epod.WaitForPodNameUnschedulableInNamespace(ctx, t.client, t.pod.Name, t.namespace.Name)
 	framework.ExpectNoError(err)
 }
 
 func (t *TestPod) WaitForFailedMountError(ctx context.Context, msg string) {
+	t.WaitForFailedMountErrorWithTimeout(ctx, msg, pollTimeoutSlow)
+}
+
+// WaitForFailedMountErrorWithTimeout waits until a FailedMount event containing msg is recorded in the pod namespace,
+// failing the test if the event does not appear within the timeout.
+func (t *TestPod) WaitForFailedMountErrorWithTimeout(ctx context.Context, msg string, timeout time.Duration) {
 	err := e2eevents.WaitTimeoutForEvent(
 		ctx,
 		t.client,
 		t.namespace.Name,
 		fields.Set{"reason": events.FailedMountVolume}.AsSelector().String(),
 		msg,
-		pollTimeoutSlow)
+		timeout)
 	framework.ExpectNoError(err)
 }
 
@@ -195,6 +384,97 @@ func (t *TestPod) SetupVolume(volumeResource *storageframework.VolumeResource, n
 	}
 	t.pod.Spec.Containers[0].VolumeMounts = append(t.pod.Spec.Containers[0].VolumeMounts, volumeMount)
 
+	t.addVolume(volumeResource, name, readOnly, mountOptions...)
+}
+
+// AddInitContainer adds an init container that runs the shell cmd before the main containers start.
+func (t *TestPod) AddInitContainer(name, cmd string) {
+	t.pod.Spec.InitContainers = append(t.pod.Spec.InitContainers, v1.Container{
+		Name:         name,
+		Image:        imageutils.GetE2EImage(imageutils.BusyBox),
+		Command:      []string{"/bin/sh"},
+		Args:         []string{"-c", cmd},
+		VolumeMounts: make([]v1.VolumeMount, 0),
+		Resources:    t.pod.Spec.Containers[0].Resources,
+	})
+}
+
+// SetupVolumeForInitContainer mounts the volume to the init container added by AddInitContainer.
+// The volume is added to the Pod if it does not exist.
+func (t *TestPod) SetupVolumeForInitContainer(volumeResource *storageframework.VolumeResource, name, containerName, mountPath string, readOnly bool, mountOptions ...string) {
+	addVolumeMount(t.pod.Spec.InitContainers, name, containerName, mountPath, readOnly)
+	t.addVolume(volumeResource, name, readOnly, mountOptions...)
+}
+
+// AddContainer adds a container that runs the shell cmd alongside the tester container.
+func (t *TestPod) AddContainer(name, cmd string) {
+	t.pod.Spec.Containers = append(t.pod.Spec.Containers, v1.Container{
+		Name:         name,
+		Image:        imageutils.GetE2EImage(imageutils.BusyBox),
+		Command:      []string{"/bin/sh"},
+		Args:         []string{"-c", cmd},
+		VolumeMounts: make([]v1.VolumeMount, 0),
+		Resources:    t.pod.Spec.Containers[0].Resources,
+	})
+}
+
+// SetupVolumeForContainer mounts the volume to the container added by AddContainer, or the tester container.
+// The volume is added to the Pod if it does not exist.
+func (t *TestPod) SetupVolumeForContainer(volumeResource *storageframework.VolumeResource, name, containerName, mountPath string, readOnly bool, mountOptions ...string) {
+	addVolumeMount(t.pod.Spec.Containers, name, containerName, mountPath, readOnly)
+	t.addVolume(volumeResource, name, readOnly, mountOptions...)
+}
+
+// SetContainerCommand sets the shell cmd of the container.
+func (t *TestPod) SetContainerCommand(containerName, cmd string) {
+	for i := range t.pod.Spec.Containers {
+		if t.pod.Spec.Containers[i].Name == containerName {
+			t.pod.Spec.Containers[i].Args = []string{"-c", cmd}
+
+			return
+		}
+	}
+	framework.Failf("container %s not found", containerName)
+}
+
+// SidecarInjectedAsInitContainer returns true if the webhook injects the sidecar container
+// as a native sidecar init container, which is required for init containers to use the volume.
+// The Pod is created in dry-run mode so that the mutating webhook is called without creating the Pod.
+func (t *TestPod) SidecarInjectedAsInitContainer(ctx context.Context) bool {
+	pod, err := t.client.CoreV1().Pods(t.namespace.Name).Create(ctx, t.pod, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	framework.ExpectNoError(err)
+
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == webhook.SidecarContainerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addVolumeMount(containers []v1.Container, name, containerName, mountPath string, readOnly bool) {
+	for i := range containers {
+		if containers[i].Name == containerName {
+			containers[i].VolumeMounts = append(containers[i].VolumeMounts, v1.VolumeMount{
+				Name:      name,
+				MountPath: mountPath,
+				ReadOnly:  readOnly,
+			})
+
+			return
+		}
+	}
+	framework.Failf("container %s not found", containerName)
+}
+
+func (t *TestPod) addVolume(volumeResource *storageframework.VolumeResource, name string, readOnly bool, mountOptions ...string) {
+	for _, v := range t.pod.Spec.Volumes {
+		if v.Name == name {
+			return
+		}
+	}
+
 	volume := v1.Volume{
 		Name: name,
 	}
@@ -205,24 +485,82 @@ func (t *TestPod) SetupVolume(volumeResource *storageframework.VolumeResource, n
 			},
 		}
 	} else if volumeResource.VolSource != nil {
-		volume.VolumeSource = *volumeResource.VolSource
-		volume.VolumeSource.CSI.ReadOnly = &readOnly
-		if len(mountOptions) > 0 {
-			volume.VolumeSource.CSI.VolumeAttributes["mountOptions"] += "," + strings.Join(mountOptions, ",")
+		// Rebuild the inline volume of the framework with the extra mount options.
+		attributes := volumeResource.VolSource.CSI.VolumeAttributes
+		sv := specbuilder.NewVolume(attributes[volumespec.VolumeContextKeyBucketName])
+		if o := attributes[volumespec.VolumeContextKeyMountOptions]; o != "" {
+			sv.MountOptions(strings.Split(o, ",")...)
+		}
+		sv.MountOptions(mountOptions...)
+		for k, v := range attributes {
+			if k != volumespec.VolumeContextKeyBucketName && k != volumespec.VolumeContextKeyMountOptions {
+				sv.Attribute(k, v)
+			}
+		}
+		if readOnly {
+			sv.ReadOnly()
 		}
+
+		var err error
+		volume, err = sv.InlineVolume(name)
+		framework.ExpectNoError(err, "failed to build the inline volume")
 	}
 
 	t.pod.Spec.Volumes = append(t.pod.Spec.Volumes, volume)
 }
 
+// SetVolumeReadOnly sets the readOnly field of the PVC or CSI ephemeral inline volume source, so that the CSI driver mounts the volume read-only,
+// without changing the read-only setting of the volume mounts.
+func (t *TestPod) SetVolumeReadOnly(name string) {
+	for i, v := range t.pod.Spec.Volumes {
+		if v.Name != name {
+			continue
+		}
+
+		switch {
+		case v.PersistentVolumeClaim != nil:
+			t.pod.Spec.Volumes[i].PersistentVolumeClaim.ReadOnly = true
+		case v.CSI != nil:
+			// The CSI volume source is shared with the volume resource, so copy it before the change.
+			csi := *v.CSI
+			csi.ReadOnly = pointer.Bool(true)
+			t.pod.Spec.Volumes[i].CSI = &csi
+		}
+
+		return
+	}
+	framework.Failf("volume %s not found", name)
+}
+
 func (t *TestPod) SetName(name string) {
 	t.pod.Name = name
 }
 
+// GetStartupLatency returns the time from the Pod creation to the tester container start of the running Pod,
+// which includes mounting all the volumes of the Pod.
+func (t *TestPod) GetStartupLatency() time.Duration {
+	for _, cs := range t.pod.Status.ContainerStatuses {
+		if cs.Name == TesterContainerName && cs.State.Running != nil {
+			return cs.State.Running.StartedAt.Sub(t.pod.CreationTimestamp.Time)
+		}
+	}
+	framework.Failf("the tester container of Pod %s is not running", t.pod.Name)
+
+	return 0
+}
+
+func (t *TestPod) GetName() string {
+	return t.pod.Name
+}
+
 func (t *TestPod) GetNode() string {
 	return t.pod.Spec.NodeName
 }
 
+func (t *TestPod) GetUID() types.UID {
+	return t.pod.UID
+}
+
 func (t *TestPod) SetNodeAffinity(nodeName string, sameNode bool) {
 	gomega.Expect(nodeName).ToNot(gomega.Equal(""))
 
@@ -235,10 +573,46 @@ func (t *TestPod) SetNodeAffinity(nodeName string, sameNode bool) {
 	t.pod.Spec.Affinity = ns.Affinity
 }
 
+// SetOS restricts the Pod to the nodes of the operating system.
+func (t *TestPod) SetOS(os v1.OSName) {
+	t.pod.Spec.OS = &v1.PodOS{Name: os}
+	t.pod.Spec.NodeSelector = map[string]string{v1.LabelOSStable: string(os)}
+}
+
+// CreateAndExpectError creates the Pod and expects the creation to be rejected with an error containing msg.
+func (t *TestPod) CreateAndExpectError(ctx context.Context, msg string) {
+	framework.Logf("Creating Pod %s, expecting error %q", t.pod.Name, msg)
+	_, err := t.client.CoreV1().Pods(t.namespace.Name).Create(ctx, t.pod, metav1.CreateOptions{})
+	gomega.Expect(err).To(gomega.HaveOccurred())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(msg))
+}
+
+// WindowsNodesExist returns true if the cluster has schedulable Windows nodes.
+func WindowsNodesExist(ctx context.Context, c clientset.Interface) bool {
+	nodes, err := c.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: v1.LabelOSStable + "=" + string(v1.Windows)})
+	framework.ExpectNoError(err)
+
+	for _, node := range nodes.Items {
+		if !node.Spec.Unschedulable {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (t *TestPod) SetNodeSelector(nodeSelector map[string]string) {
 	t.pod.Spec.NodeSelector = nodeSelector
 }
 
+// SetHostNetwork makes the pod, including the injected sidecar container, use the host network namespace.
+func (t *TestPod) SetHostNetwork(hostNetwork bool) {
+	t.pod.Spec.HostNetwork = hostNetwork
+	if hostNetwork {
+		t.pod.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+}
+
 func (t *TestPod) SetAnnotations(annotations map[string]string) {
 	t.pod.Annotations = annotations
 }
@@ -247,6 +621,32 @@ func (t *TestPod) SetServiceAccount(sa string) {
 	t.pod.Spec.ServiceAccountName = sa
 }
 
+// EnableProcessNamespaceSharing makes the processes of the sidecar container, including gcsfuse, visible to the tester container.
+func (t *TestPod) EnableProcessNamespaceSharing() {
+	t.pod.Spec.ShareProcessNamespace = pointer.Bool(true)
+}
+
+// SetIstioAnnotations adds the documented annotations for Pods running with the Istio sidecar proxy,
+// so that the proxy starts before the sidecar container sends requests to GCS.
+func (t *TestPod) SetIstioAnnotations() {
+	if t.pod.Annotations == nil {
+		t.pod.Annotations = map[string]string{}
+	}
+	t.pod.Annotations["proxy.istio.io/config"] = `{ "holdApplicationUntilProxyStarts": true }`
+	t.pod.Annotations["traffic.sidecar.istio.io/excludeOutboundIPRanges"] = "169.254.169.254/32"
+}
+
+// HasContainer returns true if the created Pod has the container, e.g. injected by other webhooks.
+func (t *TestPod) HasContainer(name string) bool {
+	for _, c := range append(t.pod.Spec.InitContainers, t.pod.Spec.Containers...) {
+		if c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (t *TestPod) SetNonRootSecurityContext() {
 	t.pod.Spec.SecurityContext = &v1.PodSecurityContext{
 		RunAsUser: pointer.Int64(1001),
@@ -285,7 +685,51 @@ func (t *TestPod) SetResource(cpuLimit, memoryLimit string) {
 	}
 }
 
+// SetExtendedResource makes the tester container request the extended resource, e.g. nvidia.com/gpu.
+func (t *TestPod) SetExtendedResource(name v1.ResourceName, quantity string) {
+	q := resource.MustParse(quantity)
+	t.pod.Spec.Containers[0].Resources.Limits[name] = q
+	t.pod.Spec.Containers[0].Resources.Requests[name] = q
+}
+
+// SetBurstableResource sets the tester container requests lower than the limits, making the Pod burstable.
+func (t *TestPod) SetBurstableResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) {
+	t.pod.Spec.Containers[0].Resources = v1.ResourceRequirements{
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpuLimit),
+			v1.ResourceMemory: resource.MustParse(memoryLimit),
+		},
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpuRequest),
+			v1.ResourceMemory: resource.MustParse(memoryRequest),
+		},
+	}
+}
+
+// GetSidecarContainer returns the injected sidecar container of the created Pod.
+func (t *TestPod) GetSidecarContainer() *v1.Container {
+	for i := range t.pod.Spec.Containers {
+		if t.pod.Spec.Containers[i].Name == webhook.SidecarContainerName {
+			return &t.pod.Spec.Containers[i]
+		}
+	}
+	for i := range t.pod.Spec.InitContainers {
+		if t.pod.Spec.InitContainers[i].Name == webhook.SidecarContainerName {
+			return &t.pod.Spec.InitContainers[i]
+		}
+	}
+	framework.Failf("the sidecar container is not injected to Pod %s", t.pod.Name)
+
+	return nil
+}
+
+// GetQOSClass returns the QoS class of the created Pod.
+func (t *TestPod) GetQOSClass() v1.PodQOSClass {
+	return t.pod.Status.QOSClass
+}
+
 func (t *TestPod) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
 	e2epod.DeletePodOrFail(ctx, t.client, t.namespace.Name, t.pod.Name)
 }
 
@@ -354,6 +798,23 @@ func (t *TestKubernetesServiceAccount) Create(ctx context.Context) {
 	framework.ExpectNoError(err)
 }
 
+// GetGCPServiceAccountEmail returns the GCP service account the Kubernetes service account is annotated with.
+func (t *TestKubernetesServiceAccount) GetGCPServiceAccountEmail() string {
+	return t.serviceAccount.Annotations["iam.gke.io/gcp-service-account"]
+}
+
+// GetKubernetesServiceAccount returns the existing Kubernetes service account with the given name.
+func GetKubernetesServiceAccount(ctx context.Context, c clientset.Interface, ns *v1.Namespace, name string) *TestKubernetesServiceAccount {
+	sa, err := c.CoreV1().ServiceAccounts(ns.Name).Get(ctx, name, metav1.GetOptions{})
+	framework.ExpectNoError(err)
+
+	return &TestKubernetesServiceAccount{
+		client:         c,
+		namespace:      ns,
+		serviceAccount: sa,
+	}
+}
+
 func (t *TestKubernetesServiceAccount) Cleanup(ctx context.Context) {
 	framework.Logf("Deleting Kubernetes Service Account %s", t.serviceAccount.Name)
 	err := t.client.CoreV1().ServiceAccounts(t.namespace.Name).Delete(ctx, t.serviceAccount.Name, metav1.DeleteOptions{})
@@ -381,7 +842,8 @@ func (t *TestGCPServiceAccount) Create(ctx context.Context) {
 	request := &iam.CreateServiceAccountRequest{
 		AccountId: t.serviceAccount.Name,
 		ServiceAccount: &iam.ServiceAccount{
-			DisplayName: "Cloud Storage FUSE CSI Driver E2E Test SA",
+			DisplayName: GCPServiceAccountDisplayName,
+			Description: GCPServiceAccountCreatedAtPrefix + time.Now().UTC().Format(time.RFC3339),
 		},
 	}
 	t.serviceAccount, err = iamService.Projects.ServiceAccounts.Create("projects/"+t.serviceAccount.ProjectId, request).Do()
@@ -631,6 +1093,7 @@ func (t *TestDeployment) GetPod(ctx context.Context) *v1.Pod {
 }
 
 func (t *TestDeployment) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
 	framework.Logf("Deleting Deployment %s", t.deployment.Name)
 	err := t.client.AppsV1().Deployments(t.namespace.Name).Delete(ctx, t.deployment.Name, metav1.DeleteOptions{})
 	framework.ExpectNoError(err)
@@ -684,8 +1147,673 @@ func (t *TestJob) WaitForJobPodsSucceeded(ctx context.Context) {
 }
 
 func (t *TestJob) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
 	framework.Logf("Deleting Job %s", t.job.Name)
 	d := metav1.DeletePropagationBackground
 	err := t.client.BatchV1().Jobs(t.namespace.Name).Delete(ctx, t.job.Name, metav1.DeleteOptions{PropagationPolicy: &d})
 	framework.ExpectNoError(err)
 }
+
+type TestStatefulSet struct {
+	client      clientset.Interface
+	statefulSet *appsv1.StatefulSet
+	namespace   *v1.Namespace
+}
+
+func NewTestStatefulSet(c clientset.Interface, ns *v1.Namespace, tPod *TestPod, replicas int32) *TestStatefulSet {
+	tPod.pod.Spec.RestartPolicy = v1.RestartPolicyAlways
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "gcsfuse-volume-statefulset-tester-",
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            pointer.Int32(replicas),
+			PodManagementPolicy: appsv1.OrderedReadyPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "gcsfuse-volume-statefulset-tester",
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: tPod.pod.ObjectMeta,
+				Spec:       tPod.pod.Spec,
+			},
+		},
+	}
+	statefulSet.Spec.Template.ObjectMeta.Labels = statefulSet.Spec.Selector.MatchLabels
+
+	return &TestStatefulSet{
+		client:      c,
+		namespace:   ns,
+		statefulSet: statefulSet,
+	}
+}
+
+// SetPerReplicaSubPath mounts the bucket prefix named after the replica Pod, e.g. "<statefulset-name>-0", instead of the bucket root.
+func (t *TestStatefulSet) SetPerReplicaSubPath(volumeName string) {
+	container := &t.statefulSet.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, v1.EnvVar{
+		Name: "POD_NAME",
+		ValueFrom: &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		},
+	})
+	for i := range container.VolumeMounts {
+		if container.VolumeMounts[i].Name == volumeName {
+			container.VolumeMounts[i].SubPathExpr = "$(POD_NAME)"
+		}
+	}
+}
+
+// SetupVolumeClaimTemplate replaces the volume with a PVC template, so that each replica provisions its own volume.
+func (t *TestStatefulSet) SetupVolumeClaimTemplate(volumeResource *storageframework.VolumeResource, volumeName string) {
+	gomega.Expect(volumeResource.Sc).ToNot(gomega.BeNil())
+
+	volumes := []v1.Volume{}
+	for _, v := range t.statefulSet.Spec.Template.Spec.Volumes {
+		if v.Name != volumeName {
+			volumes = append(volumes, v)
+		}
+	}
+	t.statefulSet.Spec.Template.Spec.Volumes = volumes
+
+	storageRequest, _ := resource.ParseQuantity("5Gi")
+	t.statefulSet.Spec.VolumeClaimTemplates = append(t.statefulSet.Spec.VolumeClaimTemplates, v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: volumeName,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			StorageClassName: &volumeResource.Sc.Name,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: storageRequest,
+				},
+			},
+		},
+	})
+}
+
+func (t *TestStatefulSet) Create(ctx context.Context) {
+	framework.Logf("Creating StatefulSet %s", t.statefulSet.Name)
+	var err error
+	t.statefulSet, err = t.client.AppsV1().StatefulSets(t.namespace.Name).Create(ctx, t.statefulSet, metav1.CreateOptions{})
+	framework.ExpectNoError(err)
+}
+
+// WaitForRunningAndReady waits for all the replicas to be ready and updated to the latest revision.
+func (t *TestStatefulSet) WaitForRunningAndReady(ctx context.Context) {
+	framework.Logf("Waiting StatefulSet %s to have %d ready replicas", t.statefulSet.Name, *t.statefulSet.Spec.Replicas)
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, pollTimeoutSlow, true, func(ctx context.Context) (bool, error) {
+		ss, err := t.client.AppsV1().StatefulSets(t.namespace.Name).Get(ctx, t.statefulSet.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		t.statefulSet = ss
+
+		return ss.Status.ObservedGeneration >= ss.Generation &&
+			ss.Status.ReadyReplicas == *ss.Spec.Replicas &&
+			ss.Status.UpdatedReplicas == *ss.Spec.Replicas &&
+			ss.Status.CurrentRevision == ss.Status.UpdateRevision, nil
+	})
+	framework.ExpectNoError(err)
+}
+
+// RollingRestart restarts the replicas one by one in reverse ordinal order, and waits for all the replicas to be ready.
+func (t *TestStatefulSet) RollingRestart(ctx context.Context) {
+	framework.Logf("Restarting StatefulSet %s", t.statefulSet.Name)
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`, time.Now().Format(time.RFC3339))
+	var err error
+	t.statefulSet, err = t.client.AppsV1().StatefulSets(t.namespace.Name).Patch(ctx, t.statefulSet.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	framework.ExpectNoError(err)
+
+	t.WaitForRunningAndReady(ctx)
+}
+
+// GetPods returns the replica Pods sorted by ordinal.
+func (t *TestStatefulSet) GetPods(ctx context.Context) []v1.Pod {
+	selector, err := metav1.LabelSelectorAsSelector(t.statefulSet.Spec.Selector)
+	framework.ExpectNoError(err)
+	podList, err := t.client.CoreV1().Pods(t.namespace.Name).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	framework.ExpectNoError(err)
+	gomega.Expect(podList.Items).To(gomega.HaveLen(int(*t.statefulSet.Spec.Replicas)))
+
+	pods := podList.Items
+	sort.Slice(pods, func(i, j int) bool {
+		return getStatefulSetPodOrdinal(&pods[i]) < getStatefulSetPodOrdinal(&pods[j])
+	})
+
+	return pods
+}
+
+func (t *TestStatefulSet) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
+	framework.Logf("Deleting StatefulSet %s", t.statefulSet.Name)
+	d := metav1.DeletePropagationForeground
+	err := t.client.AppsV1().StatefulSets(t.namespace.Name).Delete(ctx, t.statefulSet.Name, metav1.DeleteOptions{PropagationPolicy: &d})
+	framework.ExpectNoError(err)
+
+	// The PVCs created from the templates are not deleted with the StatefulSet.
+	for _, template := range t.statefulSet.Spec.VolumeClaimTemplates {
+		for i := int32(0); i < *t.statefulSet.Spec.Replicas; i++ {
+			pvcName := fmt.Sprintf("%s-%s-%d", template.Name, t.statefulSet.Name, i)
+			framework.Logf("Deleting PVC %s", pvcName)
+			err := t.client.CoreV1().PersistentVolumeClaims(t.namespace.Name).Delete(ctx, pvcName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				framework.ExpectNoError(err)
+			}
+		}
+	}
+}
+
+// getStatefulSetPodOrdinal returns the ordinal suffix of the StatefulSet Pod name, or -1 if the name does not have one.
+func getStatefulSetPodOrdinal(pod *v1.Pod) int {
+	i := strings.LastIndex(pod.Name, "-")
+	if i < 0 {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(pod.Name[i+1:])
+	if err != nil {
+		return -1
+	}
+
+	return ordinal
+}
+
+type TestDaemonSet struct {
+	client    clientset.Interface
+	daemonSet *appsv1.DaemonSet
+	namespace *v1.Namespace
+}
+
+func NewTestDaemonSet(c clientset.Interface, ns *v1.Namespace, tPod *TestPod) *TestDaemonSet {
+	tPod.pod.Spec.RestartPolicy = v1.RestartPolicyAlways
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "gcsfuse-volume-daemonset-tester-",
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "gcsfuse-volume-daemonset-tester",
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: tPod.pod.ObjectMeta,
+				Spec:       tPod.pod.Spec,
+			},
+		},
+	}
+	daemonSet.Spec.Template.ObjectMeta.Labels = daemonSet.Spec.Selector.MatchLabels
+
+	return &TestDaemonSet{
+		client:    c,
+		namespace: ns,
+		daemonSet: daemonSet,
+	}
+}
+
+func (t *TestDaemonSet) Create(ctx context.Context) {
+	framework.Logf("Creating DaemonSet %s", t.daemonSet.Name)
+	var err error
+	t.daemonSet, err = t.client.AppsV1().DaemonSets(t.namespace.Name).Create(ctx, t.daemonSet, metav1.CreateOptions{})
+	framework.ExpectNoError(err)
+}
+
+// WaitForReady waits for the DaemonSet to have a ready and updated Pod on the given number of nodes.
+func (t *TestDaemonSet) WaitForReady(ctx context.Context, numberOfNodes int) {
+	framework.Logf("Waiting DaemonSet %s to have ready pods on %d nodes", t.daemonSet.Name, numberOfNodes)
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, pollTimeoutSlow, true, func(ctx context.Context) (bool, error) {
+		ds, err := t.client.AppsV1().DaemonSets(t.namespace.Name).Get(ctx, t.daemonSet.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		t.daemonSet = ds
+
+		desired := int(ds.Status.DesiredNumberScheduled)
+
+		return ds.Status.ObservedGeneration >= ds.Generation &&
+			desired == numberOfNodes &&
+			int(ds.Status.NumberReady) == desired &&
+			int(ds.Status.UpdatedNumberScheduled) == desired, nil
+	})
+	framework.ExpectNoError(err)
+}
+
+// GetPods returns the DaemonSet Pods keyed by node name.
+func (t *TestDaemonSet) GetPods(ctx context.Context) map[string]*v1.Pod {
+	selector, err := metav1.LabelSelectorAsSelector(t.daemonSet.Spec.Selector)
+	framework.ExpectNoError(err)
+	podList, err := t.client.CoreV1().Pods(t.namespace.Name).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	framework.ExpectNoError(err)
+
+	pods := map[string]*v1.Pod{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		gomega.Expect(pods).ToNot(gomega.HaveKey(pod.Spec.NodeName), "found more than one DaemonSet pod on node %s", pod.Spec.NodeName)
+		pods[pod.Spec.NodeName] = pod
+	}
+
+	return pods
+}
+
+// SetNodeSelector adds the node selector terms to the ones inherited from the test Pod.
+func (t *TestDaemonSet) SetNodeSelector(nodeSelector map[string]string) {
+	if t.daemonSet.Spec.Template.Spec.NodeSelector == nil {
+		t.daemonSet.Spec.Template.Spec.NodeSelector = map[string]string{}
+	}
+	for k, v := range nodeSelector {
+		t.daemonSet.Spec.Template.Spec.NodeSelector[k] = v
+	}
+}
+
+func (t *TestDaemonSet) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
+	framework.Logf("Deleting DaemonSet %s", t.daemonSet.Name)
+	err := t.client.AppsV1().DaemonSets(t.namespace.Name).Delete(ctx, t.daemonSet.Name, metav1.DeleteOptions{})
+	framework.ExpectNoError(err)
+}
+
+type TestCronJob struct {
+	client    clientset.Interface
+	cronJob   *batchv1.CronJob
+	namespace *v1.Namespace
+}
+
+func NewTestCronJob(c clientset.Interface, ns *v1.Namespace, tPod *TestPod, schedule string) *TestCronJob {
+	tPod.pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "gcsfuse-volume-cronjob-tester-",
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: pointer.Int32(10),
+			FailedJobsHistoryLimit:     pointer.Int32(10),
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: tPod.pod.ObjectMeta,
+						Spec:       tPod.pod.Spec,
+					},
+					BackoffLimit: pointer.Int32(0),
+				},
+			},
+		},
+	}
+
+	return &TestCronJob{
+		client:    c,
+		namespace: ns,
+		cronJob:   cronJob,
+	}
+}
+
+func (t *TestCronJob) Create(ctx context.Context) {
+	framework.Logf("Creating CronJob %s", t.cronJob.Name)
+	var err error
+	t.cronJob, err = t.client.BatchV1().CronJobs(t.namespace.Name).Create(ctx, t.cronJob, metav1.CreateOptions{})
+	framework.ExpectNoError(err)
+}
+
+// WaitForJobsSucceeded waits for the CronJob to have the given number of succeeded Jobs, and fails if any Job fails.
+func (t *TestCronJob) WaitForJobsSucceeded(ctx context.Context, count int) {
+	framework.Logf("Waiting CronJob %s to have %d succeeded jobs", t.cronJob.Name, count)
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, pollTimeoutSlow, true, func(ctx context.Context) (bool, error) {
+		succeeded := 0
+		for _, job := range t.getJobs(ctx) {
+			for _, c := range job.Status.Conditions {
+				if c.Status != v1.ConditionTrue {
+					continue
+				}
+				switch c.Type {
+				case batchv1.JobComplete:
+					succeeded++
+				case batchv1.JobFailed:
+					return false, fmt.Errorf("job %s failed: %s", job.Name, c.Message)
+				case batchv1.JobSuspended, batchv1.JobFailureTarget:
+				}
+			}
+		}
+
+		return succeeded >= count, nil
+	})
+	framework.ExpectNoError(err)
+}
+
+// GetSucceededPods returns the Pods of the succeeded Jobs, and verifies that all the containers,
+// including the sidecar container, exited without error.
+func (t *TestCronJob) GetSucceededPods(ctx context.Context) []v1.Pod {
+	pods := []v1.Pod{}
+	for _, job := range t.getJobs(ctx) {
+		if job.Status.Succeeded == 0 {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+		framework.ExpectNoError(err)
+		podList, err := t.client.CoreV1().Pods(t.namespace.Name).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		framework.ExpectNoError(err)
+
+		for _, pod := range podList.Items {
+			if pod.Status.Phase != v1.PodSucceeded {
+				continue
+			}
+			for _, cs := range pod.Status.ContainerStatuses {
+				gomega.Expect(cs.State.Terminated).ToNot(gomega.BeNil(), "container %s of pod %s is not terminated", cs.Name, pod.Name)
+				gomega.Expect(cs.State.Terminated.ExitCode).To(gomega.BeZero(), "container %s of pod %s exited with error", cs.Name, pod.Name)
+			}
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods
+}
+
+func (t *TestCronJob) getJobs(ctx context.Context) []batchv1.Job {
+	jobList, err := t.client.BatchV1().Jobs(t.namespace.Name).List(ctx, metav1.ListOptions{})
+	framework.ExpectNoError(err)
+
+	jobs := []batchv1.Job{}
+	for _, job := range jobList.Items {
+		if metav1.IsControlledBy(&job, t.cronJob) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
+
+func (t *TestCronJob) Cleanup(ctx context.Context) {
+	CollectLogsOnFailure(ctx, t.client, t.namespace)
+	framework.Logf("Deleting CronJob %s", t.cronJob.Name)
+	d := metav1.DeletePropagationBackground
+	err := t.client.BatchV1().CronJobs(t.namespace.Name).Delete(ctx, t.cronJob.Name, metav1.DeleteOptions{PropagationPolicy: &d})
+	framework.ExpectNoError(err)
+}
+
+// RunNodeCommand runs the shell cmd in the host namespaces of the node using a privileged Pod, and waits for the cmd to succeed.
+func RunNodeCommand(ctx context.Context, c clientset.Interface, ns *v1.Namespace, nodeName, cmd string) {
+	framework.Logf("Running %q on node %s", cmd, nodeName)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "gcsfuse-node-command-",
+		},
+		Spec: v1.PodSpec{
+			NodeName:      nodeName,
+			HostPID:       true,
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:    "node-command",
+					Image:   imageutils.GetE2EImage(imageutils.BusyBox),
+					Command: []string{"nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--", "/bin/sh", "-c", cmd},
+					SecurityContext: &v1.SecurityContext{
+						Privileged: pointer.Bool(true),
+					},
+				},
+			},
+			Tolerations: []v1.Toleration{
+				{Operator: v1.TolerationOpExists},
+			},
+		},
+	}
+
+	pod, err := c.CoreV1().Pods(ns.Name).Create(ctx, pod, metav1.CreateOptions{})
+	framework.ExpectNoError(err)
+	defer e2epod.DeletePodOrFail(ctx, c, ns.Name, pod.Name)
+
+	err = e2epod.WaitForPodSuccessInNamespaceTimeout(ctx, c, pod.Name, ns.Name, pollTimeoutSlow)
+	framework.ExpectNoError(err)
+}
+
+// SimulateNodePreemption triggers a simulated maintenance event on the node VM. GKE Spot and preemptible VMs
+// terminate on host maintenance, so the event preempts the VM the same way as Compute Engine reclaiming it.
+func SimulateNodePreemption(ctx context.Context, c clientset.Interface, nodeName string) {
+	node, err := c.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	framework.ExpectNoError(err)
+	zone := node.Labels[v1.LabelTopologyZone]
+	gomega.Expect(zone).ToNot(gomega.BeEmpty(), "node %s does not have the zone label", nodeName)
+
+	framework.Logf("Simulating preemption of node %s in zone %s", nodeName, zone)
+	//nolint:gosec
+	output, err := exec.CommandContext(ctx, "gcloud", "compute", "instances", "simulate-maintenance-event", nodeName, "--zone", zone, "--quiet").CombinedOutput()
+	framework.ExpectNoError(err, "failed to simulate the preemption of node %s, output: %s", nodeName, string(output))
+}
+
+// SetNodeUnschedulable cordons or uncordons the node.
+func SetNodeUnschedulable(ctx context.Context, c clientset.Interface, nodeName string, unschedulable bool) {
+	framework.Logf("Setting node %s unschedulable to %v", nodeName, unschedulable)
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%v}}`, unschedulable)
+	_, err := c.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	framework.ExpectNoError(err)
+}
+
+// nodeSummary is the subset of the kubelet summary API response used to read the container memory usage.
+type nodeSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name   string `json:"name"`
+			Memory *struct {
+				WorkingSetBytes *uint64 `json:"workingSetBytes"`
+			} `json:"memory"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+// GetContainerMemoryUsage returns the total working set bytes of the containers with the name
+// in the namespace on the node, read from the kubelet summary API.
+func GetContainerMemoryUsage(ctx context.Context, c clientset.Interface, nodeName, namespace, containerName string) uint64 {
+	data, err := c.CoreV1().RESTClient().Get().Resource("nodes").Name(nodeName).SubResource("proxy").Suffix("stats/summary").DoRaw(ctx)
+	framework.ExpectNoError(err)
+
+	var summary nodeSummary
+	framework.ExpectNoError(json.Unmarshal(data, &summary))
+
+	var total uint64
+	for _, pod := range summary.Pods {
+		if pod.PodRef.Namespace != namespace {
+			continue
+		}
+		for _, container := range pod.Containers {
+			if container.Name == containerName && container.Memory != nil && container.Memory.WorkingSetBytes != nil {
+				total += *container.Memory.WorkingSetBytes
+			}
+		}
+	}
+
+	return total
+}
+
+// GetNodeDriverMetrics scrapes the metrics of the CSI driver node Pod on the node.
+// It returns false if the node Pod is not found, or it does not export metrics, e.g. when the managed driver is used.
+func GetNodeDriverMetrics(ctx context.Context, c clientset.Interface, nodeName string) (testutil.Metrics, bool) {
+	pods, err := c.CoreV1().Pods(DriverNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "k8s-app=gcs-fuse-csi-driver",
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	framework.ExpectNoError(err)
+	if len(pods.Items) == 0 {
+		framework.Logf("CSI driver node Pod not found on node %s", nodeName)
+
+		return nil, false
+	}
+
+	data, err := c.CoreV1().Pods(DriverNamespace).ProxyGet("http", pods.Items[0].Name, strconv.Itoa(driverMetricsPort), "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		framework.Logf("Failed to scrape the metrics of the CSI driver node Pod %s: %v", pods.Items[0].Name, err)
+
+		return nil, false
+	}
+
+	metrics := testutil.NewMetrics()
+	framework.ExpectNoError(testutil.ParseMetrics(string(data), &metrics))
+
+	return metrics, true
+}
+
+// IstioInstalled returns true if Istio or Anthos Service Mesh is installed on the cluster.
+func IstioInstalled(ctx context.Context, c clientset.Interface) bool {
+	_, err := c.CoreV1().Namespaces().Get(ctx, IstioNamespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	framework.ExpectNoError(err)
+
+	return true
+}
+
+// EnableIstioSidecarInjection labels the namespace to inject the Istio sidecar proxy to the Pods.
+func EnableIstioSidecarInjection(ctx context.Context, c clientset.Interface, ns *v1.Namespace) {
+	framework.Logf("Enabling Istio sidecar injection in namespace %s", ns.Name)
+	patch := `{"metadata":{"labels":{"istio-injection":"enabled"}}}`
+	_, err := c.CoreV1().Namespaces().Patch(ctx, ns.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	framework.ExpectNoError(err)
+}
+
+var peerAuthenticationResource = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+
+type TestPeerAuthentication struct {
+	client             dynamic.Interface
+	peerAuthentication *unstructured.Unstructured
+	namespace          *v1.Namespace
+}
+
+// NewTestPeerAuthentication returns a namespace-wide Istio PeerAuthentication with the mTLS mode, e.g. STRICT or PERMISSIVE.
+func NewTestPeerAuthentication(c dynamic.Interface, ns *v1.Namespace, mode string) *TestPeerAuthentication {
+	return &TestPeerAuthentication{
+		client:    c,
+		namespace: ns,
+		peerAuthentication: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": peerAuthenticationResource.GroupVersion().String(),
+				"kind":       "PeerAuthentication",
+				"metadata": map[string]interface{}{
+					"name": "default",
+				},
+				"spec": map[string]interface{}{
+					"mtls": map[string]interface{}{
+						"mode": mode,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *TestPeerAuthentication) Create(ctx context.Context) {
+	framework.Logf("Creating PeerAuthentication %s", t.peerAuthentication.GetName())
+	var err error
+	t.peerAuthentication, err = t.client.Resource(peerAuthenticationResource).Namespace(t.namespace.Name).Create(ctx, t.peerAuthentication, metav1.CreateOptions{})
+	framework.ExpectNoError(err)
+}
+
+func (t *TestPeerAuthentication) Cleanup(ctx context.Context) {
+	framework.Logf("Deleting PeerAuthentication %s", t.peerAuthentication.GetName())
+	err := t.client.Resource(peerAuthenticationResource).Namespace(t.namespace.Name).Delete(ctx, t.peerAuthentication.GetName(), metav1.DeleteOptions{})
+	framework.ExpectNoError(err)
+}
+
+// logDirNameRegex matches the characters that are replaced in the log directory names.
+var logDirNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// CollectLogsOnFailure writes the logs of the Pods in the namespace, the CSI driver node Pods on the same nodes,
+// and the webhook Pods to the report directory if the current spec failed. Only the logs since the spec started are collected.
+func CollectLogsOnFailure(ctx context.Context, c clientset.Interface, ns *v1.Namespace) {
+	report := ginkgo.CurrentSpecReport()
+	if !report.Failed() || framework.TestContext.ReportDir == "" {
+		return
+	}
+
+	dir := filepath.Join(framework.TestContext.ReportDir, "logs", logDirNameRegex.ReplaceAllString(report.FullText(), "_"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		framework.Logf("Failed to create log directory %s: %v", dir, err)
+
+		return
+	}
+	framework.Logf("Collecting logs to %s", dir)
+	sinceTime := metav1.NewTime(report.StartTime)
+
+	pods, err := c.CoreV1().Pods(ns.Name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		framework.Logf("Failed to list Pods in namespace %s: %v", ns.Name, err)
+
+		return
+	}
+
+	nodes := map[string]bool{}
+	for i := range pods.Items {
+		writePodLogs(ctx, c, &pods.Items[i], dir, &sinceTime)
+		if nodeName := pods.Items[i].Spec.NodeName; nodeName != "" {
+			nodes[nodeName] = true
+		}
+	}
+
+	for nodeName := range nodes {
+		writeDriverPodLogs(ctx, c, metav1.ListOptions{
+			LabelSelector: "k8s-app=gcs-fuse-csi-driver",
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		}, dir, &sinceTime)
+	}
+
+	writeDriverPodLogs(ctx, c, metav1.ListOptions{LabelSelector: "app=gcs-fuse-csi-driver-webhook"}, dir, &sinceTime)
+}
+
+// writeDriverPodLogs writes the logs of the Pods in the CSI driver namespace matching the list options.
+// No Pods are found when the managed driver is used.
+func writeDriverPodLogs(ctx context.Context, c clientset.Interface, opts metav1.ListOptions, dir string, sinceTime *metav1.Time) {
+	pods, err := c.CoreV1().Pods(DriverNamespace).List(ctx, opts)
+	if err != nil {
+		framework.Logf("Failed to list Pods in namespace %s: %v", DriverNamespace, err)
+
+		return
+	}
+
+	for i := range pods.Items {
+		writePodLogs(ctx, c, &pods.Items[i], dir, sinceTime)
+	}
+}
+
+// writePodLogs writes the logs of each container of the Pod to a file in dir.
+// The logs of the previous container instance are also written if the container restarted.
+func writePodLogs(ctx context.Context, c clientset.Interface, pod *v1.Pod, dir string, sinceTime *metav1.Time) {
+	restarted := map[string]bool{}
+	for _, status := range pod.Status.ContainerStatuses {
+		restarted[status.Name] = status.RestartCount > 0
+	}
+
+	for _, container := range pod.Spec.Containers {
+		for _, previous := range []bool{false, true} {
+			if previous && !restarted[container.Name] {
+				continue
+			}
+
+			data, err := c.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+				Container: container.Name,
+				SinceTime: sinceTime,
+				Previous:  previous,
+			}).DoRaw(ctx)
+			if err != nil {
+				framework.Logf("Failed to get logs of container %s in Pod %s/%s: %v", container.Name, pod.Namespace, pod.Name, err)
+
+				continue
+			}
+
+			fileName := fmt.Sprintf("%s_%s_%s.log", pod.Namespace, pod.Name, container.Name)
+			if previous {
+				fileName = fmt.Sprintf("%s_%s_%s_previous.log", pod.Namespace, pod.Name, container.Name)
+			}
+			if err := os.WriteFile(filepath.Join(dir, fileName), data, 0o644); err != nil {
+				framework.Logf("Failed to write logs of container %s in Pod %s/%s: %v", container.Name, pod.Namespace, pod.Name, err)
+			}
+		}
+	}
+}
@@ -22,13 +22,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/auth"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/clientset"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/metadata"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/cloud_provider/storage"
-	driver "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/csi_driver"
+	specbuilder "github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/spec_builder"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/volumespec"
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/onsi/ginkgo/v2"
 	v1 "k8s.io/api/core/v1"
@@ -48,26 +51,40 @@ type GCSFuseCSITestDriver struct {
 	volumeStore           []*gcsVolume
 	bucketLocation        string
 	skipGcpSaTest         bool
+	existingBuckets       []string // pre-created buckets the tests use instead of creating and deleting buckets
+	existingBucketIndex   int
+	storageEndpoint       string // GCS emulator endpoint, the buckets are created in the emulator if set
+	crossProjectID        string // project the cross-project buckets are created in
+	bucketKMSKeyName      string // Cloud KMS key the CMEK buckets are encrypted with
+	bucketPoolSize        int    // number of buckets created once and shared across the tests, 0 means a new bucket per test
+	bucketPool            []string
+	bucketPoolIndex       int
 }
 
 type gcsVolume struct {
 	bucketName              string
+	dir                     string // directory in the pre-created or pooled bucket that isolates the volume from other tests
 	serviceAccountNamespace string
 	mountOptions            string
+	quotaProject            string
 	shared                  bool
 	readOnly                bool
 }
 
 // InitGCSFuseCSITestDriver returns GCSFuseCSITestDriver that implements TestDriver interface.
-func InitGCSFuseCSITestDriver(c clientset.Interface, m metadata.Service, bl string, skipGcpSaTest bool) storageframework.TestDriver {
-	ssm, err := storage.NewGCSServiceManager()
+// If existingBuckets is not empty, the tests use the pre-created buckets, and do not mutate any IAM policies.
+// If storageEmulatorEndpoint is not empty, the tests create the buckets in the GCS emulator without authentication.
+// If crossProjectID is not empty, the cross-project tests create the buckets in the project.
+// If bucketPoolSize is not 0, the tests share a pool of buckets, which is deleted by DeleteBucketPool.
+func InitGCSFuseCSITestDriver(c clientset.Interface, m metadata.Service, bl string, skipGcpSaTest bool, existingBuckets []string, storageEmulatorEndpoint, crossProjectID, bucketKMSKeyName string, bucketPoolSize int) *GCSFuseCSITestDriver {
+	ssm, err := storage.NewGCSServiceManager("")
 	if err != nil {
 		e2eframework.Failf("Failed to set up storage service manager: %v", err)
 	}
 
 	return &GCSFuseCSITestDriver{
 		driverInfo: storageframework.DriverInfo{
-			Name:        driver.DefaultName,
+			Name:        volumespec.DriverName,
 			MaxFileSize: storageframework.FileSizeLarge,
 			SupportedFsType: sets.NewString(
 				"", // Default fsType
@@ -83,6 +100,11 @@ func InitGCSFuseCSITestDriver(c clientset.Interface, m metadata.Service, bl stri
 		volumeStore:           []*gcsVolume{},
 		bucketLocation:        bl,
 		skipGcpSaTest:         skipGcpSaTest,
+		existingBuckets:       existingBuckets,
+		storageEndpoint:       storageEmulatorEndpoint,
+		crossProjectID:        crossProjectID,
+		bucketKMSKeyName:      bucketKMSKeyName,
+		bucketPoolSize:        bucketPoolSize,
 	}
 }
 
@@ -102,6 +124,11 @@ func (n *GCSFuseCSITestDriver) SkipUnsupportedTest(pattern storageframework.Test
 	if pattern.VolType == storageframework.InlineVolume || pattern.VolType == storageframework.GenericEphemeralVolume {
 		e2eskipper.Skipf("GCS CSI Fuse CSI Driver does not support %s -- skipping", pattern.VolType)
 	}
+
+	// Dynamic provisioning creates buckets and grants the IAM roles.
+	if (n.useExistingBuckets() || n.storageEndpoint != "") && pattern.VolType == storageframework.DynamicPV {
+		e2eskipper.Skipf("%s requires creating buckets, not supported with existing buckets or the GCS emulator -- skipping", pattern.VolType)
+	}
 }
 
 func (n *GCSFuseCSITestDriver) PrepareTest(ctx context.Context, f *e2eframework.Framework) *storageframework.PerTestConfig {
@@ -123,7 +150,14 @@ func (n *GCSFuseCSITestDriver) PrepareTest(ctx context.Context, f *e2eframework.
 
 	ginkgo.DeferCleanup(func() {
 		for _, v := range n.volumeStore {
-			n.deleteBucket(ctx, v.bucketName)
+			switch {
+			case v.dir != "" && n.storageEndpoint != "":
+				// gsutil does not support the GCS emulator, and the objects are deleted along with the bucket pool.
+			case v.dir != "":
+				n.deleteBucketDir(v.bucketName, v.dir)
+			default:
+				n.deleteBucket(ctx, v.bucketName)
+			}
 		}
 		n.volumeStore = []*gcsVolume{}
 
@@ -148,12 +182,15 @@ func (n *GCSFuseCSITestDriver) CreateVolume(ctx context.Context, config *storage
 		case specs.InvalidVolumePrefix:
 			bucketName = specs.InvalidVolume
 		case specs.ForceNewBucketPrefix:
-			bucketName = n.createBucket(ctx, config.Framework.Namespace.Name)
+			bucketName = n.createBucketInProject(ctx, config.Framework.Namespace.Name, n.meta.GetProjectID())
 		case specs.MultipleBucketsPrefix:
+			if n.useExistingBuckets() {
+				e2eskipper.Skipf("mounting all the accessible buckets is not supported with existing buckets -- skipping")
+			}
 			isMultipleBucketsPrefix = true
 			l := []string{}
 			for i := 0; i < 2; i++ {
-				bucketName = n.createBucket(ctx, config.Framework.Namespace.Name)
+				bucketName = n.createBucketInProject(ctx, config.Framework.Namespace.Name, n.meta.GetProjectID())
 				n.volumeStore = append(n.volumeStore, &gcsVolume{
 					bucketName:              bucketName,
 					serviceAccountNamespace: config.Framework.Namespace.Name,
@@ -166,12 +203,26 @@ func (n *GCSFuseCSITestDriver) CreateVolume(ctx context.Context, config *storage
 
 			// Use config.Prefix to pass the bucket names back to the test suite.
 			config.Prefix = strings.Join(l, ",")
+		case specs.HNSBucketPrefix, specs.AutoclassBucketPrefix, specs.CMEKBucketPrefix:
+			bucketName = n.createFeatureBucket(ctx, config.Framework.Namespace.Name, config.Prefix)
 		case specs.SubfolderInBucketPrefix:
 			if len(n.volumeStore) == 0 {
 				bucketName = n.createBucket(ctx, config.Framework.Namespace.Name)
 			} else {
 				bucketName = n.volumeStore[len(n.volumeStore)-1].bucketName
 			}
+		case specs.CrossProjectBucketPrefix, specs.CrossProjectQuotaBucketPrefix:
+			if n.crossProjectID == "" {
+				e2eskipper.Skipf("cross-project tests require a cross project -- skipping")
+			}
+			if n.useExistingBuckets() || n.storageEndpoint != "" {
+				e2eskipper.Skipf("cross-project tests are not supported with existing buckets or the GCS emulator -- skipping")
+			}
+			if len(n.volumeStore) == 0 {
+				bucketName = n.createBucketInProject(ctx, config.Framework.Namespace.Name, n.crossProjectID)
+			} else {
+				return n.volumeStore[0]
+			}
 		default:
 			if len(n.volumeStore) == 0 {
 				bucketName = n.createBucket(ctx, config.Framework.Namespace.Name)
@@ -180,6 +231,13 @@ func (n *GCSFuseCSITestDriver) CreateVolume(ctx context.Context, config *storage
 			}
 		}
 
+		// Each volume uses a new directory in the pre-created or pooled bucket, so that the tests do not interfere with each other.
+		var dir string
+		if n.isSharedBucket(bucketName) {
+			dir = uuid.NewString()
+		}
+		onlyDir := dir
+
 		mountOptions := "debug_gcs,debug_fuse,debug_fs"
 		switch config.Prefix {
 		case specs.NonRootVolumePrefix:
@@ -187,18 +245,32 @@ func (n *GCSFuseCSITestDriver) CreateVolume(ctx context.Context, config *storage
 		case specs.InvalidMountOptionsVolumePrefix:
 			mountOptions += ",invalid-option"
 		case specs.ImplicitDirsVolumePrefix:
-			createImplicitDir(specs.ImplicitDirsPath, bucketName)
+			createImplicitDir(path.Join(dir, specs.ImplicitDirsPath), bucketName)
 			mountOptions += ",implicit-dirs"
+		case specs.FileCacheVolumePrefix:
+			mountOptions += ",implicit-dirs,experimental-local-file-cache"
+		case specs.RWFileModeMountOptionsVolumePrefix:
+			mountOptions += ",rw,file-mode=777,dir-mode=777"
 		case specs.SubfolderInBucketPrefix:
-			dirPath := uuid.NewString()
-			createImplicitDir(dirPath, bucketName)
-			mountOptions += ",only-dir=" + dirPath
+			onlyDir = path.Join(dir, uuid.NewString())
+			createImplicitDir(onlyDir, bucketName)
+		}
+		if onlyDir != "" {
+			mountOptions += ",only-dir=" + onlyDir
 		}
 
 		v := &gcsVolume{
 			bucketName:              bucketName,
+			dir:                     dir,
 			serviceAccountNamespace: config.Framework.Namespace.Name,
 			mountOptions:            mountOptions,
+			readOnly:                config.Prefix == specs.ReadOnlyVolumePrefix,
+		}
+
+		// Attribute the API quota to the bucket project, so that the identity also needs to use the cross project.
+		if config.Prefix == specs.CrossProjectQuotaBucketPrefix {
+			n.grantServiceUsageConsumer(ctx, config.Framework.Namespace.Name, n.crossProjectID)
+			v.quotaProject = n.crossProjectID
 		}
 
 		if !isMultipleBucketsPrefix {
@@ -219,28 +291,40 @@ func (v *gcsVolume) DeleteVolume(_ context.Context) {
 	// Does nothing because the driver cleanup will delete all the buckets.
 }
 
+// specVolume returns the volume spec of the test volume, built with the same validation as the user manifests.
+func (v *gcsVolume) specVolume() *specbuilder.Volume {
+	sv := specbuilder.NewVolume(v.bucketName).MountOptions(strings.Split(v.mountOptions, ",")...)
+	if v.quotaProject != "" {
+		sv.QuotaProject(v.quotaProject)
+	}
+	if v.readOnly {
+		sv.ReadOnly()
+	}
+
+	return sv
+}
+
 func (n *GCSFuseCSITestDriver) GetPersistentVolumeSource(readOnly bool, _ string, volume storageframework.TestVolume) (*v1.PersistentVolumeSource, *v1.VolumeNodeAffinity) {
 	gv, _ := volume.(*gcsVolume)
-	va := map[string]string{"mountOptions": gv.mountOptions}
-
-	return &v1.PersistentVolumeSource{
-		CSI: &v1.CSIPersistentVolumeSource{
-			Driver:           n.driverInfo.Name,
-			VolumeHandle:     gv.bucketName,
-			VolumeAttributes: va,
-			ReadOnly:         readOnly,
-		},
-	}, nil
+	sv := gv.specVolume()
+	if readOnly {
+		sv.ReadOnly()
+	}
+
+	source, err := sv.PersistentVolumeSource()
+	e2eframework.ExpectNoError(err, "failed to build the PersistentVolume source")
+
+	return source, nil
 }
 
 func (n *GCSFuseCSITestDriver) GetVolume(config *storageframework.PerTestConfig, _ int) (map[string]string, bool, bool) {
 	volume := n.CreateVolume(context.Background(), config, storageframework.PreprovisionedPV)
 	gv, _ := volume.(*gcsVolume)
 
-	return map[string]string{
-		"bucketName":   gv.bucketName,
-		"mountOptions": gv.mountOptions,
-	}, gv.shared, gv.readOnly
+	inlineVolume, err := gv.specVolume().InlineVolume("")
+	e2eframework.ExpectNoError(err, "failed to build the inline volume")
+
+	return inlineVolume.CSI.VolumeAttributes, gv.shared, gv.readOnly
 }
 
 func (n *GCSFuseCSITestDriver) GetCSIDriverName(_ *storageframework.PerTestConfig) string {
@@ -274,6 +358,10 @@ func (n *GCSFuseCSITestDriver) GetDynamicProvisionStorageClass(ctx context.Conte
 	}
 	generateName := "gcsfuse-csi-dynamic-test-sc-"
 	defaultBindingMode := storagev1.VolumeBindingWaitForFirstConsumer
+	reclaimPolicy := v1.PersistentVolumeReclaimDelete
+	if config.Prefix == specs.RetainVolumePrefix {
+		reclaimPolicy = v1.PersistentVolumeReclaimRetain
+	}
 
 	mountOptions := []string{"debug_gcs", "debug_fuse", "debug_fs"}
 	switch config.Prefix {
@@ -281,6 +369,10 @@ func (n *GCSFuseCSITestDriver) GetDynamicProvisionStorageClass(ctx context.Conte
 		mountOptions = append(mountOptions, "uid=1001", "gid=3003")
 	case specs.InvalidMountOptionsVolumePrefix:
 		mountOptions = append(mountOptions, "invalid-option")
+	case specs.FileCacheVolumePrefix:
+		mountOptions = append(mountOptions, "implicit-dirs", "experimental-local-file-cache")
+	case specs.RWFileModeMountOptionsVolumePrefix:
+		mountOptions = append(mountOptions, "rw", "file-mode=777", "dir-mode=777")
 	}
 
 	return &storagev1.StorageClass{
@@ -291,11 +383,17 @@ func (n *GCSFuseCSITestDriver) GetDynamicProvisionStorageClass(ctx context.Conte
 		MountOptions:      mountOptions,
 		Parameters:        parameters,
 		VolumeBindingMode: &defaultBindingMode,
+		ReclaimPolicy:     &reclaimPolicy,
 	}
 }
 
 // prepareStorageService prepares the GCS Storage Service using the default GCP credentials.
 func (n *GCSFuseCSITestDriver) prepareStorageService(ctx context.Context) (storage.Service, error) {
+	// The GCS emulator does not authenticate the requests.
+	if n.storageEndpoint != "" {
+		return n.storageServiceManager.SetupService(ctx, &auth.FakeGCPTokenSource{}, n.storageEndpoint, "")
+	}
+
 	storageService, err := n.storageServiceManager.SetupServiceWithDefaultCredential(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("storage service manager failed to setup service: %w", err)
@@ -304,8 +402,63 @@ func (n *GCSFuseCSITestDriver) prepareStorageService(ctx context.Context) (stora
 	return storageService, nil
 }
 
-// createBucket creates a GCS bucket.
+// createBucket creates a GCS bucket in the cluster project, or returns a bucket in the bucket pool if enabled.
 func (n *GCSFuseCSITestDriver) createBucket(ctx context.Context, serviceAccountNamespace string) string {
+	if n.useBucketPool() {
+		return n.getPoolBucket(ctx, serviceAccountNamespace)
+	}
+
+	return n.createBucketInProject(ctx, serviceAccountNamespace, n.meta.GetProjectID())
+}
+
+// getPoolBucket returns the buckets in the bucket pool in turn, and grants the test service account access to the bucket.
+// The pool buckets are created on first use, so that each Ginkgo process has its own pool.
+func (n *GCSFuseCSITestDriver) getPoolBucket(ctx context.Context, serviceAccountNamespace string) string {
+	if len(n.bucketPool) < n.bucketPoolSize {
+		bucketName := n.createBucketInProject(ctx, serviceAccountNamespace, n.meta.GetProjectID())
+		n.bucketPool = append(n.bucketPool, bucketName)
+
+		return bucketName
+	}
+
+	bucketName := n.bucketPool[n.bucketPoolIndex%len(n.bucketPool)]
+	n.bucketPoolIndex++
+	ginkgo.By(fmt.Sprintf("Using pooled bucket %q", bucketName))
+
+	// Each test uses a new namespace, so the bucket IAM policy accumulates the test service accounts until the pool is deleted.
+	if n.storageEndpoint == "" {
+		storageService, err := n.prepareStorageService(ctx)
+		if err != nil {
+			e2eframework.Failf("Failed to prepare storage service: %v", err)
+		}
+
+		if err := storageService.SetIAMPolicy(ctx, &storage.ServiceBucket{Name: bucketName}, n.serviceAccountMember(serviceAccountNamespace), "roles/storage.admin"); err != nil {
+			e2eframework.Failf("Failed to set the IAM policy for the pooled GCS bucket: %v", err)
+		}
+	}
+
+	return bucketName
+}
+
+// DeleteBucketPool deletes the buckets in the bucket pool, including the objects the tests did not clean up.
+func (n *GCSFuseCSITestDriver) DeleteBucketPool(ctx context.Context) {
+	for _, bucketName := range n.bucketPool {
+		n.deleteBucket(ctx, bucketName)
+	}
+	n.bucketPool = nil
+}
+
+// createBucketInProject creates a GCS bucket in the given project,
+// and grants the test service account in the cluster project access to the bucket.
+func (n *GCSFuseCSITestDriver) createBucketInProject(ctx context.Context, serviceAccountNamespace, projectID string) string {
+	if n.useExistingBuckets() {
+		bucketName := n.existingBuckets[n.existingBucketIndex%len(n.existingBuckets)]
+		n.existingBucketIndex++
+		ginkgo.By(fmt.Sprintf("Using existing bucket %q", bucketName))
+
+		return bucketName
+	}
+
 	storageService, err := n.prepareStorageService(ctx)
 	if err != nil {
 		e2eframework.Failf("Failed to prepare storage service: %v", err)
@@ -313,8 +466,8 @@ func (n *GCSFuseCSITestDriver) createBucket(ctx context.Context, serviceAccountN
 	// the GCS bucket name is always new and unique,
 	// so there is no need to check if the bucket already exists
 	newBucket := &storage.ServiceBucket{
-		Project:                        n.meta.GetProjectID(),
-		Name:                           uuid.NewString(),
+		Project:                        projectID,
+		Name:                           specs.TestBucketNamePrefix + uuid.NewString(),
 		Location:                       n.bucketLocation,
 		EnableUniformBucketLevelAccess: true,
 	}
@@ -325,17 +478,76 @@ func (n *GCSFuseCSITestDriver) createBucket(ctx context.Context, serviceAccountN
 		e2eframework.Failf("Failed to create a new GCS bucket: %v", err)
 	}
 
-	member := fmt.Sprintf("serviceAccount:%v.svc.id.goog[%v/%v]", n.meta.GetProjectID(), serviceAccountNamespace, specs.K8sServiceAccountName)
-	if !n.skipGcpSaTest {
-		member = fmt.Sprintf("serviceAccount:%v@%v.iam.gserviceaccount.com", prepareGcpSAName(serviceAccountNamespace), n.meta.GetProjectID())
+	// The GCS emulator does not support IAM policies.
+	if n.storageEndpoint != "" {
+		return bucket.Name
 	}
-	if err := storageService.SetIAMPolicy(ctx, bucket, member, "roles/storage.admin"); err != nil {
+
+	if err := storageService.SetIAMPolicy(ctx, bucket, n.serviceAccountMember(serviceAccountNamespace), "roles/storage.admin"); err != nil {
 		e2eframework.Failf("Failed to set the IAM policy for the new GCS bucket: %v", err)
 	}
 
 	return bucket.Name
 }
 
+// createFeatureBucket creates a GCS bucket with the optional bucket feature of the spec prefix,
+// and grants the test service account access to the bucket.
+// The bucket is created with gcloud because the storage client library does not support the hierarchical namespace.
+func (n *GCSFuseCSITestDriver) createFeatureBucket(ctx context.Context, serviceAccountNamespace, prefix string) string {
+	if n.useExistingBuckets() || n.storageEndpoint != "" {
+		e2eskipper.Skipf("bucket feature tests are not supported with existing buckets or the GCS emulator -- skipping")
+	}
+
+	bucketName := specs.TestBucketNamePrefix + uuid.NewString()
+	args := []string{"storage", "buckets", "create", "gs://" + bucketName, "--project", n.meta.GetProjectID(), "--location", n.bucketLocation, "--uniform-bucket-level-access"}
+	switch prefix {
+	case specs.HNSBucketPrefix:
+		args = append(args, "--enable-hierarchical-namespace")
+	case specs.AutoclassBucketPrefix:
+		args = append(args, "--enable-autoclass")
+	case specs.CMEKBucketPrefix:
+		if n.bucketKMSKeyName == "" {
+			e2eskipper.Skipf("CMEK bucket tests require a Cloud KMS key -- skipping")
+		}
+		args = append(args, "--default-encryption-key", n.bucketKMSKeyName)
+	}
+
+	ginkgo.By(fmt.Sprintf("Creating bucket %q: gcloud %v", bucketName, strings.Join(args, " ")))
+	if output, err := exec.Command("gcloud", args...).CombinedOutput(); err != nil {
+		e2eframework.Failf("Failed to create a new GCS bucket: %v, output: %s", err, output)
+	}
+
+	storageService, err := n.prepareStorageService(ctx)
+	if err != nil {
+		e2eframework.Failf("Failed to prepare storage service: %v", err)
+	}
+	if err := storageService.SetIAMPolicy(ctx, &storage.ServiceBucket{Name: bucketName}, n.serviceAccountMember(serviceAccountNamespace), "roles/storage.admin"); err != nil {
+		e2eframework.Failf("Failed to set the IAM policy for the new GCS bucket: %v", err)
+	}
+
+	return bucketName
+}
+
+// grantServiceUsageConsumer allows the test service account to attribute the API quota to the project.
+// The IAM policy binding is removed when the test finishes.
+func (n *GCSFuseCSITestDriver) grantServiceUsageConsumer(ctx context.Context, serviceAccountNamespace, projectID string) {
+	binding := specs.NewTestGCPProjectIAMPolicyBinding(projectID, n.serviceAccountMember(serviceAccountNamespace), "roles/serviceusage.serviceUsageConsumer", "")
+	binding.Create(ctx)
+
+	ginkgo.DeferCleanup(func() {
+		binding.Cleanup(ctx)
+	})
+}
+
+// serviceAccountMember returns the IAM member of the identity the test Pods in the namespace authenticate as.
+func (n *GCSFuseCSITestDriver) serviceAccountMember(serviceAccountNamespace string) string {
+	if !n.skipGcpSaTest {
+		return fmt.Sprintf("serviceAccount:%v@%v.iam.gserviceaccount.com", prepareGcpSAName(serviceAccountNamespace), n.meta.GetProjectID())
+	}
+
+	return fmt.Sprintf("serviceAccount:%v.svc.id.goog[%v/%v]", n.meta.GetProjectID(), serviceAccountNamespace, specs.K8sServiceAccountName)
+}
+
 // deleteBucket deletes the GCS bucket.
 func (n *GCSFuseCSITestDriver) deleteBucket(ctx context.Context, bucketName string) {
 	if bucketName == specs.InvalidVolume {
@@ -354,6 +566,41 @@ func (n *GCSFuseCSITestDriver) deleteBucket(ctx context.Context, bucketName stri
 	}
 }
 
+func (n *GCSFuseCSITestDriver) useExistingBuckets() bool {
+	return len(n.existingBuckets) > 0
+}
+
+func (n *GCSFuseCSITestDriver) useBucketPool() bool {
+	return n.bucketPoolSize > 0
+}
+
+// isSharedBucket returns true if the bucket is a pre-created or pooled bucket, which the tests share.
+func (n *GCSFuseCSITestDriver) isSharedBucket(bucketName string) bool {
+	for _, b := range n.existingBuckets {
+		if b == bucketName {
+			return true
+		}
+	}
+
+	for _, b := range n.bucketPool {
+		if b == bucketName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteBucketDir deletes the objects the test wrote to the directory in the pre-created bucket.
+func (n *GCSFuseCSITestDriver) deleteBucketDir(bucketName, dir string) {
+	ginkgo.By(fmt.Sprintf("Deleting directory %q in bucket %q", dir, bucketName))
+	//nolint:gosec
+	if output, err := exec.Command("gsutil", "-m", "rm", "-r", fmt.Sprintf("gs://%v/%v", bucketName, dir)).CombinedOutput(); err != nil {
+		// The directory does not exist if the test did not write any objects.
+		e2eframework.Logf("Failed to delete directory %q in GCS bucket %q: %v, output: %s", dir, bucketName, err, output)
+	}
+}
+
 func createImplicitDir(dirPath, bucketName string) {
 	// Use bucketName as the name of a temp file since bucketName is unique.
 	f, err := os.Create(bucketName)
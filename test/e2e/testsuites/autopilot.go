@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+type gcsFuseCSIAutopilotTestSuite struct {
+	tsInfo          storageframework.TestSuiteInfo
+	useGKEAutopilot bool
+}
+
+// InitGcsFuseCSIAutopilotTestSuite returns gcsFuseCSIAutopilotTestSuite that implements TestSuite interface.
+// The suite only runs on GKE Autopilot clusters.
+func InitGcsFuseCSIAutopilotTestSuite(useGKEAutopilot bool) func() storageframework.TestSuite {
+	return func() storageframework.TestSuite {
+		return &gcsFuseCSIAutopilotTestSuite{
+			tsInfo: storageframework.TestSuiteInfo{
+				Name: "autopilot",
+				TestPatterns: []storageframework.TestPattern{
+					storageframework.DefaultFsCSIEphemeralVolume,
+					storageframework.DefaultFsPreprovisionedPV,
+				},
+			},
+			useGKEAutopilot: useGKEAutopilot,
+		}
+	}
+}
+
+func (t *gcsFuseCSIAutopilotTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIAutopilotTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+	if !t.useGKEAutopilot {
+		e2eskipper.Skipf("skip because the cluster is not a GKE Autopilot cluster")
+	}
+}
+
+func (t *gcsFuseCSIAutopilotTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("autopilot", storageframework.GetDriverTimeouts(driver))
+	// Autopilot enforces the baseline Pod security standard on workloads.
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelBaseline
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	ginkgo.It("should inject the sidecar container with Autopilot-compliant resources", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		// Autopilot requires at least 250m CPU and 512Mi memory per Pod, and rounds up the resources of the containers.
+		tPod.SetResource("250m", "512Mi")
+		tPod.SetAnnotations(map[string]string{
+			"gke-gcsfuse/volumes":                 "true",
+			"gke-gcsfuse/cpu-limit":               "250m",
+			"gke-gcsfuse/memory-limit":            "256Mi",
+			"gke-gcsfuse/ephemeral-storage-limit": "5Gi",
+		})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the sidecar container has the requested resources")
+		sidecar := tPod.GetSidecarContainer()
+		for _, r := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage} {
+			gomega.Expect(sidecar.Resources.Requests).To(gomega.HaveKey(r))
+			gomega.Expect(sidecar.Resources.Limits).To(gomega.HaveKey(r))
+			request, limit := sidecar.Resources.Requests[r], sidecar.Resources.Limits[r]
+			gomega.Expect(request.Cmp(limit)).To(gomega.BeZero(), "the sidecar container %v request %v does not equal the limit %v", r, request.String(), limit.String())
+		}
+
+		ginkgo.By("Checking that the pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+	})
+
+	ginkgo.It("should store data in burstable workloads", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetBurstableResource("250m", "512Mi", "500m", "1Gi")
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running as a burstable pod")
+		tPod.WaitForRunning(ctx)
+		gomega.Expect(tPod.GetQOSClass()).To(gomega.Equal(v1.PodQOSBurstable))
+
+		ginkgo.By("Checking that the pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+	})
+
+	ginkgo.It("should satisfy the Autopilot security constraints", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetNonRootSecurityContext()
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the sidecar container is unprivileged")
+		sc := tPod.GetSidecarContainer().SecurityContext
+		gomega.Expect(sc).ToNot(gomega.BeNil())
+		gomega.Expect(sc.Privileged == nil || !*sc.Privileged).To(gomega.BeTrue(), "the sidecar container is privileged")
+		gomega.Expect(sc.AllowPrivilegeEscalation).To(gomega.HaveValue(gomega.BeFalse()))
+		gomega.Expect(sc.RunAsNonRoot).To(gomega.HaveValue(gomega.BeTrue()))
+		gomega.Expect(sc.Capabilities).ToNot(gomega.BeNil())
+		gomega.Expect(sc.Capabilities.Add).To(gomega.BeEmpty())
+
+		ginkgo.By("Checking that the non-root pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+	})
+}
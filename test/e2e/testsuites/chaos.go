@@ -0,0 +1,401 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+const (
+	// transportEndpointNotConnected is the documented I/O error after the gcsfuse process terminates.
+	transportEndpointNotConnected = "Transport endpoint is not connected"
+	nodeReadyTimeout              = 5 * time.Minute
+	// preemptionDataLossWindowMax is the upper bound of the writes lost when a Spot VM is preempted.
+	// Compute Engine gives preempted VMs 30 seconds to shut down before the VM is stopped.
+	preemptionDataLossWindowMax = 30 * time.Second
+	// nodeShutdownReason is the Pod status reason set by the kubelet graceful node shutdown.
+	nodeShutdownReason = "Terminated"
+)
+
+type gcsFuseCSIChaosTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIChaosTestSuite returns gcsFuseCSIChaosTestSuite that implements TestSuite interface.
+// The tests inject faults into the gcsfuse process, the sidecar container, the kubelet, and the node,
+// so they are disruptive and run serially.
+func InitGcsFuseCSIChaosTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIChaosTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "chaos",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIChaosTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIChaosTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIChaosTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("chaos", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	// The workload keeps the I/O errors of the killed gcsfuse process until the Pod is recreated, see docs/troubleshooting.md.
+	verifyRecoveryAfterPodRecreation := func() {
+		ginkgo.By("Recreating the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the recreated pod reads the data written before the fault")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep 'hello world' %v/data", mountPath))
+	}
+
+	ginkgo.It("[Disruptive] should return I/O errors after the gcsfuse process is killed", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.EnableProcessNamespaceSharing()
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Killing the gcsfuse process")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "pkill -9 -x gcsfuse")
+
+		ginkgo.By("Checking that the workload gets I/O errors")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("ls %v", mountPath), transportEndpointNotConnected)
+
+		ginkgo.By("Deleting the pod")
+		tPod.Cleanup(ctx)
+
+		verifyRecoveryAfterPodRecreation()
+	})
+
+	ginkgo.It("[Disruptive] should return I/O errors after the sidecar container is OOM-killed mid-I/O", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetAnnotations(map[string]string{
+			"gke-gcsfuse/volumes":      "true",
+			"gke-gcsfuse/memory-limit": "30Mi",
+		})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Running I/O until the sidecar container is OOM-killed")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("for i in $(seq 1 16); do (while true; do ls -R %v > /dev/null; echo $(date) >> %v/file-$i || break; done &) ; done", mountPath, mountPath))
+		tPod.WaitForSidecarTerminated(ctx, "OOMKilled")
+
+		ginkgo.By("Checking that the workload gets I/O errors")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("ls %v", mountPath), transportEndpointNotConnected)
+
+		ginkgo.By("Deleting the pod")
+		tPod.Cleanup(ctx)
+
+		verifyRecoveryAfterPodRecreation()
+	})
+
+	ginkgo.It("[Disruptive] should report the sidecar OOM and recover after the pod is recreated when large files are written with an undersized memory limit", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod with an undersized sidecar memory limit")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetAnnotations(map[string]string{
+			"gke-gcsfuse/volumes":      "true",
+			"gke-gcsfuse/memory-limit": "30Mi",
+		})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Writing large files until the sidecar container is OOM-killed")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("for i in $(seq 1 8); do (dd if=/dev/urandom of=%v/large-$i bs=1M count=1024 &) ; done", mountPath))
+		tPod.WaitForSidecarTerminated(ctx, "OOMKilled")
+
+		ginkgo.By("Checking that the node driver reports the OOM as a FailedMount event on the republish")
+		tPod.WaitForFailedMountError(ctx, codes.ResourceExhausted.String())
+		tPod.WaitForFailedMountError(ctx, "[SidecarOOM] the sidecar container terminated due to OOMKilled")
+
+		ginkgo.By("Checking that the restarted sidecar container does not recover the mount")
+		tPod.WaitForSidecarRestarted(ctx)
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("ls %v", mountPath), transportEndpointNotConnected)
+
+		ginkgo.By("Deleting the pod")
+		tPod.Cleanup(ctx)
+
+		verifyRecoveryAfterPodRecreation()
+	})
+
+	ginkgo.It("[Disruptive] should keep serving mounted volumes and mount new volumes after the kubelet restarts", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Restarting the kubelet")
+		specs.RunNodeCommand(ctx, f.ClientSet, f.Namespace, tPod.GetNode(), "systemctl restart kubelet")
+		ready := e2enode.WaitForNodeToBeReady(ctx, f.ClientSet, tPod.GetNode(), nodeReadyTimeout)
+		gomega.Expect(ready).To(gomega.BeTrue(), "node %s is not ready after the kubelet restart", tPod.GetNode())
+
+		ginkgo.By("Checking that the mounted volume keeps serving I/O")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep 'hello world' %v/data && echo 'hello again' > %v/data2", mountPath, mountPath))
+
+		ginkgo.By("Checking that a new pod on the same node mounts the volume")
+		tPod2 := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod2.SetNodeAffinity(tPod.GetNode(), true)
+		tPod2.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod2.Create(ctx)
+		defer tPod2.Cleanup(ctx)
+		tPod2.WaitForRunning(ctx)
+		tPod2.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep 'hello world' %v/data && grep 'hello again' %v/data2", mountPath, mountPath))
+	})
+
+	ginkgo.It("[Disruptive] should keep a single mount of the volume serving I/O across the kubelet restart, and unmount it after the pod is deleted", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+		// The CSI volume mounts of the Pod on the node, which are propagated from the node driver container to the host.
+		podMounts := fmt.Sprintf("grep '/pods/%v/volumes/kubernetes.io~csi/' /proc/self/mountinfo | grep -c fuse", tPod.GetUID())
+
+		ginkgo.By("Writing to the volume in the background")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("(while true; do date >> %v/log || break; sleep 1; done &)", mountPath))
+
+		ginkgo.By("Restarting the kubelet")
+		specs.RunNodeCommand(ctx, f.ClientSet, f.Namespace, tPod.GetNode(), "systemctl restart kubelet")
+		ready := e2enode.WaitForNodeToBeReady(ctx, f.ClientSet, tPod.GetNode(), nodeReadyTimeout)
+		gomega.Expect(ready).To(gomega.BeTrue(), "node %s is not ready after the kubelet restart", tPod.GetNode())
+
+		// The kubelet republishes the volume after the restart, which must find the existing mount instead of stacking a new one.
+		ginkgo.By("Checking that the volume stays mounted once on the node while the kubelet republishes it")
+		specs.RunNodeCommand(ctx, f.ClientSet, f.Namespace, tPod.GetNode(), fmt.Sprintf(`for i in $(seq 1 12); do test "$(%v)" -eq 1 || exit 1; sleep 10; done`, podMounts))
+
+		ginkgo.By("Checking that the background writes continued across the kubelet restart")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("a=$(wc -l < %v/log) && sleep 5 && b=$(wc -l < %v/log) && test $b -gt $a", mountPath, mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep 'hello world' %v/data", mountPath))
+
+		ginkgo.By("Deleting the pod")
+		framework.ExpectNoError(e2epod.DeletePodWithWaitByName(ctx, f.ClientSet, tPod.GetName(), f.Namespace.Name))
+
+		ginkgo.By("Checking that the volume is unmounted from the node")
+		specs.RunNodeCommand(ctx, f.ClientSet, f.Namespace, tPod.GetNode(), fmt.Sprintf(`test "$(%v)" -eq 0`, podMounts))
+	})
+
+	ginkgo.It("[Disruptive] should move the workload with its data when the node is drained mid-I/O", ginkgo.Serial, func() {
+		nodes, err := e2enode.GetBoundedReadySchedulableNodes(ctx, f.ClientSet, 2)
+		framework.ExpectNoError(err)
+		if len(nodes.Items) < 2 {
+			e2eskipper.Skipf("requires at least 2 schedulable nodes, got %v", len(nodes.Items))
+		}
+
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the deployment")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.SetCommand(fmt.Sprintf("i=0; while true; do echo $i > %v/$(hostname)-$i; i=$((i+1)); sleep 1; done", mountPath))
+		tDeployment := specs.NewTestDeployment(f.ClientSet, f.Namespace, tPod)
+
+		ginkgo.By("Deploying the deployment")
+		tDeployment.Create(ctx)
+		defer tDeployment.Cleanup(ctx)
+		tDeployment.WaitForComplete()
+		tPod.SetPod(tDeployment.GetPod(ctx))
+		tPod.WaitForRunning(ctx)
+		drainedPodName, drainedNode := tPod.GetName(), tPod.GetNode()
+
+		ginkgo.By("Draining the node mid-I/O")
+		specs.SetNodeUnschedulable(ctx, f.ClientSet, drainedNode, true)
+		defer specs.SetNodeUnschedulable(ctx, f.ClientSet, drainedNode, false)
+		tPod.Evict(ctx)
+
+		ginkgo.By("Checking that the workload is rescheduled to another node")
+		tDeployment.WaitForComplete()
+		tPod.SetPod(tDeployment.GetPod(ctx))
+		tPod.WaitForRunning(ctx)
+		gomega.Expect(tPod.GetNode()).ToNot(gomega.Equal(drainedNode))
+
+		ginkgo.By("Checking that the data written before the drain is persisted")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep -x 0 %v/%v-0", mountPath, drainedPodName))
+	})
+
+	ginkgo.It("[Disruptive] should unmount gracefully and bound the data loss window when a Spot node is preempted", ginkgo.Serial, func() {
+		spotNodes, err := f.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: "cloud.google.com/gke-spot=true"})
+		framework.ExpectNoError(err)
+		preemptibleNodes, err := f.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: "cloud.google.com/gke-preemptible=true"})
+		framework.ExpectNoError(err)
+		candidates := append(spotNodes.Items, preemptibleNodes.Items...)
+		if len(candidates) == 0 {
+			e2eskipper.Skipf("requires a Spot or preemptible node")
+		}
+		nodes, err := e2enode.GetBoundedReadySchedulableNodes(ctx, f.ClientSet, 2)
+		framework.ExpectNoError(err)
+		if len(nodes.Items) < 2 {
+			e2eskipper.Skipf("requires at least 2 schedulable nodes, got %v", len(nodes.Items))
+		}
+		preemptedNode := candidates[0].Name
+
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the writer pod on the Spot node")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetNodeAffinity(preemptedNode, true)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		// Each write creates a new object holding the write time, so the last persisted object marks the data loss window.
+		tPod.SetCommand(fmt.Sprintf("i=0; while true; do date +%%s > %v/$(hostname)-$i; i=$((i+1)); sleep 1; done", mountPath))
+
+		ginkgo.By("Deploying the writer pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+		tPod.WaitForRunning(ctx)
+		writerPodName := tPod.GetName()
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("sleep 10 && test -s %v/%v-5", mountPath, writerPodName))
+
+		ginkgo.By("Preempting the node mid-I/O")
+		preemptionTime := time.Now()
+		specs.SimulateNodePreemption(ctx, f.ClientSet, preemptedNode)
+		defer func() {
+			ready := e2enode.WaitForNodeToBeReady(ctx, f.ClientSet, preemptedNode, nodeReadyTimeout)
+			gomega.Expect(ready).To(gomega.BeTrue(), "node %s is not ready after the preemption", preemptedNode)
+		}()
+
+		ginkgo.By("Checking that the pod is terminated by the graceful node shutdown")
+		if terminatedPod := tPod.WaitForTerminatedOrDeleted(ctx); terminatedPod != nil {
+			gomega.Expect(terminatedPod.Status.Reason).To(gomega.Equal(nodeShutdownReason), "pod %s was not terminated by the graceful node shutdown: %v", writerPodName, terminatedPod.Status.Message)
+		}
+
+		ginkgo.By("Reading the persisted data from another node")
+		tPod2 := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod2.SetNodeAffinity(preemptedNode, false)
+		tPod2.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+		tPod2.Create(ctx)
+		defer tPod2.Cleanup(ctx)
+		tPod2.WaitForRunning(ctx)
+
+		// An object created right before the shutdown may be empty, but no more than one.
+		emptyObjects := tPod2.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("find %v -name '%v-*' -size 0 | wc -l", mountPath, writerPodName))
+		gomega.Expect(strconv.Atoi(strings.TrimSpace(emptyObjects))).To(gomega.BeNumerically("<=", 1))
+
+		lastWrite := tPod2.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("cat %v/%v-* | sort -n | tail -n 1", mountPath, writerPodName))
+		lastWriteUnix, err := strconv.ParseInt(strings.TrimSpace(lastWrite), 10, 64)
+		framework.ExpectNoError(err, "failed to parse the last persisted write time %q", lastWrite)
+
+		dataLossWindow := preemptionTime.Sub(time.Unix(lastWriteUnix, 0))
+		if dataLossWindow < 0 {
+			dataLossWindow = 0
+		}
+		framework.Logf("Data loss window of the preempted node %s: %v", preemptedNode, dataLossWindow)
+		ginkgo.AddReportEntry("preemption data loss window", dataLossWindow.String())
+		gomega.Expect(dataLossWindow).To(gomega.BeNumerically("<=", preemptionDataLossWindowMax))
+	})
+}
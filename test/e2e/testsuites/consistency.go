@@ -0,0 +1,260 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+const (
+	consistencyPodCount      = 3
+	consistencyFilesPerPod   = 20
+	consistencyWriteRounds   = 10
+	consistencyCacheTTL      = 15 * time.Second
+	consistencyPollInterval  = time.Second
+	consistencyExecOverheads = 10 * time.Second
+)
+
+type gcsFuseCSIConsistencyTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIConsistencyTestSuite returns gcsFuseCSIConsistencyTestSuite that implements TestSuite interface.
+func InitGcsFuseCSIConsistencyTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIConsistencyTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "consistency",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIConsistencyTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIConsistencyTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIConsistencyTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("consistency", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	// getNodes returns up to consistencyPodCount schedulable nodes, and skips the test if there are fewer than 2.
+	getNodes := func() []string {
+		nodes, err := e2enode.GetBoundedReadySchedulableNodes(ctx, f.ClientSet, consistencyPodCount)
+		framework.ExpectNoError(err)
+		if len(nodes.Items) < 2 {
+			e2eskipper.Skipf("requires at least 2 schedulable nodes, got %v", len(nodes.Items))
+		}
+
+		nodeNames := []string{}
+		for _, node := range nodes.Items {
+			nodeNames = append(nodeNames, node.Name)
+		}
+
+		return nodeNames
+	}
+
+	// createPodsOnDifferentNodes deploys a pod on each of the nodes, all mounting the same bucket with the cache TTL.
+	createPodsOnDifferentNodes := func(nodeNames []string, cacheTTL time.Duration) []*specs.TestPod {
+		// The mount options are appended to the shared volume attributes once, instead of once per pod.
+		l.volumeResource.VolSource.CSI.VolumeAttributes["mountOptions"] += fmt.Sprintf(",stat-cache-ttl=%v,type-cache-ttl=%v", cacheTTL, cacheTTL)
+
+		tPods := []*specs.TestPod{}
+		for i, nodeName := range nodeNames {
+			ginkgo.By(fmt.Sprintf("Deploying pod %v on node %v", i, nodeName))
+			tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+			tPod.SetNodeAffinity(nodeName, true)
+			tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+			tPod.Create(ctx)
+			tPods = append(tPods, tPod)
+		}
+
+		for _, tPod := range tPods {
+			tPod.WaitForRunning(ctx)
+		}
+
+		return tPods
+	}
+
+	cleanupPods := func(tPods []*specs.TestPod) {
+		for _, tPod := range tPods {
+			tPod.Cleanup(ctx)
+		}
+	}
+
+	// runConcurrently runs the function for each pod at the same time.
+	runConcurrently := func(tPods []*specs.TestPod, fn func(i int, tPod *specs.TestPod)) {
+		var wg sync.WaitGroup
+		for i, tPod := range tPods {
+			wg.Add(1)
+			go func(i int, tPod *specs.TestPod) {
+				defer ginkgo.GinkgoRecover()
+				defer wg.Done()
+				fn(i, tPod)
+			}(i, tPod)
+		}
+		wg.Wait()
+	}
+
+	// waitForOutput runs the command in the pod until the output is expected, and fails if it takes longer than the bound.
+	waitForOutput := func(tPod *specs.TestPod, cmd, expected string, bound time.Duration) {
+		start := time.Now()
+		var output string
+		err := wait.PollUntilContextTimeout(ctx, consistencyPollInterval, bound, true, func(context.Context) (bool, error) {
+			stdout, _, err := e2epod.ExecCommandInContainerWithFullOutput(f, tPod.GetName(), specs.TesterContainerName, "/bin/sh", "-c", cmd)
+			output = strings.TrimSpace(stdout)
+
+			return err == nil && output == expected, nil
+		})
+		if err != nil {
+			framework.Failf("%q in pod %v did not output %q within %v, the last output is %q", cmd, tPod.GetName(), expected, bound, output)
+		}
+		ginkgo.By(fmt.Sprintf("%q in pod %v output the expected result after %v", cmd, tPod.GetName(), time.Since(start)))
+	}
+
+	testVisibility := func(cacheTTL time.Duration) {
+		nodeNames := getNodes()
+		init()
+		defer cleanup()
+
+		tPods := createPodsOnDifferentNodes(nodeNames, cacheTTL)
+		defer cleanupPods(tPods)
+		writer, readers := tPods[0], tPods[1:]
+		bound := cacheTTL + consistencyExecOverheads
+
+		ginkgo.By("Checking that a new file is visible to the other pods")
+		writer.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'version 1' > %v/data", mountPath))
+		for _, reader := range readers {
+			waitForOutput(reader, fmt.Sprintf("cat %v/data", mountPath), "version 1", bound)
+		}
+
+		ginkgo.By("Checking that an overwritten file is visible to the other pods")
+		writer.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'version 2, which is longer' > %v/data", mountPath))
+		for _, reader := range readers {
+			waitForOutput(reader, fmt.Sprintf("cat %v/data", mountPath), "version 2, which is longer", bound)
+		}
+
+		ginkgo.By("Checking that a deleted file is invisible to the other pods")
+		writer.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("rm %v/data", mountPath))
+		for _, reader := range readers {
+			waitForOutput(reader, fmt.Sprintf("test -e %v/data && echo exists || echo deleted", mountPath), "deleted", bound)
+		}
+	}
+
+	ginkgo.It("should make the changes visible to pods on other nodes immediately when the cache is disabled", func() {
+		testVisibility(0)
+	})
+
+	ginkgo.It("should make the changes visible to pods on other nodes within the cache TTL", func() {
+		testVisibility(consistencyCacheTTL)
+	})
+
+	ginkgo.It("should list all the files written concurrently by pods on different nodes", func() {
+		nodeNames := getNodes()
+		init()
+		defer cleanup()
+
+		tPods := createPodsOnDifferentNodes(nodeNames, 0)
+		defer cleanupPods(tPods)
+
+		ginkgo.By("Writing files to the same directory from all the pods concurrently")
+		runConcurrently(tPods, func(i int, tPod *specs.TestPod) {
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mkdir -p %v/shared && for j in $(seq %v); do echo \"pod-%v file-$j\" > %v/shared/pod-%v-file-$j; done", mountPath, consistencyFilesPerPod, i, mountPath, i))
+		})
+
+		ginkgo.By("Checking that all the pods list and read all the files")
+		expectedCount := fmt.Sprint(len(tPods) * consistencyFilesPerPod)
+		runConcurrently(tPods, func(_ int, tPod *specs.TestPod) {
+			waitForOutput(tPod, fmt.Sprintf("ls %v/shared | wc -l", mountPath), expectedCount, consistencyExecOverheads)
+			for i := range tPods {
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("for j in $(seq %v); do grep -x \"pod-%v file-$j\" %v/shared/pod-%v-file-$j; done", consistencyFilesPerPod, i, mountPath, i))
+			}
+		})
+	})
+
+	ginkgo.It("should not mix the content of a file written concurrently by pods on different nodes", func() {
+		nodeNames := getNodes()
+		init()
+		defer cleanup()
+
+		tPods := createPodsOnDifferentNodes(nodeNames, 0)
+		defer cleanupPods(tPods)
+
+		ginkgo.By("Overwriting the same file from all the pods concurrently")
+		runConcurrently(tPods, func(i int, tPod *specs.TestPod) {
+			// Each line is written by a separate write call, so a mixed object would contain lines from different pods.
+			// A write may fail if another pod replaced the object since it was opened, which is allowed.
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("for r in $(seq %v); do (for k in $(seq 1000); do echo pod-%v; done > %v/contended) || true; done", consistencyWriteRounds, i, mountPath))
+		})
+
+		ginkgo.By("Checking that the file content is from a single pod")
+		for _, tPod := range tPods {
+			output := tPod.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("sort -u %v/contended", mountPath))
+			lines := strings.Fields(output)
+			if len(lines) != 1 {
+				framework.Failf("The file written concurrently contains the content from multiple pods: %v", lines)
+			}
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("test $(wc -l < %v/contended) -eq 1000", mountPath))
+		}
+	})
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+const (
+	integritySmallFileCount = 50
+	integritySmallFileSize  = 256 * 1024
+	integrityLargeFileSize  = 512 * 1024 * 1024
+)
+
+type gcsFuseCSIDataIntegrityTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIDataIntegrityTestSuite returns gcsFuseCSIDataIntegrityTestSuite that implements TestSuite interface.
+func InitGcsFuseCSIDataIntegrityTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIDataIntegrityTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "dataIntegrity",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIDataIntegrityTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIDataIntegrityTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+// getVolumeGCSPath returns the bucket name of the volume, followed by the only-dir directory if the volume mounts one.
+func getVolumeGCSPath(volumeResource *storageframework.VolumeResource) string {
+	gcsPath := volumeResource.VolSource.CSI.VolumeAttributes["bucketName"]
+	for _, o := range strings.Split(volumeResource.VolSource.CSI.VolumeAttributes["mountOptions"], ",") {
+		kv := strings.Split(o, "=")
+		if len(kv) == 2 && kv[0] == "only-dir" {
+			gcsPath += "/" + kv[1]
+		}
+	}
+
+	return gcsPath
+}
+
+// parseSha256sumOutput returns the checksums in the sha256sum output keyed by the file base names.
+func parseSha256sumOutput(output string) map[string]string {
+	checksums := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		checksums[filepath.Base(fields[1])] = fields[0]
+	}
+
+	return checksums
+}
+
+// localFileChecksums returns the sha256 checksums of the files in the local directory keyed by the file names.
+func localFileChecksums(dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	framework.ExpectNoError(err)
+
+	checksums := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		framework.ExpectNoError(err)
+		sum := sha256.Sum256(data)
+		checksums[entry.Name()] = hex.EncodeToString(sum[:])
+	}
+
+	return checksums
+}
+
+func (t *gcsFuseCSIDataIntegrityTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("data-integrity", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	createTestPod := func() *specs.TestPod {
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetResource("1", "1Gi")
+		tPod.SetAnnotations(map[string]string{
+			"gke-gcsfuse/volumes":                 "true",
+			"gke-gcsfuse/ephemeral-storage-limit": "2Gi",
+		})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false, "implicit-dirs")
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		return tPod
+	}
+
+	// downloadChecksums reads the objects under the directory directly from GCS, and returns their checksums.
+	downloadChecksums := func(dir string) map[string]string {
+		localDir, err := os.MkdirTemp("", "gcsfuse-data-integrity")
+		framework.ExpectNoError(err)
+		defer os.RemoveAll(localDir)
+
+		src := fmt.Sprintf("gs://%v/%v/*", getVolumeGCSPath(l.volumeResource), dir)
+		//nolint:gosec
+		if output, err := exec.Command("gsutil", "-m", "cp", src, localDir).CombinedOutput(); err != nil {
+			framework.Failf("Failed to download the objects %q from GCS: %v, output: %s", src, err, output)
+		}
+
+		return localFileChecksums(localDir)
+	}
+
+	// uploadRandomFiles writes files with random content directly to the directory in GCS, and returns their checksums.
+	uploadRandomFiles := func(dir string, sizes map[string]int) map[string]string {
+		localDir, err := os.MkdirTemp("", "gcsfuse-data-integrity")
+		framework.ExpectNoError(err)
+		defer os.RemoveAll(localDir)
+
+		for name, size := range sizes {
+			data := make([]byte, size)
+			_, err := rand.Read(data)
+			framework.ExpectNoError(err)
+			framework.ExpectNoError(os.WriteFile(filepath.Join(localDir, name), data, 0o644))
+		}
+
+		dest := fmt.Sprintf("gs://%v/%v/", getVolumeGCSPath(l.volumeResource), dir)
+		//nolint:gosec
+		if output, err := exec.Command("gsutil", "-m", "cp", filepath.Join(localDir, "*"), dest).CombinedOutput(); err != nil {
+			framework.Failf("Failed to upload the files to %q: %v, output: %s", dest, err, output)
+		}
+
+		return localFileChecksums(localDir)
+	}
+
+	verifyChecksums := func(expected, actual map[string]string) {
+		if len(expected) != len(actual) {
+			framework.Failf("Expected %v files, but got %v", len(expected), len(actual))
+		}
+		for name, checksum := range expected {
+			if actual[name] != checksum {
+				framework.Failf("The checksum of file %q is %q, expected %q", name, actual[name], checksum)
+			}
+		}
+	}
+
+	testWriteThroughVolume := func(dir string, count, size int) {
+		tPod := createTestPod()
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By(fmt.Sprintf("Writing %v files of %v bytes through the volume", count, size))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mkdir -p %v/%v && for i in $(seq %v); do head -c %v /dev/urandom > %v/%v/file-$i; done", mountPath, dir, count, size, mountPath, dir))
+		output := tPod.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("sha256sum %v/%v/*", mountPath, dir))
+		expected := parseSha256sumOutput(output)
+
+		ginkgo.By("Checking the checksums of the objects read directly from GCS")
+		verifyChecksums(expected, downloadChecksums(dir))
+	}
+
+	ginkgo.It("should preserve the checksums of small files written through the volume", func() {
+		init()
+		defer cleanup()
+
+		testWriteThroughVolume("small-files", integritySmallFileCount, integritySmallFileSize)
+	})
+
+	ginkgo.It("should preserve the checksums of large files written through the volume", func() {
+		init()
+		defer cleanup()
+
+		testWriteThroughVolume("large-files", 1, integrityLargeFileSize)
+	})
+
+	ginkgo.It("should preserve the checksums of files written directly in GCS", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Writing files directly in GCS")
+		sizes := map[string]int{"large-file": integrityLargeFileSize}
+		for i := 0; i < integritySmallFileCount; i++ {
+			sizes[fmt.Sprintf("small-file-%v", i)] = integritySmallFileSize
+		}
+		expected := uploadRandomFiles("gcs-written", sizes)
+
+		tPod := createTestPod()
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking the checksums of the files read through the volume")
+		output := tPod.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("sha256sum %v/gcs-written/*", mountPath))
+		verifyChecksums(expected, parseSha256sumOutput(output))
+	})
+
+	ginkgo.It("should not corrupt the object when the write is interrupted", func() {
+		init()
+		defer cleanup()
+
+		tPod := createTestPod()
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Interrupting a large file copy to the volume")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("head -c %v /dev/urandom > /tmp/source && mkdir -p %v/interrupted", integrityLargeFileSize, mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("cp /tmp/source %v/interrupted/file & pid=$!; sleep 2; kill -9 $pid; wait $pid || true", mountPath))
+
+		ginkgo.By("Checking that the object is absent, or a prefix of the source file")
+		localDir, err := os.MkdirTemp("", "gcsfuse-data-integrity")
+		framework.ExpectNoError(err)
+		defer os.RemoveAll(localDir)
+
+		src := fmt.Sprintf("gs://%v/interrupted/file", getVolumeGCSPath(l.volumeResource))
+		//nolint:gosec
+		if output, err := exec.Command("gsutil", "cp", src, localDir).CombinedOutput(); err != nil {
+			if strings.Contains(string(output), "No URLs matched") {
+				ginkgo.By("The interrupted write did not create the object")
+
+				return
+			}
+			framework.Failf("Failed to download the object %q from GCS: %v, output: %s", src, err, output)
+		}
+
+		data, err := os.ReadFile(filepath.Join(localDir, "file"))
+		framework.ExpectNoError(err)
+		sum := sha256.Sum256(data)
+		ginkgo.By(fmt.Sprintf("The interrupted write created an object of %v bytes", len(data)))
+		prefixChecksum := tPod.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName, fmt.Sprintf("head -c %v /tmp/source | sha256sum", len(data)))
+		if strings.Fields(prefixChecksum)[0] != hex.EncodeToString(sum[:]) {
+			framework.Failf("The object of %v bytes written by the interrupted copy is not a prefix of the source file", len(data))
+		}
+	})
+}
@@ -19,10 +19,14 @@ package testsuites
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/onsi/ginkgo/v2"
 	"google.golang.org/grpc/codes"
+	v1 "k8s.io/api/core/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
@@ -31,6 +35,70 @@ import (
 	admissionapi "k8s.io/pod-security-admission/api"
 )
 
+// invalidVolumeAttributeCase is a documented volume attribute set to an invalid value, and the exact error it surfaces:
+// either the FailedMount event of the node driver, or the webhook denial of the Pod creation.
+type invalidVolumeAttributeCase struct {
+	attributes map[string]string
+	// failedMountError is the gRPC error of the NodePublishVolume call, as shown in the FailedMount event.
+	failedMountError string
+	// admissionError is the error of the Pod creation, for the attributes validated by the webhook.
+	admissionError string
+}
+
+// invalidVolumeAttributeCases covers each documented volume attribute with an invalid value.
+// The error messages are asserted verbatim, so that a change of the message is a deliberate change of the tests.
+var invalidVolumeAttributeCases = []invalidVolumeAttributeCase{
+	{
+		attributes:       map[string]string{"bucketName": ""},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "bucketName" must be provided for ephemeral storage`,
+	},
+	{
+		attributes:       map[string]string{"metricsExportInterval": "1s"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "metricsExportInterval" must be a duration of at least 10s, got "1s"`,
+	},
+	{
+		attributes:       map[string]string{"metricsExportInterval": "every-minute"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "metricsExportInterval" must be a duration of at least 10s, got "every-minute"`,
+	},
+	{
+		attributes:       map[string]string{"skipBucketAccessCheck": "yes"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "skipBucketAccessCheck" must be a boolean, got "yes"`,
+	},
+	{
+		attributes:       map[string]string{"fileCacheShared": "yes"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "fileCacheShared" must be a boolean, got "yes"`,
+	},
+	{
+		attributes:       map[string]string{"requestPriority": "high"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "requestPriority" must be one of "latency-sensitive" and "throughput-batch", got "high"`,
+	},
+	{
+		attributes:       map[string]string{"maxParallelDownloads": "32"},
+		failedMountError: `rpc error: code = InvalidArgument desc = NodePublishVolume VolumeContext "downloadChunkSizeMb" and "maxParallelDownloads" require the file cache, set the file-cache-max-size-mb mount option`,
+	},
+	{
+		attributes:     map[string]string{"downloadChunkSizeMb": "0"},
+		admissionError: `volume attribute "downloadChunkSizeMb" must be an integer between 1 and 1024, got "0"`,
+	},
+	{
+		attributes:     map[string]string{"maxParallelDownloads": "1000"},
+		admissionError: `volume attribute "maxParallelDownloads" must be an integer between 1 and 256, got "1000"`,
+	},
+	{
+		attributes:     map[string]string{"tmpVolumeSize": "-1Gi"},
+		admissionError: `volume attribute "tmpVolumeSize" must be a positive quantity, got "-1Gi"`,
+	},
+	{
+		attributes:     map[string]string{"expectedMaxWriteSize": "large"},
+		admissionError: `volume attribute "expectedMaxWriteSize" must be a positive quantity, got "large"`,
+	},
+}
+
+// workloadIdentityErrorTimeout bounds how long it may take for a broken Workload Identity setup
+// to surface as a classified FailedMount event. The driver retries the token exchange for 30 seconds
+// before failing a NodePublishVolume call, and the kubelet backs off between the calls.
+const workloadIdentityErrorTimeout = 3 * time.Minute
+
 type gcsFuseCSIFailedMountTestSuite struct {
 	tsInfo storageframework.TestSuiteInfo
 }
@@ -104,6 +172,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error")
 		tPod.WaitForFailedMountError(ctx, codes.NotFound.String())
 		tPod.WaitForFailedMountError(ctx, "storage: bucket doesn't exist")
+		tPod.WaitForFailedMountError(ctx, "[BucketNotFound]")
 	})
 
 	ginkgo.It("should fail when the specified GCS bucket name is invalid", func() {
@@ -125,6 +194,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error")
 		tPod.WaitForFailedMountError(ctx, codes.NotFound.String())
 		tPod.WaitForFailedMountError(ctx, "storage: bucket doesn't exist")
+		tPod.WaitForFailedMountError(ctx, "[BucketNotFound]")
 	})
 
 	ginkgo.It("should fail when the specified service account does not have access to the GCS bucket", func() {
@@ -148,6 +218,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error PermissionDenied")
 		tPod.WaitForFailedMountError(ctx, codes.PermissionDenied.String())
 		tPod.WaitForFailedMountError(ctx, "does not have storage.objects.list access to the Google Cloud Storage bucket.")
+		tPod.WaitForFailedMountError(ctx, "[IAMPermissionDenied]")
 
 		ginkgo.By("Deleting the Kubernetes service account")
 		testK8sSA.Cleanup(ctx)
@@ -155,6 +226,68 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error Unauthenticated")
 		tPod.WaitForFailedMountError(ctx, codes.Unauthenticated.String())
 		tPod.WaitForFailedMountError(ctx, "storage service manager failed to setup service: context deadline exceeded")
+		tPod.WaitForFailedMountError(ctx, "[WorkloadIdentityNotConfigured]")
+	})
+
+	ginkgo.It("should fail when the Kubernetes service account is bound to a non-existent GCP service account via Workload Identity", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying a Kubernetes service account annotated with a non-existent GCP service account")
+		saName := "sa-with-non-existent-gcp-sa"
+		projectID := "gcs-fuse-csi-non-existent"
+		if gcpSAEmail := specs.GetKubernetesServiceAccount(ctx, f.ClientSet, f.Namespace, specs.K8sServiceAccountName).GetGCPServiceAccountEmail(); gcpSAEmail != "" {
+			projectID = strings.TrimSuffix(gcpSAEmail[strings.Index(gcpSAEmail, "@")+1:], ".iam.gserviceaccount.com")
+		}
+		testK8sSA := specs.NewTestKubernetesServiceAccount(f.ClientSet, f.Namespace, saName, "non-existent@"+projectID+".iam.gserviceaccount.com")
+		testK8sSA.Create(ctx)
+		defer testK8sSA.Cleanup(ctx)
+		tPod.SetServiceAccount(saName)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod has failed mount error Unauthenticated")
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, codes.Unauthenticated.String(), workloadIdentityErrorTimeout)
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, "fetch GCP service account token error", workloadIdentityErrorTimeout)
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, "[WorkloadIdentityNotConfigured]", workloadIdentityErrorTimeout)
+	})
+
+	ginkgo.It("should fail when the GCP service account does not have the Workload Identity binding for the Kubernetes service account", func() {
+		init()
+		defer cleanup()
+
+		gcpSAEmail := specs.GetKubernetesServiceAccount(ctx, f.ClientSet, f.Namespace, specs.K8sServiceAccountName).GetGCPServiceAccountEmail()
+		if gcpSAEmail == "" {
+			e2eskipper.Skipf("skip because the test Kubernetes service account is not bound with a GCP service account")
+		}
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		// The GCP service account only grants roles/iam.workloadIdentityUser to the test Kubernetes service account,
+		// so any other Kubernetes service account annotated with it cannot impersonate it.
+		ginkgo.By("Deploying a Kubernetes service account annotated with a GCP service account it is not bound to")
+		saName := "sa-without-wi-binding"
+		testK8sSA := specs.NewTestKubernetesServiceAccount(f.ClientSet, f.Namespace, saName, gcpSAEmail)
+		testK8sSA.Create(ctx)
+		defer testK8sSA.Cleanup(ctx)
+		tPod.SetServiceAccount(saName)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod has failed mount error Unauthenticated")
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, codes.Unauthenticated.String(), workloadIdentityErrorTimeout)
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, "fetch GCP service account token error", workloadIdentityErrorTimeout)
+		tPod.WaitForFailedMountErrorWithTimeout(ctx, "[WorkloadIdentityNotConfigured]", workloadIdentityErrorTimeout)
 	})
 
 	ginkgo.It("should fail when the sidecar container is not injected", func() {
@@ -174,6 +307,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error")
 		tPod.WaitForFailedMountError(ctx, codes.FailedPrecondition.String())
 		tPod.WaitForFailedMountError(ctx, "failed to find the sidecar container in Pod spec")
+		tPod.WaitForFailedMountError(ctx, "[SidecarNotInjected]")
 	})
 
 	ginkgo.It("should fail when the gcsfuse processes got killed due to OOM", func() {
@@ -196,6 +330,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 
 		ginkgo.By("Checking that the pod has failed mount error")
 		tPod.WaitForFailedMountError(ctx, codes.ResourceExhausted.String())
+		tPod.WaitForFailedMountError(ctx, "[SidecarOOM]")
 	})
 
 	ginkgo.It("should fail when invalid mount options are passed", func() {
@@ -213,6 +348,7 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod has failed mount error")
 		tPod.WaitForFailedMountError(ctx, codes.InvalidArgument.String())
 		tPod.WaitForFailedMountError(ctx, "Incorrect Usage. flag provided but not defined: -invalid-option")
+		tPod.WaitForFailedMountError(ctx, "[InvalidMountFlag]")
 	})
 
 	ginkgo.It("should fail when the sidecar container is specified with high resource usage", func() {
@@ -236,4 +372,74 @@ func (t *gcsFuseCSIFailedMountTestSuite) DefineTests(driver storageframework.Tes
 		ginkgo.By("Checking that the pod is in Unschedulable status")
 		tPod.WaitForUnschedulable(ctx)
 	})
+
+	ginkgo.It("[windows] should fail when the pod is scheduled to Windows nodes", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetOS(v1.Windows)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Checking that the webhook rejects the pod")
+		tPod.CreateAndExpectError(ctx, "unsupported operating system \"windows\"")
+	})
+
+	ginkgo.It("[windows] should fail when the pod without the sidecar container runs on Windows nodes", func() {
+		if !specs.WindowsNodesExist(ctx, f.ClientSet) {
+			e2eskipper.Skipf("skip because the cluster does not have Windows nodes")
+		}
+
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetOS(v1.Windows)
+		tPod.SetAnnotations(map[string]string{})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod has failed mount error")
+		tPod.WaitForFailedMountError(ctx, "driver name gcsfuse.csi.storage.gke.io not found in the list of registered CSI drivers")
+	})
+
+	for _, tc := range invalidVolumeAttributeCases {
+		tc := tc
+		ginkgo.It(fmt.Sprintf("[volume-attributes] should fail when the volume attributes are invalid: %v", tc.attributes), func() {
+			// The attributes of the PersistentVolumes are validated by the same node driver code, and optionally by the validating webhook at the PV creation.
+			if pattern.VolType != storageframework.CSIInlineVolume {
+				e2eskipper.Skipf("skip for volume type %v", pattern.VolType)
+			}
+
+			init()
+			defer cleanup()
+
+			for k, v := range tc.attributes {
+				l.volumeResource.VolSource.CSI.VolumeAttributes[k] = v
+			}
+
+			ginkgo.By("Configuring the pod")
+			tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+			tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+			if tc.admissionError != "" {
+				ginkgo.By("Checking that the webhook rejects the pod")
+				tPod.CreateAndExpectError(ctx, fmt.Sprintf("volume %q: %v", "test-gcsfuse-volume", tc.admissionError))
+
+				return
+			}
+
+			ginkgo.By("Deploying the pod")
+			tPod.Create(ctx)
+			defer tPod.Cleanup(ctx)
+
+			ginkgo.By("Checking that the pod has failed mount error")
+			tPod.WaitForFailedMountError(ctx, tc.failedMountError)
+		})
+	}
 }
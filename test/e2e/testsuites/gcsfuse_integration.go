@@ -26,30 +26,43 @@ import (
 	"github.com/onsi/ginkgo/v2"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/kubernetes/test/e2e/framework"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
 	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
 	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
 	admissionapi "k8s.io/pod-security-admission/api"
 )
 
 const (
-	gcsfuseIntegrationTestsBasePath = "gcsfuse/tools/integration_tests"
+	gcsfuseSourcePath               = "/gcsfuse"
+	gcsfuseIntegrationTestsBasePath = gcsfuseSourcePath + "/tools/integration_tests"
+	gcsfuseRepoURL                  = "https://github.com/GoogleCloudPlatform/gcsfuse.git"
 	exportGoPath                    = "export PATH=$PATH:/usr/local/go/bin"
 	commonTestCommand               = "GODEBUG=asyncpreemptoff=1 go test . -p 1 --integrationTest -v --mountedDirectory="
 )
 
 type gcsFuseCSIGCSFuseIntegrationTestSuite struct {
-	tsInfo storageframework.TestSuiteInfo
+	tsInfo     storageframework.TestSuiteInfo
+	gcsfuseRef string
+	goVersion  string
+	testImage  string
 }
 
 // InitGcsFuseCSIGCSFuseIntegrationTestSuite returns gcsFuseCSIGCSFuseIntegrationTestSuite that implements TestSuite interface.
-func InitGcsFuseCSIGCSFuseIntegrationTestSuite() storageframework.TestSuite {
-	return &gcsFuseCSIGCSFuseIntegrationTestSuite{
-		tsInfo: storageframework.TestSuiteInfo{
-			Name: "gcsfuseIntegration",
-			TestPatterns: []storageframework.TestPattern{
-				storageframework.DefaultFsCSIEphemeralVolume,
+// The suite checks out the gcsfuse integration tests at gcsfuseRef and runs them with Go goVersion.
+// If testImage is set, the image is used instead, which must contain the gcsfuse source at /gcsfuse and Go at /usr/local/go.
+func InitGcsFuseCSIGCSFuseIntegrationTestSuite(gcsfuseRef, goVersion, testImage string) func() storageframework.TestSuite {
+	return func() storageframework.TestSuite {
+		return &gcsFuseCSIGCSFuseIntegrationTestSuite{
+			tsInfo: storageframework.TestSuiteInfo{
+				Name: "gcsfuseIntegration",
+				TestPatterns: []storageframework.TestPattern{
+					storageframework.DefaultFsCSIEphemeralVolume,
+				},
 			},
-		},
+			gcsfuseRef: gcsfuseRef,
+			goVersion:  goVersion,
+			testImage:  testImage,
+		}
 	}
 }
 
@@ -58,6 +71,9 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) GetTestSuiteInfo() storageframew
 }
 
 func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+	if t.testImage == "" && (t.gcsfuseRef == "" || t.goVersion == "") {
+		e2eskipper.Skipf("skip because neither the gcsfuse integration test image nor the gcsfuse ref %q and Go version %q are set", t.gcsfuseRef, t.goVersion)
+	}
 }
 
 func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
@@ -89,10 +105,14 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframew
 		framework.ExpectNoError(err, "while cleaning up")
 	}
 
-	gcsfuseIntegrationTest := func(testName string, readOnly bool, mountOptions ...string) {
+	gcsfuseIntegrationTestWithEphemeralStorageLimit := func(testName, ephemeralStorageLimit string, readOnly bool, mountOptions ...string) {
 		ginkgo.By("Configuring the test pod")
 		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
-		tPod.SetImage(specs.GoogleCloudCliImage)
+		if t.testImage != "" {
+			tPod.SetImage(t.testImage)
+		} else {
+			tPod.SetImage(specs.GoogleCloudCliImage)
+		}
 		tPod.SetResource("1", "1Gi")
 
 		mo := l.volumeResource.VolSource.CSI.VolumeAttributes["mountOptions"]
@@ -106,7 +126,7 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframew
 			"gke-gcsfuse/volumes":                 "true",
 			"gke-gcsfuse/cpu-limit":               "250m",
 			"gke-gcsfuse/memory-limit":            "256Mi",
-			"gke-gcsfuse/ephemeral-storage-limit": "1Gi",
+			"gke-gcsfuse/ephemeral-storage-limit": ephemeralStorageLimit,
 		})
 
 		bucketName := l.volumeResource.VolSource.CSI.VolumeAttributes["bucketName"]
@@ -136,9 +156,12 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframew
 		}
 
 		ginkgo.By("Checking that the gcsfuse integration tests exits with no error")
-		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "apt-get update && apt-get install wget git -y")
-		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "wget https://go.dev/dl/go1.20.5.linux-$(dpkg --print-architecture).tar.gz -q && tar -C /usr/local -xzf go1.20.5.linux-$(dpkg --print-architecture).tar.gz")
-		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "git clone https://github.com/GoogleCloudPlatform/gcsfuse.git")
+		if t.testImage == "" {
+			goTarball := fmt.Sprintf("go%v.linux-$(dpkg --print-architecture).tar.gz", t.goVersion)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "apt-get update && apt-get install wget git -y")
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("wget https://go.dev/dl/%v -q && tar -C /usr/local -xzf %v", goTarball, goTarball))
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("git clone %v %v && cd %v && git checkout %v", gcsfuseRepoURL, gcsfuseSourcePath, gcsfuseSourcePath, t.gcsfuseRef))
+		}
 
 		switch testName {
 		case "readonly":
@@ -156,6 +179,10 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframew
 		}
 	}
 
+	gcsfuseIntegrationTest := func(testName string, readOnly bool, mountOptions ...string) {
+		gcsfuseIntegrationTestWithEphemeralStorageLimit(testName, "1Gi", readOnly, mountOptions...)
+	}
+
 	// The following test cases are derived from https://github.com/GoogleCloudPlatform/gcsfuse/blob/master/tools/integration_tests/run_tests_mounted_directory.sh
 
 	ginkgo.It("should succeed in operations test 1", func() {
@@ -353,17 +380,78 @@ func (t *gcsFuseCSIGCSFuseIntegrationTestSuite) DefineTests(driver storageframew
 		gcsfuseIntegrationTest("list_large_dir", false, "implicit-dirs=true")
 	})
 
-	ginkgo.It("should succeed in write_large_files test 1", func() {
-		init()
-		defer cleanup()
+	// gcsfuse stages the written files in the sidecar container ephemeral storage until the files are closed and uploaded.
+	// The write_large_files tests write 500MiB files, so they run with the ephemeral-storage limits that can stage the files.
+	for _, limit := range []string{"1Gi", "5Gi"} {
+		limit := limit
 
-		gcsfuseIntegrationTest("write_large_files", false, "implicit-dirs=true", "enable-storage-client-library=false")
-	})
+		ginkgo.It(fmt.Sprintf("should succeed in write_large_files test 1 with ephemeral-storage-limit %v", limit), func() {
+			init()
+			defer cleanup()
 
-	ginkgo.It("should succeed in write_large_files test 2", func() {
-		init()
-		defer cleanup()
+			gcsfuseIntegrationTestWithEphemeralStorageLimit("write_large_files", limit, false, "implicit-dirs=true", "enable-storage-client-library=false")
+		})
 
-		gcsfuseIntegrationTest("write_large_files", false, "implicit-dirs=true", "enable-storage-client-library=true")
-	})
+		ginkgo.It(fmt.Sprintf("should succeed in write_large_files test 2 with ephemeral-storage-limit %v", limit), func() {
+			init()
+			defer cleanup()
+
+			gcsfuseIntegrationTestWithEphemeralStorageLimit("write_large_files", limit, false, "implicit-dirs=true", "enable-storage-client-library=true")
+		})
+	}
+
+	// When the staged file does not fit in the sidecar container ephemeral-storage limit, the write does not fail with ENOSPC.
+	// Instead, the kubelet evicts the Pod, because the Pod exceeds its ephemeral storage limit.
+	ephemeralStorageTests := []struct {
+		limit       string
+		fileSizeMiB int
+		evicted     bool
+	}{
+		{limit: "256Mi", fileSizeMiB: 64, evicted: false},
+		{limit: "256Mi", fileSizeMiB: 512, evicted: true},
+		{limit: "1Gi", fileSizeMiB: 512, evicted: false},
+		{limit: "1Gi", fileSizeMiB: 2048, evicted: true},
+	}
+	for _, tc := range ephemeralStorageTests {
+		tc := tc
+		result := "succeed"
+		if tc.evicted {
+			result = "be evicted"
+		}
+
+		ginkgo.It(fmt.Sprintf("should %v when writing a %vMiB file with ephemeral-storage-limit %v", result, tc.fileSizeMiB, tc.limit), func() {
+			init()
+			defer cleanup()
+
+			ginkgo.By("Configuring the test pod")
+			tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+			tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+			tPod.SetAnnotations(map[string]string{
+				"gke-gcsfuse/volumes":                 "true",
+				"gke-gcsfuse/ephemeral-storage-limit": tc.limit,
+			})
+
+			ginkgo.By("Deploying the test pod")
+			tPod.Create(ctx)
+			defer tPod.Cleanup(ctx)
+
+			ginkgo.By("Checking that the test pod is running")
+			tPod.WaitForRunning(ctx)
+
+			writeCmd := fmt.Sprintf("dd if=/dev/urandom of=%v/data bs=1M count=%v", mountPath, tc.fileSizeMiB)
+			if !tc.evicted {
+				ginkgo.By("Checking that the file is written")
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("%v && [ $(stat -c %%s %v/data) -eq %v ]", writeCmd, mountPath, tc.fileSizeMiB*1024*1024))
+
+				return
+			}
+
+			ginkgo.By("Writing the file in the background")
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("nohup %v > /dev/null 2>&1 &", writeCmd))
+
+			ginkgo.By("Checking that the test pod is evicted")
+			message := tPod.WaitForEvicted(ctx)
+			framework.Logf("Pod evicted: %v", message)
+		})
+	}
 }
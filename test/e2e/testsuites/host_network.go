@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+// metadataServerEmailURL returns the identity that the metadata server vends to the caller.
+const metadataServerEmailURL = "http://169.254.169.254/computeMetadata/v1/instance/service-accounts/default/email"
+
+type gcsFuseCSIHostNetworkTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIHostNetworkTestSuite returns gcsFuseCSIHostNetworkTestSuite that implements TestSuite interface.
+func InitGcsFuseCSIHostNetworkTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIHostNetworkTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "hostNetwork",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+				storageframework.DefaultFsPreprovisionedPV,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIHostNetworkTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIHostNetworkTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIHostNetworkTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("host-network", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func() {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	// hostNetwork Pods are not supported yet. The CSI driver checks the bucket access using the Pod
+	// Kubernetes service account token, but the GKE metadata server does not serve hostNetwork Pods,
+	// so Cloud Storage FUSE in the sidecar container authenticates as the node service account.
+	// This test documents the current failure mode. Once the driver passes the Pod token to the
+	// sidecar container through an alternate token path, it should assert the mount uses the Pod identity.
+	ginkgo.It("should not authenticate the sidecar container with the Pod Workload Identity when the pod uses hostNetwork", func() {
+		init()
+		defer cleanup()
+
+		k8sSA := specs.GetKubernetesServiceAccount(ctx, f.ClientSet, f.Namespace, specs.K8sServiceAccountName)
+
+		ginkgo.By("Configuring the hostNetwork pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetHostNetwork(true)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the pod network namespace gets the node identity instead of the Pod Workload Identity")
+		email := strings.TrimSpace(tPod.VerifyExecInPodSucceedWithOutput(f, specs.TesterContainerName,
+			fmt.Sprintf("wget -q -O - --header 'Metadata-Flavor: Google' %v", metadataServerEmailURL)))
+		framework.Logf("The hostNetwork pod authenticates as %q", email)
+		gomega.Expect(email).NotTo(gomega.HaveSuffix(".svc.id.goog"))
+		if gcpSAEmail := k8sSA.GetGCPServiceAccountEmail(); gcpSAEmail != "" {
+			gomega.Expect(email).NotTo(gomega.Equal(gcpSAEmail))
+		}
+
+		ginkgo.By("Checking that the read-only mount is accessible")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("ls %v", mountPath))
+	})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+type gcsFuseCSIIstioTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIIstioTestSuite returns gcsFuseCSIIstioTestSuite that implements TestSuite interface.
+// The suite requires Istio or Anthos Service Mesh installed on the cluster.
+func InitGcsFuseCSIIstioTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIIstioTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "istio",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+				storageframework.DefaultFsPreprovisionedPV,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIIstioTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIIstioTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIIstioTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("istio", storageframework.GetDriverTimeouts(driver))
+	// The istio-init container requires NET_ADMIN and NET_RAW capabilities.
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	testCaseMountWithMTLSMode := func(mode string) {
+		if !specs.IstioInstalled(ctx, f.ClientSet) {
+			e2eskipper.Skipf("skip because Istio is not installed on the cluster")
+		}
+
+		init()
+		defer cleanup()
+
+		ginkgo.By("Enabling Istio sidecar injection in the namespace")
+		specs.EnableIstioSidecarInjection(ctx, f.ClientSet, f.Namespace)
+
+		ginkgo.By(fmt.Sprintf("Configuring the %v mTLS mode", mode))
+		tPeerAuthentication := specs.NewTestPeerAuthentication(f.DynamicClient, f.Namespace, mode)
+		tPeerAuthentication.Create(ctx)
+		defer tPeerAuthentication.Cleanup(ctx)
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetIstioAnnotations()
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the Istio sidecar proxy is injected")
+		gomega.Expect(tPod.HasContainer(specs.IstioProxyContainerName)).To(gomega.BeTrue(), "the pod does not have the %v container", specs.IstioProxyContainerName)
+
+		ginkgo.By("Checking that the pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+	}
+
+	ginkgo.It("should store data with the Istio sidecar proxy in permissive mTLS mode", func() {
+		testCaseMountWithMTLSMode("PERMISSIVE")
+	})
+
+	ginkgo.It("should store data with the Istio sidecar proxy in strict mTLS mode", func() {
+		testCaseMountWithMTLSMode("STRICT")
+	})
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"google.golang.org/grpc/codes"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+const (
+	nodePublishVolumeMethod   = "/csi.v1.Node/NodePublishVolume"
+	nodeUnpublishVolumeMethod = "/csi.v1.Node/NodeUnpublishVolume"
+	mountPhaseMetricCount     = "gcsfusecsi_mount_phase_duration_seconds_count"
+	mountPhaseMetricSum       = "gcsfusecsi_mount_phase_duration_seconds_sum"
+	metricsPollInterval       = 5 * time.Second
+	metricsPollTimeout        = 2 * time.Minute
+)
+
+// mountPhases are the mount phases observed for every successful mount.
+// The token and bucket check phases are skipped in some configurations, e.g. when the bucket access check is disabled.
+var mountPhases = []string{"validation", "pod_check", "mount", "fd_handoff", "gcsfuse_ready"}
+
+type gcsFuseCSIMetricsTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIMetricsTestSuite returns gcsFuseCSIMetricsTestSuite that implements TestSuite interface.
+func InitGcsFuseCSIMetricsTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIMetricsTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "metrics",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+				storageframework.DefaultFsPreprovisionedPV,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIMetricsTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIMetricsTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIMetricsTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("metrics", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	// scrapeNodeDriverMetrics skips the test if the CSI driver metrics are not available, e.g. when the managed driver is used.
+	scrapeNodeDriverMetrics := func(nodeName string) testutil.Metrics {
+		m, found := specs.GetNodeDriverMetrics(ctx, f.ClientSet, nodeName)
+		if !found {
+			e2eskipper.Skipf("skip because the CSI driver metrics are not available on node %v", nodeName)
+		}
+
+		return m
+	}
+
+	// waitForMetrics scrapes the node driver metrics until check returns no error, because some series are recorded asynchronously.
+	waitForMetrics := func(nodeName string, check func(testutil.Metrics) error) {
+		var lastErr error
+		err := wait.PollUntilContextTimeout(ctx, metricsPollInterval, metricsPollTimeout, true, func(context.Context) (bool, error) {
+			m, _ := specs.GetNodeDriverMetrics(ctx, f.ClientSet, nodeName)
+			lastErr = check(m)
+
+			return lastErr == nil, nil
+		})
+		if err != nil {
+			framework.Failf("The CSI driver metrics on node %v are not as expected: %v", nodeName, lastErr)
+		}
+	}
+
+	ginkgo.It("should export the mount metrics from the node driver", func() {
+		init()
+		defer cleanup()
+
+		node, err := e2enode.GetRandomReadySchedulableNode(ctx, f.ClientSet)
+		framework.ExpectNoError(err)
+		metricsBefore := scrapeNodeDriverMetrics(node.Name)
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetNodeAffinity(node.Name, true)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Checking that the node plugin is reported as registered")
+		waitForMetrics(node.Name, func(m testutil.Metrics) error {
+			samples := m["gcsfusecsi_node_plugin_registered"]
+			if len(samples) == 0 || samples[0].Value != 1 {
+				return fmt.Errorf("gcsfusecsi_node_plugin_registered is %v, expected 1", samples)
+			}
+
+			return nil
+		})
+
+		ginkgo.By("Checking that the NodePublishVolume calls and the mount latency are recorded")
+		waitForMetrics(node.Name, func(m testutil.Metrics) error {
+			if delta := counterDelta(metricsBefore, m, "csi_operations_total", map[string]string{"method_name": nodePublishVolumeMethod, "grpc_status_code": codes.OK.String()}); delta < 1 {
+				return fmt.Errorf("successful NodePublishVolume calls increased by %v, expected at least 1", delta)
+			}
+			for _, phase := range mountPhases {
+				labels := map[string]string{"phase": phase}
+				if delta := counterDelta(metricsBefore, m, mountPhaseMetricCount, labels); delta < 1 {
+					return fmt.Errorf("mount phase %q observations increased by %v, expected at least 1", phase, delta)
+				}
+				if delta := counterDelta(metricsBefore, m, mountPhaseMetricSum, labels); delta <= 0 {
+					return fmt.Errorf("mount phase %q latency increased by %v, expected a positive value", phase, delta)
+				}
+			}
+
+			return nil
+		})
+
+		ginkgo.By("Deleting the pod")
+		tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the NodeUnpublishVolume calls are recorded")
+		waitForMetrics(node.Name, func(m testutil.Metrics) error {
+			if delta := counterDelta(metricsBefore, m, "csi_operations_total", map[string]string{"method_name": nodeUnpublishVolumeMethod, "grpc_status_code": codes.OK.String()}); delta < 1 {
+				return fmt.Errorf("successful NodeUnpublishVolume calls increased by %v, expected at least 1", delta)
+			}
+
+			return nil
+		})
+	})
+
+	ginkgo.It("should export the failed mount metrics from the node driver", func() {
+		init(specs.FakeVolumePrefix)
+		defer cleanup()
+
+		node, err := e2enode.GetRandomReadySchedulableNode(ctx, f.ClientSet)
+		framework.ExpectNoError(err)
+		metricsBefore := scrapeNodeDriverMetrics(node.Name)
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetNodeAffinity(node.Name, true)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod has failed mount error")
+		tPod.WaitForFailedMountError(ctx, codes.NotFound.String())
+
+		ginkgo.By("Checking that the failed NodePublishVolume calls are recorded")
+		waitForMetrics(node.Name, func(m testutil.Metrics) error {
+			if delta := counterDelta(metricsBefore, m, "csi_operations_total", map[string]string{"method_name": nodePublishVolumeMethod, "grpc_status_code": codes.NotFound.String()}); delta < 1 {
+				return fmt.Errorf("NodePublishVolume calls with status %v increased by %v, expected at least 1", codes.NotFound, delta)
+			}
+
+			return nil
+		})
+	})
+}
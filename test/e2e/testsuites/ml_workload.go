@@ -0,0 +1,200 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+const (
+	gpuNodeLabel    = "cloud.google.com/gke-accelerator"
+	tpuNodeLabel    = "cloud.google.com/gke-tpu-accelerator"
+	gpuResourceName = v1.ResourceName("nvidia.com/gpu")
+	tpuResourceName = v1.ResourceName("google.com/tpu")
+	datasetDir      = "dataset"
+	datasetShards   = 64
+	datasetShardMiB = 4
+	checkpointDir   = "checkpoints"
+	checkpointMiB   = 256
+	trainingEpochs  = 3
+)
+
+type gcsFuseCSIMLWorkloadTestSuite struct {
+	tsInfo storageframework.TestSuiteInfo
+}
+
+// InitGcsFuseCSIMLWorkloadTestSuite returns gcsFuseCSIMLWorkloadTestSuite that implements TestSuite interface.
+// The suite requires GPU or TPU node pools in the cluster.
+func InitGcsFuseCSIMLWorkloadTestSuite() storageframework.TestSuite {
+	return &gcsFuseCSIMLWorkloadTestSuite{
+		tsInfo: storageframework.TestSuiteInfo{
+			Name: "mlWorkload",
+			TestPatterns: []storageframework.TestPattern{
+				storageframework.DefaultFsCSIEphemeralVolume,
+				storageframework.DefaultFsPreprovisionedPV,
+			},
+		},
+	}
+}
+
+func (t *gcsFuseCSIMLWorkloadTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIMLWorkloadTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+}
+
+func (t *gcsFuseCSIMLWorkloadTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("ml-workload", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	// getAcceleratorNode returns a node with the accelerator label, and the number of accelerators the Pod should request.
+	getAcceleratorNode := func(nodeLabel string, resourceName v1.ResourceName) (*v1.Node, string) {
+		nodeList, err := f.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: nodeLabel})
+		framework.ExpectNoError(err)
+		for i := range nodeList.Items {
+			node := &nodeList.Items[i]
+			if q, ok := node.Status.Allocatable[resourceName]; ok && !q.IsZero() {
+				// A TPU Pod must request all the TPU chips on the node, while one GPU is enough.
+				if resourceName == tpuResourceName {
+					return node, q.String()
+				}
+
+				return node, "1"
+			}
+		}
+
+		return nil, ""
+	}
+
+	testCaseTrainingWorkload := func(nodeLabel string, resourceName v1.ResourceName) {
+		node, acceleratorCount := getAcceleratorNode(nodeLabel, resourceName)
+		if node == nil {
+			e2eskipper.Skipf("skip because the cluster does not have nodes with allocatable %v", resourceName)
+		}
+
+		init(specs.FileCacheVolumePrefix)
+		defer cleanup()
+
+		ginkgo.By("Configuring the training pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetResource("1", "1Gi")
+		tPod.SetExtendedResource(resourceName, acceleratorCount)
+		tPod.SetNodeSelector(map[string]string{nodeLabel: node.Labels[nodeLabel]})
+		// The file cache is stored in the sidecar container ephemeral storage, so give the sidecar enough room for the dataset.
+		tPod.SetAnnotations(map[string]string{
+			"gke-gcsfuse/volumes":                 "true",
+			"gke-gcsfuse/cpu-limit":               "1",
+			"gke-gcsfuse/memory-limit":            "1Gi",
+			"gke-gcsfuse/ephemeral-storage-limit": "5Gi",
+		})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the training pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the training pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Preparing the dataset shards")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf(
+			"mkdir -p %[1]v/%[2]v && for i in $(seq 1 %[3]v); do dd if=/dev/urandom of=%[1]v/%[2]v/shard-$i bs=1M count=%[4]v; done && md5sum %[1]v/%[2]v/* > /tmp/dataset.md5",
+			mountPath, datasetDir, datasetShards, datasetShardMiB))
+
+		for epoch := 1; epoch <= trainingEpochs; epoch++ {
+			ginkgo.By(fmt.Sprintf("Reading the dataset in epoch %v", epoch))
+			// Later epochs are served from the gcsfuse file cache, and must return the same content.
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "md5sum -c /tmp/dataset.md5")
+
+			ginkgo.By(fmt.Sprintf("Writing the checkpoint of epoch %v", epoch))
+			// Write the checkpoint to a temporary file then rename it, as ML frameworks do to avoid partial checkpoints.
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf(
+				"mkdir -p %[1]v/%[2]v && dd if=/dev/urandom of=%[1]v/%[2]v/.ckpt-%[3]v.tmp bs=1M count=%[4]v && mv %[1]v/%[2]v/.ckpt-%[3]v.tmp %[1]v/%[2]v/ckpt-%[3]v && md5sum %[1]v/%[2]v/ckpt-%[3]v > /tmp/ckpt-%[3]v.md5",
+				mountPath, checkpointDir, epoch, checkpointMiB))
+		}
+
+		ginkgo.By("Restoring the checkpoints")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("test $(ls %v/%v | wc -l) -eq %v", mountPath, checkpointDir, trainingEpochs))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "for f in /tmp/ckpt-*.md5; do md5sum -c $f || exit 1; done")
+
+		ginkgo.By("Deleting the training pod")
+		tPod.Cleanup(ctx)
+
+		ginkgo.By("Configuring the inference pod")
+		tPod = specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetExtendedResource(resourceName, acceleratorCount)
+		tPod.SetNodeSelector(map[string]string{nodeLabel: node.Labels[nodeLabel]})
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+
+		ginkgo.By("Deploying the inference pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the inference pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Loading the latest checkpoint")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("cat %v/%v/ckpt-%v > /dev/null", mountPath, checkpointDir, trainingEpochs))
+	}
+
+	ginkgo.It("should read datasets and write checkpoints on GPU nodes with file cache enabled", func() {
+		testCaseTrainingWorkload(gpuNodeLabel, gpuResourceName)
+	})
+
+	ginkgo.It("should read datasets and write checkpoints on TPU nodes with file cache enabled", func() {
+		testCaseTrainingWorkload(tpuNodeLabel, tpuResourceName)
+	})
+}
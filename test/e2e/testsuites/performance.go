@@ -24,6 +24,10 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/onsi/ginkgo/v2"
@@ -46,6 +50,7 @@ type fioJobOptions struct {
 }
 
 type fioJob struct {
+	JobName string `json:"jobname"`
 	//nolint:tagliatelle
 	JobOptions  fioJobOptions `json:"job options"`
 	ReadMetric  metrics       `json:"read"`
@@ -56,20 +61,109 @@ type fioResult struct {
 	Jobs []fioJob `json:"jobs"`
 }
 
+// perfResult is a row of the structured performance results, which are written as newline-delimited JSON
+// so that they can be loaded to BigQuery for longitudinal regression tracking.
+type perfResult struct {
+	Timestamp string  `json:"timestamp"`
+	RunID     string  `json:"runID"`
+	Profile   string  `json:"profile"`
+	JobName   string  `json:"jobName"`
+	ReadWrite string  `json:"readWrite"`
+	FileSize  string  `json:"fileSize"`
+	Params    string  `json:"params"`
+	IOPS      float32 `json:"iops"`
+	BwBytes   float32 `json:"bwBytes"`
+}
+
+const (
+	// defaultFioProfile is the upstream gcsfuse fio job the performance thresholds are defined for.
+	defaultFioProfile    = "seq_rand_read_write"
+	defaultFioJobFileURL = "https://raw.githubusercontent.com/GoogleCloudPlatform/gcsfuse/master/perfmetrics/scripts/job_files/seq_rand_read_write.fio"
+	fioJobFilesDir       = "./testsuites/fio_jobs"
+	perfResultsFileName  = "perf_results.json"
+)
+
+// defaultFioParams are the environment variables the fio job files can reference, e.g. ${NUMJOBS}.
+// The DIRECTORY variable is always set to the profile directory in the volume.
+var defaultFioParams = map[string]string{
+	"NUMJOBS":  "4",
+	"FILESIZE": "512M",
+	"RUNTIME":  "60",
+	"NRFILES":  "100",
+}
+
 type gcsFuseCSIPerformanceTestSuite struct {
-	tsInfo storageframework.TestSuiteInfo
+	tsInfo         storageframework.TestSuiteInfo
+	fioJobFiles    string
+	fioParams      string
+	resultsGCSPath string
 }
 
 // InitGcsFuseCSIPerformanceTestSuite returns gcsFuseCSIPerformanceTestSuite that implements TestSuite interface.
-func InitGcsFuseCSIPerformanceTestSuite() storageframework.TestSuite {
-	return &gcsFuseCSIPerformanceTestSuite{
-		tsInfo: storageframework.TestSuiteInfo{
-			Name: "performance",
-			TestPatterns: []storageframework.TestPattern{
-				storageframework.DefaultFsCSIEphemeralVolume,
+// fioJobFiles is a comma-separated list of fio job file paths, each of which runs as a profile named after the file.
+// If it is empty, the upstream gcsfuse fio job and the job files in testsuites/fio_jobs run.
+// fioParams is a comma-separated list of KEY=VALUE pairs that override defaultFioParams.
+// If resultsGCSPath is set, the structured results are uploaded to the GCS path, e.g. gs://my-bucket/perf.
+func InitGcsFuseCSIPerformanceTestSuite(fioJobFiles, fioParams, resultsGCSPath string) func() storageframework.TestSuite {
+	return func() storageframework.TestSuite {
+		return &gcsFuseCSIPerformanceTestSuite{
+			tsInfo: storageframework.TestSuiteInfo{
+				Name: "performance",
+				TestPatterns: []storageframework.TestPattern{
+					storageframework.DefaultFsCSIEphemeralVolume,
+				},
 			},
-		},
+			fioJobFiles:    fioJobFiles,
+			fioParams:      fioParams,
+			resultsGCSPath: resultsGCSPath,
+		}
+	}
+}
+
+// parseFioParams merges the comma-separated KEY=VALUE pairs into defaultFioParams.
+func parseFioParams(params string) (map[string]string, error) {
+	merged := map[string]string{}
+	for k, v := range defaultFioParams {
+		merged[k] = v
+	}
+
+	for _, p := range strings.Split(params, ",") {
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.ContainsAny(kv[1], "'") {
+			return nil, fmt.Errorf("invalid fio parameter %q, expected KEY=VALUE without single quotes", p)
+		}
+		merged[kv[0]] = kv[1]
+	}
+
+	return merged, nil
+}
+
+// getFioJobFiles returns the fio job file paths keyed by the profile name.
+func getFioJobFiles(fioJobFiles string) (map[string]string, error) {
+	paths := []string{}
+	if fioJobFiles != "" {
+		paths = strings.Split(fioJobFiles, ",")
+	} else {
+		defaultPaths, err := filepath.Glob(filepath.Join(fioJobFilesDir, "*.fio"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the fio job files in %q: %w", fioJobFilesDir, err)
+		}
+		paths = append(paths, defaultPaths...)
+	}
+
+	jobFiles := map[string]string{}
+	for _, path := range paths {
+		profile := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, ok := jobFiles[profile]; ok || profile == defaultFioProfile {
+			return nil, fmt.Errorf("duplicate fio profile %q from job file %q", profile, path)
+		}
+		jobFiles[profile] = path
 	}
+
+	return jobFiles, nil
 }
 
 func (t *gcsFuseCSIPerformanceTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
@@ -79,6 +173,17 @@ func (t *gcsFuseCSIPerformanceTestSuite) GetTestSuiteInfo() storageframework.Tes
 func (t *gcsFuseCSIPerformanceTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
 }
 
+// fioParamsString returns the fio parameters as sorted KEY=VALUE pairs.
+func fioParamsString(params map[string]string) string {
+	pairs := []string{}
+	for k, v := range params {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
 //nolint:maintidx
 func (t *gcsFuseCSIPerformanceTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
 	type local struct {
@@ -110,7 +215,7 @@ func (t *gcsFuseCSIPerformanceTestSuite) DefineTests(driver storageframework.Tes
 		}
 	}
 
-	parseFioOutput := func(outputPath string) {
+	readFioJobs := func(outputPath string) []fioJob {
 		jsonFile, err := os.Open(outputPath)
 		if err != nil {
 			framework.Failf("Failed to open the fio output file %q: %v", outputPath, err)
@@ -126,24 +231,83 @@ func (t *gcsFuseCSIPerformanceTestSuite) DefineTests(driver storageframework.Tes
 			framework.Failf("Failed to parse the fio output file %q: %v", outputPath, err)
 		}
 
-		l.fioOutput = map[string]metrics{}
-
-		for _, job := range fr.Jobs {
-			if job.JobOptions.ReadWrite == "" {
-				job.JobOptions.ReadWrite = "read"
+		for i := range fr.Jobs {
+			if fr.Jobs[i].JobOptions.ReadWrite == "" {
+				fr.Jobs[i].JobOptions.ReadWrite = "read"
 			}
+		}
+
+		return fr.Jobs
+	}
+
+	// jobMetric returns the read metric of the read jobs, and the write metric of the others.
+	jobMetric := func(job fioJob) metrics {
+		if strings.Contains(job.JobOptions.ReadWrite, "read") {
+			return job.ReadMetric
+		}
+
+		return job.WriteMetric
+	}
 
+	parseFioOutput := func(outputPath string) {
+		l.fioOutput = map[string]metrics{}
+
+		for _, job := range readFioJobs(outputPath) {
 			metricKey := job.JobOptions.ReadWrite + "_" + job.JobOptions.FileSize
-			if job.JobOptions.ReadWrite == "read" || job.JobOptions.ReadWrite == "randread" {
-				l.fioOutput[metricKey] = job.ReadMetric
-			} else {
-				l.fioOutput[metricKey] = job.WriteMetric
-			}
+			l.fioOutput[metricKey] = jobMetric(job)
 
 			ginkgo.By(fmt.Sprintf("[%v %v] IOPS: %v, bandwidth bytes: %v", job.JobOptions.ReadWrite, job.JobOptions.FileSize, l.fioOutput[metricKey].IOPS, l.fioOutput[metricKey].BwBytes))
 		}
 	}
 
+	// writePerfResults writes the results of the profiles as newline-delimited JSON, and uploads them if the GCS path is set.
+	writePerfResults := func(profileOutputs map[string]string, params string) {
+		timestamp := time.Now().UTC().Format(time.RFC3339)
+		profiles := []string{}
+		for profile := range profileOutputs {
+			profiles = append(profiles, profile)
+		}
+		sort.Strings(profiles)
+
+		var sb strings.Builder
+		for _, profile := range profiles {
+			for _, job := range readFioJobs(profileOutputs[profile]) {
+				m := jobMetric(job)
+				b, err := json.Marshal(perfResult{
+					Timestamp: timestamp,
+					RunID:     string(framework.RunID),
+					Profile:   profile,
+					JobName:   job.JobName,
+					ReadWrite: job.JobOptions.ReadWrite,
+					FileSize:  job.JobOptions.FileSize,
+					Params:    params,
+					IOPS:      m.IOPS,
+					BwBytes:   m.BwBytes,
+				})
+				framework.ExpectNoError(err)
+				sb.Write(b)
+				sb.WriteString("\n")
+
+				ginkgo.By(fmt.Sprintf("[%v %v] IOPS: %v, bandwidth bytes: %v", profile, job.JobName, m.IOPS, m.BwBytes))
+			}
+		}
+
+		resultsPath := filepath.Join(l.artifactsDir, perfResultsFileName)
+		if err := os.WriteFile(resultsPath, []byte(sb.String()), 0o644); err != nil {
+			framework.Failf("Failed to write the performance results to %q: %v", resultsPath, err)
+		}
+
+		if t.resultsGCSPath == "" {
+			return
+		}
+		dest := fmt.Sprintf("%v/%v/%v.json", strings.TrimSuffix(t.resultsGCSPath, "/"), time.Now().UTC().Format("2006-01-02"), framework.RunID)
+		//nolint:gosec
+		if output, err := exec.Command("gsutil", "cp", resultsPath, dest).CombinedOutput(); err != nil {
+			framework.Failf("Failed to upload the performance results to %q: %v, output: %s", dest, err, output)
+		}
+		ginkgo.By(fmt.Sprintf("Uploaded the performance results to %v", dest))
+	}
+
 	parseThresholds := func(thresholdFile string) {
 		jsonFile, err := os.Open(thresholdFile)
 		if err != nil {
@@ -220,19 +384,63 @@ func (t *gcsFuseCSIPerformanceTestSuite) DefineTests(driver storageframework.Tes
 			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
 
 			ginkgo.By("Checking that the performance test exits with no error")
-			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "apt-get update && apt-get install curl fio -y")
-			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "curl -o /seq_rand_read_write.fio https://raw.githubusercontent.com/GoogleCloudPlatform/gcsfuse/master/perfmetrics/scripts/job_files/seq_rand_read_write.fio")
-			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "mkdir -p /gcs/256kb /gcs/3mb /gcs/5mb /gcs/50mb /gcs/fio-logs")
-			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "fio /seq_rand_read_write.fio --lat_percentiles 1 --output-format=json --output='/output.json'")
-			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "cp /output.json /gcs/fio-logs/output.json")
-
-			ginkgo.By("Checking that the metrics are downloaded with no error")
+			fioParams, err := parseFioParams(t.fioParams)
+			framework.ExpectNoError(err)
+			jobFiles, err := getFioJobFiles(t.fioJobFiles)
+			framework.ExpectNoError(err)
 			bucketName := l.volumeResource.VolSource.CSI.VolumeAttributes["bucketName"]
+			profileOutputs := map[string]string{}
+
+			downloadFioOutput := func(profile string) string {
+				outputPath := filepath.Join(l.artifactsDir, profile+"_output.json")
+				if profile == defaultFioProfile {
+					outputPath = filepath.Join(l.artifactsDir, "output.json")
+				}
+				//nolint:gosec
+				if output, err := exec.Command("gsutil", "cp", fmt.Sprintf("gs://%v/fio-logs/%v.json", bucketName, profile), outputPath).CombinedOutput(); err != nil {
+					framework.Failf("Failed to download the FIO metrics from GCS bucket %q: %v, output: %s", bucketName, err, output)
+				}
+
+				return outputPath
+			}
 
-			//nolint:gosec
-			if output, err := exec.Command("gsutil", "cp", fmt.Sprintf("gs://%v/fio-logs/output.json", bucketName), l.artifactsDir+"/output.json").CombinedOutput(); err != nil {
-				framework.Failf("Failed to download the FIO metrics from GCS bucket %q: %v, output: %s", bucketName, err, output)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "apt-get update && apt-get install curl fio -y")
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "mkdir -p /gcs/fio-logs /fio-jobs")
+			if t.fioJobFiles == "" {
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("curl -o /fio-jobs/%v.fio %v", defaultFioProfile, defaultFioJobFileURL))
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, "mkdir -p /gcs/256kb /gcs/3mb /gcs/5mb /gcs/50mb")
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("fio /fio-jobs/%v.fio --lat_percentiles 1 --output-format=json --output='/output.json'", defaultFioProfile))
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("cp /output.json /gcs/fio-logs/%v.json", defaultFioProfile))
+				profileOutputs[defaultFioProfile] = downloadFioOutput(defaultFioProfile)
 			}
+
+			for profile, jobFile := range jobFiles {
+				ginkgo.By(fmt.Sprintf("Running the fio profile %v", profile))
+				content, err := os.ReadFile(jobFile)
+				if err != nil {
+					framework.Failf("Failed to read the fio job file %q: %v", jobFile, err)
+				}
+
+				profileParams := map[string]string{}
+				for k, v := range fioParams {
+					profileParams[k] = v
+				}
+				profileParams["DIRECTORY"] = fmt.Sprintf("%v/%v", mountPath, profile)
+				env := []string{}
+				for k, v := range profileParams {
+					env = append(env, fmt.Sprintf("%v='%v'", k, v))
+				}
+				sort.Strings(env)
+
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("cat > /fio-jobs/%v.fio <<'FIO_JOB_EOF'\n%s\nFIO_JOB_EOF", profile, content))
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mkdir -p %v", profileParams["DIRECTORY"]))
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("%v fio /fio-jobs/%v.fio --lat_percentiles 1 --output-format=json --output='/%v.json'", strings.Join(env, " "), profile, profile))
+				tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("cp /%v.json /gcs/fio-logs/%v.json", profile, profile))
+				profileOutputs[profile] = downloadFioOutput(profile)
+			}
+
+			ginkgo.By("Checking that the structured results are written with no error")
+			writePerfResults(profileOutputs, fioParamsString(fioParams))
 		})
 
 		ginkgo.It("should succeed in performance test - parse the fio test output and threshold", func() {
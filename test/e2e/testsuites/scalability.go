@@ -0,0 +1,241 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsuites
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/pkg/webhook"
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/prometheus/common/model"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
+	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+	admissionapi "k8s.io/pod-security-admission/api"
+)
+
+type scalabilityThresholds struct {
+	MountLatencyP50Seconds      float64 `json:"mountLatencyP50Seconds"`
+	MountLatencyP99Seconds      float64 `json:"mountLatencyP99Seconds"`
+	SidecarMemoryBytesPerVolume float64 `json:"sidecarMemoryBytesPerVolume"`
+	NodePublishCallsPerVolume   float64 `json:"nodePublishCallsPerVolume"`
+	TokenExchangesPerPod        float64 `json:"tokenExchangesPerPod"`
+}
+
+type gcsFuseCSIScalabilityTestSuite struct {
+	tsInfo        storageframework.TestSuiteInfo
+	podsPerNode   int
+	volumesPerPod int
+}
+
+// InitGcsFuseCSIScalabilityTestSuite returns gcsFuseCSIScalabilityTestSuite that implements TestSuite interface.
+// The suite launches podsPerNode Pods on a single node, each Pod mounting volumesPerPod volumes.
+func InitGcsFuseCSIScalabilityTestSuite(podsPerNode, volumesPerPod int) func() storageframework.TestSuite {
+	return func() storageframework.TestSuite {
+		return &gcsFuseCSIScalabilityTestSuite{
+			tsInfo: storageframework.TestSuiteInfo{
+				Name: "scalability",
+				TestPatterns: []storageframework.TestPattern{
+					storageframework.DefaultFsCSIEphemeralVolume,
+				},
+			},
+			podsPerNode:   podsPerNode,
+			volumesPerPod: volumesPerPod,
+		}
+	}
+}
+
+func (t *gcsFuseCSIScalabilityTestSuite) GetTestSuiteInfo() storageframework.TestSuiteInfo {
+	return t.tsInfo
+}
+
+func (t *gcsFuseCSIScalabilityTestSuite) SkipUnsupportedTests(_ storageframework.TestDriver, _ storageframework.TestPattern) {
+	if t.podsPerNode <= 0 || t.volumesPerPod <= 0 {
+		e2eskipper.Skipf("skip because the number of pods per node %v or volumes per pod %v is not positive", t.podsPerNode, t.volumesPerPod)
+	}
+}
+
+func (t *gcsFuseCSIScalabilityTestSuite) DefineTests(driver storageframework.TestDriver, pattern storageframework.TestPattern) {
+	type local struct {
+		config         *storageframework.PerTestConfig
+		volumeResource *storageframework.VolumeResource
+	}
+	var l local
+	ctx := context.Background()
+
+	// Beware that it also registers an AfterEach which renders f unusable. Any code using
+	// f must run inside an It or Context callback.
+	f := framework.NewFrameworkWithCustomTimeouts("scalability", storageframework.GetDriverTimeouts(driver))
+	f.NamespacePodSecurityEnforceLevel = admissionapi.LevelPrivileged
+
+	init := func(configPrefix ...string) {
+		l = local{}
+		l.config = driver.PrepareTest(ctx, f)
+		if len(configPrefix) > 0 {
+			l.config.Prefix = configPrefix[0]
+		}
+		l.volumeResource = storageframework.CreateVolumeResource(ctx, driver, l.config, pattern, e2evolume.SizeRange{})
+	}
+
+	cleanup := func() {
+		var cleanUpErrs []error
+		cleanUpErrs = append(cleanUpErrs, l.volumeResource.CleanupResource(ctx))
+		err := utilerrors.NewAggregate(cleanUpErrs)
+		framework.ExpectNoError(err, "while cleaning up")
+	}
+
+	parseThresholds := func(thresholdFile string) scalabilityThresholds {
+		data, err := os.ReadFile(thresholdFile)
+		if err != nil {
+			framework.Failf("Failed to read the threshold file %q: %v", thresholdFile, err)
+		}
+
+		var thresholds scalabilityThresholds
+		if err := json.Unmarshal(data, &thresholds); err != nil {
+			framework.Failf("Failed to parse the threshold file %q: %v", thresholdFile, err)
+		}
+
+		return thresholds
+	}
+
+	ginkgo.It("[Serial] should mount volumes of many pods on a single node within the thresholds", ginkgo.Serial, func() {
+		init()
+		defer cleanup()
+
+		thresholds := parseThresholds("./testsuites/scalability_threshold.json")
+		numVolumes := t.podsPerNode * t.volumesPerPod
+
+		node, err := e2enode.GetRandomReadySchedulableNode(ctx, f.ClientSet)
+		framework.ExpectNoError(err)
+		metricsBefore, metricsFound := specs.GetNodeDriverMetrics(ctx, f.ClientSet, node.Name)
+
+		ginkgo.By(fmt.Sprintf("Deploying %v pods with %v volumes each on node %v", t.podsPerNode, t.volumesPerPod, node.Name))
+		tPods := []*specs.TestPod{}
+		for i := 0; i < t.podsPerNode; i++ {
+			tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+			tPod.SetNodeAffinity(node.Name, true)
+			tPod.SetAnnotations(map[string]string{
+				"gke-gcsfuse/volumes":                 "true",
+				"gke-gcsfuse/cpu-limit":               "100m",
+				"gke-gcsfuse/memory-limit":            fmt.Sprintf("%vMi", 100*t.volumesPerPod),
+				"gke-gcsfuse/ephemeral-storage-limit": "1Gi",
+			})
+			for j := 0; j < t.volumesPerPod; j++ {
+				tPod.SetupVolume(l.volumeResource, fmt.Sprintf("test-gcsfuse-volume-%v", j), fmt.Sprintf("%v/%v", mountPath, j), false)
+			}
+			tPod.Create(ctx)
+			defer tPod.Cleanup(ctx)
+			tPods = append(tPods, tPod)
+		}
+
+		ginkgo.By("Checking that all the pods are running")
+		latencies := []time.Duration{}
+		for _, tPod := range tPods {
+			tPod.WaitForRunning(ctx)
+			latencies = append(latencies, tPod.GetStartupLatency())
+		}
+		tPods[0].VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/0/data && grep 'hello world' %v/0/data", mountPath, mountPath))
+
+		ginkgo.By("Checking the mount latency percentiles")
+		p50, p99 := percentile(latencies, 0.5), percentile(latencies, 0.99)
+		ginkgo.By(fmt.Sprintf("Mount latency p50: %v, p99: %v", p50, p99))
+		if p50.Seconds() > thresholds.MountLatencyP50Seconds {
+			framework.Failf("The mount latency p50 %v is higher than the threshold %vs", p50, thresholds.MountLatencyP50Seconds)
+		}
+		if p99.Seconds() > thresholds.MountLatencyP99Seconds {
+			framework.Failf("The mount latency p99 %v is higher than the threshold %vs", p99, thresholds.MountLatencyP99Seconds)
+		}
+
+		ginkgo.By("Checking the sidecar container memory usage")
+		memory := specs.GetContainerMemoryUsage(ctx, f.ClientSet, node.Name, f.Namespace.Name, webhook.SidecarContainerName)
+		memoryPerVolume := float64(memory) / float64(numVolumes)
+		ginkgo.By(fmt.Sprintf("Sidecar container memory total: %v bytes, per volume: %.0f bytes", memory, memoryPerVolume))
+		if memoryPerVolume > thresholds.SidecarMemoryBytesPerVolume {
+			framework.Failf("The sidecar container memory per volume %.0f bytes is higher than the threshold %.0f bytes", memoryPerVolume, thresholds.SidecarMemoryBytesPerVolume)
+		}
+
+		if !metricsFound {
+			ginkgo.By("Skipping the API call count checks because the CSI driver metrics are not available")
+
+			return
+		}
+
+		ginkgo.By("Checking the API call counts")
+		metricsAfter, _ := specs.GetNodeDriverMetrics(ctx, f.ClientSet, node.Name)
+		nodePublishCalls := counterDelta(metricsBefore, metricsAfter, "csi_operations_total", map[string]string{"method_name": "/csi.v1.Node/NodePublishVolume"})
+		tokenExchanges := counterDelta(metricsBefore, metricsAfter, "gcsfusecsi_token_cache_miss_total", nil)
+		ginkgo.By(fmt.Sprintf("NodePublishVolume calls: %v, token exchanges: %v", nodePublishCalls, tokenExchanges))
+		if nodePublishCalls/float64(numVolumes) > thresholds.NodePublishCallsPerVolume {
+			framework.Failf("The NodePublishVolume calls per volume %v is higher than the threshold %v", nodePublishCalls/float64(numVolumes), thresholds.NodePublishCallsPerVolume)
+		}
+		if tokenExchanges/float64(t.podsPerNode) > thresholds.TokenExchangesPerPod {
+			framework.Failf("The token exchanges per pod %v is higher than the threshold %v", tokenExchanges/float64(t.podsPerNode), thresholds.TokenExchangesPerPod)
+		}
+	})
+}
+
+// percentile returns the q-th percentile of the durations using the nearest-rank method.
+func percentile(durations []time.Duration, q float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// counterDelta returns the increase of the counter samples matching the labels between the two scrapes.
+func counterDelta(before, after testutil.Metrics, metricName string, labels map[string]string) float64 {
+	sum := func(m testutil.Metrics) float64 {
+		total := 0.0
+		for _, sample := range m[metricName] {
+			match := true
+			for k, v := range labels {
+				if string(sample.Metric[model.LabelName(k)]) != v {
+					match = false
+
+					break
+				}
+			}
+			if match {
+				total += float64(sample.Value)
+			}
+		}
+
+		return total
+	}
+
+	return sum(after) - sum(before)
+}
@@ -20,12 +20,17 @@ package testsuites
 import (
 	"context"
 	"fmt"
+	"os/exec"
+	"time"
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/kubernetes/test/e2e/framework"
+	e2epv "k8s.io/kubernetes/test/e2e/framework/pv"
 	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
 	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
 	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
@@ -171,6 +176,105 @@ func (t *gcsFuseCSIVolumesTestSuite) DefineTests(driver storageframework.TestDri
 		tPod.VerifyExecInPodFail(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath), 1)
 	})
 
+	// The volume is read-only if any of the PV, the Pod volume, or the container volume mount is read-only.
+	// The read-only setting takes precedence over the rw, file-mode, and dir-mode mount options.
+	ginkgo.It("[read-only] should fail when write to a read-only PV with a read-write volume mount", func() {
+		if pattern.VolType != storageframework.PreprovisionedPV {
+			e2eskipper.Skipf("skip for volume type %v", pattern.VolType)
+		}
+
+		init(specs.ReadOnlyVolumePrefix)
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the volume is mounted read-only")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("ls %v", mountPath))
+
+		ginkgo.By("Expecting error when write to read-only volumes")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath), "Read-only file system")
+	})
+
+	ginkgo.It("[read-only] should fail when write to a read-only Pod volume with a read-write volume mount", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.SetVolumeReadOnly("test-gcsfuse-volume")
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the volume is mounted read-only")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+
+		ginkgo.By("Expecting error when write to read-only volumes")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath), "Read-only file system")
+	})
+
+	ginkgo.It("[read-only] should fail when write to a read-only Pod volume with the rw and file-mode mount options", func() {
+		init(specs.RWFileModeMountOptionsVolumePrefix)
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.SetVolumeReadOnly("test-gcsfuse-volume")
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the volume is mounted read-only with the dir-mode mount option")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf(`[ "$(stat -c %%a %v)" = "777" ]`, mountPath))
+
+		ginkgo.By("Expecting error when write to read-only volumes")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath), "Read-only file system")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("mkdir %v/dir", mountPath), "Read-only file system")
+	})
+
+	ginkgo.It("[read-only] should fail when write to a read-only volume mount with the rw and file-mode mount options", func() {
+		init(specs.RWFileModeMountOptionsVolumePrefix)
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the volume is mounted read-only")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+
+		ginkgo.By("Expecting error when write to read-only volumes")
+		tPod.VerifyExecInPodFailWithError(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath), "Read-only file system")
+	})
+
 	ginkgo.It("[non-root] should store data and retain the data", func() {
 		init(specs.NonRootVolumePrefix)
 		defer cleanup()
@@ -267,4 +371,235 @@ func (t *gcsFuseCSIVolumesTestSuite) DefineTests(driver storageframework.TestDri
 		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
 		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/%v/data && grep 'hello world' %v/%v/data", mountPath, specs.ImplicitDirsPath, mountPath, specs.ImplicitDirsPath))
 	})
+
+	ginkgo.It("should not block init containers that do not use the volume", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.AddInitContainer("init-tester", "echo 'hello from init container'")
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the pod command exits with no error")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+	})
+
+	ginkgo.It("[init-container] should store data written by an init container", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.AddInitContainer("init-writer", fmt.Sprintf("echo 'hello from init container' > %v/data", mountPath))
+		tPod.SetupVolumeForInitContainer(l.volumeResource, "test-gcsfuse-volume", "init-writer", mountPath, false)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		// The mount point is not accessible until the sidecar container starts,
+		// so init containers can only use the volume when the sidecar container starts before them.
+		if !tPod.SidecarInjectedAsInitContainer(ctx) {
+			e2eskipper.Skipf("the sidecar container is not injected as an init container, see docs/known-issues.md")
+		}
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the main container reads the data written by the init container")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep 'hello from init container' %v/data", mountPath))
+	})
+
+	ginkgo.It("[init-container] should read data in an init container", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the writer pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Configuring the reader pod")
+		tReaderPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tReaderPod.AddInitContainer("init-reader", fmt.Sprintf("grep 'hello world' %v/data", mountPath))
+		tReaderPod.SetupVolumeForInitContainer(l.volumeResource, "test-gcsfuse-volume", "init-reader", mountPath, true)
+		tReaderPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+
+		if !tReaderPod.SidecarInjectedAsInitContainer(ctx) {
+			e2eskipper.Skipf("the sidecar container is not injected as an init container, see docs/known-issues.md")
+		}
+
+		ginkgo.By("Deploying the writer pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data", mountPath))
+
+		ginkgo.By("Deploying the reader pod")
+		tReaderPod.Create(ctx)
+		defer tReaderPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the reader pod init container read the data and the pod is running")
+		tReaderPod.WaitForRunning(ctx)
+	})
+
+	ginkgo.It("should share the volume between multiple containers", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.AddContainer("volume-writer", fmt.Sprintf("for i in $(seq 1 10); do echo $i > %v/writer-$i; done; touch %v/writer-done; tail -f /dev/null", mountPath, mountPath))
+		tPod.SetupVolumeForContainer(l.volumeResource, "test-gcsfuse-volume", "volume-writer", mountPath, false)
+		tPod.AddContainer("volume-reader", "tail -f /dev/null")
+		tPod.SetupVolumeForContainer(l.volumeResource, "test-gcsfuse-volume", "volume-reader", mountPath, true)
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+		defer tPod.Cleanup(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+
+		ginkgo.By("Checking that the reader container reads the data written by the writer container")
+		tPod.VerifyExecInPodSucceed(f, "volume-reader", fmt.Sprintf("mount | grep %v | grep ro,", mountPath))
+		tPod.VerifyExecInPodSucceed(f, "volume-reader", fmt.Sprintf("for j in $(seq 1 60); do test -e %v/writer-done && break; sleep 1; done; for i in $(seq 1 10); do grep -x $i %v/writer-$i || exit 1; done", mountPath, mountPath))
+
+		ginkgo.By("Checking that concurrent writes from multiple containers are visible to each other")
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo tester > %v/tester-data", mountPath))
+		tPod.VerifyExecInPodSucceed(f, "volume-writer", fmt.Sprintf("echo writer > %v/writer-data", mountPath))
+		tPod.VerifyExecInPodSucceed(f, "volume-writer", fmt.Sprintf("grep -x tester %v/tester-data", mountPath))
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep -x writer %v/writer-data", mountPath))
+		tPod.VerifyExecInPodSucceed(f, "volume-reader", fmt.Sprintf("grep -x tester %v/tester-data && grep -x writer %v/writer-data", mountPath, mountPath))
+
+		ginkgo.By("Expecting error when the reader container writes to the read-only volume mount")
+		tPod.VerifyExecInPodFail(f, "volume-reader", fmt.Sprintf("echo reader > %v/reader-data", mountPath), 1)
+	})
+
+	for _, feature := range []struct {
+		name   string
+		prefix string
+	}{
+		{name: "HNS", prefix: specs.HNSBucketPrefix},
+		{name: "autoclass", prefix: specs.AutoclassBucketPrefix},
+		{name: "CMEK", prefix: specs.CMEKBucketPrefix},
+	} {
+		feature := feature
+		ginkgo.It(fmt.Sprintf("[bucket-features] should store data in a %v bucket", feature.name), func() {
+			if pattern.VolType == storageframework.DynamicPV {
+				e2eskipper.Skipf("skip for volume type %v", storageframework.DynamicPV)
+			}
+
+			init(feature.prefix)
+			defer cleanup()
+
+			ginkgo.By("Configuring the pod")
+			tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+			tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+			ginkgo.By("Deploying the pod")
+			tPod.Create(ctx)
+			defer tPod.Cleanup(ctx)
+
+			ginkgo.By("Checking that the pod is running")
+			tPod.WaitForRunning(ctx)
+
+			ginkgo.By("Checking that the pod command exits with no error")
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mkdir -p %v/dir && echo 'hello world' > %v/dir/data && grep 'hello world' %v/dir/data", mountPath, mountPath, mountPath))
+		})
+	}
+
+	// provisionedPV deploys a Pod using the dynamically provisioned volume, so that the WaitForFirstConsumer binding provisions the bucket,
+	// and returns the bound PersistentVolume after the Pod is deleted.
+	provisionedPV := func() *v1.PersistentVolume {
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Checking that the PVC is not bound before the pod is deployed")
+		pvc, err := f.ClientSet.CoreV1().PersistentVolumeClaims(f.Namespace.Name).Get(ctx, l.volumeResource.Pvc.Name, metav1.GetOptions{})
+		framework.ExpectNoError(err)
+		gomega.Expect(pvc.Status.Phase).To(gomega.Equal(v1.ClaimPending))
+
+		ginkgo.By("Deploying the pod")
+		tPod.Create(ctx)
+
+		ginkgo.By("Checking that the pod is running")
+		tPod.WaitForRunning(ctx)
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo 'hello world' > %v/data && grep 'hello world' %v/data", mountPath, mountPath))
+
+		ginkgo.By("Deleting the pod")
+		tPod.Cleanup(ctx)
+
+		pvc, err = f.ClientSet.CoreV1().PersistentVolumeClaims(f.Namespace.Name).Get(ctx, l.volumeResource.Pvc.Name, metav1.GetOptions{})
+		framework.ExpectNoError(err)
+		pv, err := f.ClientSet.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		framework.ExpectNoError(err)
+		gomega.Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(gomega.Equal(*l.volumeResource.Sc.ReclaimPolicy))
+
+		return pv
+	}
+
+	ginkgo.It("should delete the bucket when the PVC is deleted with the Delete reclaim policy", func() {
+		if pattern.VolType != storageframework.DynamicPV {
+			e2eskipper.Skipf("skip for volume type %v", pattern.VolType)
+		}
+
+		init()
+		defer cleanup()
+
+		pv := provisionedPV()
+
+		ginkgo.By("Deleting the PVC")
+		framework.ExpectNoError(e2epv.DeletePersistentVolumeClaim(ctx, f.ClientSet, l.volumeResource.Pvc.Name, f.Namespace.Name))
+
+		ginkgo.By("Checking that the PV and the bucket are deleted")
+		framework.ExpectNoError(e2epv.WaitForPersistentVolumeDeleted(ctx, f.ClientSet, pv.Name, 5*time.Second, f.Timeouts.PVDelete))
+		gomega.Expect(bucketExists(pv.Spec.CSI.VolumeHandle)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should retain the bucket when the PVC is deleted with the Retain reclaim policy", func() {
+		if pattern.VolType != storageframework.DynamicPV {
+			e2eskipper.Skipf("skip for volume type %v", pattern.VolType)
+		}
+
+		init(specs.RetainVolumePrefix)
+		defer cleanup()
+
+		pv := provisionedPV()
+		bucketName := pv.Spec.CSI.VolumeHandle
+		defer func() {
+			// The retained bucket is not deleted by the provisioner, nor by the test driver cleanup.
+			if output, err := exec.Command("gsutil", "-m", "rm", "-r", "gs://"+bucketName).CombinedOutput(); err != nil {
+				framework.Logf("failed to delete the retained bucket %q: %v, output: %s", bucketName, err, output)
+			}
+		}()
+
+		ginkgo.By("Deleting the PVC")
+		framework.ExpectNoError(e2epv.DeletePersistentVolumeClaim(ctx, f.ClientSet, l.volumeResource.Pvc.Name, f.Namespace.Name))
+
+		ginkgo.By("Checking that the PV is released and the bucket is retained")
+		framework.ExpectNoError(e2epv.WaitForPersistentVolumePhase(ctx, v1.VolumeReleased, f.ClientSet, pv.Name, 5*time.Second, f.Timeouts.PVReclaim))
+		gomega.Expect(bucketExists(bucketName)).To(gomega.BeTrue())
+
+		ginkgo.By("Deleting the released PV")
+		framework.ExpectNoError(e2epv.DeletePersistentVolume(ctx, f.ClientSet, pv.Name))
+	})
+}
+
+// bucketExists returns true if the GCS bucket exists.
+func bucketExists(bucketName string) bool {
+	output, err := exec.Command("gsutil", "ls", "-b", "gs://"+bucketName).CombinedOutput()
+	framework.Logf("gsutil ls -b gs://%v: %s", bucketName, output)
+
+	return err == nil
 }
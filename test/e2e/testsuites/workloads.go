@@ -23,9 +23,13 @@ import (
 
 	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
 	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	e2eskipper "k8s.io/kubernetes/test/e2e/framework/skipper"
 	e2evolume "k8s.io/kubernetes/test/e2e/framework/volume"
 	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
 	admissionapi "k8s.io/pod-security-admission/api"
@@ -132,4 +136,181 @@ func (t *gcsFuseCSIWorkloadsTestSuite) DefineTests(driver storageframework.TestD
 		ginkgo.By("Checking that the job is in succeeded status")
 		tJob.WaitForJobPodsSucceeded(ctx)
 	})
+
+	ginkgo.It("should store data in StatefulSet with per-replica bucket prefixes", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Configuring the statefulset")
+		tStatefulSet := specs.NewTestStatefulSet(f.ClientSet, f.Namespace, tPod, 2)
+		tStatefulSet.SetPerReplicaSubPath("test-gcsfuse-volume")
+
+		ginkgo.By("Deploying the statefulset")
+		tStatefulSet.Create(ctx)
+		defer tStatefulSet.Cleanup(ctx)
+
+		ginkgo.By("Checking that the statefulset is in ready status")
+		tStatefulSet.WaitForRunningAndReady(ctx)
+
+		ginkgo.By("Writing data from each replica")
+		for _, pod := range tStatefulSet.GetPods(ctx) {
+			pod := pod
+			tPod.SetPod(&pod)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo %v > %v/data && grep %v %v/data", pod.Name, mountPath, pod.Name, mountPath))
+		}
+
+		ginkgo.By("Restarting the statefulset")
+		tStatefulSet.RollingRestart(ctx)
+
+		ginkgo.By("Checking that each replica reads its own data after the restart")
+		for _, pod := range tStatefulSet.GetPods(ctx) {
+			pod := pod
+			tPod.SetPod(&pod)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep -x %v %v/data", pod.Name, mountPath))
+		}
+	})
+
+	ginkgo.It("should store data in StatefulSet with per-replica volumes", func() {
+		if pattern.VolType != storageframework.DynamicPV {
+			e2eskipper.Skipf("skip for volume type %v", pattern.VolType)
+		}
+
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Configuring the statefulset")
+		tStatefulSet := specs.NewTestStatefulSet(f.ClientSet, f.Namespace, tPod, 2)
+		tStatefulSet.SetupVolumeClaimTemplate(l.volumeResource, "test-gcsfuse-volume")
+
+		ginkgo.By("Deploying the statefulset")
+		tStatefulSet.Create(ctx)
+		defer tStatefulSet.Cleanup(ctx)
+
+		ginkgo.By("Checking that the statefulset is in ready status")
+		tStatefulSet.WaitForRunningAndReady(ctx)
+
+		ginkgo.By("Checking that each replica has an empty volume")
+		for _, pod := range tStatefulSet.GetPods(ctx) {
+			pod := pod
+			tPod.SetPod(&pod)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("test ! -e %v/data && echo %v > %v/data", mountPath, pod.Name, mountPath))
+		}
+
+		ginkgo.By("Restarting the statefulset")
+		tStatefulSet.RollingRestart(ctx)
+
+		ginkgo.By("Checking that each replica reads its own data after the restart")
+		for _, pod := range tStatefulSet.GetPods(ctx) {
+			pod := pod
+			tPod.SetPod(&pod)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep -x %v %v/data", pod.Name, mountPath))
+		}
+	})
+
+	ginkgo.It("should store data in DaemonSet on every node", func() {
+		// Adding a node to the cluster mid-test is emulated by adding the DaemonSet node selector label to a node,
+		// which makes the DaemonSet controller schedule a new Pod the same way as on a new node.
+		nodeList, err := e2enode.GetReadySchedulableNodes(ctx, f.ClientSet)
+		framework.ExpectNoError(err)
+		nodes := []v1.Node{}
+		for _, node := range nodeList.Items {
+			if labels.SelectorFromSet(specs.GetNodeSelector()).Matches(labels.Set(node.Labels)) {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) < 2 {
+			e2eskipper.Skipf("requires at least 2 schedulable nodes matching %v, got %v", specs.GetNodeSelector(), len(nodes))
+		}
+
+		init()
+		defer cleanup()
+
+		nodeLabelKey := "gcsfuse.csi.storage.gke.io/e2e-daemonset"
+		defer func() {
+			for _, node := range nodes {
+				e2enode.RemoveLabelOffNode(f.ClientSet, node.Name, nodeLabelKey)
+			}
+		}()
+		for _, node := range nodes[1:] {
+			e2enode.AddOrUpdateLabelOnNode(f.ClientSet, node.Name, nodeLabelKey, f.Namespace.Name)
+		}
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+
+		ginkgo.By("Configuring the daemonset")
+		tDaemonSet := specs.NewTestDaemonSet(f.ClientSet, f.Namespace, tPod)
+		tDaemonSet.SetNodeSelector(map[string]string{nodeLabelKey: f.Namespace.Name})
+
+		ginkgo.By("Deploying the daemonset")
+		tDaemonSet.Create(ctx)
+		defer tDaemonSet.Cleanup(ctx)
+
+		ginkgo.By("Checking that the daemonset is ready on every labeled node")
+		tDaemonSet.WaitForReady(ctx, len(nodes)-1)
+
+		ginkgo.By("Writing data from each node")
+		for nodeName, pod := range tDaemonSet.GetPods(ctx) {
+			tPod.SetPod(pod)
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo %v > %v/%v && grep %v %v/%v", pod.Name, mountPath, nodeName, pod.Name, mountPath, nodeName))
+		}
+
+		ginkgo.By("Adding a node to the daemonset mid-test")
+		newNode := nodes[0].Name
+		e2enode.AddOrUpdateLabelOnNode(f.ClientSet, newNode, nodeLabelKey, f.Namespace.Name)
+		tDaemonSet.WaitForReady(ctx, len(nodes))
+
+		ginkgo.By("Checking that the pod on the new node mounts the volume and reads the data of every node")
+		pods := tDaemonSet.GetPods(ctx)
+		gomega.Expect(pods).To(gomega.HaveKey(newNode))
+		tPod.SetPod(pods[newNode])
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("mount | grep %v | grep rw,", mountPath))
+		for _, node := range nodes[1:] {
+			tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("test -s %v/%v", mountPath, node.Name))
+		}
+		tPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("echo %v > %v/%v", newNode, mountPath, newNode))
+	})
+
+	ginkgo.It("should store data in CronJob", func() {
+		init()
+		defer cleanup()
+
+		ginkgo.By("Configuring the pod")
+		tPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, false)
+		tPod.SetCommand(fmt.Sprintf("hostname > %v/$(hostname) && cat %v/$(hostname)", mountPath, mountPath))
+
+		ginkgo.By("Configuring the cronjob")
+		tCronJob := specs.NewTestCronJob(f.ClientSet, f.Namespace, tPod, "*/1 * * * *")
+
+		ginkgo.By("Deploying the cronjob")
+		tCronJob.Create(ctx)
+		defer tCronJob.Cleanup(ctx)
+
+		ginkgo.By("Checking that the cronjob has 2 succeeded runs")
+		tCronJob.WaitForJobsSucceeded(ctx, 2)
+
+		ginkgo.By("Checking that the pods of each run succeeded with the sidecar container exited")
+		succeededPods := tCronJob.GetSucceededPods(ctx)
+		gomega.Expect(len(succeededPods)).To(gomega.BeNumerically(">=", 2))
+
+		ginkgo.By("Checking that the bucket contains the output of each run")
+		tReaderPod := specs.NewTestPod(f.ClientSet, f.Namespace)
+		tReaderPod.SetupVolume(l.volumeResource, "test-gcsfuse-volume", mountPath, true)
+		tReaderPod.Create(ctx)
+		defer tReaderPod.Cleanup(ctx)
+		tReaderPod.WaitForRunning(ctx)
+		for _, pod := range succeededPods {
+			tReaderPod.VerifyExecInPodSucceed(f, specs.TesterContainerName, fmt.Sprintf("grep -x %v %v/%v", pod.Name, mountPath, pod.Name))
+		}
+	})
 }
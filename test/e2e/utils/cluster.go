@@ -18,6 +18,7 @@ limitations under the License.
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
 	"strconv"
@@ -27,6 +28,43 @@ import (
 	"k8s.io/klog/v2"
 )
 
+const (
+	armNodePoolName = "arm-pool"
+
+	// ClusterTypeGKE runs the test on a GKE cluster, which the test creates when running in Prow.
+	ClusterTypeGKE = "gke"
+	// ClusterTypeKind runs the hermetic test subset on a local kind cluster against the GCS emulator.
+	ClusterTypeKind = "kind"
+)
+
+// clusterUpKind creates the kind cluster if it does not exist, and points the kubeconfig to it.
+// The cluster is kept after the test, so that the next iteration only rebuilds and reloads the images.
+func clusterUpKind(testParams *TestParameters) error {
+	out, err := exec.Command("kind", "get", "clusters").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to list kind clusters: output: %v, err: %w", string(out), err)
+	}
+
+	for _, name := range strings.Fields(string(out)) {
+		if name == testParams.KindClusterName {
+			klog.Infof("Reusing the existing kind cluster %s", testParams.KindClusterName)
+			cmd := exec.Command("kind", "export", "kubeconfig", "--name", testParams.KindClusterName)
+			if err := runCommand("Exporting the kind cluster kubeconfig", cmd); err != nil {
+				return fmt.Errorf("failed to export the kind cluster kubeconfig: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	cmd := exec.Command("kind", "create", "cluster", "--name", testParams.KindClusterName, "--wait", "5m")
+	if err := runCommand("Starting e2e cluster on kind", cmd); err != nil {
+		return fmt.Errorf("failed to bring up kubernetes e2e cluster on kind: %w", err)
+	}
+
+	return nil
+}
+
 func clusterDownGKE(testParams *TestParameters) error {
 	//nolint:gosec
 	cmd := exec.Command("gcloud", "container", "clusters", "delete", testParams.GkeClusterName, "--region", testParams.GkeClusterRegion, "--quiet")
@@ -65,12 +103,35 @@ func clusterUpGKE(testParams *TestParameters) error {
 		cmdParams = append(cmdParams, "--cluster-version", testParams.GkeClusterVersion)
 	}
 
+	if isVariableSet(testParams.GkeClusterNetwork) {
+		cmdParams = append(cmdParams, "--network", testParams.GkeClusterNetwork)
+	}
+
+	if isVariableSet(testParams.GkeClusterSubnetwork) {
+		cmdParams = append(cmdParams, "--subnetwork", testParams.GkeClusterSubnetwork)
+	}
+
+	// The private cluster has neither public node IPs nor a public control plane endpoint,
+	// so the test must run from a host that can reach the cluster VPC network.
+	if testParams.PrivateCluster {
+		cmdParams = append(cmdParams,
+			"--enable-private-nodes",
+			"--enable-private-endpoint",
+			"--enable-master-authorized-networks",
+			"--master-ipv4-cidr", testParams.PrivateClusterMasterCIDR,
+		)
+	}
+
 	standardClusterFlags := []string{
 		"--num-nodes", strconv.Itoa(testParams.NumNodes), "--image-type", testParams.NodeImageType,
 		"--machine-type", testParams.NodeMachineType,
 		"--workload-pool", fmt.Sprintf("%s.svc.id.goog", testParams.ProjectID),
 	}
 
+	if testParams.PrivateCluster {
+		standardClusterFlags = append(standardClusterFlags, "--enable-ip-alias")
+	}
+
 	if testParams.UseGKEManagedDriver {
 		standardClusterFlags = append(standardClusterFlags, "--addons", "GcsFuseCsiDriver")
 	}
@@ -86,18 +147,10 @@ func clusterUpGKE(testParams *TestParameters) error {
 		standardClusterFlags = append(standardClusterFlags, "--no-enable-autoupgrade")
 	}
 
-	// For supported regions/zones for ARM nodes, see https://cloud.google.com/kubernetes-engine/docs/concepts/arm-on-gke#arm-requirements-limitations
 	if strings.HasPrefix(testParams.NodeMachineType, "t2a-standard") {
-		var nodeLocations string
-		switch testParams.GkeClusterRegion {
-		case "us-central1":
-			nodeLocations = "us-central1-a,us-central1-b,us-central1-f"
-		case "europe-west4":
-			nodeLocations = "europe-west4-a,europe-west4-b"
-		case "asia-southeast1":
-			nodeLocations = "asia-southeast1-b,asia-southeast1-c"
-		default:
-			return fmt.Errorf("got invalid region %q for ARM node type %q", testParams.GkeClusterRegion, testParams.NodeMachineType)
+		nodeLocations, err := getARMNodeLocations(testParams.GkeClusterRegion)
+		if err != nil {
+			return fmt.Errorf("got invalid region for ARM node type %q: %w", testParams.NodeMachineType, err)
 		}
 
 		standardClusterFlags = append(standardClusterFlags, "--node-locations", nodeLocations)
@@ -133,5 +186,131 @@ func clusterUpGKE(testParams *TestParameters) error {
 		}
 	}
 
+	if testParams.AddARMNodePool && !testParams.UseGKEAutopilot {
+		if err := createARMNodePool(testParams); err != nil {
+			return err
+		}
+	}
+
+	for i := range testParams.NodePools {
+		if err := createNodePool(testParams, &testParams.NodePools[i]); err != nil {
+			return err
+		}
+	}
+
+	// The kubeconfig written by the create command uses the public endpoint, which the private cluster does not have.
+	if testParams.PrivateCluster {
+		//nolint:gosec
+		cmd = exec.Command("gcloud", "container", "clusters", "get-credentials", testParams.GkeClusterName, "--region", testParams.GkeClusterRegion, "--internal-ip")
+		if err := runCommand("Getting the private e2e cluster credentials", cmd); err != nil {
+			return fmt.Errorf("failed to get the private cluster credentials: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createARMNodePool adds an ARM node pool to the cluster, so that the multi-arch driver and sidecar images can be validated.
+// GKE taints the ARM nodes with kubernetes.io/arch=arm64:NoSchedule, which the test Pods tolerate.
+func createARMNodePool(testParams *TestParameters) error {
+	return createNodePool(testParams, &NodePool{
+		Name:        armNodePoolName,
+		ImageType:   testParams.NodeImageType,
+		MachineType: testParams.ARMNodeMachineType,
+		NumNodes:    1,
+	})
+}
+
+// getARMNodeLocations returns the zones in the region that support ARM nodes.
+// For supported regions/zones for ARM nodes, see https://cloud.google.com/kubernetes-engine/docs/concepts/arm-on-gke#arm-requirements-limitations
+func getARMNodeLocations(region string) (string, error) {
+	switch region {
+	case "us-central1":
+		return "us-central1-a,us-central1-b,us-central1-f", nil
+	case "europe-west4":
+		return "europe-west4-a,europe-west4-b", nil
+	case "asia-southeast1":
+		return "asia-southeast1-b,asia-southeast1-c", nil
+	default:
+		return "", fmt.Errorf("region %q does not support ARM nodes", region)
+	}
+}
+
+// restrictedVIPDNSZone is a Cloud DNS private zone that resolves a domain to restricted.googleapis.com,
+// so that the Google APIs and the container registries are only reachable through the VPC Service Controls restricted VIP.
+type restrictedVIPDNSZone struct {
+	name    string
+	dnsName string
+	// aRecord is the record that resolves to the restricted VIP addresses, and the wildcard CNAME record points to it.
+	aRecord string
+}
+
+var restrictedVIPDNSZones = []restrictedVIPDNSZone{
+	{name: "gcsfuse-e2e-googleapis", dnsName: "googleapis.com.", aRecord: "restricted.googleapis.com."},
+	{name: "gcsfuse-e2e-gcr", dnsName: "gcr.io.", aRecord: "gcr.io."},
+	{name: "gcsfuse-e2e-pkg-dev", dnsName: "pkg.dev.", aRecord: "pkg.dev."},
+}
+
+// restrictedVIPAddresses are the IP addresses of restricted.googleapis.com.
+var restrictedVIPAddresses = []string{"199.36.153.4", "199.36.153.5", "199.36.153.6", "199.36.153.7"}
+
+// setupRestrictedVIPDNS creates the Cloud DNS private zones on the cluster network
+// that route the Google API traffic to restricted.googleapis.com.
+// Private Google Access must be enabled on the cluster subnetwork.
+func setupRestrictedVIPDNS(testParams *TestParameters) error {
+	network := testParams.GkeClusterNetwork
+	if !isVariableSet(network) {
+		network = "default"
+	}
+
+	for _, z := range restrictedVIPDNSZones {
+		cmd := exec.Command("gcloud", "dns", "managed-zones", "create", z.name,
+			"--dns-name", z.dnsName,
+			"--description", "Route Google APIs to the restricted VIP for the GCS FUSE CSI driver e2e test",
+			"--visibility", "private",
+			"--networks", network,
+		)
+		if err := runCommand(fmt.Sprintf("Creating Cloud DNS private zone %s", z.name), cmd); err != nil {
+			return fmt.Errorf("failed to create Cloud DNS private zone %q: %w", z.name, err)
+		}
+
+		cmd = exec.Command("gcloud", "dns", "record-sets", "create", z.aRecord,
+			"--zone", z.name, "--type", "A", "--ttl", "300",
+			"--rrdatas", strings.Join(restrictedVIPAddresses, ","),
+		)
+		if err := runCommand(fmt.Sprintf("Creating A record %s in zone %s", z.aRecord, z.name), cmd); err != nil {
+			return fmt.Errorf("failed to create A record %q: %w", z.aRecord, err)
+		}
+
+		cmd = exec.Command("gcloud", "dns", "record-sets", "create", "*."+z.dnsName,
+			"--zone", z.name, "--type", "CNAME", "--ttl", "300",
+			"--rrdatas", z.aRecord,
+		)
+		if err := runCommand(fmt.Sprintf("Creating CNAME record *.%s in zone %s", z.dnsName, z.name), cmd); err != nil {
+			return fmt.Errorf("failed to create CNAME record %q: %w", "*."+z.dnsName, err)
+		}
+	}
+
 	return nil
 }
+
+// teardownRestrictedVIPDNS deletes the Cloud DNS private zones created by setupRestrictedVIPDNS.
+// It continues on errors so that as many zones as possible are deleted.
+func teardownRestrictedVIPDNS() error {
+	var errs []error
+	for _, z := range restrictedVIPDNSZones {
+		for _, r := range []struct{ name, recordType string }{{z.aRecord, "A"}, {"*." + z.dnsName, "CNAME"}} {
+			cmd := exec.Command("gcloud", "dns", "record-sets", "delete", r.name, "--zone", z.name, "--type", r.recordType)
+			if err := runCommand(fmt.Sprintf("Deleting %s record %s in zone %s", r.recordType, r.name, z.name), cmd); err != nil {
+				klog.Warningf("failed to delete %s record %q in zone %q: %v", r.recordType, r.name, z.name, err)
+			}
+		}
+
+		cmd := exec.Command("gcloud", "dns", "managed-zones", "delete", z.name, "--quiet")
+		if err := runCommand(fmt.Sprintf("Deleting Cloud DNS private zone %s", z.name), cmd); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete Cloud DNS private zone %q: %w", z.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
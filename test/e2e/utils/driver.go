@@ -19,7 +19,10 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+
+	"k8s.io/klog/v2"
 )
 
 func installDriver(pkgDir, registry, overlay string) error {
@@ -41,3 +44,33 @@ func deleteDriver(pkgDir, overlay string) error {
 
 	return nil
 }
+
+const (
+	storageEmulatorLocalPort = "4443"
+	// storageEmulatorEndpoint is the fake-gcs-server endpoint forwarded to the test host.
+	storageEmulatorEndpoint = "http://localhost:" + storageEmulatorLocalPort + "/storage/v1/"
+)
+
+// forwardStorageEmulatorPort forwards the fake-gcs-server port deployed by the emulator overlay to the test host,
+// so that the tests can create buckets in the emulator. The caller must kill the returned process.
+func forwardStorageEmulatorPort() (*exec.Cmd, error) {
+	cmd := exec.Command("kubectl", "port-forward", "--namespace", "gcs-fuse-csi-driver", "service/fake-gcs-server", storageEmulatorLocalPort+":4443")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	klog.Infof("Forwarding the GCS emulator port, cmd args=%s", cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to forward the GCS emulator port: %w", err)
+	}
+
+	return cmd, nil
+}
+
+// installIstio installs Istio with the minimal profile, which only includes the control plane and the sidecar injector.
+func installIstio() error {
+	cmd := exec.Command("istioctl", "install", "--set", "profile=minimal", "--skip-confirmation")
+	if err := runCommand("Installing Istio", cmd); err != nil {
+		return fmt.Errorf("failed to run istioctl install: %w", err)
+	}
+
+	return nil
+}
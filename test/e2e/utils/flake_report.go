@@ -0,0 +1,175 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ginkgoJSONReportName = "ginkgo-report.json"
+	flakeReportName      = "flake-report.json"
+)
+
+// flakeReport is the machine-readable summary of the spec retries of a ginkgo run.
+type flakeReport struct {
+	RunID     string            `json:"runID"`
+	NodePool  string            `json:"nodePool,omitempty"`
+	StartTime time.Time         `json:"startTime"`
+	Passed    int               `json:"passed"`
+	Flaked    int               `json:"flaked"`
+	Failed    int               `json:"failed"`
+	Specs     []specFlakeResult `json:"specs"`
+}
+
+// specFlakeResult is the result of a spec that ran. A spec flaked if it passed after more than one attempt.
+type specFlakeResult struct {
+	Name           string  `json:"name"`
+	State          string  `json:"state"`
+	Attempts       int     `json:"attempts"`
+	Flaked         bool    `json:"flaked"`
+	RunTimeSeconds float64 `json:"runTimeSeconds"`
+	FailureMessage string  `json:"failureMessage,omitempty"`
+}
+
+// writeFlakeReport generates the flake report from the ginkgo JSON report in the artifacts directory,
+// and uploads it to the GCS path if set, e.g. gs://my-bucket/flakes.
+func writeFlakeReport(artifactsDir, nodePool, gcsPath string) error {
+	b, err := os.ReadFile(filepath.Join(artifactsDir, ginkgoJSONReportName))
+	if err != nil {
+		return fmt.Errorf("failed to read the ginkgo report: %w", err)
+	}
+
+	var suiteReports []types.Report
+	if err := json.Unmarshal(b, &suiteReports); err != nil {
+		return fmt.Errorf("failed to parse the ginkgo report: %w", err)
+	}
+
+	report := generateFlakeReport(suiteReports)
+	report.NodePool = nodePool
+
+	b, err = json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the flake report: %w", err)
+	}
+
+	reportPath := filepath.Join(artifactsDir, flakeReportName)
+	if err := os.WriteFile(reportPath, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write the flake report: %w", err)
+	}
+	klog.Infof("Flake report written to %s: %d passed, %d flaked, %d failed", reportPath, report.Passed, report.Flaked, report.Failed)
+
+	if gcsPath == "" {
+		return nil
+	}
+
+	name := report.RunID
+	if nodePool != "" {
+		name += "-" + nodePool
+	}
+	dest := fmt.Sprintf("%v/%v/%v.json", strings.TrimSuffix(gcsPath, "/"), report.StartTime.UTC().Format("2006-01-02"), name)
+	//nolint:gosec
+	if output, err := exec.Command("gsutil", "cp", reportPath, dest).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to upload the flake report to %q: %w, output: %s", dest, err, output)
+	}
+	klog.Infof("Flake report uploaded to %s", dest)
+
+	return nil
+}
+
+// generateFlakeReport collects the attempts of the specs that ran. The skipped and pending specs, and the setup nodes, are ignored.
+func generateFlakeReport(suiteReports []types.Report) *flakeReport {
+	// BUILD_ID identifies the Prow job run.
+	runID, ok := os.LookupEnv("BUILD_ID")
+	if !ok {
+		runID = string(uuid.NewUUID())
+	}
+
+	report := &flakeReport{RunID: runID, Specs: []specFlakeResult{}}
+	for _, suiteReport := range suiteReports {
+		if report.StartTime.IsZero() || suiteReport.StartTime.Before(report.StartTime) {
+			report.StartTime = suiteReport.StartTime
+		}
+
+		for _, spec := range suiteReport.SpecReports {
+			if spec.LeafNodeType != types.NodeTypeIt || spec.State.Is(types.SpecStateSkipped|types.SpecStatePending) {
+				continue
+			}
+
+			result := specFlakeResult{
+				Name:           spec.FullText(),
+				State:          spec.State.String(),
+				Attempts:       spec.NumAttempts,
+				Flaked:         spec.State == types.SpecStatePassed && spec.NumAttempts > 1,
+				RunTimeSeconds: spec.RunTime.Seconds(),
+			}
+
+			switch {
+			case spec.Failed():
+				result.FailureMessage = spec.Failure.Message
+				report.Failed++
+			case result.Flaked:
+				report.Flaked++
+			default:
+				report.Passed++
+			}
+
+			report.Specs = append(report.Specs, result)
+		}
+	}
+
+	return report
+}
+
+// ReadQuarantinedSpecs reads the ginkgo skip regular expressions of the quarantined specs from the file, one per line.
+// The text after # is a comment, and the empty lines are ignored.
+func ReadQuarantinedSpecs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the quarantine file: %w", err)
+	}
+	defer f.Close()
+
+	specs := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		specs = append(specs, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the quarantine file: %w", err)
+	}
+
+	return specs, nil
+}
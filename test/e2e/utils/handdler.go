@@ -18,12 +18,15 @@ limitations under the License.
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/klog/v2"
@@ -46,18 +49,39 @@ type TestParameters struct {
 	NodeImageType       string
 	NodeMachineType     string
 	NumNodes            int
+	AddARMNodePool      bool
+	ARMNodeMachineType  string
+	NodePools           []NodePool
 	ProjectID           string
 	UseGKEAutopilot     bool
 	APIEndpointOverride string
 
-	InProw             bool
-	BoskosResourceType string
+	GkeClusterNetwork        string
+	GkeClusterSubnetwork     string
+	PrivateCluster           bool
+	PrivateClusterMasterCIDR string
+	UseRestrictedVIP         bool
+
+	ClusterType     string
+	KindClusterName string
+
+	InProw              bool
+	BoskosResourceType  string
+	AcquireCrossProject bool
+	CrossProjectID      string
+	RunJanitor          bool
+	JanitorTTL          time.Duration
 
 	ImageRegistry          string
 	BuildGcsFuseCsiDriver  bool
 	BuildGcsFuseFromSource bool
 	DeployOverlayName      string
 	UseGKEManagedDriver    bool
+	InstallIstio           bool
+	ExistingBuckets        string
+	BucketPoolSize         int
+	BucketKMSKeyName       string
+	UseStorageEmulator     bool
 
 	GinkgoSkip          string
 	GinkgoFocus         string
@@ -65,6 +89,19 @@ type TestParameters struct {
 	GinkgoTimeout       string
 	GinkgoFlakeAttempts string
 	GinkgoSkipGcpSaTest bool
+	QuarantinedSpecs    []string
+	FlakeReportGCSPath  string
+
+	GcsfuseIntegrationTestRef       string
+	GcsfuseIntegrationTestGoVersion string
+	GcsfuseIntegrationTestImage     string
+
+	PerformanceFioJobFiles    string
+	PerformanceFioParams      string
+	PerformanceResultsGCSPath string
+
+	ScalabilityPodsPerNode   int
+	ScalabilityVolumesPerPod int
 }
 
 func Handle(testParams *TestParameters) error {
@@ -98,6 +135,11 @@ func Handle(testParams *TestParameters) error {
 		testParams.ProjectID = newProject
 		testParams.ImageRegistry = fmt.Sprintf("gcr.io/%s/gcs-fuse-csi-driver", strings.TrimSpace(newProject))
 
+		// Acquire a second project for the buckets of the cross-project tests.
+		if testParams.AcquireCrossProject {
+			testParams.CrossProjectID = strings.TrimSpace(setupProwConfig(testParams.BoskosResourceType))
+		}
+
 		// 4. After the test, tear down the cluster, and switch back to the old project.
 		defer func() {
 			if err := setEnvProject(oldProject); err != nil {
@@ -105,6 +147,20 @@ func Handle(testParams *TestParameters) error {
 			}
 		}()
 
+		// Route the Google API traffic to the restricted VIP before the nodes come up, so that the cluster
+		// only reaches Cloud Storage through Private Google Access and the VPC Service Controls perimeter.
+		if testParams.UseRestrictedVIP {
+			if err := setupRestrictedVIPDNS(testParams); err != nil {
+				return fmt.Errorf("failed to set up the restricted VIP DNS: %w", err)
+			}
+
+			defer func() {
+				if err := teardownRestrictedVIPDNS(); err != nil {
+					klog.Errorf("failed to tear down the restricted VIP DNS: %v", err)
+				}
+			}()
+		}
+
 		// 3. Create a GKE cluster.
 		testParams.GkeClusterName = "gcsfuse" + string(uuid.NewUUID())[0:4]
 		if err := clusterUpGKE(testParams); err != nil {
@@ -119,9 +175,25 @@ func Handle(testParams *TestParameters) error {
 		}()
 	}
 
+	// Delete the resources leaked by the interrupted test runs before the test creates new ones in the projects.
+	if testParams.RunJanitor {
+		cleanupLeakedResources(testParams)
+	}
+
+	if testParams.ClusterType == ClusterTypeKind {
+		if err := clusterUpKind(testParams); err != nil {
+			return fmt.Errorf("failed to cluster up: %w", err)
+		}
+	}
+
 	// Build and push the driver if the test does not use the pre-installed managed CSI driver. Defer the driver image deletion.
 	if !testParams.UseGKEManagedDriver {
-		if testParams.BuildGcsFuseCsiDriver {
+		if testParams.ClusterType == ClusterTypeKind {
+			klog.Infof("Building GCS FUSE CSI Driver and loading the images to kind")
+			if err := buildAndLoadImageKind(testParams.PkgDir, testParams.ImageRegistry, testParams.KindClusterName, testParams.BuildGcsFuseFromSource); err != nil {
+				return fmt.Errorf("failed loading GCS FUSE CSI Driver images to kind: %w", err)
+			}
+		} else if testParams.BuildGcsFuseCsiDriver {
 			klog.Infof("Building GCS FUSE CSI Driver")
 			if err := buildAndPushImage(testParams.PkgDir, testParams.ImageRegistry, testParams.BuildGcsFuseFromSource); err != nil {
 				return fmt.Errorf("failed pushing GCS FUSE CSI Driver images: %w", err)
@@ -146,17 +218,75 @@ func Handle(testParams *TestParameters) error {
 		}
 	}
 
+	// Build and push the gcsfuse integration test image, so that the test Pods do not download Go and clone gcsfuse at runtime.
+	if testParams.BuildGcsFuseCsiDriver && testParams.GcsfuseIntegrationTestImage == "" && !testParams.UseGKEAutopilot && testParams.ClusterType != ClusterTypeKind {
+		klog.Infof("Building gcsfuse integration test image")
+		image, err := buildAndPushGcsfuseIntegrationTestImage(testParams.PkgDir, testParams.ImageRegistry, testParams.GcsfuseIntegrationTestRef, testParams.GcsfuseIntegrationTestGoVersion)
+		if err != nil {
+			return fmt.Errorf("failed pushing gcsfuse integration test image: %w", err)
+		}
+		testParams.GcsfuseIntegrationTestImage = image
+	}
+
+	emulatorEndpoint := ""
+	if testParams.UseStorageEmulator {
+		cmd, err := forwardStorageEmulatorPort()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := cmd.Process.Kill(); err != nil {
+				klog.Errorf("failed to stop forwarding the GCS emulator port: %v", err)
+			}
+		}()
+		emulatorEndpoint = storageEmulatorEndpoint
+	}
+
+	if testParams.InstallIstio {
+		if err := installIstio(); err != nil {
+			return fmt.Errorf("failed to install Istio: %w", err)
+		}
+	}
+
 	// Now that cluster is running and the CSI driver is installed, run the ginkgo tests on the cluster.
 	artifactsDir, ok := os.LookupEnv("ARTIFACTS")
 	if !ok {
 		artifactsDir = testParams.PkgDir + "/_artifacts"
 	}
 
-	testFocusStr := testParams.GinkgoFocus
+	// Without the node pool matrix, the tests run once on any node.
+	if len(testParams.NodePools) == 0 {
+		return runGinkgo(testParams, artifactsDir, emulatorEndpoint, "", testParams.GinkgoFocus)
+	}
+
+	// With the node pool matrix, the tests run once per node pool, including the default node pool,
+	// and the test Pods are pinned to the node pool. Keep running the other node pools if one fails.
+	errs := []error{runGinkgo(testParams, artifactsDir, emulatorEndpoint, defaultNodePoolName, testParams.GinkgoFocus)}
+	for _, pool := range testParams.NodePools {
+		focus := pool.Focus
+		if focus == "" {
+			focus = testParams.GinkgoFocus
+		}
+		errs = append(errs, runGinkgo(testParams, artifactsDir, emulatorEndpoint, pool.Name, focus))
+	}
+
+	return errors.Join(errs...)
+}
+
+// runGinkgo runs the ginkgo tests on the cluster. If nodePool is not empty, the test Pods run on the node pool,
+// and the reports are written to a subdirectory of the artifacts directory named after the node pool.
+func runGinkgo(testParams *TestParameters, artifactsDir, emulatorEndpoint, nodePool, focus string) error {
+	testFocusStr := focus
 	if len(testFocusStr) != 0 {
 		testFocusStr = fmt.Sprintf(".*%s.*", testFocusStr)
 	}
 
+	nodeArch := getTestNodeArchitecture(testParams)
+	if nodePool != "" {
+		artifactsDir = filepath.Join(artifactsDir, nodePool)
+		nodeArch = ""
+	}
+
 	//nolint:gosec
 	cmd := exec.Command("ginkgo", "run", "-v",
 		"--procs", testParams.GinkgoProcs,
@@ -165,22 +295,64 @@ func Handle(testParams *TestParameters) error {
 		"--focus", testFocusStr,
 		"--skip", generateTestSkip(testParams),
 		"--junit-report", "junit-gcsfusecsi.xml",
+		"--json-report", ginkgoJSONReportName,
 		"--output-dir", artifactsDir,
 		testParams.PkgDir+"/test/e2e/",
 		"--",
 		"--provider", "skeleton",
+		"--report-dir", artifactsDir,
 		"--test-bucket-location", testParams.GkeClusterRegion,
 		"--skip-gcp-sa-test", strconv.FormatBool(testParams.GinkgoSkipGcpSaTest),
 		"--api-env", envAPIMap[testParams.APIEndpointOverride],
+		"--use-gke-autopilot", strconv.FormatBool(testParams.UseGKEAutopilot),
+		"--node-arch", nodeArch,
+		"--node-pool", nodePool,
+		"--existing-buckets", testParams.ExistingBuckets,
+		"--bucket-pool-size", strconv.Itoa(testParams.BucketPoolSize),
+		"--cross-project-id", testParams.CrossProjectID,
+		"--bucket-kms-key-name", testParams.BucketKMSKeyName,
+		"--storage-emulator-endpoint", emulatorEndpoint,
+		"--gcsfuse-integration-test-ref", testParams.GcsfuseIntegrationTestRef,
+		"--gcsfuse-integration-test-go-version", testParams.GcsfuseIntegrationTestGoVersion,
+		"--gcsfuse-integration-test-image", testParams.GcsfuseIntegrationTestImage,
+		"--performance-fio-job-files", testParams.PerformanceFioJobFiles,
+		"--performance-fio-params", testParams.PerformanceFioParams,
+		"--performance-results-gcs-path", testParams.PerformanceResultsGCSPath,
+		"--scalability-pods-per-node", strconv.Itoa(testParams.ScalabilityPodsPerNode),
+		"--scalability-volumes-per-pod", strconv.Itoa(testParams.ScalabilityVolumesPerPod),
 	)
 
-	if err := runCommand("Running Ginkgo e2e test...", cmd); err != nil {
+	action := "Running Ginkgo e2e test..."
+	if nodePool != "" {
+		action = fmt.Sprintf("Running Ginkgo e2e test on node pool %s...", nodePool)
+	}
+	err := runCommand(action, cmd)
+
+	// The flake report is generated whether the tests passed or not, and does not fail the test run.
+	if reportErr := writeFlakeReport(artifactsDir, nodePool, testParams.FlakeReportGCSPath); reportErr != nil {
+		klog.Errorf("failed to write the flake report: %v", reportErr)
+	}
+
+	if err != nil {
+		if nodePool != "" {
+			return fmt.Errorf("failed to run e2e tests with ginkgo on node pool %q: %w", nodePool, err)
+		}
+
 		return fmt.Errorf("failed to run e2e tests with ginkgo: %w", err)
 	}
 
 	return nil
 }
 
+// getTestNodeArchitecture returns the CPU architecture of the nodes the test Pods run on. Empty means any architecture.
+func getTestNodeArchitecture(testParams *TestParameters) string {
+	if testParams.AddARMNodePool {
+		return "arm64"
+	}
+
+	return ""
+}
+
 func generateTestSkip(testParams *TestParameters) string {
 	skipTests := []string{}
 
@@ -188,12 +360,31 @@ func generateTestSkip(testParams *TestParameters) string {
 		skipTests = append(skipTests, testParams.GinkgoSkip)
 	}
 
-	if testParams.DeployOverlayName == "stable" {
-		skipTests = append(skipTests, "Dynamic.PV")
+	// The quarantined specs are flaky, and are skipped until they are fixed. See the flake report for the flaky specs.
+	skipTests = append(skipTests, testParams.QuarantinedSpecs...)
+
+	// The scalability tests saturate a node, so they only run when focused.
+	if !strings.Contains(testParams.GinkgoFocus, "scalability") {
+		skipTests = append(skipTests, "scalability")
+	}
+
+	// The existing buckets are not created by the test, and the Kubernetes service accounts are granted access to them in advance.
+	if testParams.ExistingBuckets != "" {
+		skipTests = append(skipTests, "Dynamic.PV", "multiple.GCS.buckets", "does.not.have.access", "crossProject", "bucket-features")
+	}
+
+	// The GCS emulator does not support IAM, and the implicit directories and the data integrity checks use gsutil.
+	if testParams.UseStorageEmulator {
+		skipTests = append(skipTests, "Dynamic.PV", "multiple.GCS.buckets", "does.not.have.access", "Workload.Identity", "implicit.directory", "different.directories", "dataIntegrity", "hostNetwork", "crossProject", "bucket-features")
+	}
+
+	// The Istio tests skip themselves if Istio is not installed, but skip them explicitly to avoid the per-test setup cost.
+	if !testParams.InstallIstio && !strings.Contains(testParams.GinkgoFocus, "istio") {
+		skipTests = append(skipTests, "istio")
 	}
 
 	if testParams.UseGKEAutopilot {
-		skipTests = append(skipTests, "OOM", "high.resource.usage", "gcsfuseIntegration")
+		skipTests = append(skipTests, "OOM", "high.resource.usage", "gcsfuseIntegration", "Disruptive", "hostNetwork")
 	}
 
 	skipString := strings.Join(skipTests, "|")
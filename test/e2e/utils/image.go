@@ -33,6 +33,29 @@ func buildAndPushImage(pkgDir, registry string, buildGcsFuseFromSource bool) err
 	return nil
 }
 
+// buildAndLoadImageKind builds the images for the host architecture without pushing them,
+// and loads them into the kind cluster nodes.
+func buildAndLoadImageKind(pkgDir, registry, kindClusterName string, buildGcsFuseFromSource bool) error {
+	//nolint:gosec
+	cmd := exec.Command("make", "-C", pkgDir, "build-image-and-load-kind", fmt.Sprintf("REGISTRY=%s", registry), "KIND_CLUSTER_NAME="+kindClusterName, "BUILD_GCSFUSE_FROM_SOURCE="+strconv.FormatBool(buildGcsFuseFromSource))
+	if err := runCommand("Loading images to kind cluster "+kindClusterName, cmd); err != nil {
+		return fmt.Errorf("failed to build and load images to kind: %w", err)
+	}
+
+	return nil
+}
+
+// buildAndPushGcsfuseIntegrationTestImage builds and pushes the gcsfuse integration test image, and returns the image name.
+func buildAndPushGcsfuseIntegrationTestImage(pkgDir, registry, gcsfuseRef, goVersion string) (string, error) {
+	//nolint:gosec
+	cmd := exec.Command("make", "-C", pkgDir, "build-gcsfuse-integration-test-image", fmt.Sprintf("REGISTRY=%s", registry), "GCSFUSE_INTEGRATION_TEST_REF="+gcsfuseRef, "GCSFUSE_INTEGRATION_TEST_GO_VERSION="+goVersion)
+	if err := runCommand("Pushing gcsfuse integration test image to REGISTRY "+registry, cmd); err != nil {
+		return "", fmt.Errorf("failed to run push gcsfuse integration test image: %w", err)
+	}
+
+	return fmt.Sprintf("%s/gcs-fuse-csi-driver-gcsfuse-integration-test:%s", registry, gcsfuseRef), nil
+}
+
 // TODO(songjiaxun): Implement this function. This is used when useManagedDriver is true, and inProw is true.
 func deleteImage() error {
 	return nil
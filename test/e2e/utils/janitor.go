@@ -0,0 +1,235 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcs-fuse-csi-driver/test/e2e/specs"
+	"k8s.io/klog/v2"
+)
+
+// deletedServiceAccountMemberPrefix precedes the IAM members of deleted service accounts, which no longer grant any access.
+const deletedServiceAccountMemberPrefix = "deleted:serviceAccount:"
+
+// Janitor deletes the GCS buckets, GCP service accounts, and IAM policy bindings created by the e2e tests
+// that are older than the TTL, which are leaked when a test run is interrupted before the test cleanup.
+// If no project is given, the gcloud project is cleaned up. It continues on errors so that as many resources as possible are deleted.
+func Janitor(projectIDs []string, ttl time.Duration) error {
+	if len(projectIDs) == 0 {
+		projectID, err := getGcloudProject()
+		if err != nil {
+			return err
+		}
+		projectIDs = []string{projectID}
+	}
+
+	createdBefore := time.Now().Add(-ttl)
+	klog.Infof("Deleting the e2e test resources created before %v in projects %v", createdBefore.Format(time.RFC3339), projectIDs)
+
+	// Delete the buckets and service accounts first, so that the bindings of the deleted service accounts
+	// in all the projects, including the cross-project bindings, are removed in the same pass.
+	var errs []error
+	deletedMembers := map[string]bool{}
+	for _, projectID := range projectIDs {
+		errs = append(errs, deleteLeakedBuckets(projectID, createdBefore))
+
+		emails, err := deleteLeakedServiceAccounts(projectID, createdBefore)
+		errs = append(errs, err)
+		for _, email := range emails {
+			deletedMembers["serviceAccount:"+email] = true
+		}
+	}
+
+	for _, projectID := range projectIDs {
+		errs = append(errs, removeLeakedIAMPolicyBindings(projectID, deletedMembers))
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanupLeakedResources runs the janitor on the projects the test creates resources in.
+// The janitor failures are logged, and do not fail the test run.
+func cleanupLeakedResources(testParams *TestParameters) {
+	projectIDs := []string{}
+	if isVariableSet(testParams.ProjectID) {
+		projectIDs = append(projectIDs, strings.TrimSpace(testParams.ProjectID))
+	}
+	if isVariableSet(testParams.CrossProjectID) {
+		if len(projectIDs) == 0 {
+			projectID, err := getGcloudProject()
+			if err != nil {
+				klog.Errorf("failed to run the janitor: %v", err)
+
+				return
+			}
+			projectIDs = append(projectIDs, projectID)
+		}
+		projectIDs = append(projectIDs, testParams.CrossProjectID)
+	}
+
+	if err := Janitor(projectIDs, testParams.JanitorTTL); err != nil {
+		klog.Errorf("failed to delete some leaked e2e test resources: %v", err)
+	}
+}
+
+// deleteLeakedBuckets deletes the buckets named with the test bucket name prefix created before the time, including the objects.
+func deleteLeakedBuckets(projectID string, createdBefore time.Time) error {
+	//nolint:gosec
+	output, err := exec.Command("gcloud", "storage", "buckets", "list",
+		"--project", projectID,
+		"--filter", fmt.Sprintf("name ~ ^%s", specs.TestBucketNamePrefix),
+		"--format", "json(name,creation_time)",
+	).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the buckets in project %q: %w", projectID, err)
+	}
+
+	var buckets []struct {
+		Name         string `json:"name"`
+		CreationTime string `json:"creation_time"`
+	}
+	if err := json.Unmarshal(output, &buckets); err != nil {
+		return fmt.Errorf("failed to parse the buckets in project %q: %w", projectID, err)
+	}
+
+	var errs []error
+	for _, b := range buckets {
+		created, err := parseCreationTime(b.CreationTime)
+		if err != nil {
+			klog.Warningf("skip bucket %q with unknown creation time: %v", b.Name, err)
+
+			continue
+		}
+		if !created.Before(createdBefore) {
+			continue
+		}
+
+		cmd := exec.Command("gcloud", "storage", "rm", "--recursive", "gs://"+b.Name)
+		if err := runCommand(fmt.Sprintf("Deleting leaked bucket %s created at %v", b.Name, created), cmd); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete bucket %q: %w", b.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deleteLeakedServiceAccounts deletes the test service accounts created before the time, and returns the emails of the deleted service accounts.
+func deleteLeakedServiceAccounts(projectID string, createdBefore time.Time) ([]string, error) {
+	//nolint:gosec
+	output, err := exec.Command("gcloud", "iam", "service-accounts", "list",
+		"--project", projectID,
+		"--filter", fmt.Sprintf("displayName=%q", specs.GCPServiceAccountDisplayName),
+		"--format", "json(email,description)",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the service accounts in project %q: %w", projectID, err)
+	}
+
+	var serviceAccounts []struct {
+		Email       string `json:"email"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(output, &serviceAccounts); err != nil {
+		return nil, fmt.Errorf("failed to parse the service accounts in project %q: %w", projectID, err)
+	}
+
+	var errs []error
+	deleted := []string{}
+	for _, sa := range serviceAccounts {
+		// The service accounts created before the creation time was recorded are skipped, and need to be deleted manually.
+		createdAt, ok := strings.CutPrefix(sa.Description, specs.GCPServiceAccountCreatedAtPrefix)
+		if !ok {
+			klog.Warningf("skip service account %q with unknown creation time", sa.Email)
+
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			klog.Warningf("skip service account %q with unknown creation time: %v", sa.Email, err)
+
+			continue
+		}
+		if !created.Before(createdBefore) {
+			continue
+		}
+
+		//nolint:gosec
+		cmd := exec.Command("gcloud", "iam", "service-accounts", "delete", sa.Email, "--project", projectID, "--quiet")
+		if err := runCommand(fmt.Sprintf("Deleting leaked service account %s created at %v", sa.Email, created), cmd); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete service account %q: %w", sa.Email, err))
+
+			continue
+		}
+		deleted = append(deleted, sa.Email)
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// removeLeakedIAMPolicyBindings removes the members of deleted service accounts, and the given members, from the project IAM policy.
+// The bindings of the Kubernetes service accounts in the test namespaces are not removed, because their age is unknown.
+func removeLeakedIAMPolicyBindings(projectID string, deletedMembers map[string]bool) error {
+	output, err := exec.Command("gcloud", "projects", "get-iam-policy", projectID, "--format", "json(bindings)").Output()
+	if err != nil {
+		return fmt.Errorf("failed to get the IAM policy of project %q: %w", projectID, err)
+	}
+
+	var policy struct {
+		Bindings []struct {
+			Role    string   `json:"role"`
+			Members []string `json:"members"`
+		} `json:"bindings"`
+	}
+	if err := json.Unmarshal(output, &policy); err != nil {
+		return fmt.Errorf("failed to parse the IAM policy of project %q: %w", projectID, err)
+	}
+
+	var errs []error
+	for _, b := range policy.Bindings {
+		for _, m := range b.Members {
+			if !strings.HasPrefix(m, deletedServiceAccountMemberPrefix) && !deletedMembers[m] {
+				continue
+			}
+
+			// --all removes the member from the conditional bindings of the role as well.
+			//nolint:gosec
+			cmd := exec.Command("gcloud", "projects", "remove-iam-policy-binding", projectID, "--member", m, "--role", b.Role, "--all", "--quiet")
+			if err := runCommand(fmt.Sprintf("Removing leaked member %s with role %s from project %s", m, b.Role, projectID), cmd); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove member %q with role %q from project %q: %w", m, b.Role, projectID, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseCreationTime parses the creation time of a bucket listed by gcloud, which may or may not have a colon in the time zone offset.
+func parseCreationTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02T15:04:05-0700", s)
+}
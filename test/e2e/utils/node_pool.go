@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+Copyright 2022 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// defaultNodePoolName is the name of the node pool GKE creates with the cluster.
+const defaultNodePoolName = "default-pool"
+
+// NodePool is an additional node pool of the test cluster, and the tests that run on it.
+type NodePool struct {
+	Name        string
+	ImageType   string
+	MachineType string
+	NumNodes    int
+	Spot        bool
+	// Focus is the ginkgo focus of the tests that run on the node pool. Empty means the global focus.
+	Focus string
+}
+
+// IsARM returns true if the node pool machine type uses ARM CPUs.
+func (p *NodePool) IsARM() bool {
+	return strings.HasPrefix(p.MachineType, "t2a-") || strings.HasPrefix(p.MachineType, "c4a-")
+}
+
+// ParseNodePools parses the node pool matrix in the format "name:key=value,key=value;name:key=value".
+// The keys are image-type, machine-type, num-nodes, spot, and focus. The image type and machine type
+// default to the cluster settings, and the number of nodes defaults to 1. The focus cannot contain commas or semicolons.
+func ParseNodePools(s, defaultImageType, defaultMachineType string) ([]NodePool, error) {
+	pools := []NodePool{}
+	names := map[string]bool{defaultNodePoolName: true}
+	for _, poolStr := range strings.Split(s, ";") {
+		poolStr = strings.TrimSpace(poolStr)
+		if poolStr == "" {
+			continue
+		}
+
+		name, params, _ := strings.Cut(poolStr, ":")
+		if name == "" {
+			return nil, fmt.Errorf("node pool %q has no name", poolStr)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("node pool name %q is duplicated or reserved", name)
+		}
+		names[name] = true
+
+		pool := NodePool{
+			Name:        name,
+			ImageType:   defaultImageType,
+			MachineType: defaultMachineType,
+			NumNodes:    1,
+		}
+		for _, kv := range strings.Split(params, ",") {
+			if kv == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, fmt.Errorf("node pool %q has invalid parameter %q, must be key=value", name, kv)
+			}
+
+			var err error
+			switch k {
+			case "image-type":
+				pool.ImageType = v
+			case "machine-type":
+				pool.MachineType = v
+			case "num-nodes":
+				pool.NumNodes, err = strconv.Atoi(v)
+			case "spot":
+				pool.Spot, err = strconv.ParseBool(v)
+			case "focus":
+				pool.Focus = v
+			default:
+				return nil, fmt.Errorf("node pool %q has unknown parameter %q", name, k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("node pool %q has invalid value for %q: %w", name, k, err)
+			}
+		}
+
+		pools = append(pools, pool)
+	}
+
+	return pools, nil
+}
+
+// createNodePool adds the node pool to the cluster.
+func createNodePool(testParams *TestParameters, pool *NodePool) error {
+	cmdParams := []string{
+		"container", "node-pools", "create", pool.Name,
+		"--cluster", testParams.GkeClusterName,
+		"--region", testParams.GkeClusterRegion, "--quiet",
+		"--num-nodes", strconv.Itoa(pool.NumNodes), "--image-type", pool.ImageType,
+		"--machine-type", pool.MachineType,
+		"--workload-metadata", "GKE_METADATA",
+	}
+	if pool.IsARM() {
+		nodeLocations, err := getARMNodeLocations(testParams.GkeClusterRegion)
+		if err != nil {
+			return fmt.Errorf("got invalid region for ARM node pool %q: %w", pool.Name, err)
+		}
+		cmdParams = append(cmdParams, "--node-locations", nodeLocations)
+	}
+	if pool.Spot {
+		cmdParams = append(cmdParams, "--spot")
+	}
+	if isVariableSet(testParams.GkeNodeVersion) {
+		cmdParams = append(cmdParams, "--node-version", testParams.GkeNodeVersion)
+	}
+
+	cmd := exec.Command("gcloud", cmdParams...)
+	if err := runCommand(fmt.Sprintf("Adding node pool %s to e2e Cluster on GKE", pool.Name), cmd); err != nil {
+		return fmt.Errorf("failed to add node pool %q to kubernetes e2e cluster on GKE: %w", pool.Name, err)
+	}
+
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -81,3 +82,18 @@ func setEnvProject(project string) error {
 
 	return os.Setenv("PROJECT", project)
 }
+
+// getGcloudProject returns the project of the gcloud configuration.
+func getGcloudProject() (string, error) {
+	output, err := exec.Command("gcloud", "config", "get-value", "project").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get gcloud project, err: %w", err)
+	}
+
+	project := strings.TrimSpace(string(output))
+	if project == "" {
+		return "", fmt.Errorf("gcloud project is not set")
+	}
+
+	return project, nil
+}